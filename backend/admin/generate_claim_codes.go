@@ -14,8 +14,8 @@ import (
 
 func main() {
 	if len(os.Args) < 3 {
-		fmt.Println("Usage: go run admin/generate_claim_codes.go <device_type> <count> [expires_hours]")
-		fmt.Println("Example: go run admin/generate_claim_codes.go ESP32 5 24")
+		fmt.Println("Usage: go run admin/generate_claim_codes.go <device_type> <count> [expires_hours] [org_id]")
+		fmt.Println("Example: go run admin/generate_claim_codes.go ESP32 5 24 acme-farms")
 		os.Exit(1)
 	}
 
@@ -33,21 +33,31 @@ func main() {
 		}
 	}
 
+	// Claimed devices join the organization the codes are issued for
+	orgID := database.DefaultOrganizationID
+	if len(os.Args) > 4 {
+		orgID = os.Args[4]
+	}
+
 	// Initialize database
 	if err := database.InitDatabase(); err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
 
+	if _, err := database.GetOrganizationByID(orgID); err != nil {
+		log.Fatal("Unknown organization ", orgID, ": ", err)
+	}
+
 	// Create device service
-	deviceService := services.NewDeviceService()
+	deviceService := services.NewDeviceService(nil)
 
 	// Generate claim codes
-	claimCodes, err := deviceService.GenerateClaimCodes(models.DeviceType(deviceType), count, expiresHours)
+	claimCodes, err := deviceService.GenerateClaimCodes(orgID, models.DeviceType(deviceType), count, expiresHours)
 	if err != nil {
 		log.Fatal("Failed to generate claim codes:", err)
 	}
 
-	fmt.Printf("\n✅ Generated %d claim codes for device type '%s':\n\n", len(claimCodes), deviceType)
+	fmt.Printf("\n✅ Generated %d claim codes for device type '%s' in organization '%s':\n\n", len(claimCodes), deviceType, orgID)
 	
 	for i, code := range claimCodes {
 		expiry := "Never"
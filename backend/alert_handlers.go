@@ -0,0 +1,187 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"scain-backend/database"
+	"scain-backend/middleware"
+	"scain-backend/models"
+	"scain-backend/services"
+)
+
+const (
+	defaultAlertsPerPage = 100
+	maxAlertsPerPage     = 1000
+)
+
+// alertStatuses lists the alert statuses that can be filtered on
+var alertStatuses = map[string]bool{
+	database.AlertOpen:         true,
+	database.AlertAcknowledged: true,
+	database.AlertResolved:     true,
+}
+
+// listAlertsHandler handles alert listing
+func listAlertsHandler(c *gin.Context) {
+	filter := &database.AlertFilter{
+		OrgID:    requestOrg(c),
+		Status:   c.Query("status"),
+		Severity: c.Query("severity"),
+		Rule:     c.Query("rule"),
+		Subject:  c.Query("subject"),
+	}
+
+	if filter.Status != "" && !alertStatuses[filter.Status] {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid query parameter",
+			Message: "status must be open, acknowledged or resolved",
+			Code:    400,
+		})
+		return
+	}
+
+	var err error
+	if filter.Limit, err = parseIntParam(c, "limit", defaultAlertsPerPage, 1, maxAlertsPerPage); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid query parameter",
+			Message: err.Error(),
+			Code:    400,
+		})
+		return
+	}
+
+	alerts, err := alertService.ListAlerts(filter)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list alerts")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to list alerts",
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"alerts": alerts,
+		"count":  len(alerts),
+	})
+}
+
+// getAlertHandler handles alert retrieval
+func getAlertHandler(c *gin.Context) {
+	alertID := c.Param("id")
+
+	alert, err := alertService.GetAlert(requestOrg(c), alertID)
+	if err != nil {
+		logger.WithError(err).WithField("alertId", alertID).Error("Failed to retrieve alert")
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "Alert not found",
+			Message: err.Error(),
+			Code:    404,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"status": "found",
+		"alert":  alert,
+	})
+}
+
+// acknowledgeAlertHandler handles alert acknowledgement
+func acknowledgeAlertHandler(c *gin.Context) {
+	alertAction(c, alertService.Acknowledge)
+}
+
+// resolveAlertHandler handles manual alert resolution
+func resolveAlertHandler(c *gin.Context) {
+	alertAction(c, alertService.Resolve)
+}
+
+// alertAction binds the request of an alert lifecycle action and applies it
+func alertAction(c *gin.Context, action func(orgID, id, by string) (*database.Alert, error)) {
+	var request models.AlertActionRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationError := middleware.FormatValidationError(err)
+		c.JSON(http.StatusBadRequest, validationError)
+		return
+	}
+
+	if err := validate.Struct(&request); err != nil {
+		validationError := middleware.FormatValidationError(err)
+		c.JSON(http.StatusBadRequest, validationError)
+		return
+	}
+
+	alertID := c.Param("id")
+	alert, err := action(requestOrg(c), alertID, request.By)
+	if err != nil {
+		switch {
+		case strings.HasPrefix(err.Error(), "alert not found"):
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "Alert not found",
+				Message: err.Error(),
+				Code:    404,
+			})
+		case strings.Contains(err.Error(), "is already"):
+			c.JSON(http.StatusConflict, ErrorResponse{
+				Error:   "Invalid alert status",
+				Message: err.Error(),
+				Code:    409,
+			})
+		default:
+			logger.WithError(err).WithField("alertId", alertID).Error("Failed to update alert")
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Error:   "Internal server error",
+				Message: "Failed to update alert",
+				Code:    500,
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"status": alert.Status,
+		"alert":  alert,
+	})
+}
+
+// listAlertRulesHandler handles retrieval of the alert rules and notifiers in effect
+func listAlertRulesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"rules":     alertService.Rules(),
+		"notifiers": services.NotifierNames(),
+	})
+}
+
+// testNotifierHandler handles delivery of a test notification
+func testNotifierHandler(c *gin.Context) {
+	name := c.Param("name")
+
+	if err := alertService.TestNotifier(name); err != nil {
+		if strings.HasPrefix(err.Error(), "notifier not found") {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "Notifier not found",
+				Message: err.Error(),
+				Code:    404,
+			})
+			return
+		}
+		logger.WithError(err).WithField("notifier", name).Warn("Test notification failed")
+		c.JSON(http.StatusBadGateway, ErrorResponse{
+			Error:   "Notification failed",
+			Message: err.Error(),
+			Code:    502,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"status":   "delivered",
+		"notifier": name,
+	})
+}
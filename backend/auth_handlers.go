@@ -0,0 +1,213 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"scain-backend/database"
+	"scain-backend/middleware"
+	"scain-backend/models"
+	"scain-backend/services"
+)
+
+// authEnforced reports whether credentials and permissions are required.
+// Setting AUTH_DISABLED=true turns this off for local development.
+func authEnforced() bool {
+	if os.Getenv("AUTH_DISABLED") == "true" {
+		logger.Warn("AUTH_DISABLED is set, requests are accepted without credentials or permissions")
+		return false
+	}
+	return true
+}
+
+// corsOrigins returns the origins allowed by CORS_ORIGINS, or nil when every
+// origin is allowed. Without CORS_ORIGINS every origin is allowed in
+// development and none elsewhere.
+func corsOrigins() map[string]bool {
+	value := os.Getenv("CORS_ORIGINS")
+	if value == "" {
+		if os.Getenv("NODE_ENV") == "development" {
+			logger.Warn("CORS_ORIGINS is not set, every origin is allowed in development")
+			return nil
+		}
+		logger.Warn("CORS_ORIGINS is not set, cross-origin requests are denied")
+		return map[string]bool{}
+	}
+	origins := map[string]bool{}
+	for _, origin := range strings.Split(value, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins[origin] = true
+		}
+	}
+	return origins
+}
+
+// originAllowed reports whether a browser origin may call the API
+func originAllowed(origin string) bool {
+	return allowedOrigins == nil || origin == "" || allowedOrigins[origin]
+}
+
+// requestOrg returns the organization a request acts for: that of its
+// principal, or the default organization for anonymous requests, which are
+// only let through when enforcement is off
+func requestOrg(c *gin.Context) string {
+	if principal := middleware.GetPrincipal(c); principal != nil {
+		return principal.OrgID
+	}
+	return database.DefaultOrganizationID
+}
+
+// requireUser rejects requests that are not made by a dashboard user
+func requireUser(c *gin.Context) bool {
+	principal := middleware.GetPrincipal(c)
+	if principal == nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Error:   "Unauthorized",
+			Message: "A user bearer token is required",
+			Code:    401,
+		})
+		return false
+	}
+	if principal.Type != models.PrincipalUser {
+		c.JSON(http.StatusForbidden, ErrorResponse{
+			Error:   "Forbidden",
+			Message: "Only users may manage API keys",
+			Code:    403,
+		})
+		return false
+	}
+	return true
+}
+
+// getPrincipalHandler handles retrieval of the authenticated caller
+func getPrincipalHandler(c *gin.Context) {
+	principal := middleware.GetPrincipal(c)
+	if principal == nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Error:   "Unauthorized",
+			Message: "An API key or bearer token is required",
+			Code:    401,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"principal":   principal,
+		"permissions": accessPolicy.Permissions(principal),
+	})
+}
+
+// listRolesHandler handles listing the roles of the access policy
+func listRolesHandler(c *gin.Context) {
+	roles := accessPolicy.Roles()
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"roles":       roles,
+		"permissions": services.Permissions,
+		"count":       len(roles),
+	})
+}
+
+// createAPIKeyHandler handles issuing an integration API key
+func createAPIKeyHandler(c *gin.Context) {
+	if !requireUser(c) {
+		return
+	}
+
+	var request models.APIKeyRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationError := middleware.FormatValidationError(err)
+		c.JSON(http.StatusBadRequest, validationError)
+		return
+	}
+
+	if err := validate.Struct(&request); err != nil {
+		validationError := middleware.FormatValidationError(err)
+		c.JSON(http.StatusBadRequest, validationError)
+		return
+	}
+
+	record, key, err := authService.CreateIntegrationKey(requestOrg(c), &request)
+	if err != nil {
+		logger.WithError(err).Error("Failed to issue API key")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to issue API key",
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, map[string]interface{}{
+		"status": "created",
+		"apiKey": record,
+		"key":    key, // shown once
+	})
+}
+
+// listAPIKeysHandler handles API key listing
+func listAPIKeysHandler(c *gin.Context) {
+	if !requireUser(c) {
+		return
+	}
+
+	kind := c.Query("kind")
+	if kind != "" && kind != database.APIKeyDevice && kind != database.APIKeyIntegration {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid query parameter",
+			Message: "kind must be device or integration",
+			Code:    400,
+		})
+		return
+	}
+
+	keys, err := authService.ListAPIKeys(requestOrg(c), kind)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list API keys")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to list API keys",
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"apiKeys": keys,
+		"count":   len(keys),
+	})
+}
+
+// revokeAPIKeyHandler handles API key revocation
+func revokeAPIKeyHandler(c *gin.Context) {
+	if !requireUser(c) {
+		return
+	}
+
+	keyID := c.Param("id")
+	if err := authService.RevokeAPIKey(requestOrg(c), keyID); err != nil {
+		if strings.HasPrefix(err.Error(), "API key not found") {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "API key not found",
+				Message: err.Error(),
+				Code:    404,
+			})
+			return
+		}
+		logger.WithError(err).WithField("keyId", keyID).Error("Failed to revoke API key")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to revoke API key",
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"status": "revoked",
+		"keyId":  keyID,
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"scain-backend/middleware"
+	"scain-backend/models"
+)
+
+// captureHandler handles EPCIS document capture
+func captureHandler(c *gin.Context) {
+	var document models.EPCISDocument
+
+	if err := c.ShouldBindJSON(&document); err != nil {
+		validationError := middleware.FormatValidationError(err)
+		c.JSON(http.StatusBadRequest, validationError)
+		return
+	}
+
+	for i := range document.EPCISBody.EventList {
+		document.EPCISBody.EventList[i].NormalizeCBV()
+	}
+
+	// Validate the whole document, including every event in it
+	if err := validate.Struct(&document); err != nil {
+		validationError := middleware.FormatValidationError(err)
+		c.JSON(http.StatusBadRequest, validationError)
+		return
+	}
+
+	events := make([]*models.EpcisEvent, len(document.EPCISBody.EventList))
+	for i := range document.EPCISBody.EventList {
+		events[i] = &document.EPCISBody.EventList[i]
+	}
+
+	// Check FSMA 204 KDEs; strict mode rejects the whole document
+	fsmaWarnings, ok := checkFSMA204(c, events)
+	if !ok {
+		return
+	}
+
+	job, err := captureService.StartCapture(requestOrg(c), &document, fsmaWarnings)
+	if err != nil {
+		logger.WithError(err).Error("Failed to start EPCIS capture")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to start capture",
+			Code:    500,
+		})
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"captureId":  job.CaptureID,
+		"eventCount": job.EventCount,
+	}).Info("EPCIS capture started")
+
+	c.Header("Location", "/api/capture/"+job.CaptureID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// getCaptureJobHandler handles capture job status retrieval
+func getCaptureJobHandler(c *gin.Context) {
+	captureID := c.Param("id")
+
+	job, err := captureService.GetCaptureJob(requestOrg(c), captureID)
+	if err != nil {
+		logger.WithError(err).WithField("captureId", captureID).Error("Failed to retrieve capture job")
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "Capture job not found",
+			Message: err.Error(),
+			Code:    404,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"scain-backend/database"
+	"scain-backend/middleware"
+	"scain-backend/models"
+)
+
+// createColdChainProfileHandler handles cold-chain profile creation
+func createColdChainProfileHandler(c *gin.Context) {
+	var request models.ColdChainProfileRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationError := middleware.FormatValidationError(err)
+		c.JSON(http.StatusBadRequest, validationError)
+		return
+	}
+
+	if err := validate.Struct(&request); err != nil {
+		validationError := middleware.FormatValidationError(err)
+		c.JSON(http.StatusBadRequest, validationError)
+		return
+	}
+
+	profile, err := coldChainService.CreateProfile(requestOrg(c), &request)
+	if err != nil {
+		if strings.HasSuffix(err.Error(), "already exists") {
+			c.JSON(http.StatusConflict, ErrorResponse{
+				Error:   "Profile already exists",
+				Message: err.Error(),
+				Code:    409,
+			})
+			return
+		}
+		logger.WithError(err).Error("Failed to create cold-chain profile")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to create cold-chain profile",
+			Code:    500,
+		})
+		return
+	}
+
+	c.Header("Location", "/api/cold-chain/profiles/"+profile.ID)
+	c.JSON(http.StatusCreated, map[string]interface{}{
+		"status":  "created",
+		"profile": profile,
+	})
+}
+
+// listColdChainProfilesHandler handles cold-chain profile listing
+func listColdChainProfilesHandler(c *gin.Context) {
+	profiles, err := coldChainService.ListProfiles(requestOrg(c))
+	if err != nil {
+		logger.WithError(err).Error("Failed to list cold-chain profiles")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to list cold-chain profiles",
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"profiles": profiles,
+		"count":    len(profiles),
+	})
+}
+
+// getColdChainProfileHandler handles cold-chain profile retrieval
+func getColdChainProfileHandler(c *gin.Context) {
+	profileID := c.Param("id")
+
+	profile, err := coldChainService.GetProfile(requestOrg(c), profileID)
+	if err != nil {
+		logger.WithError(err).WithField("profileId", profileID).Error("Failed to retrieve cold-chain profile")
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "Profile not found",
+			Message: err.Error(),
+			Code:    404,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"status":  "found",
+		"profile": profile,
+	})
+}
+
+// deleteColdChainProfileHandler handles cold-chain profile deletion
+func deleteColdChainProfileHandler(c *gin.Context) {
+	profileID := c.Param("id")
+
+	if err := coldChainService.DeleteProfile(requestOrg(c), profileID); err != nil {
+		logger.WithError(err).WithField("profileId", profileID).Error("Failed to delete cold-chain profile")
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "Profile not found",
+			Message: err.Error(),
+			Code:    404,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"status":    "deleted",
+		"profileId": profileID,
+	})
+}
+
+// listLotExcursionsHandler handles retrieval of the excursions of a lot
+func listLotExcursionsHandler(c *gin.Context) {
+	lotCode := c.Param("lotCode")
+	status := c.Query("status")
+
+	if status != "" && status != database.ExcursionOpen && status != database.ExcursionClosed {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid query parameter",
+			Message: "status must be open or closed",
+			Code:    400,
+		})
+		return
+	}
+
+	excursions, err := coldChainService.LotExcursions(requestOrg(c), lotCode, status)
+	if err != nil {
+		logger.WithError(err).WithField("lotCode", lotCode).Error("Failed to list excursions")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to list excursions",
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, excursions)
+}
+
+// getLotColdChainHandler handles retrieval of the temperature history summary of a lot
+func getLotColdChainHandler(c *gin.Context) {
+	lotCode := c.Param("lotCode")
+
+	var threshold *float64
+	if thresholdParam := c.Query("threshold"); thresholdParam != "" {
+		parsed, err := strconv.ParseFloat(thresholdParam, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Invalid query parameter",
+				Message: "threshold must be a temperature in degrees Celsius",
+				Code:    400,
+			})
+			return
+		}
+		threshold = &parsed
+	}
+
+	summary, err := coldChainService.LotColdChain(requestOrg(c), lotCode, threshold)
+	if err != nil {
+		logger.WithError(err).WithField("lotCode", lotCode).Error("Failed to summarize cold chain")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to summarize cold chain",
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Alert statuses
+const (
+	AlertOpen         = "open"
+	AlertAcknowledged = "acknowledged"
+	AlertResolved     = "resolved"
+)
+
+// Alert records a rule whose condition held for a device or lot. An alert
+// stays unresolved while the condition holds; repeated occurrences are counted
+// on it rather than raising new alerts.
+type Alert struct {
+	ID             string     `gorm:"primaryKey" json:"id"`
+	OrgID          string     `gorm:"index;not null;default:'default'" json:"orgId"`
+	Rule           string     `gorm:"index" json:"rule"`
+	Severity       string     `gorm:"index" json:"severity"`
+	Status         string     `gorm:"index" json:"status"`
+	SubjectType    string     `json:"subjectType"` // device or lot
+	Subject        string     `gorm:"index" json:"subject"`
+	DedupKey       string     `gorm:"index" json:"-"` // rule and subject, unique among the unresolved alerts of an organization
+	Metric         string     `json:"metric"`
+	Value          float64    `json:"value"`
+	Operator       string     `json:"operator"`
+	Threshold      float64    `json:"threshold"`
+	Message        string     `json:"message"`
+	Occurrences    int        `json:"occurrences"`
+	FirstSeenAt    time.Time  `gorm:"index" json:"firstSeenAt"`
+	LastSeenAt     time.Time  `json:"lastSeenAt"`
+	Escalations    int        `json:"escalations"`
+	EscalatedAt    *time.Time `json:"escalatedAt"`
+	AcknowledgedAt *time.Time `json:"acknowledgedAt"`
+	AcknowledgedBy *string    `json:"acknowledgedBy"`
+	ResolvedAt     *time.Time `json:"resolvedAt"`
+	ResolvedBy     *string    `json:"resolvedBy"` // empty when the condition cleared
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+// AlertFilter selects alerts, of every organization when OrgID is empty
+type AlertFilter struct {
+	OrgID    string
+	Status   string
+	Severity string
+	Rule     string
+	Subject  string
+	Limit    int
+}
+
+// SaveAlert creates or updates an alert
+func SaveAlert(alert *Alert) error {
+	if alert.ID == "" {
+		alert.ID = uuid.New().String()
+	}
+	return DB.Save(alert).Error
+}
+
+// GetAlertByID retrieves an alert of an organization by ID
+func GetAlertByID(orgID, id string) (*Alert, error) {
+	var alert Alert
+	err := DB.Scopes(inOrg(orgID)).First(&alert, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// GetUnresolvedAlert retrieves the unresolved alert of an organization with a
+// dedup key, or nil when there is none
+func GetUnresolvedAlert(orgID, dedupKey string) (*Alert, error) {
+	var alerts []Alert
+	err := DB.Scopes(inOrg(orgID)).Where("dedup_key = ? AND status <> ?", dedupKey, AlertResolved).
+		Order("first_seen_at DESC").
+		Limit(1).
+		Find(&alerts).Error
+	if err != nil || len(alerts) == 0 {
+		return nil, err
+	}
+	return &alerts[0], nil
+}
+
+// ListAlerts retrieves alerts matching a filter, most recent first
+func ListAlerts(filter *AlertFilter) ([]Alert, error) {
+	db := DB.Order("first_seen_at DESC")
+	if filter.OrgID != "" {
+		db = db.Scopes(inOrg(filter.OrgID))
+	}
+	if filter.Status != "" {
+		db = db.Where("status = ?", filter.Status)
+	}
+	if filter.Severity != "" {
+		db = db.Where("severity = ?", filter.Severity)
+	}
+	if filter.Rule != "" {
+		db = db.Where("rule = ?", filter.Rule)
+	}
+	if filter.Subject != "" {
+		db = db.Where("subject = ?", filter.Subject)
+	}
+	if filter.Limit > 0 {
+		db = db.Limit(filter.Limit)
+	}
+
+	var alerts []Alert
+	err := db.Find(&alerts).Error
+	return alerts, err
+}
+
+// ListActiveDevices retrieves the devices of every organization that are active
+func ListActiveDevices() ([]Device, error) {
+	var devices []Device
+	err := DB.Where("is_active = ?", true).Order("device_id ASC").Find(&devices).Error
+	return devices, err
+}
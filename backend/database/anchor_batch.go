@@ -0,0 +1,248 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AnchorBatch is a Merkle tree over the hashes of a batch of events of an
+// organization. Only its root is anchored on the ledger, in a single
+// transaction, and each event of the batch keeps the path from its hash to the
+// root as an inclusion proof. Batches never mix organizations, so a proof only
+// reveals hashes of the caller's own events.
+type AnchorBatch struct {
+	ID            string     `gorm:"primaryKey" json:"id"`
+	OrgID         string     `gorm:"index;not null;default:'default'" json:"orgId"`
+	Root          string     `json:"root"` // hex Merkle root
+	Size          int        `json:"size"`
+	Status        string     `gorm:"index" json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `gorm:"index" json:"nextAttemptAt"`
+	LastError     *string    `json:"lastError"`
+	TxID          *string    `json:"txId"`
+	AnchoredAt    *time.Time `json:"anchoredAt"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+// ErrBatchLeafChanged is returned when an event of an anchor batch was batched,
+// replaced or removed after the batch was built from it
+var ErrBatchLeafChanged = errors.New("event changed while its anchor batch was sealed")
+
+// BatchLeaf places an event in an anchor batch
+type BatchLeaf struct {
+	EventID    string
+	Hash       string // event hash the Merkle path starts from
+	MerklePath string // JSON path from the event hash to the batch root
+}
+
+// unbatchedOutboxEntries selects the pending outbox entries not in a batch yet
+func unbatchedOutboxEntries(db *gorm.DB) *gorm.DB {
+	return db.Where("outbox_entries.status = ? AND outbox_entries.batch_id IS NULL", AnchorPending)
+}
+
+// UnbatchedCount is the number of events of an organization waiting to be
+// added to an anchor batch
+type UnbatchedCount struct {
+	OrgID string
+	Count int64
+}
+
+// CountUnbatchedOutboxEntries counts the events waiting to be added to an
+// anchor batch per organization, the organization queued longest first
+func CountUnbatchedOutboxEntries() ([]UnbatchedCount, error) {
+	var counts []UnbatchedCount
+	err := DB.Model(&OutboxEntry{}).
+		Select("org_id, COUNT(*) AS count").
+		Scopes(unbatchedOutboxEntries).
+		Group("org_id").
+		Order("MIN(created_at) ASC").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// ListUnbatchedEvents retrieves the events of an organization waiting to be
+// added to an anchor batch, in the order they were queued
+func ListUnbatchedEvents(orgID string, limit int) ([]Event, error) {
+	var events []Event
+	err := DB.Select("events.*").
+		Joins("JOIN outbox_entries ON outbox_entries.event_id = events.id").
+		Scopes(unbatchedOutboxEntries).
+		Where("outbox_entries.org_id = ? AND events.org_id = ?", orgID, orgID).
+		Order("outbox_entries.created_at ASC").
+		Order("events.id ASC").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
+
+// CreateAnchorBatch stores an anchor batch and records the batch and Merkle
+// path of each of its events. Each event must still be unbatched and have the
+// hash its leaf was computed from; otherwise nothing is stored and
+// ErrBatchLeafChanged is returned, so that the batch is built again.
+func CreateAnchorBatch(batch *AnchorBatch, leaves []BatchLeaf) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(batch).Error; err != nil {
+			return err
+		}
+
+		for _, leaf := range leaves {
+			result := tx.Model(&OutboxEntry{}).Scopes(inOrg(batch.OrgID)).
+				Where("event_id = ? AND batch_id IS NULL", leaf.EventID).
+				Update("batch_id", batch.ID)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != 1 {
+				return fmt.Errorf("%w: outbox entry of event %s", ErrBatchLeafChanged, leaf.EventID)
+			}
+
+			result = tx.Model(&Event{}).Scopes(inOrg(batch.OrgID)).
+				Where("id = ? AND batch_id IS NULL AND hash = ?", leaf.EventID, leaf.Hash).
+				Updates(map[string]interface{}{
+					"batch_id":    batch.ID,
+					"merkle_path": leaf.MerklePath,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != 1 {
+				return fmt.Errorf("%w: event %s", ErrBatchLeafChanged, leaf.EventID)
+			}
+		}
+		return nil
+	})
+}
+
+// GetAnchorBatchByID retrieves an anchor batch of an organization by ID
+func GetAnchorBatchByID(orgID, id string) (*AnchorBatch, error) {
+	var batch AnchorBatch
+	err := DB.Scopes(inOrg(orgID)).First(&batch, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// ClaimPendingAnchorBatch marks the oldest pending anchor batch that is due as
+// submitting and returns it, or returns nil when none is due
+func ClaimPendingAnchorBatch(now time.Time) (*AnchorBatch, error) {
+	for {
+		var batch AnchorBatch
+		err := DB.Where("status = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)", AnchorPending, now).
+			Order("created_at ASC").
+			Limit(1).
+			Find(&batch).Error
+		if err != nil || batch.ID == "" {
+			return nil, err
+		}
+
+		result := DB.Model(&AnchorBatch{}).
+			Where("id = ? AND status = ?", batch.ID, AnchorPending).
+			Updates(map[string]interface{}{
+				"status":     AnchorSubmitting,
+				"updated_at": now,
+			})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			batch.Status = AnchorSubmitting
+			return &batch, nil
+		}
+		// Claimed by another relay first; try the next one
+	}
+}
+
+// ResetInterruptedAnchorBatches returns anchor batches left submitting by a
+// previous process to the pending queue
+func ResetInterruptedAnchorBatches() error {
+	return DB.Model(&AnchorBatch{}).Where("status = ?", AnchorSubmitting).
+		Update("status", AnchorPending).Error
+}
+
+// UpdateAnchorBatch saves the state of an anchor batch. Once the batch is
+// anchored or has failed, its outbox entries and events follow it.
+func UpdateAnchorBatch(batch *AnchorBatch) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(batch).Error; err != nil {
+			return err
+		}
+
+		entryUpdates := map[string]interface{}{"status": batch.Status}
+		eventUpdates := map[string]interface{}{"anchor_status": batch.Status}
+		switch batch.Status {
+		case AnchorAnchored:
+			entryUpdates["anchored_at"] = batch.AnchoredAt
+			entryUpdates["last_error"] = nil
+			eventUpdates["blockchain_tx_id"] = batch.TxID
+		case AnchorFailed:
+			entryUpdates["last_error"] = batch.LastError
+		default:
+			return nil
+		}
+
+		err := tx.Model(&OutboxEntry{}).Where("batch_id = ?", batch.ID).Updates(entryUpdates).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&Event{}).Where("batch_id = ?", batch.ID).Updates(eventUpdates).Error
+	})
+}
+
+// RequeueAnchorBatch returns the failed anchor batch of an event of an
+// organization to the pending queue with a fresh set of attempts, together
+// with every event of the organization in it. An event that failed before it
+// was batched is queued for the next batch. It reports false when the
+// anchoring of the event has not failed.
+func RequeueAnchorBatch(orgID, eventID string) (bool, error) {
+	var queued bool
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var entry OutboxEntry
+		err := tx.Scopes(inOrg(orgID)).
+			Where("event_id = ? AND status = ?", eventID, AnchorFailed).
+			Limit(1).
+			Find(&entry).Error
+		if err != nil || entry.ID == "" {
+			return err
+		}
+
+		if entry.BatchID == nil {
+			err := tx.Model(&entry).Update("status", AnchorPending).Error
+			if err != nil {
+				return err
+			}
+			queued = true
+			return tx.Model(&Event{}).Scopes(inOrg(orgID)).Where("id = ?", eventID).Update("anchor_status", AnchorPending).Error
+		}
+
+		result := tx.Model(&AnchorBatch{}).Scopes(inOrg(orgID)).
+			Where("id = ? AND status = ?", *entry.BatchID, AnchorFailed).
+			Updates(map[string]interface{}{
+				"status":          AnchorPending,
+				"attempts":        0,
+				"next_attempt_at": nil,
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		err = tx.Model(&OutboxEntry{}).Scopes(inOrg(orgID)).Where("batch_id = ?", *entry.BatchID).
+			Update("status", AnchorPending).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&Event{}).Scopes(inOrg(orgID)).Where("batch_id = ?", *entry.BatchID).
+			Update("anchor_status", AnchorPending).Error
+		if err != nil {
+			return err
+		}
+
+		queued = true
+		return nil
+	})
+	return queued, err
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testBatch builds an anchor batch of an organization over events, with each
+// leaf computed from the given hash
+func testBatch(id, orgID, hash string, eventIDs ...string) (*AnchorBatch, []BatchLeaf) {
+	batch := &AnchorBatch{ID: id, OrgID: orgID, Root: hash, Size: len(eventIDs), Status: AnchorPending}
+	leaves := make([]BatchLeaf, len(eventIDs))
+	for i, eventID := range eventIDs {
+		leaves[i] = BatchLeaf{EventID: eventID, Hash: hash, MerklePath: "[]"}
+	}
+	return batch, leaves
+}
+
+// eventBatch returns the batch of an event and of its outbox entry
+func eventBatch(t *testing.T, eventID string) (string, string) {
+	t.Helper()
+	var event Event
+	if err := DB.First(&event, "id = ?", eventID).Error; err != nil {
+		t.Fatalf("failed to load event %s: %v", eventID, err)
+	}
+	var entry OutboxEntry
+	if err := DB.First(&entry, "event_id = ?", eventID).Error; err != nil {
+		t.Fatalf("failed to load outbox entry of %s: %v", eventID, err)
+	}
+	var eventBatch, entryBatch string
+	if event.BatchID != nil {
+		eventBatch = *event.BatchID
+	}
+	if entry.BatchID != nil {
+		entryBatch = *entry.BatchID
+	}
+	return eventBatch, entryBatch
+}
+
+func TestCreateAnchorBatch(t *testing.T) {
+	openTestDatabase(t)
+	createTestEvent(t, "a1", "org-a", "", "")
+	createTestEvent(t, "a2", "org-a", "", "")
+	hash := strings.Repeat("0", 64)
+
+	batch, leaves := testBatch("batch-1", "org-a", hash, "a1", "a2")
+	if err := CreateAnchorBatch(batch, leaves); err != nil {
+		t.Fatalf("CreateAnchorBatch: %v", err)
+	}
+	for _, id := range []string{"a1", "a2"} {
+		if eventBatch, entryBatch := eventBatch(t, id); eventBatch != "batch-1" || entryBatch != "batch-1" {
+			t.Errorf("%s is in batch %q, its outbox entry in %q, want batch-1", id, eventBatch, entryBatch)
+		}
+	}
+	if events, err := ListUnbatchedEvents("org-a", 10); err != nil || len(events) != 0 {
+		t.Errorf("ListUnbatchedEvents = %d events, %v, want none", len(events), err)
+	}
+}
+
+func TestCreateAnchorBatchRejectsChangedEvents(t *testing.T) {
+	hash := strings.Repeat("0", 64)
+	tests := []struct {
+		name   string
+		change func(t *testing.T)
+	}{
+		{
+			// A replay replaced the event with one of another hash
+			name: "hash changed",
+			change: func(t *testing.T) {
+				if err := DB.Model(&Event{}).Where("id = ?", "a2").Update("hash", strings.Repeat("1", 64)).Error; err != nil {
+					t.Fatalf("failed to change hash: %v", err)
+				}
+			},
+		},
+		{
+			// A replay removed the event
+			name: "event removed",
+			change: func(t *testing.T) {
+				if err := DeleteEventsTx(DB, []string{"a2"}); err != nil {
+					t.Fatalf("DeleteEventsTx: %v", err)
+				}
+			},
+		},
+		{
+			name: "already batched",
+			change: func(t *testing.T) {
+				batch, leaves := testBatch("batch-0", "org-a", hash, "a2")
+				if err := CreateAnchorBatch(batch, leaves); err != nil {
+					t.Fatalf("CreateAnchorBatch: %v", err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			createTestEvent(t, "a1", "org-a", "", "")
+			createTestEvent(t, "a2", "org-a", "", "")
+			tt.change(t)
+
+			batch, leaves := testBatch("batch-1", "org-a", hash, "a1", "a2")
+			if err := CreateAnchorBatch(batch, leaves); !errors.Is(err, ErrBatchLeafChanged) {
+				t.Fatalf("CreateAnchorBatch = %v, want ErrBatchLeafChanged", err)
+			}
+
+			// Nothing of the batch is stored
+			if _, err := GetAnchorBatchByID("org-a", "batch-1"); err == nil {
+				t.Error("the batch was stored")
+			}
+			if eventBatch, entryBatch := eventBatch(t, "a1"); eventBatch != "" || entryBatch != "" {
+				t.Errorf("a1 is in batch %q, its outbox entry in %q, want unbatched", eventBatch, entryBatch)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// API key kinds
+const (
+	APIKeyDevice      = "device"
+	APIKeyIntegration = "integration"
+)
+
+// APIKey authenticates a device or an integration. Only the SHA-256 hash of
+// the key is stored; the key itself is shown once, when it is issued.
+type APIKey struct {
+	ID         string     `gorm:"primaryKey" json:"id"`
+	OrgID      string     `gorm:"index;not null;default:'default'" json:"orgId"`
+	Kind       string     `gorm:"index" json:"kind"`
+	Name       string     `json:"name"`
+	DeviceID   *string    `gorm:"index" json:"deviceId"` // set for device keys
+	Prefix     string     `json:"prefix"`                // first characters of the key, to tell keys apart
+	KeyHash    string     `gorm:"uniqueIndex" json:"-"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+// CreateAPIKey stores a new API key
+func CreateAPIKey(key *APIKey) error {
+	return CreateAPIKeyTx(DB, key)
+}
+
+// CreateAPIKeyTx stores a new API key using the given transaction
+func CreateAPIKeyTx(tx *gorm.DB, key *APIKey) error {
+	if key.ID == "" {
+		key.ID = uuid.New().String()
+	}
+	return tx.Create(key).Error
+}
+
+// GetAPIKeyByHash retrieves the API key with a key hash, revoked or not
+func GetAPIKeyByHash(keyHash string) (*APIKey, error) {
+	var key APIKey
+	err := DB.First(&key, "key_hash = ?", keyHash).Error
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ListAPIKeys retrieves the API keys of an organization of a kind, or of every
+// kind, oldest first
+func ListAPIKeys(orgID, kind string) ([]APIKey, error) {
+	db := DB.Scopes(inOrg(orgID)).Order("created_at ASC")
+	if kind != "" {
+		db = db.Where("kind = ?", kind)
+	}
+
+	var keys []APIKey
+	err := db.Find(&keys).Error
+	return keys, err
+}
+
+// RevokeAPIKey revokes an API key of an organization. Revoking a revoked key
+// keeps its revocation time.
+func RevokeAPIKey(orgID, id string, now time.Time) error {
+	result := DB.Model(&APIKey{}).Scopes(inOrg(orgID)).Where("id = ?", id).
+		Update("revoked_at", gorm.Expr("COALESCE(revoked_at, ?)", now))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// TouchAPIKey records when an API key was last used
+func TouchAPIKey(id string, now time.Time) error {
+	return DB.Model(&APIKey{}).Where("id = ?", id).UpdateColumn("last_used_at", now).Error
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Capture job statuses
+const (
+	CaptureRunning   = "running"
+	CaptureSucceeded = "succeeded"
+	CaptureFailed    = "failed"
+)
+
+// CaptureJob tracks the processing of a captured EPCIS document
+type CaptureJob struct {
+	ID           string     `gorm:"primaryKey" json:"id"`
+	OrgID        string     `gorm:"index;not null;default:'default'" json:"orgId"`
+	Status       string     `gorm:"index" json:"status"` // running, succeeded, failed
+	EventCount   int        `json:"eventCount"`
+	EventIDs     string     `gorm:"type:text" json:"eventIds"` // JSON array of created event IDs
+	ErrorMessage *string    `json:"errorMessage"`
+	Warnings     string     `gorm:"type:text" json:"warnings"` // JSON array of FSMA 204 checks with missing KDEs
+	FinishedAt   *time.Time `json:"finishedAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+// MasterDataElement stores a master data vocabulary element received in an
+// EPCIS document header. Each organization keeps its own master data.
+type MasterDataElement struct {
+	OrgID      string    `gorm:"primaryKey;uniqueIndex:idx_master_data_elements_org_id;default:'default'" json:"orgId"`
+	ID         string    `gorm:"primaryKey;uniqueIndex:idx_master_data_elements_org_id" json:"id"`
+	Type       string    `gorm:"index" json:"type"`
+	Attributes string    `gorm:"type:text" json:"attributes"` // Store attributes as JSON
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// CreateCaptureJob creates a new capture job record
+func CreateCaptureJob(job *CaptureJob) error {
+	if job.ID == "" {
+		job.ID = uuid.New().String()
+	}
+	return DB.Create(job).Error
+}
+
+// GetCaptureJobByID retrieves a capture job of an organization by ID
+func GetCaptureJobByID(orgID, id string) (*CaptureJob, error) {
+	var job CaptureJob
+	err := DB.Scopes(inOrg(orgID)).First(&job, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// UpdateCaptureJob saves the state of a capture job
+func UpdateCaptureJob(job *CaptureJob) error {
+	return DB.Save(job).Error
+}
+
+// FailInterruptedCaptureJobs marks jobs left running by a previous process as failed
+func FailInterruptedCaptureJobs() error {
+	now := time.Now()
+	return DB.Model(&CaptureJob{}).Where("status = ?", CaptureRunning).Updates(map[string]interface{}{
+		"status":        CaptureFailed,
+		"error_message": "capture interrupted by server restart",
+		"finished_at":   now,
+	}).Error
+}
+
+// UpsertMasterDataTx creates or replaces master data elements using the given transaction
+func UpsertMasterDataTx(tx *gorm.DB, elements []MasterDataElement) error {
+	if len(elements) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "org_id"}, {Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"type", "attributes", "updated_at"}),
+	}).Create(&elements).Error
+}
+
+// GetMasterDataElements retrieves the master data elements of an organization
+// with the given IDs
+func GetMasterDataElements(orgID string, ids []string) ([]MasterDataElement, error) {
+	var elements []MasterDataElement
+	if len(ids) == 0 {
+		return elements, nil
+	}
+	err := DB.Scopes(inOrg(orgID)).Where("id IN ?", ids).Find(&elements).Error
+	return elements, err
+}
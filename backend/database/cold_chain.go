@@ -0,0 +1,180 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Excursion statuses
+const (
+	ExcursionOpen   = "open"
+	ExcursionClosed = "closed"
+)
+
+// Excursion limits, the side of the range a reading left
+const (
+	ExcursionAboveMax = "max"
+	ExcursionBelowMin = "min"
+)
+
+// ColdChainProfile stores the temperature and humidity range and the shelf-life
+// decay model of a lot or of a product, identified by an EPC or EPC class prefix
+type ColdChainProfile struct {
+	ID                      string    `gorm:"primaryKey" json:"id"`
+	OrgID                   string    `gorm:"not null;default:'default';uniqueIndex:idx_cold_chain_profiles_org_lot;uniqueIndex:idx_cold_chain_profiles_org_product" json:"orgId"`
+	Name                    string    `json:"name"`
+	LotCode                 *string   `gorm:"uniqueIndex:idx_cold_chain_profiles_org_lot" json:"lotCode"`
+	Product                 *string   `gorm:"uniqueIndex:idx_cold_chain_profiles_org_product" json:"product"`
+	MinTemperature          *float64  `json:"minTemperature"`          // CEL
+	MaxTemperature          *float64  `json:"maxTemperature"`          // CEL
+	MinHumidity             *float64  `json:"minHumidity"`             // P1, relative humidity
+	MaxHumidity             *float64  `json:"maxHumidity"`             // P1, relative humidity
+	AllowedExcursionMinutes int       `json:"allowedExcursionMinutes"` // cumulative time out of range the lot tolerates
+	DecayModel              *string   `json:"decayModel"`              // q10 or arrhenius, for shelf-life estimates
+	ShelfLifeHours          *float64  `json:"shelfLifeHours"`          // at the reference temperature
+	ReferenceTemperature    *float64  `json:"referenceTemperature"`    // CEL
+	Q10                     *float64  `json:"q10"`
+	ActivationEnergy        *float64  `json:"activationEnergy"` // kJ/mol
+	CreatedAt               time.Time `json:"createdAt"`
+	UpdatedAt               time.Time `json:"updatedAt"`
+}
+
+// Excursion records a period in which the readings of a device monitoring a
+// lot were outside the range of its cold-chain profile
+type Excursion struct {
+	ID              string     `gorm:"primaryKey" json:"id"`
+	OrgID           string     `gorm:"index;not null;default:'default'" json:"orgId"`
+	LotCode         string     `gorm:"index" json:"lotCode"`
+	ProfileID       string     `gorm:"index" json:"profileId"`
+	DeviceID        string     `gorm:"index" json:"deviceId"`
+	SensorType      string     `json:"sensorType"`
+	Component       string     `json:"component,omitempty"`
+	Limit           string     `json:"limit"`     // max or min
+	Threshold       float64    `json:"threshold"` // the limit that was crossed
+	Peak            float64    `json:"peak"`      // the reading furthest out of range
+	UOM             string     `json:"uom"`
+	Status          string     `gorm:"index" json:"status"`
+	StartedAt       time.Time  `gorm:"index" json:"startedAt"`
+	LastReadingAt   time.Time  `json:"lastReadingAt"` // last reading out of range
+	EndedAt         *time.Time `json:"endedAt"`       // first reading back in range
+	DurationSeconds int64      `json:"durationSeconds"`
+	StartEventID    string     `json:"startEventId"`
+	EndEventID      *string    `json:"endEventId"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+}
+
+// CreateColdChainProfile creates a new cold-chain profile
+func CreateColdChainProfile(profile *ColdChainProfile) error {
+	if profile.ID == "" {
+		profile.ID = uuid.New().String()
+	}
+	return DB.Create(profile).Error
+}
+
+// GetColdChainProfileByID retrieves a cold-chain profile of an organization by ID
+func GetColdChainProfileByID(orgID, id string) (*ColdChainProfile, error) {
+	var profile ColdChainProfile
+	err := DB.Scopes(inOrg(orgID)).First(&profile, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// GetColdChainProfileByLot retrieves the cold-chain profile an organization
+// set for a lot, or nil when the lot has none
+func GetColdChainProfileByLot(orgID, lotCode string) (*ColdChainProfile, error) {
+	var profiles []ColdChainProfile
+	err := DB.Scopes(inOrg(orgID)).Where("lot_code = ?", lotCode).Limit(1).Find(&profiles).Error
+	if err != nil || len(profiles) == 0 {
+		return nil, err
+	}
+	return &profiles[0], nil
+}
+
+// ListColdChainProfiles retrieves the cold-chain profiles of an organization,
+// optionally only the product profiles
+func ListColdChainProfiles(orgID string, productsOnly bool) ([]ColdChainProfile, error) {
+	var profiles []ColdChainProfile
+	db := DB.Scopes(inOrg(orgID)).Order("created_at ASC")
+	if productsOnly {
+		db = db.Where("product IS NOT NULL")
+	}
+	err := db.Find(&profiles).Error
+	return profiles, err
+}
+
+// DeleteColdChainProfile deletes a cold-chain profile of an organization. The
+// excursions recorded against it are kept.
+func DeleteColdChainProfile(orgID, id string) error {
+	result := DB.Scopes(inOrg(orgID)).Delete(&ColdChainProfile{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ListLotEPCs retrieves the distinct EPCs and EPC classes recorded in the events
+// of an organization for a lot
+func ListLotEPCs(orgID, lotCode string) ([]string, error) {
+	var epcs []string
+	err := DB.Model(&EventEPC{}).
+		Distinct("event_epcs.epc").
+		Joins("JOIN events ON events.id = event_epcs.event_id").
+		Where("events.org_id = ? AND events.lot_code = ?", orgID, lotCode).
+		Pluck("event_epcs.epc", &epcs).Error
+	return epcs, err
+}
+
+// GetOpenExcursion retrieves the open excursion of a device and sensor for a
+// lot of an organization, or nil when there is none
+func GetOpenExcursion(orgID, lotCode, deviceID, sensorType, component string) (*Excursion, error) {
+	var excursions []Excursion
+	err := DB.Scopes(inOrg(orgID)).Where("lot_code = ? AND device_id = ? AND sensor_type = ? AND component = ? AND status = ?",
+		lotCode, deviceID, sensorType, component, ExcursionOpen).
+		Limit(1).
+		Find(&excursions).Error
+	if err != nil || len(excursions) == 0 {
+		return nil, err
+	}
+	return &excursions[0], nil
+}
+
+// ExcursionCovers reports whether a closed excursion of a device and sensor for
+// a lot of an organization already covers a point in time, as when readings
+// are replayed
+func ExcursionCovers(orgID, lotCode, deviceID, sensorType, component string, at time.Time) (bool, error) {
+	var count int64
+	err := DB.Model(&Excursion{}).Scopes(inOrg(orgID)).
+		Where("lot_code = ? AND device_id = ? AND sensor_type = ? AND component = ? AND status = ?",
+			lotCode, deviceID, sensorType, component, ExcursionClosed).
+		Where("started_at <= ? AND ended_at > ?", at, at).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// SaveExcursion creates or updates an excursion
+func SaveExcursion(excursion *Excursion) error {
+	if excursion.ID == "" {
+		excursion.ID = uuid.New().String()
+	}
+	return DB.Save(excursion).Error
+}
+
+// ListExcursions retrieves the excursions of a lot of an organization in start
+// order, optionally only those with a status
+func ListExcursions(orgID, lotCode, status string) ([]Excursion, error) {
+	var excursions []Excursion
+	db := DB.Scopes(inOrg(orgID)).Where("lot_code = ?", lotCode).Order("started_at ASC")
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+	err := db.Find(&excursions).Error
+	return excursions, err
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/google/uuid"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
@@ -15,27 +16,47 @@ var DB *gorm.DB
 
 // Event represents EPCIS events in the database
 type Event struct {
-	ID                  string    `gorm:"primaryKey" json:"id"`
-	EventType           string    `json:"eventType"`
-	EventTime           time.Time `json:"eventTime"`
+	ID                  string    `gorm:"primaryKey;index:idx_events_event_time_id,priority:2" json:"id"`
+	OrgID               string    `gorm:"index;not null;default:'default'" json:"orgId"`
+	EventType           string    `gorm:"index" json:"eventType"`
+	EventTime           time.Time `gorm:"index:idx_events_event_time_id,priority:1" json:"eventTime"`
 	EventTimeZoneOffset string    `json:"eventTimeZoneOffset"`
-	BizStep             *string   `json:"bizStep"`
-	Disposition         *string   `json:"disposition"`
-	ReadPointID         *string   `json:"readPointId"`
-	BizLocationID       *string   `json:"bizLocationId"`
-	LotCode             *string   `json:"lotCode"`
-	DeviceID            *string   `json:"deviceId"`
+	Action              *string   `gorm:"index" json:"action"`
+	BizStep             *string   `gorm:"index" json:"bizStep"`
+	Disposition         *string   `gorm:"index" json:"disposition"`
+	ReadPointID         *string   `gorm:"index" json:"readPointId"`
+	BizLocationID       *string   `gorm:"index" json:"bizLocationId"`
+	LotCode             *string   `gorm:"index" json:"lotCode"`
+	DeviceID            *string   `gorm:"index" json:"deviceId"`
 	DeviceTimestamp     *time.Time `json:"deviceTimestamp"`
+	ParentID            *string   `gorm:"index" json:"parentId"`
+	TransformationID    *string   `gorm:"index" json:"transformationId"`
+	CTE                 *string   `gorm:"column:cte;index" json:"cte"`              // FSMA 204 Critical Tracking Event
+	LotCodeSource       *string   `json:"lotCodeSource"`                          // FSMA 204 traceability lot code source
+	IngestionID         *string   `gorm:"index" json:"ingestionId"`               // raw data ingestion the event was derived from
 	Hash                string    `json:"hash"`
 	RawData             string    `gorm:"type:text" json:"rawData"` // Store full EPCIS event as JSON
 	BlockchainTxID      *string   `json:"blockchainTxId"`
+	AnchorStatus        string    `gorm:"index;default:'pending'" json:"anchorStatus"` // pending, anchored or failed
+	BatchID             *string   `gorm:"index" json:"batchId"`                     // anchor batch the event hash is a leaf of
+	MerklePath          string    `gorm:"type:text" json:"-"`                        // JSON path from the leaf to the batch root
+	EPCs                []EventEPC `gorm:"foreignKey:EventID" json:"-"` // EPCs referenced by the event, for MATCH_epc queries
 	CreatedAt           time.Time `json:"createdAt"`
 	UpdatedAt           time.Time `json:"updatedAt"`
 }
 
+// EventEPC indexes an EPC referenced by an event
+type EventEPC struct {
+	ID      uint   `gorm:"primaryKey" json:"-"`
+	EventID string `gorm:"index" json:"eventId"`
+	EPC     string `gorm:"index" json:"epc"`
+	Role    string `gorm:"index" json:"role"` // the event field the EPC appears in, e.g. epcList, childEPCs, inputQuantityList
+}
+
 // Device represents devices in the database
 type Device struct {
 	DeviceID         string     `gorm:"primaryKey" json:"deviceId"`
+	OrgID            string     `gorm:"index;not null;default:'default'" json:"orgId"` // assigned when claimed
 	Type             string     `json:"type"`
 	SecureBoot       *bool      `json:"secureBoot"`
 	OTACapable       *bool      `json:"otaCapable"`
@@ -44,6 +65,8 @@ type Device struct {
 	BatteryPct       *int       `json:"batteryPct"`
 	LastHeartbeat    *time.Time `json:"lastHeartbeat"`
 	JoinStatus       *string    `json:"joinStatus"`
+	DevEUI           *string    `gorm:"column:dev_eui;uniqueIndex" json:"devEui"` // LoRaWAN device EUI, upper-case hex
+	PayloadCodec     *string    `json:"payloadCodec"` // codec for LoRaWAN uplink payloads
 	ClaimedAt        *time.Time `json:"claimedAt"`
 	ClaimCode        *string    `json:"claimCode"`
 	IsActive         bool       `gorm:"default:true" json:"isActive"`
@@ -54,6 +77,7 @@ type Device struct {
 // RawDataIngestion represents raw data before processing
 type RawDataIngestion struct {
 	ID           string    `gorm:"primaryKey" json:"id"`
+	OrgID        string    `gorm:"index;not null;default:'default'" json:"orgId"`
 	DeviceType   string    `json:"deviceType"`
 	DeviceID     string    `json:"deviceId"`
 	Timestamp    time.Time `json:"timestamp"`
@@ -61,7 +85,11 @@ type RawDataIngestion struct {
 	RawData      string    `gorm:"type:text" json:"rawData"` // Store raw payload as JSON
 	Metadata     string    `gorm:"type:text" json:"metadata"` // Store metadata as JSON
 	ProcessedAt  *time.Time `json:"processedAt"`
-	ProcessingStatus string `gorm:"default:'pending'" json:"processingStatus"` // pending, processed, failed
+	ProcessingStatus string `gorm:"default:'pending';index" json:"processingStatus"` // pending, processing, processed, failed
+	EventIDs     string    `gorm:"type:text" json:"eventIds"` // JSON array of created event IDs
+	Attempts     int       `json:"attempts"`
+	NextAttemptAt *time.Time `gorm:"index" json:"nextAttemptAt"` // when a failed attempt is retried
+	ErrorMessage *string   `json:"errorMessage"`
 	CreatedAt    time.Time `json:"createdAt"`
 	UpdatedAt    time.Time `json:"updatedAt"`
 }
@@ -70,6 +98,7 @@ type RawDataIngestion struct {
 type ClaimCodeEntry struct {
 	ID          string     `gorm:"primaryKey" json:"id"`
 	ClaimCode   string     `gorm:"uniqueIndex" json:"claimCode"`
+	OrgID       string     `gorm:"index;not null;default:'default'" json:"orgId"` // the organization claimed devices join
 	DeviceType  string     `json:"deviceType"`
 	DeviceID    *string    `json:"deviceId"` // Set when claimed
 	IsUsed      bool       `gorm:"default:false" json:"isUsed"`
@@ -96,30 +125,67 @@ func InitDatabase() error {
 
 	// Auto migrate the schema
 	err = DB.AutoMigrate(
+		&Organization{},
 		&Event{},
+		&EventEPC{},
 		&Device{},
 		&RawDataIngestion{},
 		&ClaimCodeEntry{},
+		&CaptureJob{},
+		&MasterDataElement{},
+		&RecallDrill{},
+		&ColdChainProfile{},
+		&Excursion{},
+		&Alert{},
+		&Subscription{},
+		&WebhookDelivery{},
+		&APIKey{},
+		&SharingAgreement{},
+		&OutboxEntry{},
+		&AnchorBatch{},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to migrate database schema: %w", err)
 	}
+	if err := migrateToOrganizations(); err != nil {
+		return fmt.Errorf("failed to migrate database to organizations: %w", err)
+	}
+	if err := ensureDefaultOrganization(); err != nil {
+		return fmt.Errorf("failed to create default organization: %w", err)
+	}
+	if err := migrateToOutbox(); err != nil {
+		return fmt.Errorf("failed to migrate database to the anchoring outbox: %w", err)
+	}
 
 	return nil
 }
 
 // CreateEvent creates a new event in the database
 func CreateEvent(event *Event) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return CreateEventTx(tx, event)
+	})
+}
+
+// CreateEventTx creates a new event using the given transaction, together with
+// the outbox entry that queues it for anchoring on the ledger
+func CreateEventTx(tx *gorm.DB, event *Event) error {
 	if event.ID == "" {
 		event.ID = uuid.New().String()
 	}
-	return DB.Create(event).Error
+	if event.AnchorStatus == "" {
+		event.AnchorStatus = AnchorPending
+	}
+	if err := tx.Create(event).Error; err != nil {
+		return err
+	}
+	return createOutboxEntryTx(tx, event)
 }
 
-// GetEventByID retrieves an event by ID
-func GetEventByID(id string) (*Event, error) {
+// GetEventByID retrieves an event of an organization by ID
+func GetEventByID(orgID, id string) (*Event, error) {
 	var event Event
-	err := DB.First(&event, "id = ?", id).Error
+	err := DB.Scopes(inOrg(orgID)).First(&event, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -128,15 +194,20 @@ func GetEventByID(id string) (*Event, error) {
 
 // UpdateEvent updates an existing event in the database by ID
 func UpdateEvent(event *Event) error {
-	return DB.Model(&Event{}).Where("id = ?", event.ID).Updates(event).Error
+	return DB.Model(&Event{}).Where("id = ?", event.ID).Omit(clause.Associations).Updates(event).Error
 }
 
 // CreateDevice creates a new device in the database
 func CreateDevice(device *Device) error {
-	return DB.Create(device).Error
+	return CreateDeviceTx(DB, device)
 }
 
-// GetDeviceByID retrieves a device by ID
+// CreateDeviceTx creates a new device using the given transaction
+func CreateDeviceTx(tx *gorm.DB, device *Device) error {
+	return tx.Create(device).Error
+}
+
+// GetDeviceByID retrieves a device by ID, whichever organization it belongs to
 func GetDeviceByID(deviceID string) (*Device, error) {
 	var device Device
 	err := DB.First(&device, "device_id = ?", deviceID).Error
@@ -146,6 +217,17 @@ func GetDeviceByID(deviceID string) (*Device, error) {
 	return &device, nil
 }
 
+// GetDeviceByDevEUI retrieves a device by its LoRaWAN device EUI, whichever
+// organization it belongs to
+func GetDeviceByDevEUI(devEUI string) (*Device, error) {
+	var device Device
+	err := DB.First(&device, "dev_eui = ?", devEUI).Error
+	if err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
 // CreateRawDataIngestion creates a new raw data ingestion record
 func CreateRawDataIngestion(ingestion *RawDataIngestion) error {
 	if ingestion.ID == "" {
@@ -164,14 +246,20 @@ func GetClaimCodeByCode(code string) (*ClaimCodeEntry, error) {
 	return &claimCode, nil
 }
 
-// MarkClaimCodeAsUsed marks a claim code as used and associates it with a device
-func MarkClaimCodeAsUsed(code string, deviceID string) error {
+// MarkClaimCodeAsUsedTx marks an unused, unexpired claim code as used and
+// associates it with a device using the given transaction. It reports false
+// when the code was used or has expired in the meantime, so a code is only
+// ever claimed once.
+func MarkClaimCodeAsUsedTx(tx *gorm.DB, code string, deviceID string) (bool, error) {
 	now := time.Now()
-	return DB.Model(&ClaimCodeEntry{}).Where("claim_code = ?", code).Updates(map[string]interface{}{
-		"is_used":   true,
-		"device_id": deviceID,
-		"used_at":   now,
-	}).Error
+	result := tx.Model(&ClaimCodeEntry{}).
+		Where("claim_code = ? AND is_used = ? AND (expires_at IS NULL OR expires_at > ?)", code, false, now).
+		Updates(map[string]interface{}{
+			"is_used":   true,
+			"device_id": deviceID,
+			"used_at":   now,
+		})
+	return result.RowsAffected == 1, result.Error
 }
 
 // CreateClaimCode creates a new claim code (for testing/admin purposes)
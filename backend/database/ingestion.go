@@ -0,0 +1,198 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Raw data ingestion processing statuses
+const (
+	IngestionPending    = "pending"
+	IngestionProcessing = "processing"
+	IngestionProcessed  = "processed"
+	IngestionFailed     = "failed"
+)
+
+// ClaimPendingIngestion marks the oldest pending ingestion that is due as
+// processing and returns it, or returns nil when none is due. The status check
+// in the update ensures an ingestion is only claimed by one worker.
+func ClaimPendingIngestion(now time.Time) (*RawDataIngestion, error) {
+	for {
+		var ingestion RawDataIngestion
+		err := DB.Where("processing_status = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)", IngestionPending, now).
+			Order("created_at ASC").
+			Limit(1).
+			Find(&ingestion).Error
+		if err != nil || ingestion.ID == "" {
+			return nil, err
+		}
+
+		result := DB.Model(&RawDataIngestion{}).
+			Where("id = ? AND processing_status = ?", ingestion.ID, IngestionPending).
+			Updates(map[string]interface{}{
+				"processing_status": IngestionProcessing,
+				"updated_at":        now,
+			})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			ingestion.ProcessingStatus = IngestionProcessing
+			return &ingestion, nil
+		}
+		// Another worker claimed it first; try the next one
+	}
+}
+
+// GetRawDataIngestionByID retrieves a raw data ingestion of an organization by ID
+func GetRawDataIngestionByID(orgID, id string) (*RawDataIngestion, error) {
+	var ingestion RawDataIngestion
+	err := DB.Scopes(inOrg(orgID)).First(&ingestion, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &ingestion, nil
+}
+
+// UpdateRawDataIngestion saves the state of a raw data ingestion
+func UpdateRawDataIngestion(ingestion *RawDataIngestion) error {
+	return DB.Save(ingestion).Error
+}
+
+// ResetInterruptedIngestions returns ingestions left processing by a previous
+// process to the pending queue
+func ResetInterruptedIngestions() error {
+	return DB.Model(&RawDataIngestion{}).Where("processing_status = ?", IngestionProcessing).
+		Update("processing_status", IngestionPending).Error
+}
+
+// IngestionFilter selects raw data ingestions of an organization
+type IngestionFilter struct {
+	OrgID    string
+	DeviceID string
+	Status   string
+	From     *time.Time // inclusive lower bound on the device timestamp
+	To       *time.Time // exclusive upper bound on the device timestamp
+	Limit    int
+	Offset   int
+}
+
+// apply adds the filter's conditions to a query
+func (f *IngestionFilter) apply(db *gorm.DB) *gorm.DB {
+	db = db.Scopes(inOrg(f.OrgID))
+	if f.DeviceID != "" {
+		db = db.Where("device_id = ?", f.DeviceID)
+	}
+	if f.Status != "" {
+		db = db.Where("processing_status = ?", f.Status)
+	}
+	if f.From != nil {
+		db = db.Where("timestamp >= ?", f.From.UTC())
+	}
+	if f.To != nil {
+		db = db.Where("timestamp < ?", f.To.UTC())
+	}
+	return db
+}
+
+// ListRawDataIngestions retrieves raw data ingestions matching a filter, most
+// recent first, together with the total number of matches
+func ListRawDataIngestions(filter *IngestionFilter) ([]RawDataIngestion, int64, error) {
+	var total int64
+	if err := filter.apply(DB.Model(&RawDataIngestion{})).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var ingestions []RawDataIngestion
+	err := filter.apply(DB).
+		Order("created_at DESC").Order("id DESC").
+		Limit(filter.Limit).Offset(filter.Offset).
+		Find(&ingestions).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return ingestions, total, nil
+}
+
+// GetEventsByIngestionID returns the events derived from a raw data ingestion
+func GetEventsByIngestionID(ingestionID string) ([]Event, error) {
+	var events []Event
+	err := DB.Where("ingestion_id = ?", ingestionID).
+		Order("event_time ASC").Order("id ASC").
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// anchoredEvents selects the events that are in an anchor batch or anchored on
+// the ledger. They are part of the anchored history and are never replaced.
+func anchoredEvents(db *gorm.DB) *gorm.DB {
+	return db.Where("(events.batch_id IS NOT NULL OR events.blockchain_tx_id IS NOT NULL)")
+}
+
+// ListEventsByIngestionTx retrieves the events derived from a raw data
+// ingestion using the given transaction
+func ListEventsByIngestionTx(tx *gorm.DB, ingestionID string) ([]Event, error) {
+	var events []Event
+	err := tx.Where("ingestion_id = ?", ingestionID).Find(&events).Error
+	return events, err
+}
+
+// HasAnchoredEvents reports whether any event derived from a raw data
+// ingestion is in an anchor batch or anchored on the ledger
+func HasAnchoredEvents(ingestionID string) (bool, error) {
+	var count int64
+	err := DB.Model(&Event{}).Scopes(anchoredEvents).Where("ingestion_id = ?", ingestionID).Count(&count).Error
+	return count > 0, err
+}
+
+// DeleteEventsTx removes events, their EPC index and their outbox entries
+// using the given transaction
+func DeleteEventsTx(tx *gorm.DB, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Where("event_id IN ?", ids).Delete(&EventEPC{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("event_id IN ?", ids).Delete(&OutboxEntry{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("id IN ?", ids).Delete(&Event{}).Error
+}
+
+// ReplayIngestion returns a processed or failed ingestion to the pending queue
+// with a fresh set of attempts. It reports false when the ingestion is pending
+// or being processed, so it is never replayed underneath its worker.
+func ReplayIngestion(orgID, id string) (bool, error) {
+	count, err := resetForReplay(DB.Scopes(inOrg(orgID)).Where("id = ?", id), IngestionProcessed, IngestionFailed)
+	return count == 1, err
+}
+
+// ReplayFailedIngestions returns every failed ingestion matching a filter to the
+// pending queue and returns how many were queued. Ingestions with anchored
+// events are left alone. The filter's status, limit and offset are ignored.
+func ReplayFailedIngestions(filter *IngestionFilter) (int64, error) {
+	scope := *filter
+	scope.Status = ""
+	anchored := DB.Model(&Event{}).Select("ingestion_id").Scopes(anchoredEvents).Where("ingestion_id IS NOT NULL")
+	return resetForReplay(scope.apply(DB).Where("id NOT IN (?)", anchored), IngestionFailed)
+}
+
+// resetForReplay resets the ingestions selected by a query that are in one of
+// the given statuses
+func resetForReplay(db *gorm.DB, statuses ...string) (int64, error) {
+	result := db.Model(&RawDataIngestion{}).
+		Where("processing_status IN ?", statuses).
+		Updates(map[string]interface{}{
+			"processing_status": IngestionPending,
+			"attempts":          0,
+			"next_attempt_at":   nil,
+			"error_message":     nil,
+			"processed_at":      nil,
+		})
+	return result.RowsAffected, result.Error
+}
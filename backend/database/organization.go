@@ -0,0 +1,105 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultOrganizationID is the organization that owns data recorded before
+// organizations existed, and that of callers no organization is known for. It
+// operates the deployment and is the only one to manage organizations.
+const DefaultOrganizationID = "default"
+
+// Organization is a tenant, such as a grower or a packer. Events, devices,
+// claim codes and everything derived from them belong to one organization
+// and are only visible to it.
+type Organization struct {
+	ID        string    `gorm:"primaryKey" json:"id"` // slug, e.g. acme-farms
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ensureDefaultOrganization creates the default organization when it is missing
+func ensureDefaultOrganization() error {
+	return DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&Organization{
+		ID:   DefaultOrganizationID,
+		Name: "Default",
+	}).Error
+}
+
+// migrateToOrganizations removes the constraints that kept data unique across
+// the whole deployment in databases created before organizations existed.
+// Their rows belong to the default organization through the column default.
+func migrateToOrganizations() error {
+	migrator := DB.Migrator()
+	for _, index := range []string{"idx_cold_chain_profiles_lot_code", "idx_cold_chain_profiles_product"} {
+		if migrator.HasIndex(&ColdChainProfile{}, index) {
+			if err := migrator.DropIndex(&ColdChainProfile{}, index); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Master data was keyed by element ID alone, and SQLite cannot change the
+	// primary key of a table in place
+	var schema string
+	if err := DB.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'master_data_elements'").Scan(&schema).Error; err != nil {
+		return err
+	}
+	if !strings.Contains(schema, "PRIMARY KEY (`id`)") {
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			"DROP INDEX IF EXISTS idx_master_data_elements_type",
+			"DROP INDEX IF EXISTS idx_master_data_elements_org_id",
+			"ALTER TABLE master_data_elements RENAME TO master_data_elements_legacy",
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Migrator().CreateTable(&MasterDataElement{}); err != nil {
+			return err
+		}
+		if err := tx.Exec(`INSERT INTO master_data_elements (org_id, id, type, attributes, created_at, updated_at)
+			SELECT org_id, id, type, attributes, created_at, updated_at FROM master_data_elements_legacy`).Error; err != nil {
+			return err
+		}
+		return tx.Exec("DROP TABLE master_data_elements_legacy").Error
+	})
+}
+
+// CreateOrganization creates a new organization
+func CreateOrganization(org *Organization) error {
+	return DB.Create(org).Error
+}
+
+// GetOrganizationByID retrieves an organization by ID
+func GetOrganizationByID(id string) (*Organization, error) {
+	var org Organization
+	err := DB.First(&org, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// ListOrganizations retrieves all organizations
+func ListOrganizations() ([]Organization, error) {
+	var orgs []Organization
+	err := DB.Order("id ASC").Find(&orgs).Error
+	return orgs, err
+}
+
+// inOrg restricts a query to the rows of an organization
+func inOrg(orgID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("org_id = ?", orgID)
+	}
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Anchoring statuses of events, their outbox entries and anchor batches
+const (
+	AnchorPending    = "pending"
+	AnchorSubmitting = "submitting" // batches only, while the relay submits them
+	AnchorAnchored   = "anchored"
+	AnchorFailed     = "failed" // gave up after the last attempt
+)
+
+// OutboxEntry asks the anchor relay to anchor an event on the ledger. It is
+// written in the transaction that stores the event, so every stored event is
+// anchored eventually, even when the ledger is unavailable or the process
+// stops before submitting it. The relay adds pending entries to an anchor
+// batch and retries the batch as a whole.
+type OutboxEntry struct {
+	ID         string     `gorm:"primaryKey" json:"id"`
+	OrgID      string     `gorm:"index;not null;default:'default'" json:"orgId"`
+	EventID    string     `gorm:"uniqueIndex" json:"eventId"`
+	BatchID    *string    `gorm:"index" json:"batchId"` // set once the event is added to an anchor batch
+	Status     string     `gorm:"index" json:"status"`
+	LastError  *string    `json:"lastError"`
+	AnchoredAt *time.Time `json:"anchoredAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+// createOutboxEntryTx queues a stored event for anchoring using the given transaction
+func createOutboxEntryTx(tx *gorm.DB, event *Event) error {
+	return tx.Create(&OutboxEntry{
+		ID:      uuid.New().String(),
+		OrgID:   event.OrgID,
+		EventID: event.ID,
+		Status:  AnchorPending,
+	}).Error
+}
+
+// migrateToOutbox tracks the anchoring of events stored before the outbox
+// existed: those with a ledger transaction are anchored and the others are
+// queued for anchoring
+func migrateToOutbox() error {
+	err := DB.Model(&Event{}).
+		Where("anchor_status = ? AND blockchain_tx_id IS NOT NULL", AnchorPending).
+		Update("anchor_status", AnchorAnchored).Error
+	if err != nil {
+		return err
+	}
+
+	return DB.Exec(`INSERT INTO outbox_entries (id, org_id, event_id, status, created_at, updated_at)
+		SELECT lower(hex(randomblob(16))), org_id, id, ?, ?, ? FROM events
+		WHERE anchor_status = ? AND id NOT IN (SELECT event_id FROM outbox_entries)`,
+		AnchorPending, time.Now(), time.Now(), AnchorPending).Error
+}
+
+// OutboxFilter selects the outbox entries of an organization
+type OutboxFilter struct {
+	OrgID  string
+	Status string // pending or failed; both when empty
+	Limit  int
+}
+
+// ListUnanchoredOutboxEntries retrieves the outbox entries of the events of an
+// organization that are not anchored yet, oldest first
+func ListUnanchoredOutboxEntries(filter *OutboxFilter) ([]OutboxEntry, error) {
+	db := DB.Scopes(inOrg(filter.OrgID)).Order("created_at ASC").Order("id ASC")
+	switch filter.Status {
+	case AnchorPending, AnchorFailed:
+		db = db.Where("status = ?", filter.Status)
+	default:
+		db = db.Where("status <> ?", AnchorAnchored)
+	}
+	if filter.Limit > 0 {
+		db = db.Limit(filter.Limit)
+	}
+
+	var entries []OutboxEntry
+	err := db.Find(&entries).Error
+	return entries, err
+}
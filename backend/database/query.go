@@ -0,0 +1,235 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Event fields an EPC can appear in, recorded as EventEPC.Role
+const (
+	RoleEPCList            = "epcList"
+	RoleQuantityList       = "quantityList"
+	RoleParentID           = "parentID"
+	RoleChildEPCs          = "childEPCs"
+	RoleChildQuantityList  = "childQuantityList"
+	RoleInputEPCList       = "inputEPCList"
+	RoleInputQuantityList  = "inputQuantityList"
+	RoleOutputEPCList      = "outputEPCList"
+	RoleOutputQuantityList = "outputQuantityList"
+)
+
+// EPCMatch restricts a query to events referencing any of the patterns in any of the roles
+type EPCMatch struct {
+	Roles    []string
+	Patterns []string // exact EPCs or urn:epc:idpat patterns with * wildcards
+}
+
+// EventQuery holds the filters for querying stored events, modelled on the
+// EPCIS 2.0 SimpleEventQuery parameters, within the events of an organization
+// and those partners shared with it. Multi-valued filters match any value.
+type EventQuery struct {
+	OrgID             string
+	Shared            []SharedScope // partner events within these scopes are included
+	EventTypes        []string
+	GETime            *time.Time
+	LTTime            *time.Time
+	Actions           []string
+	BizSteps          []string
+	Dispositions      []string
+	ReadPoints        []string
+	BizLocations      []string
+	TransformationIDs []string
+	EPCMatches        []EPCMatch
+	LotCodes          []string
+	DeviceIDs         []string
+	After             *EventCursor
+	Limit             int
+}
+
+// EventCursor marks the position after which a paginated query resumes
+type EventCursor struct {
+	EventTime time.Time
+	ID        string
+}
+
+// QueryEvents returns the events matching the query, ordered by event time and ID
+func QueryEvents(query *EventQuery) ([]Event, error) {
+	tx := DB.Model(&Event{}).Scopes(visibleTo(query.OrgID, query.Shared))
+
+	if len(query.EventTypes) > 0 {
+		tx = tx.Where("event_type IN ?", query.EventTypes)
+	}
+	if query.GETime != nil {
+		tx = tx.Where("event_time >= ?", query.GETime.UTC())
+	}
+	if query.LTTime != nil {
+		tx = tx.Where("event_time < ?", query.LTTime.UTC())
+	}
+	if len(query.Actions) > 0 {
+		tx = tx.Where("action IN ?", query.Actions)
+	}
+	if len(query.BizSteps) > 0 {
+		tx = tx.Where("biz_step IN ?", query.BizSteps)
+	}
+	if len(query.Dispositions) > 0 {
+		tx = tx.Where("disposition IN ?", query.Dispositions)
+	}
+	if len(query.ReadPoints) > 0 {
+		tx = tx.Where("read_point_id IN ?", query.ReadPoints)
+	}
+	if len(query.BizLocations) > 0 {
+		tx = tx.Where("biz_location_id IN ?", query.BizLocations)
+	}
+	if len(query.TransformationIDs) > 0 {
+		tx = tx.Where("transformation_id IN ?", query.TransformationIDs)
+	}
+	if len(query.LotCodes) > 0 {
+		tx = tx.Where("lot_code IN ?", query.LotCodes)
+	}
+	if len(query.DeviceIDs) > 0 {
+		tx = tx.Where("device_id IN ?", query.DeviceIDs)
+	}
+	for _, match := range query.EPCMatches {
+		tx = tx.Where("id IN (?)", matchEPCSubquery(match))
+	}
+	if query.After != nil {
+		after := query.After.EventTime.UTC()
+		tx = tx.Where("event_time > ? OR (event_time = ? AND id > ?)", after, after, query.After.ID)
+	}
+	if query.Limit > 0 {
+		tx = tx.Limit(query.Limit)
+	}
+
+	var events []Event
+	err := tx.Order("event_time ASC").Order("id ASC").Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// matchEPCSubquery selects the IDs of events matching an EPC match
+func matchEPCSubquery(match EPCMatch) *gorm.DB {
+	var conditions []string
+	var args []interface{}
+
+	for _, pattern := range match.Patterns {
+		if !strings.Contains(pattern, "*") {
+			conditions = append(conditions, "epc = ?")
+			args = append(args, pattern)
+			continue
+		}
+
+		// urn:epc:idpat:sgtin:0614141.107346.* matches urn:epc:id:sgtin:0614141.107346.<any>,
+		// and urn:epc:idpat:lgtin:... matches EPC classes such as urn:epc:class:lgtin:...
+		escaper := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+		like := strings.ReplaceAll(escaper.Replace(pattern), "*", "%")
+		if strings.HasPrefix(pattern, "urn:epc:idpat:") {
+			conditions = append(conditions, `epc LIKE ? ESCAPE '\'`, `epc LIKE ? ESCAPE '\'`)
+			args = append(args,
+				strings.Replace(like, "urn:epc:idpat:", "urn:epc:id:", 1),
+				strings.Replace(like, "urn:epc:idpat:", "urn:epc:class:", 1))
+			continue
+		}
+		conditions = append(conditions, `epc LIKE ? ESCAPE '\'`)
+		args = append(args, like)
+	}
+
+	return DB.Model(&EventEPC{}).
+		Select("event_id").
+		Where("role IN ?", match.Roles).
+		Where(strings.Join(conditions, " OR "), args...)
+}
+
+// FindEventsByIdentifier returns the events of an organization that reference a
+// lot code, EPC or EPC class in any field, ordered by event time
+func FindEventsByIdentifier(orgID, identifier string) ([]Event, error) {
+	return findEventsByIdentifier(inOrg(orgID), identifier)
+}
+
+// FindVisibleEventsByIdentifier returns the events of an organization and the
+// partner events within the scopes shared with it that reference a lot code,
+// EPC or EPC class in any field, ordered by event time
+func FindVisibleEventsByIdentifier(orgID string, shared []SharedScope, identifier string) ([]Event, error) {
+	return findEventsByIdentifier(visibleTo(orgID, shared), identifier)
+}
+
+// FindPartnerEventsByIdentifier returns all events of the organizations that
+// shared a scope that reference a lot code, EPC or EPC class in any field,
+// whether or not they are within the scope, ordered by event time
+func FindPartnerEventsByIdentifier(shared []SharedScope, identifier string) ([]Event, error) {
+	if len(shared) == 0 {
+		return nil, nil
+	}
+	return findEventsByIdentifier(sharedBy(shared), identifier)
+}
+
+// findEventsByIdentifier returns the events within a scope that reference a
+// lot code, EPC or EPC class in any field, ordered by event time
+func findEventsByIdentifier(scope func(*gorm.DB) *gorm.DB, identifier string) ([]Event, error) {
+	epcEvents := DB.Model(&EventEPC{}).Select("event_id").Where("epc = ?", identifier)
+
+	var events []Event
+	err := DB.Scopes(scope).Where("lot_code = ? OR id IN (?)", identifier, epcEvents).
+		Order("event_time ASC").Order("id ASC").
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// GetEventsByTransformationID returns the events of an organization, and the
+// partner events within the scopes shared with it, that belong to one
+// transformation
+func GetEventsByTransformationID(orgID string, shared []SharedScope, transformationID string) ([]Event, error) {
+	var events []Event
+	err := DB.Scopes(visibleTo(orgID, shared)).Where("transformation_id = ?", transformationID).
+		Order("event_time ASC").Order("id ASC").
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// FindLotCodeSource returns the lot code source recorded for a traceability lot
+// code by the event of an organization that assigned it, or an empty string if
+// none is known
+func FindLotCodeSource(orgID, lotCode string) (string, error) {
+	var events []Event
+	err := DB.Scopes(inOrg(orgID)).Select("lot_code_source").
+		Where("lot_code = ? AND lot_code_source IS NOT NULL", lotCode).
+		Order("event_time ASC").Limit(1).
+		Find(&events).Error
+	if err != nil || len(events) == 0 {
+		return "", err
+	}
+	return *events[0].LotCodeSource, nil
+}
+
+// FindCTEEvents returns the FSMA 204 Critical Tracking Events an organization
+// recorded for a lot code, EPC or EPC class within an optional time range, in
+// event time order. All CTEs in the range are returned when no lot is given.
+func FindCTEEvents(orgID, lot string, from, to *time.Time) ([]Event, error) {
+	db := DB.Scopes(inOrg(orgID)).Where("cte IS NOT NULL")
+	if lot != "" {
+		epcEvents := DB.Model(&EventEPC{}).Select("event_id").Where("epc = ?", lot)
+		db = db.Where("lot_code = ? OR id IN (?)", lot, epcEvents)
+	}
+	if from != nil {
+		db = db.Where("event_time >= ?", from.UTC())
+	}
+	if to != nil {
+		db = db.Where("event_time < ?", to.UTC())
+	}
+
+	var events []Event
+	err := db.Order("event_time ASC").Order("id ASC").Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RecallDrill stores the result of a recall drill
+type RecallDrill struct {
+	ID               string    `gorm:"primaryKey" json:"id"`
+	OrgID            string    `gorm:"index;not null;default:'default'" json:"orgId"`
+	LotCode          string    `gorm:"index" json:"lotCode"`
+	Depth            int       `json:"depth"`
+	InitiatedBy      *string   `json:"initiatedBy"`
+	StartedAt        time.Time `gorm:"index" json:"startedAt"`
+	CompletedAt      time.Time `json:"completedAt"`
+	DurationMs       int64     `json:"durationMs"`
+	WithinFSMAWindow bool      `json:"withinFsmaWindow"`
+	AffectedLots     int       `json:"affectedLots"`
+	Locations        int       `json:"locations"`
+	Customers        int       `json:"customers"`
+	InTransit        int       `json:"inTransit"`
+	Report           string    `gorm:"type:text" json:"-"` // Store the full drill report as JSON
+	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// CreateRecallDrill creates a new recall drill record
+func CreateRecallDrill(drill *RecallDrill) error {
+	if drill.ID == "" {
+		drill.ID = uuid.New().String()
+	}
+	return DB.Create(drill).Error
+}
+
+// GetRecallDrillByID retrieves a recall drill of an organization by ID
+func GetRecallDrillByID(orgID, id string) (*RecallDrill, error) {
+	var drill RecallDrill
+	err := DB.Scopes(inOrg(orgID)).First(&drill, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &drill, nil
+}
+
+// ListRecallDrills retrieves the recall drills of an organization, most recent
+// first, optionally for a single lot
+func ListRecallDrills(orgID, lotCode string, limit int) ([]RecallDrill, error) {
+	var drills []RecallDrill
+	db := DB.Scopes(inOrg(orgID)).Omit("report").Order("started_at DESC").Limit(limit)
+	if lotCode != "" {
+		db = db.Where("lot_code = ?", lotCode)
+	}
+	err := db.Find(&drills).Error
+	return drills, err
+}
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// openTestDatabase initializes a fresh database in a temporary directory
+func openTestDatabase(t *testing.T) {
+	t.Helper()
+	t.Setenv("DATABASE_PATH", filepath.Join(t.TempDir(), "test.db"))
+	if err := InitDatabase(); err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// createTestEvent stores an event of an organization with a lot code,
+// business location and EPCs, any of which may be empty
+func createTestEvent(t *testing.T, id, orgID, lotCode, bizLocation string, epcs ...string) {
+	t.Helper()
+	event := &Event{
+		ID:        id,
+		OrgID:     orgID,
+		EventType: "ObjectEvent",
+		EventTime: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		Hash:      strings.Repeat("0", 64),
+		RawData:   "{}",
+	}
+	if lotCode != "" {
+		event.LotCode = &lotCode
+	}
+	if bizLocation != "" {
+		event.BizLocationID = &bizLocation
+	}
+	for _, epc := range epcs {
+		event.EPCs = append(event.EPCs, EventEPC{EPC: epc, Role: RoleEPCList})
+	}
+	if err := CreateEvent(event); err != nil {
+		t.Fatalf("CreateEvent: %v", err)
+	}
+}
+
+// eventIDs returns the sorted IDs of the events a scope selects
+func eventIDs(t *testing.T, scope func(*gorm.DB) *gorm.DB) []string {
+	t.Helper()
+	var ids []string
+	if err := DB.Model(&Event{}).Scopes(scope).Pluck("id", &ids).Error; err != nil {
+		t.Fatalf("failed to query events: %v", err)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestInOrg(t *testing.T) {
+	openTestDatabase(t)
+	createTestEvent(t, "a1", "org-a", "LOT-1", "")
+	createTestEvent(t, "a2", "org-a", "LOT-2", "")
+	createTestEvent(t, "b1", "org-b", "LOT-1", "")
+
+	tests := []struct {
+		orgID string
+		want  string
+	}{
+		{"org-a", "a1,a2"},
+		{"org-b", "b1"},
+		{"org-c", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.orgID, func(t *testing.T) {
+			if got := strings.Join(eventIDs(t, inOrg(tt.orgID)), ","); got != tt.want {
+				t.Errorf("events of %q = %s, want %s", tt.orgID, got, tt.want)
+			}
+		})
+	}
+
+	// The scope also confines lookups by ID
+	if _, err := GetEventByID("org-b", "a1"); err != gorm.ErrRecordNotFound {
+		t.Errorf("GetEventByID of another organization's event = %v, want not found", err)
+	}
+}
+
+func TestVisibleTo(t *testing.T) {
+	openTestDatabase(t)
+
+	// The caller's own events
+	createTestEvent(t, "own", "org-a", "LOT-OWN", "")
+	// Events of the partner that shares with the caller
+	createTestEvent(t, "lot", "org-b", "LOT-1", "")
+	createTestEvent(t, "location", "org-b", "", "urn:epc:id:sgln:0614141.00777.0")
+	createTestEvent(t, "company", "org-b", "", "", "urn:epc:id:sgtin:4012345.011111.1")
+	createTestEvent(t, "class", "org-b", "", "", "urn:epc:class:lgtin:4012345.012345.L1")
+	createTestEvent(t, "uri", "org-b", "", "", "urn:epc:id:sscc:0614141.1234567890")
+	createTestEvent(t, "private", "org-b", "LOT-2", "", "urn:epc:id:sgtin:9999999.011111.1")
+	// Not a wildcard match for the 4012345 company prefix
+	createTestEvent(t, "lookalike", "org-b", "", "", "urn:epc:id:sgtin:40123456.011111.1")
+	// Events of an organization that shares nothing, matching the partner's scope
+	createTestEvent(t, "other", "org-c", "LOT-1", "urn:epc:id:sgln:0614141.00777.0", "urn:epc:id:sgtin:4012345.011111.2")
+
+	tests := []struct {
+		name   string
+		orgID  string
+		shared []SharedScope
+		want   string
+	}{
+		{
+			name:  "own events only",
+			orgID: "org-a",
+			want:  "own",
+		},
+		{
+			name:   "by lot code",
+			orgID:  "org-a",
+			shared: []SharedScope{{OrgID: "org-b", LotCodes: []string{"LOT-1"}}},
+			want:   "lot,own",
+		},
+		{
+			name:   "by business location",
+			orgID:  "org-a",
+			shared: []SharedScope{{OrgID: "org-b", BizLocations: []string{"urn:epc:id:sgln:0614141.00777.0"}}},
+			want:   "location,own",
+		},
+		{
+			name:   "by GS1 company prefix",
+			orgID:  "org-a",
+			shared: []SharedScope{{OrgID: "org-b", EPCPrefixes: []string{"4012345"}}},
+			want:   "class,company,own",
+		},
+		{
+			name:   "by EPC URI prefix",
+			orgID:  "org-a",
+			shared: []SharedScope{{OrgID: "org-b", EPCPrefixes: []string{"urn:epc:id:sscc:0614141."}}},
+			want:   "own,uri",
+		},
+		{
+			name:  "several scopes",
+			orgID: "org-a",
+			shared: []SharedScope{
+				{OrgID: "org-b", LotCodes: []string{"LOT-1"}},
+				{OrgID: "org-b", BizLocations: []string{"urn:epc:id:sgln:0614141.00777.0"}},
+			},
+			want: "location,lot,own",
+		},
+		{
+			name:   "empty scope shares nothing",
+			orgID:  "org-a",
+			shared: []SharedScope{{OrgID: "org-b"}},
+			want:   "own",
+		},
+		{
+			name:   "wildcards in prefixes are literal",
+			orgID:  "org-a",
+			shared: []SharedScope{{OrgID: "org-b", EPCPrefixes: []string{"urn:epc:id:%"}}},
+			want:   "own",
+		},
+		{
+			name:   "scope of an organization without events",
+			orgID:  "org-a",
+			shared: []SharedScope{{OrgID: "org-d", LotCodes: []string{"LOT-1"}}},
+			want:   "own",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(eventIDs(t, visibleTo(tt.orgID, tt.shared)), ","); got != tt.want {
+				t.Errorf("visible events = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
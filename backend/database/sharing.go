@@ -0,0 +1,168 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Directions of the sharing agreements of an organization
+const (
+	SharingGranted  = "granted"  // agreements the organization granted partners
+	SharingReceived = "received" // agreements partners granted the organization
+)
+
+// SharingAgreement grants a partner organization read access to the events of
+// the granting organization within a scope, until it expires or is revoked
+type SharingAgreement struct {
+	ID           string     `gorm:"primaryKey" json:"id"`
+	OrgID        string     `gorm:"index;not null" json:"orgId"` // the granting organization, which owns the events
+	PartnerOrgID string     `gorm:"index;not null" json:"partnerOrgId"`
+	Scope        string     `gorm:"type:text" json:"scope"` // models.SharingScope as JSON
+	Description  *string    `json:"description"`
+	ExpiresAt    *time.Time `gorm:"index" json:"expiresAt"` // never when empty
+	RevokedAt    *time.Time `json:"revokedAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+// SharedScope is the part of the events of a granting organization a partner
+// may read. An event is shared when its lot code, one of its EPCs or EPC
+// classes, or its business location is within any of the lists.
+type SharedScope struct {
+	OrgID        string
+	LotCodes     []string
+	EPCPrefixes  []string // EPC URI prefixes, or GS1 company prefixes such as 4012345
+	BizLocations []string
+}
+
+// CreateSharingAgreement creates a new sharing agreement
+func CreateSharingAgreement(agreement *SharingAgreement) error {
+	if agreement.ID == "" {
+		agreement.ID = uuid.New().String()
+	}
+	return DB.Create(agreement).Error
+}
+
+// GetSharingAgreementByID retrieves a sharing agreement an organization
+// granted or received by ID
+func GetSharingAgreementByID(orgID, id string) (*SharingAgreement, error) {
+	var agreement SharingAgreement
+	err := DB.Where("org_id = ? OR partner_org_id = ?", orgID, orgID).First(&agreement, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &agreement, nil
+}
+
+// ListSharingAgreements retrieves the sharing agreements an organization
+// granted or received, or both when no direction is given, most recent first
+func ListSharingAgreements(orgID, direction string) ([]SharingAgreement, error) {
+	db := DB.Order("created_at DESC")
+	switch direction {
+	case SharingGranted:
+		db = db.Where("org_id = ?", orgID)
+	case SharingReceived:
+		db = db.Where("partner_org_id = ?", orgID)
+	default:
+		db = db.Where("org_id = ? OR partner_org_id = ?", orgID, orgID)
+	}
+
+	var agreements []SharingAgreement
+	err := db.Find(&agreements).Error
+	return agreements, err
+}
+
+// ListActiveSharingAgreements retrieves the agreements granted to a partner
+// organization that are neither revoked nor expired
+func ListActiveSharingAgreements(partnerOrgID string, now time.Time) ([]SharingAgreement, error) {
+	var agreements []SharingAgreement
+	err := DB.Where("partner_org_id = ? AND revoked_at IS NULL", partnerOrgID).
+		Where("expires_at IS NULL OR expires_at > ?", now.UTC()).
+		Order("created_at ASC").
+		Find(&agreements).Error
+	return agreements, err
+}
+
+// RevokeSharingAgreement revokes a sharing agreement an organization granted.
+// It returns gorm.ErrRecordNotFound when there is no such agreement that is
+// still in effect.
+func RevokeSharingAgreement(orgID, id string, now time.Time) error {
+	result := DB.Model(&SharingAgreement{}).
+		Where("id = ? AND org_id = ? AND revoked_at IS NULL", id, orgID).
+		Update("revoked_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// visibleTo restricts a query to the events an organization can read: its own
+// and those of partners within the scopes they shared with it
+func visibleTo(orgID string, shared []SharedScope) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		conditions := []string{"org_id = ?"}
+		args := []interface{}{orgID}
+		for _, scope := range shared {
+			condition, scopeArgs := sharedCondition(scope)
+			if condition == "" {
+				continue
+			}
+			conditions = append(conditions, "(org_id = ? AND ("+condition+"))")
+			args = append(append(args, scope.OrgID), scopeArgs...)
+		}
+		return db.Where(strings.Join(conditions, " OR "), args...)
+	}
+}
+
+// sharedCondition builds the condition selecting the events within a shared
+// scope, or an empty condition when the scope shares nothing
+func sharedCondition(scope SharedScope) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if len(scope.LotCodes) > 0 {
+		conditions = append(conditions, "lot_code IN ?")
+		args = append(args, scope.LotCodes)
+	}
+	if len(scope.BizLocations) > 0 {
+		conditions = append(conditions, "biz_location_id IN ?")
+		args = append(args, scope.BizLocations)
+	}
+	if len(scope.EPCPrefixes) > 0 {
+		var epcConditions []string
+		var epcArgs []interface{}
+		escaper := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+		for _, prefix := range scope.EPCPrefixes {
+			// A GS1 company prefix follows the scheme of any EPC URI, e.g.
+			// urn:epc:id:sgtin:4012345.011111.1 or urn:epc:class:lgtin:4012345.012345.L1
+			like := escaper.Replace(prefix) + "%"
+			if !strings.Contains(prefix, ":") {
+				like = "urn:epc:%:" + escaper.Replace(prefix) + ".%"
+			}
+			epcConditions = append(epcConditions, `epc LIKE ? ESCAPE '\'`)
+			epcArgs = append(epcArgs, like)
+		}
+		epcEvents := DB.Model(&EventEPC{}).Select("event_id").Where(strings.Join(epcConditions, " OR "), epcArgs...)
+		conditions = append(conditions, "id IN (?)")
+		args = append(args, epcEvents)
+	}
+
+	return strings.Join(conditions, " OR "), args
+}
+
+// sharedBy restricts a query to the rows of the organizations that shared a scope
+func sharedBy(shared []SharedScope) func(*gorm.DB) *gorm.DB {
+	orgIDs := make([]string, 0, len(shared))
+	for _, scope := range shared {
+		orgIDs = append(orgIDs, scope.OrgID)
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("org_id IN ?", orgIDs)
+	}
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryPending    = "pending"
+	DeliveryDelivering = "delivering"
+	DeliveryDelivered  = "delivered"
+	DeliveryDead       = "dead" // gave up after the last attempt
+)
+
+// Subscription pushes the events matching a filter to a URL
+type Subscription struct {
+	ID          string    `gorm:"primaryKey" json:"id"`
+	OrgID       string    `gorm:"index;not null;default:'default'" json:"orgId"`
+	URL         string    `json:"url"`
+	Filter      string    `gorm:"type:text" json:"filter"` // models.SubscriptionFilter as JSON
+	Secret      string    `json:"-"`                       // HMAC-SHA256 key for delivery signatures
+	Description *string   `json:"description"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// WebhookDelivery records the delivery of one event to a subscription
+type WebhookDelivery struct {
+	ID             string     `gorm:"primaryKey" json:"id"`
+	OrgID          string     `gorm:"index;not null;default:'default'" json:"orgId"`
+	SubscriptionID string     `gorm:"index" json:"subscriptionId"`
+	EventID        string     `gorm:"index" json:"eventId"`
+	Status         string     `gorm:"index" json:"status"`
+	Payload        string     `gorm:"type:text" json:"-"` // delivered body, identical on every attempt
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `gorm:"index" json:"nextAttemptAt"`
+	LastStatusCode *int       `json:"lastStatusCode"`
+	LastError      *string    `json:"lastError"`
+	DeliveredAt    *time.Time `json:"deliveredAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+// CreateSubscription creates a new subscription
+func CreateSubscription(subscription *Subscription) error {
+	if subscription.ID == "" {
+		subscription.ID = uuid.New().String()
+	}
+	return DB.Create(subscription).Error
+}
+
+// GetSubscriptionByID retrieves a subscription of an organization by ID
+func GetSubscriptionByID(orgID, id string) (*Subscription, error) {
+	var subscription Subscription
+	err := DB.Scopes(inOrg(orgID)).First(&subscription, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// ListSubscriptions retrieves the subscriptions of an organization, oldest first
+func ListSubscriptions(orgID string) ([]Subscription, error) {
+	var subscriptions []Subscription
+	err := DB.Scopes(inOrg(orgID)).Order("created_at ASC").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// DeleteSubscription deletes a subscription of an organization and its deliveries
+func DeleteSubscription(orgID, id string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Scopes(inOrg(orgID)).Delete(&Subscription{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Delete(&WebhookDelivery{}, "subscription_id = ?", id).Error
+	})
+}
+
+// CreateWebhookDelivery queues a delivery
+func CreateWebhookDelivery(delivery *WebhookDelivery) error {
+	if delivery.ID == "" {
+		delivery.ID = uuid.New().String()
+	}
+	return DB.Create(delivery).Error
+}
+
+// GetWebhookDeliveryByID retrieves a delivery of an organization by ID
+func GetWebhookDeliveryByID(orgID, id string) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	err := DB.Scopes(inOrg(orgID)).First(&delivery, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// UpdateWebhookDelivery saves the state of a delivery
+func UpdateWebhookDelivery(delivery *WebhookDelivery) error {
+	return DB.Save(delivery).Error
+}
+
+// ClaimPendingDelivery marks the oldest pending delivery that is due as
+// delivering and returns it, or returns nil when none is due. The status check
+// in the update ensures a delivery is only claimed by one worker.
+func ClaimPendingDelivery(now time.Time) (*WebhookDelivery, error) {
+	for {
+		var delivery WebhookDelivery
+		err := DB.Where("status = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)", DeliveryPending, now).
+			Order("created_at ASC").
+			Limit(1).
+			Find(&delivery).Error
+		if err != nil || delivery.ID == "" {
+			return nil, err
+		}
+
+		result := DB.Model(&WebhookDelivery{}).
+			Where("id = ? AND status = ?", delivery.ID, DeliveryPending).
+			Updates(map[string]interface{}{
+				"status":     DeliveryDelivering,
+				"updated_at": now,
+			})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			delivery.Status = DeliveryDelivering
+			return &delivery, nil
+		}
+		// Another worker claimed it first; try the next one
+	}
+}
+
+// ResetInterruptedDeliveries returns deliveries left delivering by a previous
+// process to the pending queue
+func ResetInterruptedDeliveries() error {
+	return DB.Model(&WebhookDelivery{}).Where("status = ?", DeliveryDelivering).
+		Update("status", DeliveryPending).Error
+}
+
+// RedeliverWebhookDelivery returns a dead delivery to the pending queue with a
+// fresh set of attempts. It reports false when the delivery is not dead.
+func RedeliverWebhookDelivery(id string) (bool, error) {
+	result := DB.Model(&WebhookDelivery{}).
+		Where("id = ? AND status = ?", id, DeliveryDead).
+		Updates(map[string]interface{}{
+			"status":          DeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": nil,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// DeliveryFilter selects webhook deliveries of an organization
+type DeliveryFilter struct {
+	OrgID          string
+	SubscriptionID string
+	Status         string
+	Limit          int
+}
+
+// ListWebhookDeliveries retrieves deliveries matching a filter, most recent first
+func ListWebhookDeliveries(filter *DeliveryFilter) ([]WebhookDelivery, error) {
+	db := DB.Scopes(inOrg(filter.OrgID)).Order("created_at DESC").Order("id DESC")
+	if filter.SubscriptionID != "" {
+		db = db.Where("subscription_id = ?", filter.SubscriptionID)
+	}
+	if filter.Status != "" {
+		db = db.Where("status = ?", filter.Status)
+	}
+	if filter.Limit > 0 {
+		db = db.Limit(filter.Limit)
+	}
+
+	var deliveries []WebhookDelivery
+	err := db.Find(&deliveries).Error
+	return deliveries, err
+}
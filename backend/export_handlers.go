@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"scain-backend/services"
+)
+
+// exportContentTypes maps export formats to their MIME types
+var exportContentTypes = map[string]string{
+	services.ExportCSV:  "text/csv; charset=utf-8",
+	services.ExportXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// unsafeFilenameChars matches characters not allowed in export file names
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// exportFSMA204Handler handles the FDA electronic sortable spreadsheet export
+func exportFSMA204Handler(c *gin.Context) {
+	lot := c.Query("lot")
+	format := c.DefaultQuery("format", services.ExportCSV)
+
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid query parameter",
+			Message: "format must be csv or xlsx",
+			Code:    400,
+		})
+		return
+	}
+
+	from, err := parseExportTime(c.Query("from"), false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid query parameter",
+			Message: "from " + err.Error(),
+			Code:    400,
+		})
+		return
+	}
+	to, err := parseExportTime(c.Query("to"), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid query parameter",
+			Message: "to " + err.Error(),
+			Code:    400,
+		})
+		return
+	}
+
+	rows, err := exportService.FSMA204Rows(requestOrg(c), lot, from, to)
+	if err != nil {
+		logger.WithError(err).WithField("lot", lot).Error("Failed to build FSMA 204 export")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to build FSMA 204 export",
+			Code:    500,
+		})
+		return
+	}
+
+	// Render into a buffer so that a failure can still be reported as JSON
+	var buffer bytes.Buffer
+	if format == services.ExportXLSX {
+		err = exportService.WriteFSMA204XLSX(&buffer, rows)
+	} else {
+		err = exportService.WriteFSMA204CSV(&buffer, rows)
+	}
+	if err != nil {
+		logger.WithError(err).WithField("lot", lot).Error("Failed to write FSMA 204 export")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to write FSMA 204 export",
+			Code:    500,
+		})
+		return
+	}
+
+	name := "fsma204"
+	if lot != "" {
+		name += "_" + unsafeFilenameChars.ReplaceAllString(lot, "_")
+	}
+	filename := fmt.Sprintf("%s_%s.%s", name, time.Now().UTC().Format("20060102"), format)
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, contentType, buffer.Bytes())
+}
+
+// parseExportTime parses an optional RFC 3339 timestamp or YYYY-MM-DD date. A
+// date used as an end bound includes the whole day.
+func parseExportTime(value string, end bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return &parsed, nil
+	}
+
+	parsed, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+	}
+	if end {
+		parsed = parsed.AddDate(0, 0, 1)
+	}
+	return &parsed, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"scain-backend/models"
+)
+
+// FSMA204ErrorResponse represents the rejection of events with missing KDEs in strict mode
+type FSMA204ErrorResponse struct {
+	Error   string                `json:"error"`
+	Message string                `json:"message"`
+	Code    int                   `json:"code"`
+	Checks  []models.FSMA204Check `json:"fsma204"`
+}
+
+// checkFSMA204 checks events about to be captured for missing FSMA 204 KDEs. In
+// strict mode it rejects the request and returns false; otherwise it returns the
+// checks to report as warnings.
+func checkFSMA204(c *gin.Context, events []*models.EpcisEvent) ([]models.FSMA204Check, bool) {
+	checks, err := fsmaService.CheckEvents(requestOrg(c), events)
+	if err != nil {
+		logger.WithError(err).Error("Failed to check FSMA 204 KDEs")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to check FSMA 204 KDEs",
+			Code:    500,
+		})
+		return nil, false
+	}
+
+	if len(checks) > 0 && fsmaService.Mode() == models.FSMA204Strict {
+		c.JSON(http.StatusBadRequest, FSMA204ErrorResponse{
+			Error:   "FSMA 204 validation failed",
+			Message: "One or more Critical Tracking Events are missing Key Data Elements",
+			Code:    400,
+			Checks:  checks,
+		})
+		return nil, false
+	}
+
+	return checks, true
+}
+
+// getEventFSMA204Handler handles FSMA 204 classification of a stored event
+func getEventFSMA204Handler(c *gin.Context) {
+	eventID := c.Param("id")
+
+	check, err := fsmaService.CheckStoredEvent(requestOrg(c), eventID)
+	if err != nil {
+		logger.WithError(err).WithField("eventId", eventID).Error("Failed to check FSMA 204 KDEs")
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "Event not found",
+			Message: err.Error(),
+			Code:    404,
+		})
+		return
+	}
+
+	if check == nil {
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"eventId": eventID,
+			"isCTE":   false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"eventId":     eventID,
+		"isCTE":       true,
+		"cte":         check.CTE,
+		"missingKdes": check.MissingKDEs,
+		"compliant":   len(check.MissingKDEs) == 0,
+	})
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"scain-backend/database"
+	"scain-backend/middleware"
+	"scain-backend/services"
+)
+
+const (
+	defaultIngestionsPerPage = 50
+	maxIngestionsPerPage     = 500
+)
+
+// ingestionStatuses lists the processing statuses that can be filtered on
+var ingestionStatuses = map[string]bool{
+	database.IngestionPending:    true,
+	database.IngestionProcessing: true,
+	database.IngestionProcessed:  true,
+	database.IngestionFailed:     true,
+}
+
+// ReplayRequest selects the failed ingestions to replay in bulk
+type ReplayRequest struct {
+	DeviceID string     `json:"deviceId,omitempty"`
+	From     *time.Time `json:"from,omitempty"`
+	To       *time.Time `json:"to,omitempty"`
+}
+
+// listIngestionsHandler handles raw data ingestion listing
+func listIngestionsHandler(c *gin.Context) {
+	filter := &database.IngestionFilter{
+		OrgID:    requestOrg(c),
+		DeviceID: c.Query("deviceId"),
+		Status:   c.Query("status"),
+		Limit:    defaultIngestionsPerPage,
+	}
+
+	if filter.Status != "" && !ingestionStatuses[filter.Status] {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid query parameter",
+			Message: "status must be pending, processing, processed or failed",
+			Code:    400,
+		})
+		return
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(c, "from"); err == nil {
+		filter.To, err = parseTimeParam(c, "to")
+	}
+	if err == nil {
+		filter.Limit, err = parseIntParam(c, "limit", defaultIngestionsPerPage, 1, maxIngestionsPerPage)
+	}
+	if offset := c.Query("offset"); err == nil && offset != "" {
+		if filter.Offset, err = strconv.Atoi(offset); err != nil || filter.Offset < 0 {
+			err = fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid query parameter",
+			Message: err.Error(),
+			Code:    400,
+		})
+		return
+	}
+
+	ingestions, total, err := ingestionService.ListIngestions(filter)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list ingestions")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to list ingestions",
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"ingestions": ingestions,
+		"count":      len(ingestions),
+		"total":      total,
+		"limit":      filter.Limit,
+		"offset":     filter.Offset,
+	})
+}
+
+// getIngestionHandler handles raw data ingestion retrieval
+func getIngestionHandler(c *gin.Context) {
+	ingestionID := c.Param("id")
+
+	ingestion, err := ingestionService.GetIngestion(requestOrg(c), ingestionID)
+	if err != nil {
+		logger.WithError(err).WithField("ingestionId", ingestionID).Error("Failed to retrieve ingestion")
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "Ingestion not found",
+			Message: err.Error(),
+			Code:    404,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ingestion)
+}
+
+// replayIngestionHandler handles replay of a single raw data ingestion
+func replayIngestionHandler(c *gin.Context) {
+	ingestionID := c.Param("id")
+
+	if err := ingestionService.Replay(requestOrg(c), ingestionID); err != nil {
+		if errors.Is(err, services.ErrIngestionBusy) || errors.Is(err, services.ErrIngestionAnchored) {
+			c.JSON(http.StatusConflict, ErrorResponse{
+				Error:   "Replay not possible",
+				Message: err.Error(),
+				Code:    409,
+			})
+			return
+		}
+		logger.WithError(err).WithField("ingestionId", ingestionID).Error("Failed to replay ingestion")
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "Ingestion not found",
+			Message: err.Error(),
+			Code:    404,
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, map[string]interface{}{
+		"status":      "queued",
+		"ingestionId": ingestionID,
+	})
+}
+
+// replayFailedIngestionsHandler handles bulk replay of failed raw data ingestions
+func replayFailedIngestionsHandler(c *gin.Context) {
+	var request ReplayRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationError := middleware.FormatValidationError(err)
+		c.JSON(http.StatusBadRequest, validationError)
+		return
+	}
+
+	count, err := ingestionService.ReplayFailed(&database.IngestionFilter{
+		OrgID:    requestOrg(c),
+		DeviceID: request.DeviceID,
+		From:     request.From,
+		To:       request.To,
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to replay ingestions")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to replay ingestions",
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, map[string]interface{}{
+		"status": "queued",
+		"count":  count,
+	})
+}
+
+// parseIntParam parses an optional integer query parameter within bounds
+func parseIntParam(c *gin.Context, name string, fallback, min, max int) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < min || parsed > max {
+		return 0, fmt.Errorf("%s must be between %d and %d", name, min, max)
+	}
+	return parsed, nil
+}
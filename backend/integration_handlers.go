@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"scain-backend/middleware"
+	"scain-backend/models"
+	"scain-backend/services"
+)
+
+// ttnUplinkHandler handles uplink message webhooks from The Things Stack
+func ttnUplinkHandler(c *gin.Context) {
+	var uplink models.TTNUplink
+	if !bindUplink(c, &uplink) {
+		return
+	}
+
+	payload, err := lorawanService.TTNPayload(&uplink)
+	ingestUplink(c, payload, err)
+}
+
+// chirpStackUplinkHandler handles HTTP integration events from ChirpStack.
+// Events other than uplinks are acknowledged and ignored.
+func chirpStackUplinkHandler(c *gin.Context) {
+	if event := c.Query("event"); event != "" && event != "up" {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	var uplink models.ChirpStackUplink
+	if !bindUplink(c, &uplink) {
+		return
+	}
+
+	payload, err := lorawanService.ChirpStackPayload(&uplink)
+	ingestUplink(c, payload, err)
+}
+
+// bindUplink binds and validates the uplink in the request body, responding
+// with 400 Bad Request when it is invalid
+func bindUplink(c *gin.Context, uplink interface{}) bool {
+	if err := c.ShouldBindJSON(uplink); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.FormatValidationError(err))
+		return false
+	}
+	if err := validate.Struct(uplink); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.FormatValidationError(err))
+		return false
+	}
+	return true
+}
+
+// ingestUplink stores a decoded uplink as a raw data ingestion, the same way
+// POST /api/ingest does. Uplinks without application data are acknowledged
+// without being stored.
+func ingestUplink(c *gin.Context, payload *models.RawIngestPayload, err error) {
+	if err != nil {
+		if errors.Is(err, services.ErrPayloadDecode) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Invalid payload",
+				Message: err.Error(),
+				Code:    400,
+			})
+			return
+		}
+
+		logger.WithError(err).Error("Failed to map LoRaWAN uplink")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to ingest uplink",
+			Code:    500,
+		})
+		return
+	}
+	if payload == nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	ingestion, err := deviceService.ProcessRawDataIngestion(requestOrg(c), payload)
+	if err != nil {
+		if errors.Is(err, services.ErrDeviceOtherOrganization) {
+			c.JSON(http.StatusForbidden, ErrorResponse{
+				Error:   "Forbidden",
+				Message: err.Error(),
+				Code:    403,
+			})
+			return
+		}
+		logger.WithError(err).Error("Failed to process raw data ingestion")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to ingest uplink",
+			Code:    500,
+		})
+		return
+	}
+	ingestionWorker.Notify()
+
+	logger.WithFields(logrus.Fields{
+		"source":      payload.Metadata["source"],
+		"deviceId":    payload.DeviceID,
+		"ingestionId": ingestion.ID,
+	}).Info("LoRaWAN uplink ingested")
+
+	c.JSON(http.StatusAccepted, map[string]interface{}{
+		"status":           "ingested",
+		"ingestionId":      ingestion.ID,
+		"processingStatus": ingestion.ProcessingStatus,
+		"payload":          payload,
+	})
+}
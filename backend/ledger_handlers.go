@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"scain-backend/database"
+	"scain-backend/services"
+)
+
+const (
+	defaultUnanchoredPerPage = 100
+	maxUnanchoredPerPage     = 1000
+)
+
+// ledgerError responds to a failed ledger lookup of an event
+func ledgerError(c *gin.Context, err error, eventID, action string) {
+	switch {
+	case errors.Is(err, services.ErrLedgerDisabled):
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+			Error:   "Ledger disabled",
+			Message: "Events are not anchored on a ledger; see LEDGER_BACKEND",
+			Code:    503,
+		})
+	case errors.Is(err, services.ErrEventNotBatched):
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Error:   "Proof not available",
+			Message: "Event is not in an anchor batch yet; see GET /api/events/unanchored",
+			Code:    409,
+		})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "Event not found",
+			Message: "event not found: " + eventID,
+			Code:    404,
+		})
+	default:
+		logger.WithError(err).WithField("eventId", eventID).Error("Failed to " + action)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to " + action,
+			Code:    500,
+		})
+	}
+}
+
+// verifyEventHandler handles checking a stored event against its ledger anchor
+func verifyEventHandler(c *gin.Context) {
+	eventID := c.Param("id")
+
+	verification, err := epcisService.VerifyEvent(requestOrg(c), eventID)
+	if err != nil {
+		ledgerError(c, err, eventID, "verify event")
+		return
+	}
+
+	c.JSON(http.StatusOK, verification)
+}
+
+// getEventHistoryHandler handles retrieval of the ledger transactions of an event
+func getEventHistoryHandler(c *gin.Context) {
+	eventID := c.Param("id")
+
+	history, err := epcisService.EventHistory(requestOrg(c), eventID)
+	if err != nil {
+		ledgerError(c, err, eventID, "retrieve event history")
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"eventId": eventID,
+		"history": history,
+		"count":   len(history),
+	})
+}
+
+// getEventProofHandler handles retrieval of the Merkle inclusion proof of an event
+func getEventProofHandler(c *gin.Context) {
+	eventID := c.Param("id")
+
+	proof, err := epcisService.EventProof(requestOrg(c), eventID)
+	if err != nil {
+		ledgerError(c, err, eventID, "retrieve event proof")
+		return
+	}
+
+	c.JSON(http.StatusOK, proof)
+}
+
+// listUnanchoredEventsHandler handles retrieval of the events not anchored on the ledger yet
+func listUnanchoredEventsHandler(c *gin.Context) {
+	status := c.Query("status")
+
+	if status != "" && status != database.AnchorPending && status != database.AnchorFailed {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid query parameter",
+			Message: "status must be pending or failed",
+			Code:    400,
+		})
+		return
+	}
+	limit, err := parseIntParam(c, "limit", defaultUnanchoredPerPage, 1, maxUnanchoredPerPage)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid query parameter",
+			Message: err.Error(),
+			Code:    400,
+		})
+		return
+	}
+
+	entries, err := anchorRelay.ListUnanchored(requestOrg(c), status, limit)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list unanchored events")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to list unanchored events",
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"events": entries,
+		"count":  len(entries),
+	})
+}
+
+// anchorEventHandler handles requeueing an event whose anchoring failed
+func anchorEventHandler(c *gin.Context) {
+	eventID := c.Param("id")
+
+	event, err := anchorRelay.Requeue(requestOrg(c), eventID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrAnchorNotFailed):
+			c.JSON(http.StatusConflict, ErrorResponse{
+				Error:   "Anchoring not possible",
+				Message: err.Error(),
+				Code:    409,
+			})
+		case strings.HasPrefix(err.Error(), "event not found"):
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "Event not found",
+				Message: err.Error(),
+				Code:    404,
+			})
+		default:
+			logger.WithError(err).WithField("eventId", eventID).Error("Failed to queue event for anchoring")
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Error:   "Internal server error",
+				Message: "Failed to queue event for anchoring",
+				Code:    500,
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, map[string]interface{}{
+		"status": "queued",
+		"event":  event,
+	})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"os"
 	"os/signal"
@@ -24,6 +25,28 @@ var validate = validator.New()
 // Service instances
 var epcisService *services.EPCISService
 var deviceService *services.DeviceService
+var captureService *services.CaptureService
+var traceService *services.TraceService
+var recallService *services.RecallService
+var organizationService *services.OrganizationService
+var sharingService *services.SharingService
+var fsmaService *services.FSMAService
+var exportService *services.ExportService
+var ingestionWorker *services.IngestionWorker
+var ingestionService *services.IngestionService
+var mqttListener *services.MQTTListener
+var lorawanService *services.LoRaWANService
+var coldChainService *services.ColdChainService
+var alertService *services.AlertService
+var webhookDispatcher *services.WebhookDispatcher
+var anchorRelay *services.AnchorRelay
+var subscriptionService *services.SubscriptionService
+var eventBus *services.EventBus
+var authService *services.AuthService
+var accessPolicy *services.AccessPolicy
+
+// allowedOrigins holds the browser origins allowed by CORS_ORIGINS, nil for any
+var allowedOrigins map[string]bool
 
 // HealthResponse represents the health check response
 type HealthResponse struct {
@@ -63,14 +86,66 @@ func init() {
 		logger.SetLevel(logrus.InfoLevel)
 	}
 
+	// Register EPCIS event-type-specific validation rules
+	validate.RegisterStructValidation(models.ValidateEpcisEvent, models.EpcisEvent{})
+	validate.RegisterStructValidation(models.ValidateColdChainProfileRequest, models.ColdChainProfileRequest{})
+	validate.RegisterStructValidation(models.ValidateSharingAgreementRequest, models.SharingAgreementRequest{})
+	validate.RegisterValidation("payloadcodec", func(fl validator.FieldLevel) bool {
+		_, ok := services.GetPayloadCodec(fl.Field().String())
+		return ok
+	})
+	validate.RegisterValidation("slug", func(fl validator.FieldLevel) bool {
+		return models.IsSlug(fl.Field().String())
+	})
+
 	// Initialize database
 	if err := database.InitDatabase(); err != nil {
 		logger.WithError(err).Fatal("Failed to initialize database")
 	}
 
 	// Initialize services
-	epcisService = services.NewEPCISService()
-	deviceService = services.NewDeviceService()
+	var err error
+	authService = services.NewAuthService()
+	accessPolicy, err = services.NewAccessPolicy()
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to initialize access policy")
+	}
+	eventBus = services.NewEventBus()
+	epcisService, err = services.NewEPCISService()
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to initialize EPCIS service")
+	}
+	anchorRelay = services.NewAnchorRelay(epcisService.Ledger())
+	deviceService = services.NewDeviceService(eventBus)
+	captureService = services.NewCaptureService(epcisService)
+	traceService = services.NewTraceService()
+	recallService = services.NewRecallService(traceService)
+	organizationService = services.NewOrganizationService()
+	sharingService = services.NewSharingService()
+	fsmaService = services.NewFSMAService()
+	exportService = services.NewExportService()
+	ingestionWorker = services.NewIngestionWorker(epcisService)
+	ingestionService = services.NewIngestionService(ingestionWorker)
+	mqttListener = services.NewMQTTListener(deviceService, ingestionWorker, validate)
+	lorawanService = services.NewLoRaWANService()
+	coldChainService = services.NewColdChainService()
+	alertService = services.NewAlertService()
+	webhookDispatcher = services.NewWebhookDispatcher()
+	subscriptionService = services.NewSubscriptionService(webhookDispatcher)
+
+	// Anchor stored events on the ledger
+	epcisService.AddListener(anchorRelay)
+
+	// Check the sensor readings of stored events against cold-chain profiles,
+	// then evaluate alert rules against the readings and excursions
+	epcisService.AddListener(coldChainService)
+	epcisService.AddListener(alertService)
+
+	// Push stored events to the webhook subscriptions they match
+	epcisService.AddListener(subscriptionService)
+
+	// Stream stored events to live clients
+	epcisService.AddListener(eventBus)
 }
 
 // healthHandler handles the health check endpoint
@@ -92,11 +167,65 @@ func apiHandler(c *gin.Context) {
 			"GET /health - Health check",
 			"GET /api - API information",
 			"POST /api/events - Create EPCIS event",
+			"GET /api/events - Query EPCIS events",
 			"GET /api/events/{id} - Get EPCIS event",
+			"GET /api/events/{id}/fsma204 - FSMA 204 CTE classification and missing KDEs",
+			"GET /api/events/{id}/verify - Verify event against its ledger anchor",
+			"GET /api/events/{id}/history - Ledger transactions of an event",
+			"GET /api/events/{id}/proof - Merkle inclusion proof of an event in its anchor batch",
+			"GET /api/events/unanchored - Events not anchored on the ledger yet",
+			"POST /api/events/{id}/anchor - Retry anchoring of an event that failed",
+			"POST /api/capture - Capture EPCIS document",
+			"GET /api/capture/{id} - Get capture job status",
+			"GET /api/trace/{lotOrEpc} - Trace lot genealogy",
+			"POST /api/recall-drills - Run recall drill",
+			"GET /api/recall-drills - List recall drills",
+			"GET /api/recall-drills/{id} - Get recall drill report",
+			"GET /api/exports/fsma204 - FDA sortable spreadsheet export (CSV or XLSX)",
+			"POST /api/cold-chain/profiles - Create cold-chain profile",
+			"GET /api/cold-chain/profiles - List cold-chain profiles",
+			"GET /api/cold-chain/profiles/{id} - Get cold-chain profile",
+			"DELETE /api/cold-chain/profiles/{id} - Delete cold-chain profile",
+			"GET /api/lots/{lotCode}/excursions - List temperature and humidity excursions of a lot",
+			"GET /api/lots/{lotCode}/cold-chain - Lot temperature summary, MKT and remaining shelf life",
+			"GET /api/alerts - List alerts",
+			"GET /api/alerts/{id} - Get alert",
+			"POST /api/alerts/{id}/acknowledge - Acknowledge alert",
+			"POST /api/alerts/{id}/resolve - Resolve alert",
+			"GET /api/alerts/rules - Alert rules and notifiers in effect",
+			"POST /api/alerts/notifiers/{name}/test - Send test notification",
+			"POST /api/subscriptions - Create webhook subscription",
+			"GET /api/subscriptions - List webhook subscriptions",
+			"GET /api/subscriptions/{id} - Get webhook subscription",
+			"DELETE /api/subscriptions/{id} - Delete webhook subscription",
+			"GET /api/subscriptions/{id}/deliveries - Delivery log of a subscription",
+			"POST /api/subscriptions/{id}/deliveries/{deliveryId}/redeliver - Redeliver dead-lettered delivery",
+			"GET /api/subscriptions/dead-letters - Deliveries given up after their last attempt",
+			"GET /api/stream/events - Live events and device heartbeats (Server-Sent Events)",
+			"GET /api/stream/ws - Live events and device heartbeats (WebSocket)",
 			"POST /api/devices - Register device",
 			"GET /api/devices/{deviceId} - Get device info",
 			"POST /api/ingest - Raw device data ingestion",
-			"POST /api/claim - Claim device with code",
+			"GET /api/ingestions - List raw data ingestions",
+			"GET /api/ingestions/{id} - Get raw data ingestion and derived events",
+			"POST /api/ingestions/{id}/replay - Replay raw data ingestion",
+			"POST /api/ingestions/replay - Replay failed raw data ingestions",
+			"POST /api/integrations/ttn - The Things Stack uplink webhook",
+			"POST /api/integrations/chirpstack - ChirpStack uplink webhook",
+			"POST /api/claim - Claim device with code, issuing its API key",
+			"POST /api/claim-codes - Issue device claim codes",
+			"GET /api/auth/me - Authenticated caller and its permissions",
+			"GET /api/auth/roles - Roles of the access policy",
+			"POST /api/auth/api-keys - Issue integration API key",
+			"GET /api/auth/api-keys - List API keys",
+			"DELETE /api/auth/api-keys/{id} - Revoke API key",
+			"POST /api/organizations - Create organization",
+			"GET /api/organizations - List organizations",
+			"GET /api/organizations/current - Organization of the caller",
+			"POST /api/sharing-agreements - Share events with a partner organization",
+			"GET /api/sharing-agreements - List sharing agreements granted and received",
+			"GET /api/sharing-agreements/{id} - Get sharing agreement",
+			"DELETE /api/sharing-agreements/{id} - Revoke sharing agreement",
 		},
 	}
 	c.JSON(http.StatusOK, response)
@@ -112,6 +241,8 @@ func createEventHandler(c *gin.Context) {
 		return
 	}
 	
+	event.NormalizeCBV()
+	
 	// Validate the event
 	if err := validate.Struct(&event); err != nil {
 		validationError := middleware.FormatValidationError(err)
@@ -119,8 +250,14 @@ func createEventHandler(c *gin.Context) {
 		return
 	}
 	
+	// Check FSMA 204 KDEs; strict mode rejects the event
+	fsmaWarnings, ok := checkFSMA204(c, []*models.EpcisEvent{&event})
+	if !ok {
+		return
+	}
+	
 	// Create event using service
-	dbEvent, err := epcisService.CreateEvent(&event)
+	dbEvent, err := epcisService.CreateEvent(requestOrg(c), &event)
 	if err != nil {
 		logger.WithError(err).Error("Failed to create EPCIS event")
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
@@ -143,6 +280,9 @@ func createEventHandler(c *gin.Context) {
 		"hash":    dbEvent.Hash,
 		"event":   event,
 	}
+	if len(fsmaWarnings) > 0 {
+		response["fsma204Warnings"] = fsmaWarnings
+	}
 	
 	c.JSON(http.StatusCreated, response)
 }
@@ -161,7 +301,7 @@ func getEventHandler(c *gin.Context) {
 	}
 	
 	// Retrieve event using service
-	event, err := epcisService.GetEvent(eventId)
+	event, err := epcisService.GetEvent(requestOrg(c), eventId)
 	if err != nil {
 		logger.WithError(err).WithField("eventId", eventId).Error("Failed to retrieve event")
 		c.JSON(http.StatusNotFound, ErrorResponse{
@@ -198,12 +338,12 @@ func registerDeviceHandler(c *gin.Context) {
 	}
 	
 	// Register device using service
-	dbDevice, err := deviceService.RegisterDevice(&device)
+	dbDevice, err := deviceService.RegisterDevice(requestOrg(c), &device)
 	if err != nil {
 		logger.WithError(err).Error("Failed to register device")
 		
 		// Check if device already exists
-		if err.Error() == "device with ID "+device.DeviceID+" already exists" {
+		if errors.Is(err, services.ErrDeviceAlreadyRegistered) {
 			c.JSON(http.StatusConflict, ErrorResponse{
 				Error:   "Device already exists",
 				Message: err.Error(),
@@ -247,7 +387,7 @@ func getDeviceHandler(c *gin.Context) {
 	}
 	
 	// Retrieve device using service
-	device, err := deviceService.GetDevice(deviceId)
+	device, err := deviceService.GetDevice(requestOrg(c), deviceId)
 	if err != nil {
 		logger.WithError(err).WithField("deviceId", deviceId).Error("Failed to retrieve device")
 		c.JSON(http.StatusNotFound, ErrorResponse{
@@ -283,9 +423,27 @@ func ingestRawDataHandler(c *gin.Context) {
 		return
 	}
 	
+	// Devices may only report their own data
+	if principal := middleware.GetPrincipal(c); principal != nil && principal.Type == models.PrincipalDevice && principal.DeviceID != payload.DeviceID {
+		c.JSON(http.StatusForbidden, ErrorResponse{
+			Error:   "Forbidden",
+			Message: "Device API keys may only ingest data of their own device",
+			Code:    403,
+		})
+		return
+	}
+	
 	// Store raw data using service
-	ingestion, err := deviceService.ProcessRawDataIngestion(&payload)
+	ingestion, err := deviceService.ProcessRawDataIngestion(requestOrg(c), &payload)
 	if err != nil {
+		if errors.Is(err, services.ErrDeviceOtherOrganization) {
+			c.JSON(http.StatusForbidden, ErrorResponse{
+				Error:   "Forbidden",
+				Message: err.Error(),
+				Code:    403,
+			})
+			return
+		}
 		logger.WithError(err).Error("Failed to process raw data ingestion")
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Error:   "Internal server error",
@@ -295,31 +453,8 @@ func ingestRawDataHandler(c *gin.Context) {
 		return
 	}
 	
-	// Transform raw data to EPCIS events
-	events, err := epcisService.TransformRawData(&payload)
-	if err != nil {
-		logger.WithError(err).Error("Failed to transform raw data to EPCIS events")
-		// Don't fail the request, just log the error
-	} else {
-		// Create EPCIS events
-		var createdEvents []string
-		for _, event := range events {
-			dbEvent, eventErr := epcisService.CreateEvent(event)
-			if eventErr != nil {
-				logger.WithError(eventErr).Error("Failed to create EPCIS event from raw data")
-				continue
-			}
-			createdEvents = append(createdEvents, dbEvent.ID)
-		}
-		
-		logger.WithFields(logrus.Fields{
-			"ingestionId":  ingestion.ID,
-			"deviceType":   payload.DeviceType,
-			"deviceId":     payload.DeviceID,
-			"eventCount":   len(createdEvents),
-			"createdEvents": createdEvents,
-		}).Info("Raw data processed and EPCIS events created")
-	}
+	// Transformation happens in the background; wake a worker to pick it up
+	ingestionWorker.Notify()
 	
 	logger.WithFields(logrus.Fields{
 		"deviceType": payload.DeviceType,
@@ -328,9 +463,10 @@ func ingestRawDataHandler(c *gin.Context) {
 	}).Info("Raw data ingested")
 	
 	response := map[string]interface{}{
-		"status":      "ingested",
-		"ingestionId": ingestion.ID,
-		"payload":     payload,
+		"status":           "ingested",
+		"ingestionId":      ingestion.ID,
+		"processingStatus": ingestion.ProcessingStatus,
+		"payload":          payload,
 	}
 	
 	c.JSON(http.StatusAccepted, response)
@@ -354,7 +490,7 @@ func claimDeviceHandler(c *gin.Context) {
 	}
 	
 	// Claim device using service
-	device, err := deviceService.ClaimDevice(&claimCode)
+	device, apiKey, err := deviceService.ClaimDevice(&claimCode)
 	if err != nil {
 		logger.WithError(err).Error("Failed to claim device")
 		c.JSON(http.StatusBadRequest, ErrorResponse{
@@ -375,11 +511,46 @@ func claimDeviceHandler(c *gin.Context) {
 		"status":   "claimed",
 		"deviceId": device.DeviceID,
 		"device":   device,
+		"apiKey":   apiKey, // shown once
 	}
 	
 	c.JSON(http.StatusOK, response)
 }
 
+// issueClaimCodesHandler handles issuing device claim codes
+func issueClaimCodesHandler(c *gin.Context) {
+	var request models.ClaimCodeRequest
+	
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationError := middleware.FormatValidationError(err)
+		c.JSON(http.StatusBadRequest, validationError)
+		return
+	}
+	
+	if err := validate.Struct(&request); err != nil {
+		validationError := middleware.FormatValidationError(err)
+		c.JSON(http.StatusBadRequest, validationError)
+		return
+	}
+	
+	claimCodes, err := deviceService.GenerateClaimCodes(requestOrg(c), request.Type, request.Count, request.ExpiresHours)
+	if err != nil {
+		logger.WithError(err).Error("Failed to issue claim codes")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to issue claim codes",
+			Code:    500,
+		})
+		return
+	}
+	
+	c.JSON(http.StatusCreated, map[string]interface{}{
+		"status":     "created",
+		"claimCodes": claimCodes,
+		"count":      len(claimCodes),
+	})
+}
+
 func setupRoutes(r *gin.Engine) {
 	// Add global middleware
 	r.Use(middleware.ContentTypeMiddleware())
@@ -391,22 +562,109 @@ func setupRoutes(r *gin.Engine) {
 	// API info endpoint
 	r.GET("/api", apiHandler)
 
-	// API routes group
+	// API routes group; routes require the permission they are registered
+	// with, except claiming a device, which the claim code authorizes. Only
+	// the live streams take a token from the query string.
+	enforce := authEnforced()
+	can := func(permission string) gin.HandlerFunc {
+		return middleware.RequirePermission(accessPolicy, enforce, permission)
+	}
 	api := r.Group("/api")
+	api.Use(middleware.AuthMiddleware(authService, enforce,
+		[]string{"/api/claim"},
+		[]string{"/api/stream/events", "/api/stream/ws"}))
 	{
 		// EPCIS Events
-		api.POST("/events", createEventHandler)
-		api.GET("/events/:id", getEventHandler)
+		api.POST("/events", can(services.PermEventsWrite), createEventHandler)
+		api.GET("/events", can(services.PermEventsRead), queryEventsHandler)
+		api.GET("/events/:id", can(services.PermEventsRead), getEventHandler)
+		api.GET("/events/:id/fsma204", can(services.PermEventsRead), getEventFSMA204Handler)
+		api.GET("/events/:id/verify", can(services.PermEventsVerify), verifyEventHandler)
+		api.GET("/events/:id/history", can(services.PermEventsVerify), getEventHistoryHandler)
+		api.GET("/events/:id/proof", can(services.PermEventsVerify), getEventProofHandler)
+		api.GET("/events/unanchored", can(services.PermEventsVerify), listUnanchoredEventsHandler)
+		api.POST("/events/:id/anchor", can(services.PermEventsWrite), anchorEventHandler)
+		
+		// EPCIS Capture
+		api.POST("/capture", can(services.PermEventsWrite), captureHandler)
+		api.GET("/capture/:id", can(services.PermEventsRead), getCaptureJobHandler)
+		
+		// Traceability
+		api.GET("/trace/:id", can(services.PermEventsRead), traceHandler)
+		
+		// Recall Drills
+		api.POST("/recall-drills", can(services.PermRecallsRun), createRecallDrillHandler)
+		api.GET("/recall-drills", can(services.PermRecallsRead), listRecallDrillsHandler)
+		api.GET("/recall-drills/:id", can(services.PermRecallsRead), getRecallDrillHandler)
+		
+		// Regulatory Exports
+		api.GET("/exports/fsma204", can(services.PermExportsRun), exportFSMA204Handler)
+		
+		// Cold Chain Monitoring
+		api.POST("/cold-chain/profiles", can(services.PermColdChainManage), createColdChainProfileHandler)
+		api.GET("/cold-chain/profiles", can(services.PermColdChainRead), listColdChainProfilesHandler)
+		api.GET("/cold-chain/profiles/:id", can(services.PermColdChainRead), getColdChainProfileHandler)
+		api.DELETE("/cold-chain/profiles/:id", can(services.PermColdChainManage), deleteColdChainProfileHandler)
+		api.GET("/lots/:lotCode/excursions", can(services.PermColdChainRead), listLotExcursionsHandler)
+		api.GET("/lots/:lotCode/cold-chain", can(services.PermColdChainRead), getLotColdChainHandler)
+		
+		// Alerting
+		api.GET("/alerts", can(services.PermAlertsRead), listAlertsHandler)
+		api.GET("/alerts/rules", can(services.PermAlertsRead), listAlertRulesHandler)
+		api.GET("/alerts/:id", can(services.PermAlertsRead), getAlertHandler)
+		api.POST("/alerts/:id/acknowledge", can(services.PermAlertsManage), acknowledgeAlertHandler)
+		api.POST("/alerts/:id/resolve", can(services.PermAlertsManage), resolveAlertHandler)
+		api.POST("/alerts/notifiers/:name/test", can(services.PermAlertsManage), testNotifierHandler)
+		
+		// Webhook Subscriptions
+		api.POST("/subscriptions", can(services.PermSubscriptionsManage), createSubscriptionHandler)
+		api.GET("/subscriptions", can(services.PermSubscriptionsRead), listSubscriptionsHandler)
+		api.GET("/subscriptions/dead-letters", can(services.PermSubscriptionsRead), listDeadLettersHandler)
+		api.GET("/subscriptions/:id", can(services.PermSubscriptionsRead), getSubscriptionHandler)
+		api.DELETE("/subscriptions/:id", can(services.PermSubscriptionsManage), deleteSubscriptionHandler)
+		api.GET("/subscriptions/:id/deliveries", can(services.PermSubscriptionsRead), listDeliveriesHandler)
+		api.POST("/subscriptions/:id/deliveries/:deliveryId/redeliver", can(services.PermSubscriptionsManage), redeliverHandler)
+		
+		// Live Streams
+		api.GET("/stream/events", can(services.PermEventsRead), streamEventsHandler)
+		api.GET("/stream/ws", can(services.PermEventsRead), streamEventsWebSocketHandler)
 		
 		// Device Management
-		api.POST("/devices", registerDeviceHandler)
-		api.GET("/devices/:deviceId", getDeviceHandler)
+		api.POST("/devices", can(services.PermDevicesManage), registerDeviceHandler)
+		api.GET("/devices/:deviceId", can(services.PermDevicesRead), getDeviceHandler)
 		
 		// Data Ingestion
-		api.POST("/ingest", ingestRawDataHandler)
+		api.POST("/ingest", can(services.PermIngestWrite), ingestRawDataHandler)
+		api.GET("/ingestions", can(services.PermIngestionsRead), listIngestionsHandler)
+		api.GET("/ingestions/:id", can(services.PermIngestionsRead), getIngestionHandler)
+		api.POST("/ingestions/:id/replay", can(services.PermIngestionsReplay), replayIngestionHandler)
+		api.POST("/ingestions/replay", can(services.PermIngestionsReplay), replayFailedIngestionsHandler)
+		
+		// LoRaWAN Network Server Integrations
+		api.POST("/integrations/ttn", can(services.PermIngestWrite), ttnUplinkHandler)
+		api.POST("/integrations/chirpstack", can(services.PermIngestWrite), chirpStackUplinkHandler)
 		
 		// Device Claiming
 		api.POST("/claim", claimDeviceHandler)
+		api.POST("/claim-codes", can(services.PermClaimCodesIssue), issueClaimCodesHandler)
+		
+		// Authentication
+		api.GET("/auth/me", getPrincipalHandler)
+		api.GET("/auth/roles", can(services.PermAPIKeysManage), listRolesHandler)
+		api.POST("/auth/api-keys", can(services.PermAPIKeysManage), createAPIKeyHandler)
+		api.GET("/auth/api-keys", can(services.PermAPIKeysManage), listAPIKeysHandler)
+		api.DELETE("/auth/api-keys/:id", can(services.PermAPIKeysManage), revokeAPIKeyHandler)
+		
+		// Organizations
+		api.POST("/organizations", can(services.PermOrgsManage), createOrganizationHandler)
+		api.GET("/organizations", can(services.PermOrgsManage), listOrganizationsHandler)
+		api.GET("/organizations/current", getCurrentOrganizationHandler)
+		
+		// Sharing Agreements
+		api.POST("/sharing-agreements", can(services.PermSharingManage), createSharingAgreementHandler)
+		api.GET("/sharing-agreements", can(services.PermSharingRead), listSharingAgreementsHandler)
+		api.GET("/sharing-agreements/:id", can(services.PermSharingRead), getSharingAgreementHandler)
+		api.DELETE("/sharing-agreements/:id", can(services.PermSharingManage), revokeSharingAgreementHandler)
 	}
 }
 
@@ -420,14 +678,21 @@ func main() {
 	r := gin.New()
 
 	// Add middleware
-	r.Use(gin.Logger())
+	r.Use(middleware.RequestLogger())
 	r.Use(gin.Recovery())
 
-	// CORS middleware
+	// CORS middleware; only the origins CORS_ORIGINS lists are allowed, or
+	// every origin in development when it is unset
+	allowedOrigins = corsOrigins()
 	r.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
+		if allowedOrigins == nil {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else if origin := c.GetHeader("Origin"); allowedOrigins[origin] {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Vary", "Origin")
+		}
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, Last-Event-ID")
 		
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusNoContent)
@@ -440,6 +705,21 @@ func main() {
 	// Setup routes
 	setupRoutes(r)
 
+	// Start background processing of raw data ingestions
+	ingestionWorker.Start()
+
+	// Start ingesting device telemetry from the MQTT broker, if configured
+	mqttListener.Start()
+
+	// Start checking device state and escalating alerts
+	alertService.Start()
+
+	// Start delivering events to webhook subscriptions
+	webhookDispatcher.Start()
+
+	// Start anchoring stored events on the ledger
+	anchorRelay.Start()
+
 	// Get port and host from environment
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -471,6 +751,13 @@ func main() {
 	<-quit
 	
 	logger.Info("Shutting down server...")
-	// Add graceful shutdown logic here if needed
+	mqttListener.Stop()
+	ingestionWorker.Stop()
+	alertService.Stop()
+	webhookDispatcher.Stop()
+	anchorRelay.Stop()
+	if err := epcisService.Close(); err != nil {
+		logger.WithError(err).Warn("Failed to close ledger")
+	}
 	logger.Info("Server shutdown complete")
 } 
\ No newline at end of file
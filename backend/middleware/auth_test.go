@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"scain-backend/models"
+)
+
+// tokenAuthenticator accepts a single credential
+type tokenAuthenticator string
+
+func (a tokenAuthenticator) Authenticate(credential string) (*models.Principal, error) {
+	if credential != string(a) {
+		return nil, errors.New("invalid credential")
+	}
+	return &models.Principal{Type: "user", ID: "user-1"}, nil
+}
+
+// testRouter serves the ID of the principal of a request on a plain and a
+// stream route, or "anonymous"
+func testRouter(output *bytes.Buffer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if output != nil {
+		gin.DefaultWriter = output
+		r.Use(RequestLogger())
+	}
+	api := r.Group("/api")
+	api.Use(AuthMiddleware(tokenAuthenticator("secret-token"), true, nil, []string{"/api/stream/events"}))
+	whoami := func(c *gin.Context) {
+		if principal := GetPrincipal(c); principal != nil {
+			c.String(http.StatusOK, principal.ID)
+			return
+		}
+		c.String(http.StatusOK, "anonymous")
+	}
+	api.GET("/events", whoami)
+	api.GET("/stream/events", whoami)
+	return r
+}
+
+func TestAuthMiddlewareQueryToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		header string
+		want   string
+	}{
+		{"header on a plain route", "/api/events", "Bearer secret-token", "user-1"},
+		{"query on a stream route", "/api/stream/events?access_token=secret-token", "", "user-1"},
+		{"query on a plain route is ignored", "/api/events?access_token=secret-token", "", "anonymous"},
+		{"header wins over query", "/api/stream/events?access_token=other", "Bearer secret-token", "user-1"},
+	}
+	router := testRouter(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				request.Header.Set("Authorization", tt.header)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != http.StatusOK || recorder.Body.String() != tt.want {
+				t.Errorf("got %d %q, want 200 %q", recorder.Code, recorder.Body.String(), tt.want)
+			}
+		})
+	}
+
+	// An invalid query token on a stream route is rejected like any credential
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/stream/events?access_token=other", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("invalid query token: got %d, want 401", recorder.Code)
+	}
+}
+
+func TestRequestLoggerOmitsQuery(t *testing.T) {
+	writer := gin.DefaultWriter
+	defer func() { gin.DefaultWriter = writer }()
+
+	var output bytes.Buffer
+	router := testRouter(&output)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/stream/events?access_token=secret-token", nil))
+
+	logged := output.String()
+	if !strings.Contains(logged, "/api/stream/events") {
+		t.Errorf("log %q does not contain the path", logged)
+	}
+	if strings.Contains(logged, "secret-token") || strings.Contains(logged, "access_token") {
+		t.Errorf("log %q contains the query", logged)
+	}
+}
@@ -43,6 +43,8 @@ func FormatValidationError(err error) ValidationErrorResponse {
 				response.Details[field] = "Value is too short or too small"
 			case "max":
 				response.Details[field] = "Value is too long or too large"
+			case "http_url":
+				response.Details[field] = "Must be an HTTP or HTTPS URL"
 			case "email":
 				response.Details[field] = "Invalid email format"
 			case "oneof":
@@ -51,6 +53,28 @@ func FormatValidationError(err error) ValidationErrorResponse {
 				response.Details[field] = "Must contain only letters and numbers"
 			case "len":
 				response.Details[field] = "Invalid length"
+			case "hexadecimal":
+				response.Details[field] = "Must be a hexadecimal value"
+			case "payloadcodec":
+				response.Details[field] = "Unknown payload codec"
+			case "slug":
+				response.Details[field] = "Must be lowercase letters and digits, separated by single hyphens"
+			case "required_for":
+				response.Details[field] = "This field is required for " + fieldError.Param()
+			case "not_allowed_for":
+				response.Details[field] = "This field is not allowed for " + fieldError.Param()
+			case "required_one_of":
+				response.Details[field] = "One of these fields is required: " + strings.Join(strings.Fields(fieldError.Param()), ", ")
+			case "required_with":
+				response.Details[field] = "This field is required with " + strings.ToLower(fieldError.Param())
+			case "gt":
+				response.Details[field] = "Value must be greater than " + fieldError.Param()
+			case "excluded_with":
+				response.Details[field] = "This field cannot be combined with " + fieldError.Param()
+			case "gtefield":
+				response.Details[field] = "Must not be less than " + fieldError.Param()
+			case "future":
+				response.Details[field] = "Must be in the future"
 			default:
 				response.Details[field] = "Invalid value"
 			}
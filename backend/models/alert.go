@@ -0,0 +1,6 @@
+package models
+
+// AlertActionRequest represents a request to acknowledge or resolve an alert
+type AlertActionRequest struct {
+	By string `json:"by" validate:"required"`
+}
@@ -0,0 +1,24 @@
+package models
+
+// Principal types
+const (
+	PrincipalDevice      = "device"
+	PrincipalIntegration = "integration"
+	PrincipalUser        = "user"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Type     string   `json:"type"`
+	ID       string   `json:"id"` // API key ID, or the subject of a user token
+	OrgID    string   `json:"orgId"`
+	Name     string   `json:"name,omitempty"`
+	Email    string   `json:"email,omitempty"`
+	DeviceID string   `json:"deviceId,omitempty"` // set for devices
+	Roles    []string `json:"roles,omitempty"`    // from the roles claim of a user token, or the principal type of an API key
+}
+
+// APIKeyRequest represents a request to issue an integration API key
+type APIKeyRequest struct {
+	Name string `json:"name" validate:"required"`
+}
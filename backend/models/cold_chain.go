@@ -0,0 +1,110 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Shelf-life decay models
+const (
+	DecayModelQ10       = "q10"
+	DecayModelArrhenius = "arrhenius"
+)
+
+// TagExcludedWith is reported when two fields that exclude each other are both set
+const TagExcludedWith = "excluded_with"
+
+// ColdChainProfileRequest represents a request to create the cold-chain
+// profile of a lot, or of a product identified by an EPC or EPC class prefix
+// such as urn:epc:class:lgtin:4012345.012345. Temperatures are in degrees
+// Celsius and humidity in percent relative humidity. A decay model estimates
+// the remaining shelf life from the temperature history: the shelf life at the
+// reference temperature shortens by a factor of Q10 per 10 degrees warmer, or
+// per the Arrhenius equation with an activation energy in kJ/mol.
+type ColdChainProfileRequest struct {
+	Name                    string   `json:"name" validate:"required"`
+	LotCode                 *string  `json:"lotCode,omitempty"`
+	Product                 *string  `json:"product,omitempty"`
+	MinTemperature          *float64 `json:"minTemperature,omitempty"`
+	MaxTemperature          *float64 `json:"maxTemperature,omitempty"`
+	MinHumidity             *float64 `json:"minHumidity,omitempty" validate:"omitempty,min=0,max=100"`
+	MaxHumidity             *float64 `json:"maxHumidity,omitempty" validate:"omitempty,min=0,max=100"`
+	AllowedExcursionMinutes int      `json:"allowedExcursionMinutes" validate:"min=0"`
+	DecayModel              *string  `json:"decayModel,omitempty" validate:"omitempty,oneof=q10 arrhenius"`
+	ShelfLifeHours          *float64 `json:"shelfLifeHours,omitempty" validate:"required_with=DecayModel,omitempty,gt=0"`
+	ReferenceTemperature    *float64 `json:"referenceTemperature,omitempty" validate:"required_with=DecayModel"`
+	Q10                     *float64 `json:"q10,omitempty" validate:"omitempty,gt=1"`
+	ActivationEnergy        *float64 `json:"activationEnergy,omitempty" validate:"omitempty,gt=0"`
+}
+
+// ColdChainSummary represents the temperature history of a lot across every
+// device that reported on it. Each reading holds until the next one, so
+// statistics are weighted by time.
+type ColdChainSummary struct {
+	LotCode                string             `json:"lotCode"`
+	ProfileID              *string            `json:"profileId,omitempty"`
+	Readings               int                `json:"readings"`
+	Devices                []string           `json:"devices"`
+	From                   *time.Time         `json:"from,omitempty"`
+	To                     *time.Time         `json:"to,omitempty"`
+	MinTemperature         *float64           `json:"minTemperature,omitempty"`
+	MaxTemperature         *float64           `json:"maxTemperature,omitempty"`
+	AvgTemperature         *float64           `json:"avgTemperature,omitempty"`
+	MeanKineticTemperature *float64           `json:"meanKineticTemperature,omitempty"`
+	Threshold              *float64           `json:"threshold,omitempty"`
+	MinutesAboveThreshold  *float64           `json:"minutesAboveThreshold,omitempty"`
+	ShelfLife              *ShelfLifeEstimate `json:"shelfLife,omitempty"`
+}
+
+// ShelfLifeEstimate represents the shelf life a lot has left according to the
+// decay model of its profile
+type ShelfLifeEstimate struct {
+	Model                string    `json:"model"`
+	ShelfLifeHours       float64   `json:"shelfLifeHours"`       // at the reference temperature
+	ReferenceTemperature float64   `json:"referenceTemperature"` // CEL
+	ConsumedHours        float64   `json:"consumedHours"`        // in hours at the reference temperature
+	RemainingHours       float64   `json:"remainingHours"`       // at the last recorded temperature
+	RemainingPct         float64   `json:"remainingPct"`
+	PredictedExpiry      time.Time `json:"predictedExpiry"`
+	Expired              bool      `json:"expired"`
+}
+
+// ValidateColdChainProfileRequest checks that a profile applies to either a lot
+// or a product, has a consistent range and the parameters of its decay model. Register it with
+// validator.RegisterStructValidation for ColdChainProfileRequest.
+func ValidateColdChainProfileRequest(sl validator.StructLevel) {
+	request := sl.Current().Interface().(ColdChainProfileRequest)
+
+	if request.LotCode == nil && request.Product == nil {
+		sl.ReportError(request.LotCode, "lotCode", "LotCode", TagRequiredOneOf, "lotCode product")
+	}
+	if request.LotCode != nil && request.Product != nil {
+		sl.ReportError(request.Product, "product", "Product", TagExcludedWith, "lotCode")
+	}
+
+	if request.MinTemperature == nil && request.MaxTemperature == nil &&
+		request.MinHumidity == nil && request.MaxHumidity == nil && request.DecayModel == nil {
+		sl.ReportError(request.MinTemperature, "minTemperature", "MinTemperature", TagRequiredOneOf,
+			"minTemperature maxTemperature minHumidity maxHumidity decayModel")
+	}
+	if request.MinTemperature != nil && request.MaxTemperature != nil && *request.MaxTemperature < *request.MinTemperature {
+		sl.ReportError(request.MaxTemperature, "maxTemperature", "MaxTemperature", "gtefield", "minTemperature")
+	}
+	if request.MinHumidity != nil && request.MaxHumidity != nil && *request.MaxHumidity < *request.MinHumidity {
+		sl.ReportError(request.MaxHumidity, "maxHumidity", "MaxHumidity", "gtefield", "minHumidity")
+	}
+
+	if request.DecayModel != nil {
+		switch *request.DecayModel {
+		case DecayModelQ10:
+			if request.Q10 == nil {
+				sl.ReportError(request.Q10, "q10", "Q10", TagRequiredFor, DecayModelQ10)
+			}
+		case DecayModelArrhenius:
+			if request.ActivationEnergy == nil {
+				sl.ReportError(request.ActivationEnergy, "activationEnergy", "ActivationEnergy", TagRequiredFor, DecayModelArrhenius)
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// EPCISDocument represents an EPCIS 2.0 capture document
+type EPCISDocument struct {
+	Context       interface{}  `json:"@context" validate:"required"`
+	Type          string       `json:"type" validate:"required,eq=EPCISDocument"`
+	SchemaVersion string       `json:"schemaVersion" validate:"required,startswith=2."`
+	CreationDate  time.Time    `json:"creationDate" validate:"required"`
+	EPCISHeader   *EPCISHeader `json:"epcisHeader,omitempty"`
+	EPCISBody     EPCISBody    `json:"epcisBody" validate:"required"`
+}
+
+// EPCISHeader represents the optional header of an EPCIS document
+type EPCISHeader struct {
+	EPCISMasterData *EPCISMasterData `json:"epcisMasterData,omitempty"`
+}
+
+// EPCISMasterData holds master data vocabularies sent with a document
+type EPCISMasterData struct {
+	VocabularyList []Vocabulary `json:"vocabularyList" validate:"dive"`
+}
+
+// Vocabulary represents a master data vocabulary such as locations or products
+type Vocabulary struct {
+	Type                  string              `json:"type" validate:"required"`
+	VocabularyElementList []VocabularyElement `json:"vocabularyElementList" validate:"dive"`
+}
+
+// VocabularyElement represents a single master data element and its attributes
+type VocabularyElement struct {
+	ID         string                `json:"id" validate:"required"`
+	Attributes []VocabularyAttribute `json:"attributes,omitempty"`
+}
+
+// VocabularyAttribute represents a master data attribute
+type VocabularyAttribute struct {
+	ID        string      `json:"id" validate:"required"`
+	Attribute interface{} `json:"attribute"`
+}
+
+// EPCISBody holds the events of an EPCIS document
+type EPCISBody struct {
+	EventList []EpcisEvent `json:"eventList" validate:"required,min=1,dive"`
+}
+
+// CaptureJobStatus represents the status of a capture job as defined by the
+// EPCIS 2.0 capture interface
+type CaptureJobStatus struct {
+	CaptureID             string         `json:"captureID"`
+	CreatedAt             time.Time      `json:"createdAt"`
+	FinishedAt            *time.Time     `json:"finishedAt,omitempty"`
+	Running               bool           `json:"running"`
+	Success               bool           `json:"success"`
+	CaptureErrorBehaviour string         `json:"captureErrorBehaviour"`
+	Errors                []string       `json:"errors"`
+	EventCount            int            `json:"eventCount"`
+	EventIDs              []string       `json:"eventIds,omitempty"`
+	Warnings              []FSMA204Check `json:"fsma204Warnings,omitempty"`
+}
+
+// UnmarshalJSON accepts both a bare EPCISDocument and one wrapped in an
+// "epcis" envelope
+func (d *EPCISDocument) UnmarshalJSON(data []byte) error {
+	type document EPCISDocument
+
+	var envelope struct {
+		EPCIS json.RawMessage `json:"epcis"`
+	}
+	if err := json.Unmarshal(data, &envelope); err == nil && len(envelope.EPCIS) > 0 {
+		data = envelope.EPCIS
+	}
+
+	return json.Unmarshal(data, (*document)(d))
+}
+
+// UnmarshalJSON accepts the EPCIS 2.0 JSON-LD "type" member as an alias for eventType
+func (e *EpcisEvent) UnmarshalJSON(data []byte) error {
+	type event EpcisEvent
+
+	aux := struct {
+		*event
+		Type EventType `json:"type"`
+	}{event: (*event)(e)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	if e.EventType == "" {
+		e.EventType = aux.Type
+	}
+	return nil
+}
+
+// cbvPrefixes lists the prefixes that may precede a CBV business step or
+// disposition value
+var cbvPrefixes = []string{
+	"urn:epcglobal:cbv:bizstep:",
+	"urn:epcglobal:cbv:disp:",
+	"https://ref.gs1.org/cbv/BizStep-",
+	"https://ref.gs1.org/cbv/Disp-",
+	"cbv:BizStep-",
+	"cbv:Disp-",
+	"cbvmda:",
+}
+
+// NormalizeCBV reduces CBV business step and disposition URIs to their bare
+// values, e.g. urn:epcglobal:cbv:bizstep:shipping becomes shipping
+func (e *EpcisEvent) NormalizeCBV() {
+	if e.BizStep != nil {
+		bizStep := BusinessStep(trimCBVPrefix(string(*e.BizStep)))
+		e.BizStep = &bizStep
+	}
+	if e.Disposition != nil {
+		disposition := trimCBVPrefix(*e.Disposition)
+		e.Disposition = &disposition
+	}
+}
+
+// trimCBVPrefix removes a known CBV prefix from a value
+func trimCBVPrefix(value string) string {
+	for _, prefix := range cbvPrefixes {
+		if strings.HasPrefix(value, prefix) {
+			return strings.TrimPrefix(value, prefix)
+		}
+	}
+	return value
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -14,6 +15,15 @@ const (
 	TransactionEventType   EventType = "TransactionEvent"
 )
 
+// Action represents the EPCIS event action
+type Action string
+
+const (
+	ActionAdd     Action = "ADD"
+	ActionObserve Action = "OBSERVE"
+	ActionDelete  Action = "DELETE"
+)
+
 // BusinessStep represents the business step enumeration
 type BusinessStep string
 
@@ -47,12 +57,17 @@ const (
 	JoinFailed  JoinStatus = "failed"
 )
 
-// SensorReport represents individual sensor readings
+// SensorReport represents individual sensor readings. A report carries a value,
+// or the minimum, maximum and mean of the readings over a period.
 type SensorReport struct {
-	Type  string      `json:"type" validate:"required"`
-	Value interface{} `json:"value" validate:"required"`
-	UOM   *string     `json:"uom,omitempty"`
-	Time  time.Time   `json:"time" validate:"required"`
+	Type      string      `json:"type" validate:"required"`
+	Value     interface{} `json:"value,omitempty" validate:"required_without_all=MinValue MaxValue MeanValue"`
+	Component *string     `json:"component,omitempty"`
+	MinValue  *float64    `json:"minValue,omitempty"`
+	MaxValue  *float64    `json:"maxValue,omitempty"`
+	MeanValue *float64    `json:"meanValue,omitempty"`
+	UOM       *string     `json:"uom,omitempty"`
+	Time      time.Time   `json:"time" validate:"required"`
 }
 
 // DeviceMetadata represents metadata for sensor devices
@@ -66,6 +81,8 @@ type DeviceMetadata struct {
 type SensorMetadata struct {
 	DeviceID       string          `json:"deviceId" validate:"required"`
 	DeviceMetadata *DeviceMetadata `json:"deviceMetadata,omitempty"`
+	Radio          *RadioMetadata  `json:"radio,omitempty"`
+	Health         *DeviceHealth   `json:"deviceHealth,omitempty"`
 }
 
 // SensorElement represents a sensor element with metadata and reports
@@ -97,19 +114,83 @@ type BizTransaction struct {
 	BizTransaction string `json:"bizTransaction" validate:"required"`
 }
 
+// Source represents the source of a business transfer
+type Source struct {
+	Type   string `json:"type" validate:"required"`
+	Source string `json:"source" validate:"required"`
+}
+
+// Destination represents the destination of a business transfer
+type Destination struct {
+	Type        string `json:"type" validate:"required"`
+	Destination string `json:"destination" validate:"required"`
+}
+
+// PersistentDisposition represents dispositions that persist beyond the event
+type PersistentDisposition struct {
+	Set   []string `json:"set,omitempty"`
+	Unset []string `json:"unset,omitempty"`
+}
+
+// ErrorDeclaration marks an event as erroneous
+type ErrorDeclaration struct {
+	DeclarationTime    time.Time `json:"declarationTime" validate:"required"`
+	Reason             *string   `json:"reason,omitempty"`
+	CorrectiveEventIDs []string  `json:"correctiveEventIDs,omitempty"`
+}
+
+// URIList is a list of URIs that may also be given as a single string in JSON
+type URIList []string
+
+// UnmarshalJSON accepts either a single URI string or an array of URIs
+func (l *URIList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = URIList{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
 // EpcisEvent represents the main EPCIS event structure
 type EpcisEvent struct {
+	EventID             string                `json:"eventID,omitempty"`
 	EventType           EventType             `json:"eventType" validate:"required,oneof=ObjectEvent TransformationEvent AggregationEvent TransactionEvent"`
 	EventTime           time.Time             `json:"eventTime" validate:"required"`
 	EventTimeZoneOffset string                `json:"eventTimeZoneOffset" validate:"required"`
+	Action              *Action               `json:"action,omitempty" validate:"omitempty,oneof=ADD OBSERVE DELETE"`
 	BizStep             *BusinessStep         `json:"bizStep,omitempty"`
 	Disposition         *string               `json:"disposition,omitempty"`
+	PersistentDisposition *PersistentDisposition `json:"persistentDisposition,omitempty"`
 	ReadPoint           *ReadPoint            `json:"readPoint,omitempty"`
 	BizLocation         *BizLocation          `json:"bizLocation,omitempty"`
 	EPCList             []string              `json:"epcList,omitempty"`
-	QuantityList        []QuantityElement     `json:"quantityList,omitempty"`
-	BizTransactionList  []BizTransaction      `json:"bizTransactionList,omitempty"`
+	QuantityList        []QuantityElement     `json:"quantityList,omitempty" validate:"omitempty,dive"`
+	BizTransactionList  []BizTransaction      `json:"bizTransactionList,omitempty" validate:"omitempty,dive"`
+	SourceList          []Source              `json:"sourceList,omitempty" validate:"omitempty,dive"`
+	DestinationList     []Destination         `json:"destinationList,omitempty" validate:"omitempty,dive"`
 	SensorElementList   []SensorElement       `json:"sensorElementList,omitempty"`
+	ILMD                map[string]interface{} `json:"ilmd,omitempty"`
+	CertificationInfo   URIList               `json:"certificationInfo,omitempty"`
+	ErrorDeclaration    *ErrorDeclaration     `json:"errorDeclaration,omitempty"`
+	
+	// AggregationEvent (and TransactionEvent parentID)
+	ParentID            *string               `json:"parentID,omitempty"`
+	ChildEPCs           []string              `json:"childEPCs,omitempty"`
+	ChildQuantityList   []QuantityElement     `json:"childQuantityList,omitempty" validate:"omitempty,dive"`
+	
+	// TransformationEvent
+	TransformationID    *string               `json:"transformationID,omitempty"`
+	InputEPCList        []string              `json:"inputEPCList,omitempty"`
+	InputQuantityList   []QuantityElement     `json:"inputQuantityList,omitempty" validate:"omitempty,dive"`
+	OutputEPCList       []string              `json:"outputEPCList,omitempty"`
+	OutputQuantityList  []QuantityElement     `json:"outputQuantityList,omitempty" validate:"omitempty,dive"`
 	
 	// Custom extensions
 	LotCode         *string    `json:"lotCode,omitempty"`
@@ -129,6 +210,8 @@ type DeviceInfo struct {
 	BatteryPct       *int        `json:"batteryPct,omitempty" validate:"omitempty,min=0,max=100"`
 	LastHeartbeat    *time.Time  `json:"lastHeartbeat,omitempty"`
 	JoinStatus       *JoinStatus `json:"joinStatus,omitempty"`
+	DevEUI           *string     `json:"devEui,omitempty" validate:"omitempty,hexadecimal,len=16"`
+	PayloadCodec     *string     `json:"payloadCodec,omitempty" validate:"omitempty,payloadcodec"`
 }
 
 // RawIngestPayload represents raw device data before normalization
@@ -146,4 +229,11 @@ type ClaimCode struct {
 	ClaimCode   string            `json:"claimCode" validate:"required,len=8,alphanum"`
 	Type        DeviceType        `json:"type" validate:"required,oneof=ESP32 ExpressLink LoRaWAN Tracker"`
 	Identifiers map[string]string `json:"identifiers,omitempty"`
+}
+
+// ClaimCodeRequest represents a request to issue device claim codes
+type ClaimCodeRequest struct {
+	Type         DeviceType `json:"type" validate:"required,oneof=ESP32 ExpressLink LoRaWAN Tracker"`
+	Count        int        `json:"count" validate:"required,min=1,max=100"`
+	ExpiresHours int        `json:"expiresHours,omitempty" validate:"min=0"` // 0 never expires
 } 
\ No newline at end of file
@@ -0,0 +1,255 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CTE represents an FSMA 204 Critical Tracking Event
+type CTE string
+
+const (
+	CTEHarvesting         CTE = "harvesting"
+	CTECooling            CTE = "cooling"
+	CTEInitialPacking     CTE = "initialPacking"
+	CTEFirstLandReceiving CTE = "firstLandReceiving"
+	CTEShipping           CTE = "shipping"
+	CTEReceiving          CTE = "receiving"
+	CTETransformation     CTE = "transformation"
+)
+
+// KDE represents an FSMA 204 Key Data Element
+type KDE string
+
+const (
+	KDETraceabilityLotCode KDE = "traceabilityLotCode" // lotCode, ILMD lotNumber or an LGTIN
+	KDELotCodeSource       KDE = "lotCodeSource"       // where the traceability lot code was assigned
+	KDEQuantity            KDE = "quantity"            // EPCs or quantity elements
+	KDEUnitOfMeasure       KDE = "unitOfMeasure"       // uom on every quantity element
+	KDELocation            KDE = "location"            // bizLocation or readPoint
+	KDESourceLocation      KDE = "sourceLocation"      // where the food was shipped from
+	KDEDestinationLocation KDE = "destinationLocation" // where the food was shipped to
+	KDEReferenceDocument   KDE = "referenceDocument"   // bizTransactionList
+)
+
+// FSMA204Mode controls how missing KDEs are handled at capture time
+type FSMA204Mode string
+
+const (
+	FSMA204Off    FSMA204Mode = "off"    // no checks
+	FSMA204Warn   FSMA204Mode = "warn"   // events are stored and missing KDEs reported
+	FSMA204Strict FSMA204Mode = "strict" // events with missing KDEs are rejected
+)
+
+// cteBizSteps maps the business steps that are FSMA 204 CTEs to their CTE
+var cteBizSteps = map[BusinessStep]CTE{
+	Harvesting:         CTEHarvesting,
+	Cooling:            CTECooling,
+	InitialPacking:     CTEInitialPacking,
+	FirstLandReceiving: CTEFirstLandReceiving,
+	Shipping:           CTEShipping,
+	Receiving:          CTEReceiving,
+	Transformation:     CTETransformation,
+}
+
+// RequiredKDEs lists the KDEs each CTE must carry. The unit of measure is
+// required wherever a quantity is.
+var RequiredKDEs = map[CTE][]KDE{
+	CTEHarvesting:         {KDEQuantity, KDELocation, KDEReferenceDocument},
+	CTECooling:            {KDETraceabilityLotCode, KDEQuantity, KDELocation, KDEReferenceDocument},
+	CTEInitialPacking:     {KDETraceabilityLotCode, KDELotCodeSource, KDEQuantity, KDELocation, KDEReferenceDocument},
+	CTEFirstLandReceiving: {KDETraceabilityLotCode, KDELotCodeSource, KDEQuantity, KDELocation, KDEReferenceDocument},
+	CTEShipping:           {KDETraceabilityLotCode, KDELotCodeSource, KDEQuantity, KDESourceLocation, KDEDestinationLocation, KDEReferenceDocument},
+	CTEReceiving:          {KDETraceabilityLotCode, KDELotCodeSource, KDEQuantity, KDESourceLocation, KDELocation, KDEReferenceDocument},
+	CTETransformation:     {KDETraceabilityLotCode, KDELotCodeSource, KDEQuantity, KDELocation, KDEReferenceDocument},
+}
+
+// FSMA204Check reports the CTE an event was classified as and the KDEs it lacks
+type FSMA204Check struct {
+	EventIndex  *int   `json:"eventIndex,omitempty"` // position in a captured document
+	EventID     string `json:"eventId,omitempty"`
+	CTE         CTE    `json:"cte"`
+	MissingKDEs []KDE  `json:"missingKdes"`
+}
+
+// ClassifyCTE returns the CTE an event records, if any. Events are classified
+// by business step; a TransformationEvent without one is a transformation CTE.
+func ClassifyCTE(event *EpcisEvent) (CTE, bool) {
+	if event.BizStep != nil {
+		cte, ok := cteBizSteps[*event.BizStep]
+		return cte, ok
+	}
+	if event.EventType == TransformationEventType {
+		return CTETransformation, true
+	}
+	return "", false
+}
+
+// AssignsLotCode reports whether a CTE assigns a new traceability lot code, in
+// which case the location of the event is the lot code source
+func AssignsLotCode(cte CTE) bool {
+	return cte == CTEInitialPacking || cte == CTEFirstLandReceiving || cte == CTETransformation
+}
+
+// TraceabilityLotCode returns the traceability lot code of an event: the lotCode
+// extension, the ILMD lot number, or the lot of an LGTIN. For transformations
+// this is the lot produced.
+func TraceabilityLotCode(event *EpcisEvent) string {
+	if event.LotCode != nil && *event.LotCode != "" {
+		return *event.LotCode
+	}
+	for _, key := range []string{"lotNumber", "cbvmda:lotNumber"} {
+		if lot, ok := event.ILMD[key].(string); ok && lot != "" {
+			return lot
+		}
+	}
+
+	identifiers := append(append([]string{}, event.EPCList...), event.OutputEPCList...)
+	for _, quantities := range [][]QuantityElement{event.QuantityList, event.OutputQuantityList} {
+		for _, quantity := range quantities {
+			identifiers = append(identifiers, quantity.EPCClass)
+		}
+	}
+	for _, id := range identifiers {
+		if strings.HasPrefix(id, "urn:epc:class:lgtin:") {
+			return id
+		}
+	}
+	return ""
+}
+
+// LotCodeSource returns the lot code source recorded on an event: the ILMD
+// lotCodeSource or, when the event assigns the lot code, its business location
+func LotCodeSource(event *EpcisEvent) string {
+	if source, ok := event.ILMD["lotCodeSource"].(string); ok && source != "" {
+		return source
+	}
+	if cte, ok := ClassifyCTE(event); ok && AssignsLotCode(cte) && event.BizLocation != nil {
+		return event.BizLocation.ID
+	}
+	return ""
+}
+
+// CheckKDEs classifies an event and reports the KDEs it lacks. lotCodeSources
+// holds the sources already known for traceability lot codes assigned by
+// earlier events. It returns nil for events that are not CTEs.
+func CheckKDEs(event *EpcisEvent, lotCodeSources map[string]string) *FSMA204Check {
+	cte, ok := ClassifyCTE(event)
+	if !ok {
+		return nil
+	}
+
+	check := &FSMA204Check{CTE: cte, MissingKDEs: []KDE{}}
+	lotCode := TraceabilityLotCode(event)
+
+	epcs, quantities := event.EPCList, event.QuantityList
+	if event.EventType == TransformationEventType {
+		epcs, quantities = event.OutputEPCList, event.OutputQuantityList
+	} else if event.EventType == AggregationEventType {
+		epcs, quantities = event.ChildEPCs, event.ChildQuantityList
+	}
+
+	for _, kde := range RequiredKDEs[cte] {
+		present := true
+		switch kde {
+		case KDETraceabilityLotCode:
+			present = lotCode != ""
+		case KDELotCodeSource:
+			present = LotCodeSource(event) != "" || (lotCode != "" && lotCodeSources[lotCode] != "")
+		case KDEQuantity:
+			present = len(epcs) > 0 || len(quantities) > 0
+			for _, quantity := range quantities {
+				if quantity.UOM == nil || *quantity.UOM == "" {
+					check.MissingKDEs = append(check.MissingKDEs, KDEUnitOfMeasure)
+					break
+				}
+			}
+		case KDELocation:
+			present = event.BizLocation != nil || event.ReadPoint != nil
+		case KDESourceLocation:
+			// The shipper's own business location is where a shipment leaves from
+			present = len(event.SourceList) > 0 || (cte == CTEShipping && event.BizLocation != nil)
+		case KDEDestinationLocation:
+			present = len(event.DestinationList) > 0
+		case KDEReferenceDocument:
+			present = len(event.BizTransactionList) > 0
+		}
+		if !present {
+			check.MissingKDEs = append(check.MissingKDEs, kde)
+		}
+	}
+
+	return check
+}
+
+// String summarises the missing KDEs of a check
+func (c *FSMA204Check) String() string {
+	kdes := make([]string, len(c.MissingKDEs))
+	for i, kde := range c.MissingKDEs {
+		kdes[i] = string(kde)
+	}
+	return fmt.Sprintf("%s event is missing KDEs: %s", c.CTE, strings.Join(kdes, ", "))
+}
+
+// FSMA204Columns are the column headings of the FDA electronic sortable spreadsheet
+var FSMA204Columns = []string{
+	"Traceability Lot Code",
+	"Traceability Lot Code Source",
+	"Critical Tracking Event",
+	"Event Date",
+	"Event Time (UTC)",
+	"Product Description",
+	"Quantity",
+	"Unit of Measure",
+	"Location Description",
+	"Ship From Location",
+	"Ship To Location",
+	"Reference Document Type",
+	"Reference Document Number",
+	"Event ID",
+	"Event Hash",
+	"Blockchain Transaction ID",
+}
+
+// FSMA204Row represents one CTE in the FDA electronic sortable spreadsheet.
+// Fields holding several values separate them with "; ".
+type FSMA204Row struct {
+	TraceabilityLotCode       string `json:"traceabilityLotCode"`
+	TraceabilityLotCodeSource string `json:"traceabilityLotCodeSource"`
+	CTE                       CTE    `json:"cte"`
+	EventDate                 string `json:"eventDate"`
+	EventTime                 string `json:"eventTime"`
+	ProductDescription        string `json:"productDescription"`
+	Quantity                  string `json:"quantity"`
+	UnitOfMeasure             string `json:"unitOfMeasure"`
+	LocationDescription       string `json:"locationDescription"`
+	ShipFromLocation          string `json:"shipFromLocation"`
+	ShipToLocation            string `json:"shipToLocation"`
+	ReferenceDocumentType     string `json:"referenceDocumentType"`
+	ReferenceDocumentNumber   string `json:"referenceDocumentNumber"`
+	EventID                   string `json:"eventId"`
+	Hash                      string `json:"hash"`
+	BlockchainTxID            string `json:"blockchainTxId"`
+}
+
+// Values returns the row's cells in FSMA204Columns order
+func (r *FSMA204Row) Values() []string {
+	return []string{
+		r.TraceabilityLotCode,
+		r.TraceabilityLotCodeSource,
+		string(r.CTE),
+		r.EventDate,
+		r.EventTime,
+		r.ProductDescription,
+		r.Quantity,
+		r.UnitOfMeasure,
+		r.LocationDescription,
+		r.ShipFromLocation,
+		r.ShipToLocation,
+		r.ReferenceDocumentType,
+		r.ReferenceDocumentNumber,
+		r.EventID,
+		r.Hash,
+		r.BlockchainTxID,
+	}
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// IngestionDetail represents a raw data ingestion together with its decoded
+// payload and the EPCIS events derived from it
+type IngestionDetail struct {
+	ID               string                 `json:"id"`
+	DeviceType       DeviceType             `json:"deviceType"`
+	DeviceID         string                 `json:"deviceId"`
+	Timestamp        time.Time              `json:"timestamp"`
+	LotCode          *string                `json:"lotCode,omitempty"`
+	Data             map[string]interface{} `json:"data"`
+	Metadata         map[string]interface{} `json:"metadata,omitempty"`
+	ProcessingStatus string                 `json:"processingStatus"`
+	Attempts         int                    `json:"attempts"`
+	ErrorMessage     *string                `json:"errorMessage,omitempty"`
+	NextAttemptAt    *time.Time             `json:"nextAttemptAt,omitempty"`
+	ProcessedAt      *time.Time             `json:"processedAt,omitempty"`
+	CreatedAt        time.Time              `json:"createdAt"`
+	Events           []EpcisEvent           `json:"events"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"scain-backend/utils"
+)
+
+// EventVerification represents the result of checking a stored event against
+// the hash anchored for it on the ledger
+type EventVerification struct {
+	EventID      string     `json:"eventId"`
+	Ledger       string     `json:"ledger"`
+	AnchorStatus string     `json:"anchorStatus"` // pending, anchored or failed
+	Anchored     bool       `json:"anchored"`
+	Verified     bool       `json:"verified"`             // the stored event matches the anchored hash
+	StoredHash   string     `json:"storedHash"`           // hash recorded with the event when it was stored
+	ComputedHash string     `json:"computedHash"`         // hash of the event as it is stored now
+	BatchID      string     `json:"batchId,omitempty"`    // anchor batch whose Merkle root is anchored for the event
+	MerkleRoot   string     `json:"merkleRoot,omitempty"` // root computed from the event as it is stored now and its Merkle path
+	LedgerHash   string     `json:"ledgerHash,omitempty"`
+	TxID         string     `json:"txId,omitempty"`
+	AnchoredAt   *time.Time `json:"anchoredAt,omitempty"`
+}
+
+// MerkleProof proves that the hash of an event is a leaf of the Merkle tree of
+// its anchor batch. Hashing the leaf hash with each step of the path in turn
+// must give the root anchored on the ledger.
+type MerkleProof struct {
+	EventID      string             `json:"eventId"`
+	EventHash    string             `json:"eventHash"`
+	LeafHash     string             `json:"leafHash"` // SHA-256 of 0x00 followed by the event hash
+	BatchID      string             `json:"batchId"`
+	BatchSize    int                `json:"batchSize"`
+	Path         []utils.MerkleStep `json:"path"`
+	MerkleRoot   string             `json:"merkleRoot"`
+	Ledger       string             `json:"ledger,omitempty"`
+	AnchorStatus string             `json:"anchorStatus"` // of the batch: pending, anchored or failed
+	TxID         string             `json:"txId,omitempty"`
+	AnchoredAt   *time.Time         `json:"anchoredAt,omitempty"`
+}
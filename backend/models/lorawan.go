@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// RadioMetadata describes how a LoRaWAN uplink was received. The gateway values
+// are those of the gateway with the strongest signal.
+type RadioMetadata struct {
+	NetworkServer   string   `json:"networkServer"`
+	DevEUI          string   `json:"devEui"`
+	FPort           int      `json:"fPort"`
+	FCnt            int      `json:"fCnt"`
+	GatewayID       string   `json:"gatewayId,omitempty"`
+	GatewayCount    int      `json:"gatewayCount"`
+	RSSI            *float64 `json:"rssi,omitempty"`
+	SNR             *float64 `json:"snr,omitempty"`
+	SpreadingFactor *int     `json:"spreadingFactor,omitempty"`
+	Bandwidth       *int     `json:"bandwidth,omitempty"`
+	Frequency       *int64   `json:"frequency,omitempty"`
+}
+
+// TTNUplink is the uplink message webhook of The Things Stack (TTN v3)
+type TTNUplink struct {
+	EndDeviceIDs struct {
+		DeviceID       string `json:"device_id"`
+		DevEUI         string `json:"dev_eui" validate:"required,hexadecimal,len=16"`
+		ApplicationIDs struct {
+			ApplicationID string `json:"application_id"`
+		} `json:"application_ids"`
+	} `json:"end_device_ids"`
+	ReceivedAt    *time.Time `json:"received_at"`
+	UplinkMessage *struct {
+		FPort          int                    `json:"f_port"`
+		FCnt           int                    `json:"f_cnt"`
+		FRMPayload     []byte                 `json:"frm_payload"`
+		DecodedPayload map[string]interface{} `json:"decoded_payload"`
+		RxMetadata     []struct {
+			GatewayIDs struct {
+				GatewayID string `json:"gateway_id"`
+				EUI       string `json:"eui"`
+			} `json:"gateway_ids"`
+			RSSI        *float64 `json:"rssi"`
+			ChannelRSSI *float64 `json:"channel_rssi"`
+			SNR         *float64 `json:"snr"`
+		} `json:"rx_metadata"`
+		Settings struct {
+			DataRate struct {
+				LoRa struct {
+					Bandwidth       *int `json:"bandwidth"`
+					SpreadingFactor *int `json:"spreading_factor"`
+				} `json:"lora"`
+			} `json:"data_rate"`
+			Frequency *string `json:"frequency"` // uint64 values are strings in protobuf JSON
+		} `json:"settings"`
+		ReceivedAt *time.Time `json:"received_at"`
+	} `json:"uplink_message" validate:"required"`
+}
+
+// ChirpStackUplink is the uplink event of the ChirpStack v4 HTTP integration
+type ChirpStackUplink struct {
+	DeduplicationID string     `json:"deduplicationId"`
+	Time            *time.Time `json:"time"`
+	DeviceInfo      struct {
+		DevEUI            string            `json:"devEui" validate:"required,hexadecimal,len=16"`
+		DeviceName        string            `json:"deviceName"`
+		ApplicationID     string            `json:"applicationId"`
+		DeviceProfileName string            `json:"deviceProfileName"`
+		Tags              map[string]string `json:"tags"`
+	} `json:"deviceInfo"`
+	FPort  int                    `json:"fPort"`
+	FCnt   int                    `json:"fCnt"`
+	Data   []byte                 `json:"data"`
+	Object map[string]interface{} `json:"object"`
+	RxInfo []struct {
+		GatewayID string   `json:"gatewayId"`
+		RSSI      *float64 `json:"rssi"`
+		SNR       *float64 `json:"snr"`
+	} `json:"rxInfo"`
+	TxInfo struct {
+		Frequency  *int64 `json:"frequency"`
+		Modulation struct {
+			LoRa struct {
+				Bandwidth       *int `json:"bandwidth"`
+				SpreadingFactor *int `json:"spreadingFactor"`
+			} `json:"lora"`
+		} `json:"modulation"`
+	} `json:"txInfo"`
+}
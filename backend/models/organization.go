@@ -0,0 +1,18 @@
+package models
+
+import "regexp"
+
+// slugPattern matches organization IDs: lowercase letters and digits in words
+// joined by single hyphens, e.g. acme-farms
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// OrganizationRequest represents a request to create an organization
+type OrganizationRequest struct {
+	ID   string `json:"id" validate:"required,max=64,slug"`
+	Name string `json:"name" validate:"required,max=200"`
+}
+
+// IsSlug reports whether a value can be used as an organization ID
+func IsSlug(value string) bool {
+	return slugPattern.MatchString(value)
+}
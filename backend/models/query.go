@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+)
+
+// EPCISContext is the JSON-LD context for EPCIS 2.0 documents
+const EPCISContext = "https://ref.gs1.org/standards/epcis/2.0.0/epcis-context.jsonld"
+
+// EPCISQueryDocument represents an EPCIS 2.0 query result document
+type EPCISQueryDocument struct {
+	Context       interface{}    `json:"@context"`
+	Type          string         `json:"type"`
+	SchemaVersion string         `json:"schemaVersion"`
+	CreationDate  time.Time      `json:"creationDate"`
+	EPCISBody     EPCISQueryBody `json:"epcisBody"`
+	NextPageToken *string        `json:"nextPageToken,omitempty"`
+}
+
+// EPCISQueryBody wraps the query results of a query document
+type EPCISQueryBody struct {
+	QueryResults QueryResults `json:"queryResults"`
+}
+
+// QueryResults represents the results of a named EPCIS query
+type QueryResults struct {
+	QueryName   string           `json:"queryName"`
+	ResultsBody QueryResultsBody `json:"resultsBody"`
+}
+
+// QueryResultsBody holds the events matched by a query
+type QueryResultsBody struct {
+	EventList []EpcisEvent `json:"eventList"`
+}
+
+// NewEPCISQueryDocument creates a query document for the given query name and events
+func NewEPCISQueryDocument(queryName string, events []EpcisEvent) *EPCISQueryDocument {
+	if events == nil {
+		events = []EpcisEvent{}
+	}
+
+	return &EPCISQueryDocument{
+		Context:       []string{EPCISContext},
+		Type:          "EPCISQueryDocument",
+		SchemaVersion: "2.0",
+		CreationDate:  time.Now().UTC(),
+		EPCISBody: EPCISQueryBody{
+			QueryResults: QueryResults{
+				QueryName: queryName,
+				ResultsBody: QueryResultsBody{
+					EventList: events,
+				},
+			},
+		},
+	}
+}
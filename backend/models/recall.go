@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+)
+
+// FSMA204TraceWindow is the time FSMA 204 allows for producing traceability records
+const FSMA204TraceWindow = 24 * time.Hour
+
+// RecallDrillRequest represents a request to run a recall drill for a suspect lot
+type RecallDrillRequest struct {
+	LotCode     string  `json:"lotCode" validate:"required"`
+	Depth       *int    `json:"depth,omitempty" validate:"omitempty,min=1,max=25"`
+	InitiatedBy *string `json:"initiatedBy,omitempty"`
+	Notes       *string `json:"notes,omitempty"`
+}
+
+// RecallCustomer represents a customer reached by an affected product, identified
+// by a shipment destination or, failing that, by a business transaction
+type RecallCustomer struct {
+	ID              string           `json:"id"`
+	Type            string           `json:"type"`
+	BizTransactions []BizTransaction `json:"bizTransactions"`
+	EventIDs        []string         `json:"eventIds"`
+}
+
+// InTransitShipment represents an affected product whose last movement was a
+// shipment that has not been received yet
+type InTransitShipment struct {
+	Product   string    `json:"product"`
+	ShippedAt time.Time `json:"shippedAt"`
+	EventID   string    `json:"eventId"`
+	Trackers  []string  `json:"trackers"`
+}
+
+// RecallDrillReport represents the outcome of a recall drill
+type RecallDrillReport struct {
+	ID                string              `json:"id"`
+	LotCode           string              `json:"lotCode"`
+	Depth             int                 `json:"depth"`
+	InitiatedBy       *string             `json:"initiatedBy,omitempty"`
+	Notes             *string             `json:"notes,omitempty"`
+	StartedAt         time.Time           `json:"startedAt"`
+	CompletedAt       time.Time           `json:"completedAt"`
+	DurationMs        int64               `json:"durationMs"`
+	WithinFSMAWindow  bool                `json:"withinFsmaWindow"`
+	Truncated         bool                `json:"truncated"`
+	AffectedLots      []string            `json:"affectedLots"`
+	AffectedProducts  []string            `json:"affectedProducts"`
+	AffectedLocations []string            `json:"affectedLocations"`
+	Customers         []RecallCustomer    `json:"customers"`
+	BizTransactions   []BizTransaction    `json:"bizTransactions"`
+	InTransit         []InTransitShipment `json:"inTransit"`
+	EventCount        int                 `json:"eventCount"`
+}
@@ -0,0 +1,469 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// CBV sensor measurement types
+const (
+	SensorTemperature      = "gs1:Temperature"
+	SensorRelativeHumidity = "gs1:RelativeHumidity"
+	SensorAbsoluteHumidity = "gs1:AbsoluteHumidity"
+	SensorAbsolutePressure = "gs1:AbsolutePressure"
+	SensorIlluminance      = "gs1:Illuminance"
+	SensorVoltage          = "gs1:Voltage"
+	SensorCurrent          = "gs1:Current"
+	SensorAcceleration     = "gs1:Acceleration"
+	SensorAltitude         = "gs1:Altitude"
+)
+
+// UN/ECE Recommendation 20 unit codes
+const (
+	UnitCelsius           = "CEL"
+	UnitFahrenheit        = "FAH"
+	UnitKelvin            = "KEL"
+	UnitPercent           = "P1"
+	UnitGramPerCubicMetre = "A93"
+	UnitHectopascal       = "A97"
+	UnitPascal            = "PAL"
+	UnitKilopascal        = "KPA"
+	UnitBar               = "BAR"
+	UnitVolt              = "VLT"
+	UnitMillivolt         = "2Z"
+	UnitAmpere            = "AMP"
+	UnitLux               = "LUX"
+	UnitMetre             = "MTR"
+)
+
+// DeviceHealth holds readings about the device itself, as opposed to the
+// environment of the product it monitors
+type DeviceHealth struct {
+	BatteryPct     *float64 `json:"batteryPct,omitempty"`
+	BatteryVoltage *float64 `json:"batteryVoltage,omitempty"` // volts
+	RSSI           *float64 `json:"rssi,omitempty"`
+	SNR            *float64 `json:"snr,omitempty"`
+}
+
+// sensorTypes maps lower-case reading names, and the local names of CBV
+// measurement types, to CBV measurement types
+var sensorTypes = map[string]string{
+	"temperature":      SensorTemperature,
+	"temp":             SensorTemperature,
+	"tmp":              SensorTemperature,
+	"humidity":         SensorRelativeHumidity,
+	"hum":              SensorRelativeHumidity,
+	"rh":               SensorRelativeHumidity,
+	"relativehumidity": SensorRelativeHumidity,
+	"absolutehumidity": SensorAbsoluteHumidity,
+	"pressure":         SensorAbsolutePressure,
+	"airpressure":      SensorAbsolutePressure,
+	"absolutepressure": SensorAbsolutePressure,
+	"barometer":        SensorAbsolutePressure,
+	"baro":             SensorAbsolutePressure,
+	"illuminance":      SensorIlluminance,
+	"light":            SensorIlluminance,
+	"lux":              SensorIlluminance,
+	"voltage":          SensorVoltage,
+	"current":          SensorCurrent,
+	"acceleration":     SensorAcceleration,
+	"accelerometer":    SensorAcceleration,
+	"accel":            SensorAcceleration,
+	"altitude":         SensorAltitude,
+}
+
+// canonicalUnits maps measurement types to the unit their readings are converted to
+var canonicalUnits = map[string]string{
+	SensorTemperature:      UnitCelsius,
+	SensorRelativeHumidity: UnitPercent,
+	SensorAbsoluteHumidity: UnitGramPerCubicMetre,
+	SensorAbsolutePressure: UnitHectopascal,
+	SensorIlluminance:      UnitLux,
+	SensorVoltage:          UnitVolt,
+	SensorCurrent:          UnitAmpere,
+	SensorAltitude:         UnitMetre,
+}
+
+// unitAliases maps lower-case unit spellings to UN/ECE unit codes
+var unitAliases = map[string]string{
+	"cel": UnitCelsius, "c": UnitCelsius, "°c": UnitCelsius, "degc": UnitCelsius, "celsius": UnitCelsius,
+	"fah": UnitFahrenheit, "f": UnitFahrenheit, "°f": UnitFahrenheit, "degf": UnitFahrenheit, "fahrenheit": UnitFahrenheit,
+	"kel": UnitKelvin, "k": UnitKelvin, "kelvin": UnitKelvin,
+	"p1": UnitPercent, "%": UnitPercent, "%rh": UnitPercent, "pct": UnitPercent, "percent": UnitPercent,
+	"a93": UnitGramPerCubicMetre, "g/m3": UnitGramPerCubicMetre,
+	"a97": UnitHectopascal, "hpa": UnitHectopascal, "mbar": UnitHectopascal, "mbr": UnitHectopascal,
+	"pal": UnitPascal, "pa": UnitPascal,
+	"kpa": UnitKilopascal,
+	"bar": UnitBar,
+	"vlt": UnitVolt, "v": UnitVolt,
+	"2z": UnitMillivolt, "mv": UnitMillivolt,
+	"amp": UnitAmpere, "a": UnitAmpere,
+	"lux": UnitLux, "lx": UnitLux,
+	"mtr": UnitMetre, "m": UnitMetre,
+}
+
+// keyUnitHints are the unit spellings recognised as part of a reading name,
+// e.g. temp_f
+var keyUnitHints = map[string]bool{
+	"c": true, "celsius": true, "degc": true,
+	"f": true, "fahrenheit": true, "degf": true,
+	"k": true, "kelvin": true,
+	"pct": true, "percent": true,
+	"hpa": true, "mbar": true, "pa": true, "kpa": true,
+	"mv": true,
+}
+
+// unitConversions converts readings from a unit to the canonical unit of
+// their measurement type
+var unitConversions = map[[2]string]func(float64) float64{
+	{UnitFahrenheit, UnitCelsius}:     func(v float64) float64 { return (v - 32) * 5 / 9 },
+	{UnitKelvin, UnitCelsius}:         func(v float64) float64 { return v - 273.15 },
+	{UnitPascal, UnitHectopascal}:     func(v float64) float64 { return v / 100 },
+	{UnitKilopascal, UnitHectopascal}: func(v float64) float64 { return v * 10 },
+	{UnitBar, UnitHectopascal}:        func(v float64) float64 { return v * 1000 },
+	{UnitMillivolt, UnitVolt}:         func(v float64) float64 { return v / 1000 },
+	// The ESP32 firmware labels relative humidity in percent as A93
+	{UnitGramPerCubicMetre, UnitPercent}: func(v float64) float64 { return v },
+}
+
+// Reading statistics that map to minValue, maxValue and meanValue
+var statWords = map[string]string{
+	"min": "min", "minimum": "min",
+	"max": "max", "maximum": "max",
+	"mean": "mean", "avg": "mean", "average": "mean",
+}
+
+// Device health readings
+const (
+	healthBattery        = "battery"
+	healthBatteryVoltage = "batteryVoltage"
+	healthRSSI           = "rssi"
+	healthSNR            = "snr"
+)
+
+// healthWords maps lower-case reading names to the device health field they report
+var healthWords = map[string]string{
+	"battery": healthBattery, "batt": healthBattery, "bat": healthBattery,
+	"vbat": healthBatteryVoltage, "vbatt": healthBatteryVoltage,
+	"rssi": healthRSSI,
+	"snr":  healthSNR,
+}
+
+// readingKey is what a raw reading name says about the reading
+type readingKey struct {
+	sensorType string // CBV measurement type, or the raw name when unknown
+	known      bool   // whether the name was recognised
+	component  string
+	stat       string // min, max or mean
+	unit       string
+	health     string // device health field, when the reading is about the device
+}
+
+// NormalizeUnit returns the UN/ECE code of a unit spelling, or the spelling
+// itself when it is not known
+func NormalizeUnit(uom string) string {
+	if code, ok := unitAliases[strings.ToLower(strings.TrimSpace(uom))]; ok {
+		return code
+	}
+	return uom
+}
+
+// NormalizeSensorElement normalizes the reports of a sensor element. Reading
+// names are mapped to CBV measurement types, with a component, statistic or
+// unit found in the name (air_temperature, temp_max, temp_f, gs1:Temperature/probe)
+// applied to the report. Values are converted to the canonical unit of their
+// type, and readings of a statistic are merged into the report of their type and
+// component. Battery, RSSI and SNR readings are moved to the device health of
+// the sensor metadata. Reports of unknown readings are kept as they are.
+func NormalizeSensorElement(element *SensorElement) {
+	var reports []SensorReport
+	merged := make(map[string]int)
+
+	for _, report := range element.SensorReport {
+		key := parseReadingKey(report.Type)
+		if report.Component != nil && *report.Component != "" {
+			key.component = *report.Component
+		}
+		if report.UOM != nil && *report.UOM != "" {
+			key.unit = NormalizeUnit(*report.UOM)
+		}
+
+		if key.health != "" {
+			if element.SensorMetaData.Health == nil {
+				element.SensorMetaData.Health = &DeviceHealth{}
+			}
+			element.SensorMetaData.Health.set(key, report.Value)
+			continue
+		}
+		if !key.known {
+			reports = append(reports, report)
+			continue
+		}
+
+		normalized := normalizeReport(report, key)
+		mergeKey := normalized.Type + "/" + key.component
+		if i, ok := merged[mergeKey]; ok && mergeReport(&reports[i], &normalized) {
+			continue
+		}
+		merged[mergeKey] = len(reports)
+		reports = append(reports, normalized)
+	}
+
+	element.SensorReport = reports
+}
+
+// DeviceHealthFromReadings collects the device health readings among raw
+// readings. It returns nil when there are none.
+func DeviceHealthFromReadings(data map[string]interface{}) *DeviceHealth {
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var health *DeviceHealth
+	for _, name := range names {
+		key := parseReadingKey(name)
+		if key.health == "" {
+			continue
+		}
+		if health == nil {
+			health = &DeviceHealth{}
+		}
+		health.set(key, data[name])
+	}
+	return health
+}
+
+// normalizeReport sets the type, component and unit of a report and converts
+// its values to the canonical unit
+func normalizeReport(report SensorReport, key readingKey) SensorReport {
+	normalized := SensorReport{Type: key.sensorType, Time: report.Time}
+	if key.component != "" {
+		component := key.component
+		normalized.Component = &component
+	}
+
+	unit := key.unit
+	target := canonicalUnits[key.sensorType]
+	if unit == "" {
+		unit = target
+	}
+	convert := func(v float64) float64 { return v }
+	if conversion, ok := unitConversions[[2]string{unit, target}]; ok && target != "" {
+		convert = conversion
+		unit = target
+	}
+	if unit != "" {
+		normalized.UOM = &unit
+	}
+
+	setStat := func(stat string, value float64) {
+		value = roundSensorValue(convert(value))
+		switch stat {
+		case "min":
+			normalized.MinValue = &value
+		case "max":
+			normalized.MaxValue = &value
+		case "mean":
+			normalized.MeanValue = &value
+		default:
+			normalized.Value = value
+		}
+	}
+
+	// Values may be an object of statistics, e.g. {"min": 2.1, "max": 4.0}
+	if stats, ok := report.Value.(map[string]interface{}); ok && isStatObject(stats) {
+		for name, value := range stats {
+			if number, ok := SensorNumber(value); ok {
+				setStat(statWords[strings.ToLower(name)], number)
+			}
+		}
+	} else if number, ok := SensorNumber(report.Value); ok {
+		setStat(key.stat, number)
+	} else {
+		normalized.Value = report.Value
+	}
+
+	for stat, value := range map[string]*float64{"min": report.MinValue, "max": report.MaxValue, "mean": report.MeanValue} {
+		if value != nil {
+			setStat(stat, *value)
+		}
+	}
+
+	return normalized
+}
+
+// mergeReport adds the values of a report to another of the same type and
+// component. It reports false when both carry the same value field.
+func mergeReport(into, from *SensorReport) bool {
+	if (into.Value != nil && from.Value != nil) ||
+		(into.MinValue != nil && from.MinValue != nil) ||
+		(into.MaxValue != nil && from.MaxValue != nil) ||
+		(into.MeanValue != nil && from.MeanValue != nil) {
+		return false
+	}
+
+	if from.Value != nil {
+		into.Value = from.Value
+	}
+	if from.MinValue != nil {
+		into.MinValue = from.MinValue
+	}
+	if from.MaxValue != nil {
+		into.MaxValue = from.MaxValue
+	}
+	if from.MeanValue != nil {
+		into.MeanValue = from.MeanValue
+	}
+	return true
+}
+
+// set records a device health reading. Battery readings in volts or millivolts
+// are battery voltages; other battery readings are percentages.
+func (h *DeviceHealth) set(key readingKey, value interface{}) {
+	number, ok := SensorNumber(value)
+	if !ok {
+		return
+	}
+
+	switch key.health {
+	case healthBattery, healthBatteryVoltage:
+		if key.health == healthBatteryVoltage || key.sensorType == SensorVoltage || key.unit == UnitVolt || key.unit == UnitMillivolt {
+			if key.unit == UnitMillivolt {
+				number /= 1000
+			}
+			number = roundSensorValue(number)
+			h.BatteryVoltage = &number
+		} else {
+			h.BatteryPct = &number
+		}
+	case healthRSSI:
+		h.RSSI = &number
+	case healthSNR:
+		h.SNR = &number
+	}
+}
+
+// parseReadingKey reads the measurement type, component, statistic, unit or
+// device health field from a raw reading name. Names prefixed with gs1: are
+// CBV types, optionally followed by /component.
+func parseReadingKey(name string) readingKey {
+	base, component := name, ""
+	if i := strings.Index(name, "/"); i >= 0 {
+		base, component = name[:i], name[i+1:]
+	}
+
+	if strings.HasPrefix(strings.ToLower(base), "gs1:") {
+		key := readingKey{sensorType: base, component: component, known: true}
+		if sensorType, ok := sensorTypes[strings.ToLower(base[4:])]; ok {
+			key.sensorType = sensorType
+		}
+		return key
+	}
+
+	key := readingKey{known: true}
+	var rest []string
+	words := splitReadingName(base)
+	for i := 0; i < len(words); i++ {
+		// Names of two words, e.g. relative_humidity
+		if i+1 < len(words) && key.sensorType == "" {
+			if sensorType, ok := sensorTypes[words[i]+words[i+1]]; ok {
+				key.sensorType = sensorType
+				i++
+				continue
+			}
+		}
+
+		word := words[i]
+		if sensorType, ok := sensorTypes[word]; ok && key.sensorType == "" {
+			key.sensorType = sensorType
+		} else if health, ok := healthWords[word]; ok && key.health == "" {
+			key.health = health
+		} else if stat, ok := statWords[word]; ok && key.stat == "" {
+			key.stat = stat
+		} else if keyUnitHints[word] && key.unit == "" {
+			key.unit = unitAliases[word]
+		} else {
+			rest = append(rest, word)
+		}
+	}
+
+	if key.sensorType == "" && key.health == "" {
+		return readingKey{sensorType: name}
+	}
+	key.component = component
+	if key.component == "" {
+		key.component = strings.Join(rest, "_")
+	}
+	return key
+}
+
+// splitReadingName splits a reading name into lower-case words at separators,
+// camel case humps and between letters and digits
+func splitReadingName(name string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+
+	runes := []rune(name)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if i > 0 && len(word) > 0 {
+			previous := runes[i-1]
+			if (unicode.IsUpper(r) && unicode.IsLower(previous)) || unicode.IsDigit(r) != unicode.IsDigit(previous) {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+	return words
+}
+
+// isStatObject reports whether an object value holds reading statistics
+func isStatObject(value map[string]interface{}) bool {
+	if len(value) == 0 {
+		return false
+	}
+	for name := range value {
+		if _, ok := statWords[strings.ToLower(name)]; !ok && strings.ToLower(name) != "value" {
+			return false
+		}
+	}
+	return true
+}
+
+// SensorNumber returns a numeric reading as a float64
+func SensorNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		number, err := v.Float64()
+		return number, err == nil
+	}
+	return 0, false
+}
+
+// roundSensorValue drops the floating point noise introduced by unit conversion
+func roundSensorValue(value float64) float64 {
+	return math.Round(value*1e4) / 1e4
+}
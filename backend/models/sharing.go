@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// TagFuture is reported when a time must lie in the future
+const TagFuture = "future"
+
+// SharingAgreementRequest represents a request to let a partner organization
+// read the events of the caller's organization within a scope
+type SharingAgreementRequest struct {
+	PartnerOrgID string       `json:"partnerOrgId" validate:"required,max=64,slug"`
+	Scope        SharingScope `json:"scope"`
+	ExpiresAt    *time.Time   `json:"expiresAt,omitempty"`
+	Description  *string      `json:"description,omitempty" validate:"omitempty,max=500"`
+}
+
+// SharingScope selects the events a partner may read. Values within a field
+// are alternatives, and an event is shared when it matches any field.
+type SharingScope struct {
+	LotCodes     []string `json:"lotCodes,omitempty" validate:"dive,required"`
+	EPCPrefixes  []string `json:"epcPrefixes,omitempty" validate:"dive,required"` // EPC URI prefixes or GS1 company prefixes
+	BizLocations []string `json:"bizLocations,omitempty" validate:"dive,required"`
+}
+
+// ValidateSharingAgreementRequest requires a scope that shares something and
+// an expiry in the future. Register it with validator.RegisterStructValidation
+// for SharingAgreementRequest.
+func ValidateSharingAgreementRequest(sl validator.StructLevel) {
+	request := sl.Current().Interface().(SharingAgreementRequest)
+
+	scope := request.Scope
+	if len(scope.LotCodes) == 0 && len(scope.EPCPrefixes) == 0 && len(scope.BizLocations) == 0 {
+		sl.ReportError(request.Scope, "scope", "Scope", TagRequiredOneOf, "lotCodes epcPrefixes bizLocations")
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		sl.ReportError(request.ExpiresAt, "expiresAt", "ExpiresAt", TagFuture, "")
+	}
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+)
+
+// Stream message types
+const (
+	StreamEvent     = "event"
+	StreamHeartbeat = "heartbeat"
+)
+
+// StreamMessage is pushed to live stream clients. IDs increase with every
+// message published, so a client resumes after the last ID it received.
+type StreamMessage struct {
+	ID       uint64      `json:"id"`
+	OrgID    string      `json:"-"` // only subscribers of the organization receive the message
+	Type     string      `json:"type"`
+	Time     time.Time   `json:"time"`
+	LotCode  string      `json:"lotCode,omitempty"`
+	DeviceID string      `json:"deviceId,omitempty"`
+	Location string      `json:"location,omitempty"` // bizLocation, or else readPoint
+	Data     interface{} `json:"data"`
+}
+
+// StreamFilter selects the messages of a live stream, within the messages of
+// an organization. Every other field that is set has to match.
+type StreamFilter struct {
+	OrgID    string `form:"-"`
+	LotCode  string `form:"lotCode"`
+	DeviceID string `form:"deviceId"`
+	Location string `form:"location"`
+}
+
+// Matches reports whether a message passes the filter
+func (f *StreamFilter) Matches(message *StreamMessage) bool {
+	return f.OrgID == message.OrgID &&
+		(f.LotCode == "" || f.LotCode == message.LotCode) &&
+		(f.DeviceID == "" || f.DeviceID == message.DeviceID) &&
+		(f.Location == "" || f.Location == message.Location)
+}
+
+// StreamEventData is the data of an event message
+type StreamEventData struct {
+	EventID string      `json:"eventId"`
+	Hash    string      `json:"hash"`
+	Event   *EpcisEvent `json:"event"`
+}
+
+// StreamHeartbeatData is the data of a device heartbeat message
+type StreamHeartbeatData struct {
+	DeviceID      string    `json:"deviceId"`
+	LastHeartbeat time.Time `json:"lastHeartbeat"`
+	BatteryPct    *int      `json:"batteryPct,omitempty"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+)
+
+// SubscriptionRequest represents a request to push the events matching a
+// filter to a URL. Deliveries are signed with the shared secret.
+type SubscriptionRequest struct {
+	URL         string             `json:"url" validate:"required,http_url"`
+	Filter      SubscriptionFilter `json:"filter"`
+	Secret      string             `json:"secret" validate:"required,min=16"`
+	Description *string            `json:"description,omitempty"`
+}
+
+// SubscriptionFilter selects the events pushed to a subscription, with the
+// parameter names of the EPCIS query interface. Values within a field are
+// alternatives; an empty field matches every event.
+type SubscriptionFilter struct {
+	EventTypes   []EventType `json:"eventType,omitempty" validate:"dive,oneof=ObjectEvent TransformationEvent AggregationEvent TransactionEvent"`
+	BizSteps     []string    `json:"EQ_bizStep,omitempty"`
+	BizLocations []string    `json:"EQ_bizLocation,omitempty"`
+	LotCodes     []string    `json:"lotCode,omitempty"`
+}
+
+// Normalize reduces CBV business step URIs to their bare values, the way
+// events are stored
+func (f *SubscriptionFilter) Normalize() {
+	for i, bizStep := range f.BizSteps {
+		f.BizSteps[i] = trimCBVPrefix(bizStep)
+	}
+}
+
+// EventNotification is the body delivered to a subscription for an event
+type EventNotification struct {
+	SubscriptionID string      `json:"subscriptionId"`
+	EventID        string      `json:"eventId"`
+	Hash           string      `json:"hash"`
+	Event          *EpcisEvent `json:"event"`
+	CreatedAt      time.Time   `json:"createdAt"`
+}
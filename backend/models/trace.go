@@ -0,0 +1,74 @@
+package models
+
+import "time"
+
+// TraceDirection represents the direction of a traceability query
+type TraceDirection string
+
+const (
+	TraceBackward TraceDirection = "backward" // towards inputs and origins
+	TraceForward  TraceDirection = "forward"  // towards outputs and destinations
+)
+
+// NodeKind represents the kind of identifier a trace node stands for
+type NodeKind string
+
+const (
+	LotNode      NodeKind = "lot"
+	EPCNode      NodeKind = "epc"
+	EPCClassNode NodeKind = "epcClass"
+	LocationNode NodeKind = "location"
+	PartyNode    NodeKind = "party"
+)
+
+// Edge relations in a trace graph. Edges always point downstream, in the
+// direction product flows.
+const (
+	RelationIncludes        = "includes"         // lot to the EPCs or classes recorded with it
+	RelationTransformedInto = "transformed_into" // transformation input to output
+	RelationAggregatedInto  = "aggregated_into"  // child to parent on packing
+	RelationDisaggregatedTo = "disaggregated_to" // parent to child on unpacking
+	RelationShippedFrom     = "shipped_from"     // source location or party to product
+	RelationShippedTo       = "shipped_to"       // product to destination location or party
+	RelationReceivedAt      = "received_at"      // product to receiving location
+	RelationObservedAt      = "observed_at"      // product to any other business location
+)
+
+// TraceNode represents a lot, EPC, EPC class, location or party in a trace graph
+type TraceNode struct {
+	ID    string   `json:"id"`
+	Kind  NodeKind `json:"kind"`
+	Depth int      `json:"depth"`
+}
+
+// TraceEdge represents a link between two trace nodes and the events that justify it
+type TraceEdge struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Relation string   `json:"relation"`
+	EventIDs []string `json:"eventIds"`
+}
+
+// RedactedEvent stands for a partner event that references a traced product
+// but lies outside every scope the partner shared. Only the fact that the
+// partner recorded an event is disclosed, and the trace does not continue
+// through it.
+type RedactedEvent struct {
+	OrgID      string    `json:"orgId"`
+	Identifier string    `json:"identifier"` // the traced product the event references
+	EventType  EventType `json:"eventType"`
+	EventTime  time.Time `json:"eventTime"`
+}
+
+// TraceGraph represents the result of a backward or forward trace
+type TraceGraph struct {
+	Root         string            `json:"root"`
+	Direction    TraceDirection    `json:"direction"`
+	MaxDepth     int               `json:"maxDepth"`
+	Truncated    bool              `json:"truncated"` // nodes at maxDepth were not expanded
+	Nodes        []TraceNode       `json:"nodes"`
+	Edges        []TraceEdge       `json:"edges"`
+	Events       []EpcisEvent      `json:"events"`
+	SharedEvents map[string]string `json:"sharedEvents,omitempty"` // event ID to the partner organization that recorded it
+	Redacted     []RedactedEvent   `json:"redacted,omitempty"`
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"github.com/go-playground/validator/v10"
+)
+
+// Validation tags reported by ValidateEpcisEvent
+const (
+	TagRequiredFor   = "required_for"    // field is required for the event type or action in the param
+	TagNotAllowedFor = "not_allowed_for" // field must be absent for the event type or action in the param
+	TagRequiredOneOf = "required_one_of" // at least one of the fields in the param must be present
+)
+
+// ValidateEpcisEvent applies the EPCIS 2.0 rules that depend on the event type
+// and action. Register it with validator.RegisterStructValidation for EpcisEvent.
+func ValidateEpcisEvent(sl validator.StructLevel) {
+	event := sl.Current().Interface().(EpcisEvent)
+	eventType := string(event.EventType)
+
+	// Lists that only belong to one kind of event
+	if event.EventType != AggregationEventType {
+		if len(event.ChildEPCs) > 0 {
+			sl.ReportError(event.ChildEPCs, "childEPCs", "ChildEPCs", TagNotAllowedFor, eventType)
+		}
+		if len(event.ChildQuantityList) > 0 {
+			sl.ReportError(event.ChildQuantityList, "childQuantityList", "ChildQuantityList", TagNotAllowedFor, eventType)
+		}
+	}
+	if event.EventType != TransformationEventType {
+		if len(event.InputEPCList) > 0 || len(event.InputQuantityList) > 0 {
+			sl.ReportError(event.InputEPCList, "inputEPCList", "InputEPCList", TagNotAllowedFor, eventType)
+		}
+		if len(event.OutputEPCList) > 0 || len(event.OutputQuantityList) > 0 {
+			sl.ReportError(event.OutputEPCList, "outputEPCList", "OutputEPCList", TagNotAllowedFor, eventType)
+		}
+		if event.TransformationID != nil {
+			sl.ReportError(event.TransformationID, "transformationID", "TransformationID", TagNotAllowedFor, eventType)
+		}
+	}
+
+	switch event.EventType {
+	case ObjectEventType:
+		if !requireAction(sl, &event) {
+			return
+		}
+		if len(event.EPCList) == 0 && len(event.QuantityList) == 0 && event.LotCode == nil {
+			sl.ReportError(event.EPCList, "epcList", "EPCList", TagRequiredOneOf, "epcList quantityList lotCode")
+		}
+		if event.ParentID != nil {
+			sl.ReportError(event.ParentID, "parentID", "ParentID", TagNotAllowedFor, eventType)
+		}
+		if len(event.ILMD) > 0 && *event.Action != ActionAdd {
+			sl.ReportError(event.ILMD, "ilmd", "ILMD", TagNotAllowedFor, string(*event.Action))
+		}
+
+	case AggregationEventType:
+		if !requireAction(sl, &event) {
+			return
+		}
+		if event.ParentID == nil && *event.Action != ActionObserve {
+			sl.ReportError(event.ParentID, "parentID", "ParentID", TagRequiredFor, string(*event.Action))
+		}
+		if len(event.ChildEPCs) == 0 && len(event.ChildQuantityList) == 0 && *event.Action != ActionDelete {
+			sl.ReportError(event.ChildEPCs, "childEPCs", "ChildEPCs", TagRequiredOneOf, "childEPCs childQuantityList")
+		}
+		rejectObjectLists(sl, &event)
+		rejectILMD(sl, &event)
+
+	case TransactionEventType:
+		if !requireAction(sl, &event) {
+			return
+		}
+		if len(event.BizTransactionList) == 0 {
+			sl.ReportError(event.BizTransactionList, "bizTransactionList", "BizTransactionList", TagRequiredFor, eventType)
+		}
+		rejectILMD(sl, &event)
+
+	case TransformationEventType:
+		if event.Action != nil {
+			sl.ReportError(event.Action, "action", "Action", TagNotAllowedFor, eventType)
+		}
+		if event.ParentID != nil {
+			sl.ReportError(event.ParentID, "parentID", "ParentID", TagNotAllowedFor, eventType)
+		}
+		rejectObjectLists(sl, &event)
+
+		hasInputs := len(event.InputEPCList) > 0 || len(event.InputQuantityList) > 0
+		hasOutputs := len(event.OutputEPCList) > 0 || len(event.OutputQuantityList) > 0
+
+		// Events sharing a transformationID may each carry only inputs or only outputs
+		if event.TransformationID != nil {
+			if !hasInputs && !hasOutputs {
+				sl.ReportError(event.InputEPCList, "inputEPCList", "InputEPCList", TagRequiredOneOf, "inputEPCList inputQuantityList outputEPCList outputQuantityList")
+			}
+			return
+		}
+		if !hasInputs {
+			sl.ReportError(event.InputEPCList, "inputEPCList", "InputEPCList", TagRequiredOneOf, "inputEPCList inputQuantityList")
+		}
+		if !hasOutputs {
+			sl.ReportError(event.OutputEPCList, "outputEPCList", "OutputEPCList", TagRequiredOneOf, "outputEPCList outputQuantityList")
+		}
+	}
+}
+
+// requireAction reports a missing action and returns whether one is present
+func requireAction(sl validator.StructLevel, event *EpcisEvent) bool {
+	if event.Action == nil {
+		sl.ReportError(event.Action, "action", "Action", TagRequiredFor, string(event.EventType))
+		return false
+	}
+	return true
+}
+
+// rejectObjectLists reports epcList and quantityList on events that use their own lists
+func rejectObjectLists(sl validator.StructLevel, event *EpcisEvent) {
+	if len(event.EPCList) > 0 {
+		sl.ReportError(event.EPCList, "epcList", "EPCList", TagNotAllowedFor, string(event.EventType))
+	}
+	if len(event.QuantityList) > 0 {
+		sl.ReportError(event.QuantityList, "quantityList", "QuantityList", TagNotAllowedFor, string(event.EventType))
+	}
+}
+
+// rejectILMD reports instance/lot master data on events that cannot carry it
+func rejectILMD(sl validator.StructLevel, event *EpcisEvent) {
+	if len(event.ILMD) > 0 {
+		sl.ReportError(event.ILMD, "ilmd", "ILMD", TagNotAllowedFor, string(event.EventType))
+	}
+}
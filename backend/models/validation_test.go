@@ -0,0 +1,75 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// newEventValidator returns a validator with the EPCIS event rules registered,
+// as the API validates events with
+func newEventValidator() *validator.Validate {
+	validate := validator.New()
+	validate.RegisterStructValidation(ValidateEpcisEvent, EpcisEvent{})
+	return validate
+}
+
+// quantityEvent returns a valid ObjectEvent or AggregationEvent observing quantities
+func quantityEvent(eventType EventType, quantities []QuantityElement) EpcisEvent {
+	action := ActionObserve
+	event := EpcisEvent{
+		EventType:           eventType,
+		EventTime:           time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		EventTimeZoneOffset: "+00:00",
+		Action:              &action,
+	}
+	if eventType == AggregationEventType {
+		event.ChildQuantityList = quantities
+	} else {
+		event.QuantityList = quantities
+	}
+	return event
+}
+
+func TestValidateQuantityLists(t *testing.T) {
+	uom := "KGM"
+	tests := []struct {
+		name     string
+		element  QuantityElement
+		wantTag  string // failing tag, empty when the element is valid
+		wantPath string
+	}{
+		{"valid", QuantityElement{EPCClass: "urn:epc:class:lgtin:4012345.012345.L1", Quantity: 200, UOM: &uom}, "", ""},
+		{"missing epcClass", QuantityElement{Quantity: 200, UOM: &uom}, "required", "EPCClass"},
+		{"negative quantity", QuantityElement{EPCClass: "urn:epc:class:lgtin:4012345.012345.L1", Quantity: -5, UOM: &uom}, "min", "Quantity"},
+	}
+
+	validate := newEventValidator()
+	for _, eventType := range []EventType{ObjectEventType, AggregationEventType} {
+		for _, tt := range tests {
+			t.Run(string(eventType)+"/"+tt.name, func(t *testing.T) {
+				event := quantityEvent(eventType, []QuantityElement{tt.element})
+				err := validate.Struct(event)
+				if tt.wantTag == "" {
+					if err != nil {
+						t.Fatalf("Struct: %v", err)
+					}
+					return
+				}
+
+				var errs validator.ValidationErrors
+				if !errors.As(err, &errs) {
+					t.Fatalf("error = %v, want validation errors", err)
+				}
+				for _, fieldErr := range errs {
+					if fieldErr.Tag() == tt.wantTag && fieldErr.StructField() == tt.wantPath {
+						return
+					}
+				}
+				t.Errorf("errors = %v, want %s to fail %s", errs, tt.wantPath, tt.wantTag)
+			})
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"scain-backend/database"
+	"scain-backend/middleware"
+	"scain-backend/models"
+)
+
+// requireDefaultOrg rejects requests made for another organization than the
+// default one, which operates the deployment
+func requireDefaultOrg(c *gin.Context) bool {
+	if requestOrg(c) != database.DefaultOrganizationID {
+		c.JSON(http.StatusForbidden, ErrorResponse{
+			Error:   "Forbidden",
+			Message: "Only the default organization may manage organizations",
+			Code:    403,
+		})
+		return false
+	}
+	return true
+}
+
+// createOrganizationHandler handles organization creation
+func createOrganizationHandler(c *gin.Context) {
+	if !requireDefaultOrg(c) {
+		return
+	}
+
+	var request models.OrganizationRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationError := middleware.FormatValidationError(err)
+		c.JSON(http.StatusBadRequest, validationError)
+		return
+	}
+
+	if err := validate.Struct(&request); err != nil {
+		validationError := middleware.FormatValidationError(err)
+		c.JSON(http.StatusBadRequest, validationError)
+		return
+	}
+
+	org, err := organizationService.CreateOrganization(&request)
+	if err != nil {
+		if strings.HasSuffix(err.Error(), "already exists") {
+			c.JSON(http.StatusConflict, ErrorResponse{
+				Error:   "Organization already exists",
+				Message: err.Error(),
+				Code:    409,
+			})
+			return
+		}
+		logger.WithError(err).Error("Failed to create organization")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to create organization",
+			Code:    500,
+		})
+		return
+	}
+
+	c.Header("Location", "/api/organizations/"+org.ID)
+	c.JSON(http.StatusCreated, map[string]interface{}{
+		"status":       "created",
+		"organization": org,
+	})
+}
+
+// listOrganizationsHandler handles organization listing
+func listOrganizationsHandler(c *gin.Context) {
+	if !requireDefaultOrg(c) {
+		return
+	}
+
+	orgs, err := organizationService.ListOrganizations()
+	if err != nil {
+		logger.WithError(err).Error("Failed to list organizations")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to list organizations",
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"organizations": orgs,
+		"count":         len(orgs),
+	})
+}
+
+// getCurrentOrganizationHandler handles retrieval of the caller's organization
+func getCurrentOrganizationHandler(c *gin.Context) {
+	principal := middleware.GetPrincipal(c)
+	if principal == nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Error:   "Unauthorized",
+			Message: "An API key or bearer token is required",
+			Code:    401,
+		})
+		return
+	}
+
+	org, err := organizationService.GetOrganization(principal.OrgID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to get organization")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to get organization",
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"status":       "found",
+		"organization": org,
+	})
+}
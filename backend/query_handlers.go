@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"scain-backend/database"
+	"scain-backend/services"
+)
+
+const (
+	defaultQueryPerPage = 100
+	maxQueryPerPage     = 1000
+)
+
+// epcMatchParams maps the EPCIS MATCH_ query parameters to the event fields they search
+var epcMatchParams = map[string][]string{
+	"MATCH_epc":       {database.RoleEPCList, database.RoleChildEPCs},
+	"MATCH_parentID":  {database.RoleParentID},
+	"MATCH_inputEPC":  {database.RoleInputEPCList},
+	"MATCH_outputEPC": {database.RoleOutputEPCList},
+	"MATCH_anyEPC": {
+		database.RoleEPCList, database.RoleParentID, database.RoleChildEPCs,
+		database.RoleInputEPCList, database.RoleOutputEPCList,
+	},
+	"MATCH_epcClass":       {database.RoleQuantityList, database.RoleChildQuantityList},
+	"MATCH_inputEPCClass":  {database.RoleInputQuantityList},
+	"MATCH_outputEPCClass": {database.RoleOutputQuantityList},
+	"MATCH_anyEPCClass": {
+		database.RoleQuantityList, database.RoleChildQuantityList,
+		database.RoleInputQuantityList, database.RoleOutputQuantityList,
+	},
+}
+
+// queryEventsHandler handles EPCIS 2.0 event queries
+func queryEventsHandler(c *gin.Context) {
+	query, err := parseEventQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid query parameter",
+			Message: err.Error(),
+			Code:    400,
+		})
+		return
+	}
+
+	var ok bool
+	if query.Shared, ok = requestGrants(c); !ok {
+		return
+	}
+
+	document, err := epcisService.QueryEvents(query)
+	if err != nil {
+		logger.WithError(err).Error("Failed to query EPCIS events")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to query events",
+			Code:    500,
+		})
+		return
+	}
+
+	if document.NextPageToken != nil {
+		next := *c.Request.URL
+		params := next.Query()
+		params.Set("nextPageToken", *document.NextPageToken)
+		next.RawQuery = params.Encode()
+		c.Header("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	}
+
+	c.JSON(http.StatusOK, document)
+}
+
+// parseEventQuery builds an event query from the EPCIS query parameters
+func parseEventQuery(c *gin.Context) (*database.EventQuery, error) {
+	query := &database.EventQuery{
+		OrgID:             requestOrg(c),
+		EventTypes:        splitQueryParam(c, "eventType"),
+		Actions:           splitQueryParam(c, "EQ_action"),
+		BizSteps:          splitQueryParam(c, "EQ_bizStep"),
+		Dispositions:      splitQueryParam(c, "EQ_disposition"),
+		ReadPoints:        splitQueryParam(c, "EQ_readPoint"),
+		BizLocations:      splitQueryParam(c, "EQ_bizLocation"),
+		TransformationIDs: splitQueryParam(c, "EQ_transformationID"),
+		LotCodes:          splitQueryParam(c, "lotCode"),
+		DeviceIDs:         splitQueryParam(c, "deviceId"),
+		Limit:             defaultQueryPerPage,
+	}
+
+	for param, roles := range epcMatchParams {
+		if patterns := splitQueryParam(c, param); len(patterns) > 0 {
+			query.EPCMatches = append(query.EPCMatches, database.EPCMatch{Roles: roles, Patterns: patterns})
+		}
+	}
+
+	var err error
+	if query.GETime, err = parseTimeParam(c, "GE_eventTime"); err != nil {
+		return nil, err
+	}
+	if query.LTTime, err = parseTimeParam(c, "LT_eventTime"); err != nil {
+		return nil, err
+	}
+
+	if perPage := c.Query("perPage"); perPage != "" {
+		limit, err := strconv.Atoi(perPage)
+		if err != nil || limit < 1 || limit > maxQueryPerPage {
+			return nil, fmt.Errorf("perPage must be between 1 and %d", maxQueryPerPage)
+		}
+		query.Limit = limit
+	}
+
+	if token := c.Query("nextPageToken"); token != "" {
+		cursor, err := services.DecodePageToken(token)
+		if err != nil {
+			return nil, err
+		}
+		query.After = cursor
+	}
+
+	return query, nil
+}
+
+// splitQueryParam returns the comma-separated values of a query parameter
+func splitQueryParam(c *gin.Context, name string) []string {
+	var values []string
+	for _, param := range c.QueryArray(name) {
+		for _, value := range strings.Split(param, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// parseTimeParam parses an optional RFC 3339 timestamp query parameter
+func parseTimeParam(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+	}
+	return &parsed, nil
+}
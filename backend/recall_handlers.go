@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"scain-backend/middleware"
+	"scain-backend/models"
+)
+
+// createRecallDrillHandler handles recall drill runs
+func createRecallDrillHandler(c *gin.Context) {
+	var request models.RecallDrillRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationError := middleware.FormatValidationError(err)
+		c.JSON(http.StatusBadRequest, validationError)
+		return
+	}
+
+	if err := validate.Struct(&request); err != nil {
+		validationError := middleware.FormatValidationError(err)
+		c.JSON(http.StatusBadRequest, validationError)
+		return
+	}
+
+	report, err := recallService.RunDrill(requestOrg(c), &request)
+	if err != nil {
+		logger.WithError(err).WithField("lotCode", request.LotCode).Error("Failed to run recall drill")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to run recall drill",
+			Code:    500,
+		})
+		return
+	}
+
+	c.Header("Location", "/api/recall-drills/"+report.ID)
+	c.JSON(http.StatusCreated, report)
+}
+
+// listRecallDrillsHandler handles recall drill history retrieval
+func listRecallDrillsHandler(c *gin.Context) {
+	limit := 0
+	if limitParam := c.Query("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Invalid query parameter",
+				Message: "limit must be a positive integer",
+				Code:    400,
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	drills, err := recallService.ListDrills(requestOrg(c), c.Query("lotCode"), limit)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list recall drills")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to list recall drills",
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"drills": drills,
+		"count":  len(drills),
+	})
+}
+
+// getRecallDrillHandler handles recall drill report retrieval
+func getRecallDrillHandler(c *gin.Context) {
+	drillID := c.Param("id")
+
+	report, err := recallService.GetDrill(requestOrg(c), drillID)
+	if err != nil {
+		logger.WithError(err).WithField("drillId", drillID).Error("Failed to retrieve recall drill")
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "Recall drill not found",
+			Message: err.Error(),
+			Code:    404,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
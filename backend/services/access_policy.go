@@ -0,0 +1,218 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"scain-backend/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Permissions granted to roles and required by routes
+const (
+	PermEventsRead          = "events:read"
+	PermEventsWrite         = "events:write"
+	PermEventsVerify        = "events:verify"
+	PermExportsRun          = "exports:run"
+	PermRecallsRead         = "recalls:read"
+	PermRecallsRun          = "recalls:run"
+	PermColdChainRead       = "coldchain:read"
+	PermColdChainManage     = "coldchain:manage"
+	PermAlertsRead          = "alerts:read"
+	PermAlertsManage        = "alerts:manage"
+	PermSubscriptionsRead   = "subscriptions:read"
+	PermSubscriptionsManage = "subscriptions:manage"
+	PermDevicesRead         = "devices:read"
+	PermDevicesManage       = "devices:manage"
+	PermIngestWrite         = "ingest:write"
+	PermIngestionsRead      = "ingestions:read"
+	PermIngestionsReplay    = "ingestions:replay"
+	PermClaimCodesIssue     = "claimcodes:issue"
+	PermAPIKeysManage       = "apikeys:manage"
+	PermOrgsManage          = "organizations:manage"
+	PermSharingRead         = "sharing:read"
+	PermSharingManage       = "sharing:manage"
+)
+
+// Permissions lists every permission, in the order they are documented
+var Permissions = []string{
+	PermEventsRead, PermEventsWrite, PermEventsVerify, PermExportsRun,
+	PermRecallsRead, PermRecallsRun, PermColdChainRead, PermColdChainManage,
+	PermAlertsRead, PermAlertsManage, PermSubscriptionsRead, PermSubscriptionsManage,
+	PermDevicesRead, PermDevicesManage, PermIngestWrite, PermIngestionsRead,
+	PermIngestionsReplay, PermClaimCodesIssue, PermAPIKeysManage, PermOrgsManage,
+	PermSharingRead, PermSharingManage,
+}
+
+// Role names of the default policy
+const (
+	RoleAdmin       = "admin"
+	RoleOperator    = "operator"
+	RoleQA          = "qa"
+	RoleAuditor     = "auditor"
+	RoleDevice      = models.PrincipalDevice      // every device API key
+	RoleIntegration = models.PrincipalIntegration // every integration API key
+)
+
+// Role grants permissions. A permission of "*" grants every permission and
+// one ending in ":*", e.g. "events:*", every permission of that resource.
+type Role struct {
+	Name        string   `yaml:"name" json:"name"`
+	Permissions []string `yaml:"permissions" json:"permissions"`
+}
+
+// accessPolicyFile is the layout of the file RBAC_POLICY_PATH points to
+type accessPolicyFile struct {
+	Roles []Role `yaml:"roles"`
+}
+
+// DefaultRoles are the roles used when RBAC_POLICY_PATH is not set
+var DefaultRoles = []Role{
+	{
+		Name:        RoleAdmin,
+		Permissions: []string{"*"},
+	},
+	{
+		Name: RoleOperator,
+		Permissions: []string{
+			PermEventsRead, PermEventsWrite, PermDevicesRead, PermDevicesManage,
+			PermIngestWrite, PermIngestionsRead, PermIngestionsReplay,
+			PermColdChainRead, PermAlertsRead, PermAlertsManage, PermRecallsRead,
+		},
+	},
+	{
+		Name: RoleQA,
+		Permissions: []string{
+			PermEventsRead, PermEventsVerify, PermExportsRun, PermRecallsRead,
+			PermRecallsRun, PermColdChainRead, PermColdChainManage, PermAlertsRead,
+			PermAlertsManage, PermDevicesRead, PermIngestionsRead, PermSharingRead,
+		},
+	},
+	{
+		// Read-only access to events and their verification, nothing else
+		Name:        RoleAuditor,
+		Permissions: []string{PermEventsRead, PermEventsVerify},
+	},
+	{
+		Name:        RoleDevice,
+		Permissions: []string{PermIngestWrite},
+	},
+	{
+		Name:        RoleIntegration,
+		Permissions: []string{PermEventsRead, PermEventsWrite, PermIngestWrite},
+	},
+}
+
+// AccessPolicy maps the roles of principals to the permissions they hold
+type AccessPolicy struct {
+	roles  []Role
+	grants map[string]map[string]bool // role name to granted permissions
+}
+
+// NewAccessPolicy creates the access policy. Roles are read from the YAML or
+// JSON file RBAC_POLICY_PATH points to, or else the default roles are used.
+// A policy file that cannot be loaded is an error rather than a fallback to
+// the default roles, which may grant more than the file intended.
+func NewAccessPolicy() (*AccessPolicy, error) {
+	roles := DefaultRoles
+	if path := os.Getenv("RBAC_POLICY_PATH"); path != "" {
+		loaded, err := LoadAccessPolicy(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load access policy from %s: %w", path, err)
+		}
+		roles = loaded
+		logger.WithField("roles", len(roles)).Info("Access policy loaded")
+	}
+
+	policy := &AccessPolicy{
+		roles:  roles,
+		grants: make(map[string]map[string]bool, len(roles)),
+	}
+	for _, role := range roles {
+		grants := make(map[string]bool, len(role.Permissions))
+		for _, permission := range role.Permissions {
+			grants[permission] = true
+		}
+		policy.grants[role.Name] = grants
+	}
+	return policy, nil
+}
+
+// LoadAccessPolicy reads and checks roles from a YAML or JSON file
+func LoadAccessPolicy(path string) ([]Role, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON policies are valid YAML
+	var file accessPolicyFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for i, role := range file.Roles {
+		if role.Name == "" {
+			return nil, fmt.Errorf("role %d: name is required", i)
+		}
+		if names[role.Name] {
+			return nil, fmt.Errorf("role %d: duplicate name %s", i, role.Name)
+		}
+		names[role.Name] = true
+		for _, permission := range role.Permissions {
+			if !knownPermission(permission) {
+				return nil, fmt.Errorf("role %s: unknown permission %s", role.Name, permission)
+			}
+		}
+	}
+	return file.Roles, nil
+}
+
+// knownPermission reports whether a permission, or a wildcard, is one routes require
+func knownPermission(permission string) bool {
+	if permission == "*" {
+		return true
+	}
+	for _, known := range Permissions {
+		if known == permission || strings.HasSuffix(permission, ":*") && strings.HasPrefix(known, strings.TrimSuffix(permission, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Roles returns the roles of the policy
+func (p *AccessPolicy) Roles() []Role {
+	return p.roles
+}
+
+// Allowed reports whether any role of a principal grants a permission
+func (p *AccessPolicy) Allowed(principal *models.Principal, permission string) bool {
+	if principal == nil {
+		return false
+	}
+	resource, _, _ := strings.Cut(permission, ":")
+	for _, role := range principal.Roles {
+		grants := p.grants[role]
+		if grants["*"] || grants[permission] || grants[resource+":*"] {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the permissions a principal holds, sorted
+func (p *AccessPolicy) Permissions(principal *models.Principal) []string {
+	permissions := []string{}
+	for _, permission := range Permissions {
+		if p.Allowed(principal, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	sort.Strings(permissions)
+	return permissions
+}
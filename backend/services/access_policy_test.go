@@ -0,0 +1,87 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"scain-backend/models"
+)
+
+// writePolicy writes a policy file to a temporary directory and points
+// RBAC_POLICY_PATH to it
+func writePolicy(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rbac-policy.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+	t.Setenv("RBAC_POLICY_PATH", path)
+}
+
+func TestNewAccessPolicy(t *testing.T) {
+	writePolicy(t, `
+roles:
+  - name: auditor
+    permissions: [events:*]
+`)
+	policy, err := NewAccessPolicy()
+	if err != nil {
+		t.Fatalf("NewAccessPolicy: %v", err)
+	}
+	if len(policy.Roles()) != 1 {
+		t.Fatalf("got %d roles, want only the ones of the file", len(policy.Roles()))
+	}
+
+	auditor := &models.Principal{Roles: []string{RoleAuditor}}
+	if !policy.Allowed(auditor, PermEventsVerify) {
+		t.Error("events:* does not grant events:verify")
+	}
+	if policy.Allowed(auditor, PermDevicesRead) {
+		t.Error("events:* grants devices:read")
+	}
+	// Roles the file leaves out hold no permissions
+	if policy.Allowed(&models.Principal{Roles: []string{RoleAdmin}}, PermEventsRead) {
+		t.Error("admin, which the file leaves out, is granted events:read")
+	}
+}
+
+func TestNewAccessPolicyDefaultRoles(t *testing.T) {
+	t.Setenv("RBAC_POLICY_PATH", "")
+	policy, err := NewAccessPolicy()
+	if err != nil {
+		t.Fatalf("NewAccessPolicy: %v", err)
+	}
+	if len(policy.Roles()) != len(DefaultRoles) {
+		t.Errorf("got %d roles, want the %d default roles", len(policy.Roles()), len(DefaultRoles))
+	}
+}
+
+func TestNewAccessPolicyRejectsInvalidFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"malformed YAML", "roles: [name: admin\n  permissions: *"},
+		{"roles not a list", "roles: admin"},
+		{"role without name", "roles:\n  - permissions: [events:read]"},
+		{"duplicate role", "roles:\n  - name: qa\n  - name: qa"},
+		{"unknown permission", "roles:\n  - name: qa\n    permissions: [events:delete]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writePolicy(t, tt.content)
+			// Failing open to the default roles would grant more than the file intended
+			if policy, err := NewAccessPolicy(); err == nil {
+				t.Fatalf("NewAccessPolicy accepted the file with %d roles", len(policy.Roles()))
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Setenv("RBAC_POLICY_PATH", filepath.Join(t.TempDir(), "missing.yaml"))
+		if _, err := NewAccessPolicy(); err == nil {
+			t.Fatal("NewAccessPolicy accepted a missing file")
+		}
+	})
+}
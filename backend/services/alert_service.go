@@ -0,0 +1,603 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"scain-backend/database"
+	"scain-backend/models"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// Alert rule metrics. Sensor readings are matched with the sensor metric prefix
+// followed by the CBV sensor type, e.g. sensor.gs1:Temperature.
+const (
+	MetricExcursionOpen    = "excursion.open"       // lot: number of open cold-chain excursions
+	MetricExcursionMinutes = "excursion.minutes"    // lot: cumulative minutes out of range
+	MetricDeviceSilent     = "device.silentMinutes" // device: minutes since the last heartbeat
+	MetricDeviceBattery    = "device.batteryPct"    // device: battery level in percent
+	MetricSensorPrefix     = "sensor."              // device: latest reading of a sensor type
+)
+
+// Alert subject types
+const (
+	AlertSubjectDevice = "device"
+	AlertSubjectLot    = "lot"
+)
+
+// Alert severities
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// DefaultAlertCheckInterval is how often device state and escalations are
+// checked, in seconds, when ALERT_CHECK_INTERVAL is not set
+const DefaultAlertCheckInterval = 60
+
+// AlertRule raises an alert for a device or lot while a metric compares to a
+// threshold. Notifications go to the named notifiers, every registered one when
+// none are named. An alert left open for EscalateAfterMinutes is escalated to
+// EscalateTo, again every EscalateAfterMinutes until it is acknowledged.
+type AlertRule struct {
+	Name                 string   `yaml:"name" json:"name"`
+	Metric               string   `yaml:"metric" json:"metric"`
+	Operator             string   `yaml:"operator" json:"operator"` // gt, gte, lt, lte, eq or ne
+	Threshold            float64  `yaml:"threshold" json:"threshold"`
+	Severity             string   `yaml:"severity" json:"severity"`
+	Message              string   `yaml:"message" json:"message,omitempty"`
+	Notifiers            []string `yaml:"notifiers" json:"notifiers,omitempty"`
+	EscalateAfterMinutes int      `yaml:"escalateAfterMinutes" json:"escalateAfterMinutes,omitempty"`
+	EscalateTo           []string `yaml:"escalateTo" json:"escalateTo,omitempty"`
+}
+
+// alertRulesFile is the layout of the file ALERT_RULES_PATH points to
+type alertRulesFile struct {
+	Rules []AlertRule `yaml:"rules"`
+}
+
+// DefaultAlertRules are the rules used when ALERT_RULES_PATH is not set
+var DefaultAlertRules = []AlertRule{
+	{
+		Name:                 "cold-chain-excursion",
+		Metric:               MetricExcursionOpen,
+		Operator:             "gt",
+		Threshold:            0,
+		Severity:             SeverityCritical,
+		Message:              "Lot is out of its cold-chain range",
+		EscalateAfterMinutes: 30,
+	},
+	{
+		Name:      "device-silent",
+		Metric:    MetricDeviceSilent,
+		Operator:  "gt",
+		Threshold: 30,
+		Severity:  SeverityWarning,
+		Message:   "Device stopped reporting",
+	},
+	{
+		Name:      "low-battery",
+		Metric:    MetricDeviceBattery,
+		Operator:  "lt",
+		Threshold: 20,
+		Severity:  SeverityWarning,
+		Message:   "Device battery is low",
+	},
+}
+
+// AlertService evaluates alert rules over stored events, device state and
+// cold-chain excursions, keeps one unresolved alert per rule and subject, and
+// notifies when alerts open, escalate and resolve
+type AlertService struct {
+	mu            sync.Mutex // serializes evaluation, events are stored by several workers
+	rules         []AlertRule
+	checkInterval time.Duration
+	stop          chan struct{}
+	wg            sync.WaitGroup
+}
+
+// NewAlertService creates a new alert service. Rules are read from the YAML or
+// JSON file ALERT_RULES_PATH points to, and notifiers from the environment.
+func NewAlertService() *AlertService {
+	registerEnvNotifiers()
+
+	rules := DefaultAlertRules
+	if path := os.Getenv("ALERT_RULES_PATH"); path != "" {
+		loaded, err := LoadAlertRules(path)
+		if err != nil {
+			logger.Errorf("Failed to load alert rules from %s: %v", path, err)
+		} else {
+			rules = loaded
+			logger.WithField("rules", len(rules)).Info("Alert rules loaded")
+		}
+	}
+
+	return &AlertService{
+		rules:         rules,
+		checkInterval: time.Duration(envInt("ALERT_CHECK_INTERVAL", DefaultAlertCheckInterval)) * time.Second,
+		stop:          make(chan struct{}),
+	}
+}
+
+// LoadAlertRules reads and checks alert rules from a YAML or JSON file
+func LoadAlertRules(path string) ([]AlertRule, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON rules are valid YAML
+	var file alertRulesFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for i := range file.Rules {
+		rule := &file.Rules[i]
+		if err := checkAlertRule(rule); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("rule %d: duplicate name %s", i, rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	return file.Rules, nil
+}
+
+// checkAlertRule checks a rule and fills in its default severity
+func checkAlertRule(rule *AlertRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if alertSubjectType(rule.Metric) == "" {
+		return fmt.Errorf("unknown metric %q", rule.Metric)
+	}
+	if _, ok := compareOperators[rule.Operator]; !ok {
+		return fmt.Errorf("operator must be gt, gte, lt, lte, eq or ne")
+	}
+	switch rule.Severity {
+	case "":
+		rule.Severity = SeverityWarning
+	case SeverityInfo, SeverityWarning, SeverityCritical:
+	default:
+		return fmt.Errorf("severity must be info, warning or critical")
+	}
+	if rule.EscalateAfterMinutes < 0 {
+		return fmt.Errorf("escalateAfterMinutes must not be negative")
+	}
+	return nil
+}
+
+// compareOperators maps rule operators to comparisons and their symbols
+var compareOperators = map[string]struct {
+	symbol  string
+	compare func(value, threshold float64) bool
+}{
+	"gt":  {">", func(v, t float64) bool { return v > t }},
+	"gte": {">=", func(v, t float64) bool { return v >= t }},
+	"lt":  {"<", func(v, t float64) bool { return v < t }},
+	"lte": {"<=", func(v, t float64) bool { return v <= t }},
+	"eq":  {"=", func(v, t float64) bool { return v == t }},
+	"ne":  {"!=", func(v, t float64) bool { return v != t }},
+}
+
+// alertSubjectType returns whether a metric is measured on devices or lots,
+// or an empty string for unknown metrics
+func alertSubjectType(metric string) string {
+	switch {
+	case metric == MetricExcursionOpen, metric == MetricExcursionMinutes:
+		return AlertSubjectLot
+	case metric == MetricDeviceSilent, metric == MetricDeviceBattery:
+		return AlertSubjectDevice
+	case strings.HasPrefix(metric, MetricSensorPrefix) && len(metric) > len(MetricSensorPrefix):
+		return AlertSubjectDevice
+	default:
+		return ""
+	}
+}
+
+// Rules returns the alert rules in effect
+func (s *AlertService) Rules() []AlertRule {
+	return s.rules
+}
+
+// Start launches the periodic check of device state and escalations
+func (s *AlertService) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.checkInterval)
+		defer ticker.Stop()
+		for {
+			s.Check(time.Now())
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	logger.WithFields(logrus.Fields{
+		"rules":     len(s.rules),
+		"notifiers": NotifierNames(),
+		"interval":  s.checkInterval.String(),
+	}).Info("Alerting started")
+}
+
+// Stop ends the periodic check
+func (s *AlertService) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+	logger.Info("Alerting stopped")
+}
+
+// Check evaluates the device rules against every active device and escalates
+// the open alerts that are due
+func (s *AlertService) Check(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	devices, err := database.ListActiveDevices()
+	if err != nil {
+		logger.WithError(err).Error("Failed to list devices for alerting")
+	}
+	for i := range devices {
+		device := &devices[i]
+		lastSeen := device.CreatedAt
+		if device.LastHeartbeat != nil {
+			lastSeen = *device.LastHeartbeat
+		}
+		s.evaluate(device.OrgID, AlertSubjectDevice, device.DeviceID, MetricDeviceSilent, now.Sub(lastSeen).Minutes(), now)
+		if device.BatteryPct != nil {
+			s.evaluate(device.OrgID, AlertSubjectDevice, device.DeviceID, MetricDeviceBattery, float64(*device.BatteryPct), now)
+		}
+	}
+
+	s.escalate(now)
+}
+
+// EventStored evaluates the sensor rules against the readings of an event and
+// the excursion rules against its lot. It runs after the cold-chain service
+// has applied the readings to the lot's excursions.
+func (s *AlertService) EventStored(event *models.EpcisEvent, dbEvent *database.Event) {
+	if len(event.SensorElementList) == 0 {
+		return
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, element := range event.SensorElementList {
+		deviceID := element.SensorMetaData.DeviceID
+		if deviceID == "" && event.DeviceID != nil {
+			deviceID = *event.DeviceID
+		}
+		if deviceID == "" {
+			continue
+		}
+		for _, report := range element.SensorReport {
+			if value, ok := models.SensorNumber(report.Value); ok {
+				s.evaluate(dbEvent.OrgID, AlertSubjectDevice, deviceID, MetricSensorPrefix+report.Type, value, now)
+			} else if report.MeanValue != nil {
+				s.evaluate(dbEvent.OrgID, AlertSubjectDevice, deviceID, MetricSensorPrefix+report.Type, *report.MeanValue, now)
+			}
+		}
+	}
+
+	if event.LotCode == nil {
+		return
+	}
+	excursions, err := database.ListExcursions(dbEvent.OrgID, *event.LotCode, "")
+	if err != nil {
+		logger.WithError(err).WithField("lotCode", *event.LotCode).Error("Failed to list excursions for alerting")
+		return
+	}
+	open := 0
+	for _, excursion := range excursions {
+		if excursion.Status == database.ExcursionOpen {
+			open++
+		}
+	}
+	s.evaluate(dbEvent.OrgID, AlertSubjectLot, *event.LotCode, MetricExcursionOpen, float64(open), now)
+	s.evaluate(dbEvent.OrgID, AlertSubjectLot, *event.LotCode, MetricExcursionMinutes, excursionMinutes(excursions), now)
+}
+
+// evaluate applies a metric value of a subject of an organization to the rules
+// on the metric: it opens an alert when the condition starts holding, counts an
+// occurrence while it holds and resolves the alert once it no longer does
+func (s *AlertService) evaluate(orgID, subjectType, subject, metric string, value float64, now time.Time) {
+	for i := range s.rules {
+		rule := &s.rules[i]
+		if rule.Metric != metric {
+			continue
+		}
+		if err := s.apply(orgID, rule, subjectType, subject, value, now); err != nil {
+			logger.WithError(err).WithFields(logrus.Fields{
+				"rule":    rule.Name,
+				"subject": subject,
+			}).Error("Failed to evaluate alert rule")
+		}
+	}
+}
+
+// apply evaluates one rule for a subject of an organization
+func (s *AlertService) apply(orgID string, rule *AlertRule, subjectType, subject string, value float64, now time.Time) error {
+	operator := compareOperators[rule.Operator]
+	holds := operator.compare(value, rule.Threshold)
+
+	dedupKey := rule.Name + "|" + subjectType + ":" + subject
+	alert, err := database.GetUnresolvedAlert(orgID, dedupKey)
+	if err != nil {
+		return fmt.Errorf("failed to get unresolved alert: %w", err)
+	}
+
+	switch {
+	case alert != nil && holds:
+		alert.Occurrences++
+		alert.Value = value
+		alert.LastSeenAt = now
+		return database.SaveAlert(alert)
+
+	case alert != nil:
+		alert.Status = database.AlertResolved
+		alert.Value = value
+		alert.ResolvedAt = &now
+		if err := database.SaveAlert(alert); err != nil {
+			return err
+		}
+		logger.WithFields(logrus.Fields{
+			"alertId": alert.ID,
+			"rule":    alert.Rule,
+			"subject": subject,
+		}).Info("Alert resolved")
+		s.notify(rule.Notifiers, NotificationAlertResolved, alert)
+		return nil
+
+	case holds:
+		message := rule.Message
+		if message == "" {
+			message = rule.Name
+		}
+		alert = &database.Alert{
+			OrgID:       orgID,
+			Rule:        rule.Name,
+			Severity:    rule.Severity,
+			Status:      database.AlertOpen,
+			SubjectType: subjectType,
+			Subject:     subject,
+			DedupKey:    dedupKey,
+			Metric:      rule.Metric,
+			Value:       value,
+			Operator:    rule.Operator,
+			Threshold:   rule.Threshold,
+			Message:     message,
+			Occurrences: 1,
+			FirstSeenAt: now,
+			LastSeenAt:  now,
+		}
+		if err := database.SaveAlert(alert); err != nil {
+			return err
+		}
+		logger.WithFields(logrus.Fields{
+			"alertId":  alert.ID,
+			"rule":     alert.Rule,
+			"severity": alert.Severity,
+			"subject":  subject,
+			"value":    value,
+		}).Warn("Alert opened")
+		s.notify(rule.Notifiers, NotificationAlertOpened, alert)
+	}
+	return nil
+}
+
+// escalate notifies again about the open alerts that have not been
+// acknowledged within the escalation delay of their rule
+func (s *AlertService) escalate(now time.Time) {
+	alerts, err := database.ListAlerts(&database.AlertFilter{Status: database.AlertOpen})
+	if err != nil {
+		logger.WithError(err).Error("Failed to list open alerts")
+		return
+	}
+
+	for i := range alerts {
+		alert := &alerts[i]
+		rule := s.rule(alert.Rule)
+		if rule == nil || rule.EscalateAfterMinutes == 0 {
+			continue
+		}
+		since := alert.FirstSeenAt
+		if alert.EscalatedAt != nil {
+			since = *alert.EscalatedAt
+		}
+		if now.Sub(since) < time.Duration(rule.EscalateAfterMinutes)*time.Minute {
+			continue
+		}
+
+		alert.Escalations++
+		alert.EscalatedAt = &now
+		if err := database.SaveAlert(alert); err != nil {
+			logger.WithError(err).WithField("alertId", alert.ID).Error("Failed to escalate alert")
+			continue
+		}
+		logger.WithFields(logrus.Fields{
+			"alertId":     alert.ID,
+			"rule":        alert.Rule,
+			"subject":     alert.Subject,
+			"escalations": alert.Escalations,
+		}).Warn("Alert escalated")
+
+		targets := rule.EscalateTo
+		if len(targets) == 0 {
+			targets = rule.Notifiers
+		}
+		s.notify(targets, NotificationAlertEscalated, alert)
+	}
+}
+
+// rule returns the rule with a name, or nil when it is no longer configured
+func (s *AlertService) rule(name string) *AlertRule {
+	for i := range s.rules {
+		if s.rules[i].Name == name {
+			return &s.rules[i]
+		}
+	}
+	return nil
+}
+
+// notify delivers a notification about an alert in the background to the
+// named notifiers, or to every registered notifier when none are named
+func (s *AlertService) notify(names []string, notificationType string, alert *database.Alert) {
+	if len(names) == 0 {
+		names = NotifierNames()
+	}
+	snapshot := *alert
+	notification := &AlertNotification{
+		Type:   notificationType,
+		Text:   alertText(notificationType, &snapshot),
+		Alert:  &snapshot,
+		SentAt: time.Now().UTC(),
+	}
+
+	for _, name := range names {
+		notifier, ok := GetNotifier(name)
+		if !ok {
+			logger.WithField("notifier", name).Warn("Alert notifier is not configured")
+			continue
+		}
+		go func(name string, notifier Notifier) {
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			defer cancel()
+			if err := notifier.Notify(ctx, notification); err != nil {
+				logger.WithError(err).WithFields(logrus.Fields{
+					"notifier": name,
+					"alertId":  alert.ID,
+					"type":     notificationType,
+				}).Error("Failed to deliver alert notification")
+			}
+		}(name, notifier)
+	}
+}
+
+// alertText summarizes an alert notification on one line
+func alertText(notificationType string, alert *database.Alert) string {
+	state := map[string]string{
+		NotificationAlertOpened:    "opened",
+		NotificationAlertEscalated: "escalated",
+		NotificationAlertResolved:  "resolved",
+	}[notificationType]
+	return fmt.Sprintf("[%s] %s %s: %s, %s %s %s %g (threshold %g)",
+		strings.ToUpper(alert.Severity), alert.Rule, state, alert.Message,
+		alert.SubjectType, alert.Subject, alert.Metric, alert.Value, alert.Threshold)
+}
+
+// ListAlerts retrieves alerts matching a filter, most recent first. Callers
+// set the organization of the filter.
+func (s *AlertService) ListAlerts(filter *database.AlertFilter) ([]database.Alert, error) {
+	alerts, err := database.ListAlerts(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alerts: %w", err)
+	}
+	return alerts, nil
+}
+
+// GetAlert retrieves an alert of an organization by ID
+func (s *AlertService) GetAlert(orgID, id string) (*database.Alert, error) {
+	alert, err := database.GetAlertByID(orgID, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("alert not found: %s", id)
+		}
+		return nil, fmt.Errorf("failed to get alert from database: %w", err)
+	}
+	return alert, nil
+}
+
+// Acknowledge records that someone is handling an open alert, which stops its
+// escalation. The alert still resolves by itself once its condition clears.
+func (s *AlertService) Acknowledge(orgID, id, by string) (*database.Alert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	alert, err := s.GetAlert(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	if alert.Status != database.AlertOpen {
+		return nil, fmt.Errorf("alert %s is already %s", id, alert.Status)
+	}
+
+	now := time.Now()
+	alert.Status = database.AlertAcknowledged
+	alert.AcknowledgedAt = &now
+	alert.AcknowledgedBy = &by
+	if err := database.SaveAlert(alert); err != nil {
+		return nil, fmt.Errorf("failed to acknowledge alert: %w", err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"alertId": alert.ID,
+		"by":      by,
+	}).Info("Alert acknowledged")
+	return alert, nil
+}
+
+// Resolve closes an alert by hand. When its condition still holds, the next
+// evaluation opens a new alert.
+func (s *AlertService) Resolve(orgID, id, by string) (*database.Alert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	alert, err := s.GetAlert(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	if alert.Status == database.AlertResolved {
+		return nil, fmt.Errorf("alert %s is already %s", id, alert.Status)
+	}
+
+	now := time.Now()
+	alert.Status = database.AlertResolved
+	alert.ResolvedAt = &now
+	alert.ResolvedBy = &by
+	if err := database.SaveAlert(alert); err != nil {
+		return nil, fmt.Errorf("failed to resolve alert: %w", err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"alertId": alert.ID,
+		"by":      by,
+	}).Info("Alert resolved")
+	if rule := s.rule(alert.Rule); rule != nil {
+		s.notify(rule.Notifiers, NotificationAlertResolved, alert)
+	}
+	return alert, nil
+}
+
+// TestNotifier delivers a test notification through a notifier and waits for
+// the outcome, to check its configuration
+func (s *AlertService) TestNotifier(name string) error {
+	notifier, ok := GetNotifier(name)
+	if !ok {
+		return fmt.Errorf("notifier not found: %s", name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	return notifier.Notify(ctx, &AlertNotification{
+		Type:   NotificationTest,
+		Text:   "Scain test notification",
+		SentAt: time.Now().UTC(),
+	})
+}
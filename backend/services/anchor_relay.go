@@ -0,0 +1,370 @@
+package services
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"scain-backend/database"
+	"scain-backend/models"
+	"scain-backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultAnchorMaxAttempts is the number of attempts when ANCHOR_MAX_ATTEMPTS is not set
+	DefaultAnchorMaxAttempts = 10
+	// DefaultAnchorBatchSize is the most events in a batch when ANCHOR_BATCH_SIZE is not set
+	DefaultAnchorBatchSize = 1000
+	// DefaultAnchorBatchInterval is how often a partial batch is sealed, in
+	// seconds, when ANCHOR_BATCH_INTERVAL is not set
+	DefaultAnchorBatchInterval = 60
+
+	// MerkleBatchEventType is the event type of the ledger records anchoring batch roots
+	MerkleBatchEventType = "MerkleBatch"
+
+	// anchorRetryBaseDelay is the delay before the first retry; it doubles with each attempt
+	anchorRetryBaseDelay = 5 * time.Second
+	// anchorRetryMaxDelay caps the delay between retries
+	anchorRetryMaxDelay = 30 * time.Minute
+	// anchorPollInterval is how often the idle relay looks for due retries and batches
+	anchorPollInterval = time.Second
+	// anchorSealAttempts is how often a batch is built again when its events
+	// change before it is stored
+	anchorSealAttempts = 3
+)
+
+// ErrAnchorNotFailed is returned when requeueing an event whose anchoring has not failed
+var ErrAnchorNotFailed = errors.New("only events whose anchoring failed can be requeued")
+
+// AnchorRelay anchors the events queued in the outbox on the ledger in the
+// background. It seals queued events into batches, a full batch at once and a
+// partial one periodically, and submits only the Merkle root of each batch.
+// Failed submissions are retried with exponential backoff until the last
+// attempt, after which anchoring of the batch and its events has failed.
+type AnchorRelay struct {
+	ledger        Ledger
+	maxAttempts   int
+	batchSize     int
+	batchInterval time.Duration
+	wake          chan struct{}
+	stop          chan struct{}
+	wg            sync.WaitGroup
+}
+
+// NewAnchorRelay creates a new anchor relay submitting to a ledger. The number
+// of attempts, batch size and batch interval are read from ANCHOR_MAX_ATTEMPTS,
+// ANCHOR_BATCH_SIZE and ANCHOR_BATCH_INTERVAL.
+func NewAnchorRelay(ledger Ledger) *AnchorRelay {
+	// Batches in flight belong to a previous process and are picked up again
+	if err := database.ResetInterruptedAnchorBatches(); err != nil {
+		logger.Warnf("Failed to reset interrupted anchor batches: %v", err)
+	}
+
+	return &AnchorRelay{
+		ledger:        ledger,
+		maxAttempts:   envInt("ANCHOR_MAX_ATTEMPTS", DefaultAnchorMaxAttempts),
+		batchSize:     envInt("ANCHOR_BATCH_SIZE", DefaultAnchorBatchSize),
+		batchInterval: time.Duration(envInt("ANCHOR_BATCH_INTERVAL", DefaultAnchorBatchInterval)) * time.Second,
+		wake:          make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+	}
+}
+
+// Start launches the relay. Without a ledger events stay pending until the
+// backend is started with one.
+func (r *AnchorRelay) Start() {
+	if r.ledger == nil {
+		logger.Info("No ledger configured, events are not anchored")
+		return
+	}
+
+	r.wg.Add(1)
+	go r.run()
+
+	logger.WithFields(logrus.Fields{
+		"ledger":        r.ledger.Name(),
+		"maxAttempts":   r.maxAttempts,
+		"batchSize":     r.batchSize,
+		"batchInterval": r.batchInterval,
+	}).Info("Anchor relay started")
+}
+
+// Stop signals the relay to exit and waits for a submission in progress to finish
+func (r *AnchorRelay) Stop() {
+	close(r.stop)
+	r.wg.Wait()
+	if r.ledger != nil {
+		logger.Info("Anchor relay stopped")
+	}
+}
+
+// Notify wakes the idle relay after an event has been queued
+func (r *AnchorRelay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// EventStored wakes the relay, which seals a batch once enough events are queued
+func (r *AnchorRelay) EventStored(event *models.EpcisEvent, dbEvent *database.Event) {
+	r.Notify()
+}
+
+// ListUnanchored retrieves the outbox entries of the events of an organization
+// that are not anchored yet, optionally only the pending or failed ones
+func (r *AnchorRelay) ListUnanchored(orgID, status string, limit int) ([]database.OutboxEntry, error) {
+	entries, err := database.ListUnanchoredOutboxEntries(&database.OutboxFilter{
+		OrgID:  orgID,
+		Status: status,
+		Limit:  limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unanchored events: %w", err)
+	}
+	return entries, nil
+}
+
+// Requeue queues the batch of an event of an organization whose anchoring
+// failed again with a fresh set of attempts
+func (r *AnchorRelay) Requeue(orgID, eventID string) (*database.Event, error) {
+	if _, err := database.GetEventByID(orgID, eventID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("event not found: %s", eventID)
+		}
+		return nil, fmt.Errorf("failed to get event from database: %w", err)
+	}
+
+	queued, err := database.RequeueAnchorBatch(orgID, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue event for anchoring: %w", err)
+	}
+	if !queued {
+		return nil, ErrAnchorNotFailed
+	}
+	r.Notify()
+
+	return database.GetEventByID(orgID, eventID)
+}
+
+// run seals batches and submits them until the relay is stopped
+func (r *AnchorRelay) run() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(anchorPollInterval)
+	defer ticker.Stop()
+
+	lastFlush := time.Now()
+	flush := false
+	for {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+
+		batch, err := database.ClaimPendingAnchorBatch(time.Now())
+		if err != nil {
+			logger.WithError(err).Error("Failed to claim anchor batch")
+		}
+		if batch != nil {
+			r.anchor(batch)
+			continue
+		}
+
+		// Partial batches are sealed once per interval
+		if time.Since(lastFlush) >= r.batchInterval {
+			lastFlush = time.Now()
+			flush = true
+		}
+		sealed, err := r.seal(flush)
+		if err != nil {
+			logger.WithError(err).Error("Failed to seal anchor batch")
+		}
+		if sealed {
+			continue
+		}
+		flush = false
+
+		select {
+		case <-r.stop:
+			return
+		case <-r.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// seal adds the oldest queued events of an organization to a new batch, when
+// a full batch is queued or partial batches are flushed, and reports whether
+// it did. Batches never mix organizations, so that an inclusion proof does not
+// reveal the hashes of other organizations' events.
+func (r *AnchorRelay) seal(flush bool) (bool, error) {
+	counts, err := database.CountUnbatchedOutboxEntries()
+	if err != nil {
+		return false, fmt.Errorf("failed to count queued events: %w", err)
+	}
+
+	orgID := ""
+	for _, count := range counts {
+		if count.Count > 0 && (flush || count.Count >= int64(r.batchSize)) {
+			orgID = count.OrgID
+			break
+		}
+	}
+	if orgID == "" {
+		return false, nil
+	}
+
+	// A replay may replace queued events between listing and storing the
+	// batch; the batch is then built again from the events as they are now
+	var batch *database.AnchorBatch
+	for attempt := 1; ; attempt++ {
+		events, err := database.ListUnbatchedEvents(orgID, r.batchSize)
+		if err != nil {
+			return false, fmt.Errorf("failed to list queued events: %w", err)
+		}
+		if len(events) == 0 {
+			return false, nil
+		}
+
+		var leaves []database.BatchLeaf
+		batch, leaves, err = buildAnchorBatch(orgID, events)
+		if err != nil {
+			return false, err
+		}
+		err = database.CreateAnchorBatch(batch, leaves)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, database.ErrBatchLeafChanged) || attempt == anchorSealAttempts {
+			return false, fmt.Errorf("failed to create anchor batch: %w", err)
+		}
+		logger.WithError(err).WithField("orgId", orgID).Debug("Queued events changed, rebuilding anchor batch")
+	}
+
+	logger.WithFields(logrus.Fields{
+		"batchId": batch.ID,
+		"orgId":   batch.OrgID,
+		"size":    batch.Size,
+		"root":    batch.Root,
+	}).Info("Anchor batch sealed")
+	return true, nil
+}
+
+// buildAnchorBatch computes the Merkle tree over the hashes of events of an
+// organization and returns the batch and the path of each event to its root
+func buildAnchorBatch(orgID string, events []database.Event) (*database.AnchorBatch, []database.BatchLeaf, error) {
+	hashes := make([][]byte, len(events))
+	for i, event := range events {
+		leaf, err := utils.MerkleLeafHash(event.Hash)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to hash event %s: %w", event.ID, err)
+		}
+		hashes[i] = leaf
+	}
+	root, paths := utils.BuildMerkleTree(hashes)
+
+	leaves := make([]database.BatchLeaf, len(events))
+	for i, event := range events {
+		path := paths[i]
+		if path == nil {
+			path = []utils.MerkleStep{}
+		}
+		pathJSON, err := json.Marshal(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal Merkle path: %w", err)
+		}
+		leaves[i] = database.BatchLeaf{EventID: event.ID, Hash: event.Hash, MerklePath: string(pathJSON)}
+	}
+
+	batch := &database.AnchorBatch{
+		ID:     uuid.New().String(),
+		OrgID:  orgID,
+		Root:   hex.EncodeToString(root),
+		Size:   len(events),
+		Status: database.AnchorPending,
+	}
+	return batch, leaves, nil
+}
+
+// anchor runs one attempt at submitting the root of a batch and records its outcome
+func (r *AnchorRelay) anchor(batch *database.AnchorBatch) {
+	batch.Attempts++
+	fields := logrus.Fields{
+		"batchId": batch.ID,
+		"size":    batch.Size,
+		"attempt": batch.Attempts,
+	}
+
+	txID, retry, err := r.submit(batch)
+
+	now := time.Now()
+	if err != nil {
+		message := err.Error()
+		batch.LastError = &message
+
+		if !retry || batch.Attempts >= r.maxAttempts {
+			batch.Status = database.AnchorFailed
+			batch.NextAttemptAt = nil
+			logger.WithError(err).WithFields(fields).Error("Anchor batch failed")
+		} else {
+			next := now.Add(backoffDelay(batch.Attempts, anchorRetryBaseDelay, anchorRetryMaxDelay))
+			batch.Status = database.AnchorPending
+			batch.NextAttemptAt = &next
+			logger.WithError(err).WithFields(fields).Warn("Anchor batch attempt failed, retrying")
+		}
+	} else {
+		batch.Status = database.AnchorAnchored
+		batch.AnchoredAt = &now
+		batch.NextAttemptAt = nil
+		batch.LastError = nil
+		if txID != "" {
+			batch.TxID = &txID
+		}
+		fields["txId"] = txID
+		logger.WithFields(fields).Info("Anchor batch anchored on ledger")
+	}
+
+	if err := database.UpdateAnchorBatch(batch); err != nil {
+		logger.WithError(err).WithFields(fields).Error("Failed to update anchor batch")
+	}
+}
+
+// submit anchors the root of a batch and returns its ledger transaction ID, or
+// whether a failed submission is worth retrying
+func (r *AnchorRelay) submit(batch *database.AnchorBatch) (string, bool, error) {
+	txID, err := r.ledger.Submit(batchRecord(batch))
+	if !errors.Is(err, ErrLedgerRecordExists) {
+		return txID, true, err
+	}
+
+	// An earlier submission reached the ledger but was not recorded because
+	// the process stopped. It only counts when the ledger holds the same root.
+	record, err := r.ledger.Get(batch.ID)
+	if err != nil {
+		return "", true, fmt.Errorf("failed to get batch from ledger: %w", err)
+	}
+	if record.EventHash != batch.Root {
+		return "", false, fmt.Errorf("ledger already anchors batch %s with a different root", batch.ID)
+	}
+	return record.TxID, true, nil
+}
+
+// batchRecord builds the ledger record anchoring the root of a batch
+func batchRecord(batch *database.AnchorBatch) *EventRecord {
+	return &EventRecord{
+		EventID:   batch.ID,
+		EventHash: batch.Root,
+		Timestamp: time.Now().UTC(),
+		EventType: MerkleBatchEventType,
+		Data:      fmt.Sprintf(`{"size":%d}`, batch.Size),
+	}
+}
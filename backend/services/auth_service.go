@@ -0,0 +1,223 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"scain-backend/database"
+	"scain-backend/models"
+	"scain-backend/utils"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// API key prefixes, telling device and integration keys apart at a glance
+const (
+	deviceKeyPrefix      = "scd_"
+	integrationKeyPrefix = "sci_"
+
+	// apiKeyDisplayLength is how much of a key is kept to identify it
+	apiKeyDisplayLength = 12
+)
+
+// ErrUnauthenticated is returned for credentials that do not identify a caller
+var ErrUnauthenticated = errors.New("invalid or revoked credentials")
+
+// AuthService authenticates devices and integrations by API key and dashboard
+// users by bearer token, and issues integration API keys
+type AuthService struct {
+	jwtSecret      string // HS256 tokens
+	nextAuthSecret string // NextAuth.js session tokens
+}
+
+// NewAuthService creates a new auth service. User tokens are verified with
+// JWT_SECRET (HS256) and NEXTAUTH_SECRET (NextAuth.js session tokens); users
+// cannot authenticate when neither is set.
+func NewAuthService() *AuthService {
+	service := &AuthService{
+		jwtSecret:      os.Getenv("JWT_SECRET"),
+		nextAuthSecret: os.Getenv("NEXTAUTH_SECRET"),
+	}
+	if service.jwtSecret == "" && service.nextAuthSecret == "" {
+		logger.Warn("Neither JWT_SECRET nor NEXTAUTH_SECRET is set, user tokens are rejected")
+	}
+	return service
+}
+
+// Authenticate returns the principal of an API key or a user token
+func (s *AuthService) Authenticate(credential string) (*models.Principal, error) {
+	if strings.HasPrefix(credential, deviceKeyPrefix) || strings.HasPrefix(credential, integrationKeyPrefix) {
+		return s.authenticateKey(credential)
+	}
+	return s.authenticateToken(credential)
+}
+
+// authenticateKey looks up an API key by its hash
+func (s *AuthService) authenticateKey(key string) (*models.Principal, error) {
+	record, err := database.GetAPIKeyByHash(hashAPIKey(key))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrUnauthenticated
+		}
+		return nil, fmt.Errorf("failed to look up API key: %w", err)
+	}
+	if record.RevokedAt != nil {
+		return nil, ErrUnauthenticated
+	}
+
+	// Last use is informational, it must not fail the request
+	if err := database.TouchAPIKey(record.ID, time.Now()); err != nil {
+		logger.WithError(err).WithField("keyId", record.ID).Warn("Failed to record API key use")
+	}
+
+	// API keys hold the role named after their principal type
+	principal := &models.Principal{
+		Type:  models.PrincipalIntegration,
+		ID:    record.ID,
+		OrgID: record.OrgID,
+		Name:  record.Name,
+		Roles: []string{RoleIntegration},
+	}
+	if record.Kind == database.APIKeyDevice && record.DeviceID != nil {
+		principal.Type = models.PrincipalDevice
+		principal.DeviceID = *record.DeviceID
+		principal.Roles = []string{RoleDevice}
+	}
+	return principal, nil
+}
+
+// authenticateToken verifies an HS256 token or decrypts a NextAuth.js session
+// token, whichever the token is
+func (s *AuthService) authenticateToken(token string) (*models.Principal, error) {
+	var claims utils.JWTClaims
+	var err error
+	switch strings.Count(token, ".") {
+	case 2:
+		if s.jwtSecret == "" {
+			return nil, ErrUnauthenticated
+		}
+		claims, err = utils.VerifyHS256(token, s.jwtSecret)
+	case 4:
+		if s.nextAuthSecret == "" {
+			return nil, ErrUnauthenticated
+		}
+		claims, err = utils.DecryptNextAuthJWE(token, s.nextAuthSecret)
+	default:
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		logger.WithError(err).Debug("Rejected user token")
+		return nil, ErrUnauthenticated
+	}
+
+	principal := &models.Principal{
+		Type:  models.PrincipalUser,
+		ID:    claims.String("sub"),
+		OrgID: claims.String("org"),
+		Name:  claims.String("name"),
+		Email: claims.String("email"),
+		Roles: claims.Strings("roles"),
+	}
+	if principal.ID == "" {
+		principal.ID = principal.Email
+	}
+	if principal.ID == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	// Users of single-organization deployments carry no org claim
+	if principal.OrgID == "" {
+		principal.OrgID = database.DefaultOrganizationID
+	}
+	if _, err := database.GetOrganizationByID(principal.OrgID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logger.WithField("orgId", principal.OrgID).Debug("Rejected user token of an unknown organization")
+			return nil, ErrUnauthenticated
+		}
+		return nil, fmt.Errorf("failed to look up organization: %w", err)
+	}
+	return principal, nil
+}
+
+// CreateIntegrationKey issues an API key for an integration of an organization,
+// such as an ERP. The key is returned once and cannot be retrieved later.
+func (s *AuthService) CreateIntegrationKey(orgID string, request *models.APIKeyRequest) (*database.APIKey, string, error) {
+	return issueAPIKey(orgID, database.APIKeyIntegration, request.Name, nil)
+}
+
+// ListAPIKeys retrieves the API keys of an organization of a kind, or of every kind
+func (s *AuthService) ListAPIKeys(orgID, kind string) ([]database.APIKey, error) {
+	keys, err := database.ListAPIKeys(orgID, kind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an API key of an organization, which stops
+// authenticating at once
+func (s *AuthService) RevokeAPIKey(orgID, id string) error {
+	if err := database.RevokeAPIKey(orgID, id, time.Now()); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("API key not found: %s", id)
+		}
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	logger.WithField("keyId", id).Info("API key revoked")
+	return nil
+}
+
+// issueAPIKey generates and stores an API key of a kind for an organization,
+// returning the record and the key
+func issueAPIKey(orgID, kind, name string, deviceID *string) (*database.APIKey, string, error) {
+	return issueAPIKeyTx(database.DB, orgID, kind, name, deviceID)
+}
+
+// issueAPIKeyTx generates and stores an API key of a kind for an organization
+// using the given transaction, returning the record and the key
+func issueAPIKeyTx(tx *gorm.DB, orgID, kind, name string, deviceID *string) (*database.APIKey, string, error) {
+	secret, err := utils.GenerateRandomHash()
+	if err != nil {
+		return nil, "", err
+	}
+	prefix := integrationKeyPrefix
+	if kind == database.APIKeyDevice {
+		prefix = deviceKeyPrefix
+	}
+	key := prefix + secret
+
+	record := &database.APIKey{
+		OrgID:    orgID,
+		Kind:     kind,
+		Name:     name,
+		DeviceID: deviceID,
+		Prefix:   key[:apiKeyDisplayLength],
+		KeyHash:  hashAPIKey(key),
+	}
+	if err := database.CreateAPIKeyTx(tx, record); err != nil {
+		return nil, "", fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"keyId":  record.ID,
+		"orgId":  orgID,
+		"kind":   kind,
+		"name":   name,
+		"prefix": record.Prefix,
+	}).Info("API key issued")
+	return record, key, nil
+}
+
+// hashAPIKey returns the stored form of an API key. Keys are random, so an
+// unsalted hash is enough to keep them from being read back.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"scain-backend/database"
+	"scain-backend/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// CaptureService handles asynchronous capture of EPCIS documents
+type CaptureService struct {
+	epcisService *EPCISService
+}
+
+// NewCaptureService creates a new capture service instance
+func NewCaptureService(epcisService *EPCISService) *CaptureService {
+	// Jobs still running belong to a previous process and will never finish
+	if err := database.FailInterruptedCaptureJobs(); err != nil {
+		logger.Warnf("Failed to mark interrupted capture jobs as failed: %v", err)
+	}
+
+	return &CaptureService{epcisService: epcisService}
+}
+
+// StartCapture creates a capture job for a validated document of an
+// organization and processes it in the background. The job can be polled with
+// GetCaptureJob. FSMA 204 warnings found while validating are kept with the job.
+func (s *CaptureService) StartCapture(orgID string, document *models.EPCISDocument, warnings []models.FSMA204Check) (*models.CaptureJobStatus, error) {
+	job := &database.CaptureJob{
+		OrgID:      orgID,
+		Status:     database.CaptureRunning,
+		EventCount: len(document.EPCISBody.EventList),
+	}
+	if len(warnings) > 0 {
+		warningsJSON, _ := json.Marshal(warnings)
+		job.Warnings = string(warningsJSON)
+	}
+	if err := database.CreateCaptureJob(job); err != nil {
+		return nil, fmt.Errorf("failed to create capture job: %w", err)
+	}
+
+	go s.runCapture(job, document)
+
+	return captureJobStatus(job), nil
+}
+
+// GetCaptureJob retrieves the status of a capture job of an organization
+func (s *CaptureService) GetCaptureJob(orgID, id string) (*models.CaptureJobStatus, error) {
+	job, err := database.GetCaptureJobByID(orgID, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("capture job not found: %s", id)
+		}
+		return nil, fmt.Errorf("failed to get capture job from database: %w", err)
+	}
+
+	return captureJobStatus(job), nil
+}
+
+// runCapture stores every event of a document in one transaction so that the
+// capture either succeeds completely or leaves no events behind
+func (s *CaptureService) runCapture(job *database.CaptureJob, document *models.EPCISDocument) {
+	events := make([]*models.EpcisEvent, len(document.EPCISBody.EventList))
+	for i := range document.EPCISBody.EventList {
+		events[i] = &document.EPCISBody.EventList[i]
+	}
+
+	var dbEvents []*database.Event
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := database.UpsertMasterDataTx(tx, masterDataElements(job.OrgID, document)); err != nil {
+			return fmt.Errorf("failed to store master data: %w", err)
+		}
+
+		for i, event := range events {
+			dbEvent, err := s.epcisService.CreateEventTx(tx, job.OrgID, event)
+			if err != nil {
+				return fmt.Errorf("event %d: %w", i, err)
+			}
+			dbEvents = append(dbEvents, dbEvent)
+		}
+		return nil
+	})
+
+	now := time.Now()
+	job.FinishedAt = &now
+
+	if err != nil {
+		message := err.Error()
+		job.Status = database.CaptureFailed
+		job.ErrorMessage = &message
+		logger.WithError(err).WithField("captureId", job.ID).Error("EPCIS capture failed")
+	} else {
+		eventIDs := make([]string, len(dbEvents))
+		for i, dbEvent := range dbEvents {
+			eventIDs[i] = dbEvent.ID
+			s.epcisService.EventCommitted(events[i], dbEvent)
+		}
+		eventIDsJSON, _ := json.Marshal(eventIDs)
+		job.Status = database.CaptureSucceeded
+		job.EventIDs = string(eventIDsJSON)
+	}
+
+	if err := database.UpdateCaptureJob(job); err != nil {
+		logger.WithError(err).WithField("captureId", job.ID).Error("Failed to update capture job")
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"captureId":  job.ID,
+		"status":     job.Status,
+		"eventCount": job.EventCount,
+	}).Info("EPCIS capture finished")
+}
+
+// masterDataElements flattens the master data vocabularies of a document header
+// into the master data of an organization
+func masterDataElements(orgID string, document *models.EPCISDocument) []database.MasterDataElement {
+	if document.EPCISHeader == nil || document.EPCISHeader.EPCISMasterData == nil {
+		return nil
+	}
+
+	var elements []database.MasterDataElement
+	positions := make(map[string]int)
+	for _, vocabulary := range document.EPCISHeader.EPCISMasterData.VocabularyList {
+		for _, element := range vocabulary.VocabularyElementList {
+			attributesJSON, _ := json.Marshal(element.Attributes)
+			record := database.MasterDataElement{
+				OrgID:      orgID,
+				ID:         element.ID,
+				Type:       vocabulary.Type,
+				Attributes: string(attributesJSON),
+			}
+
+			// A later definition of the same element replaces the earlier one
+			if i, exists := positions[element.ID]; exists {
+				elements[i] = record
+				continue
+			}
+			positions[element.ID] = len(elements)
+			elements = append(elements, record)
+		}
+	}
+	return elements
+}
+
+// captureJobStatus converts a capture job record to its EPCIS status representation
+func captureJobStatus(job *database.CaptureJob) *models.CaptureJobStatus {
+	status := &models.CaptureJobStatus{
+		CaptureID:             job.ID,
+		CreatedAt:             job.CreatedAt,
+		FinishedAt:            job.FinishedAt,
+		Running:               job.Status == database.CaptureRunning,
+		Success:               job.Status == database.CaptureSucceeded,
+		CaptureErrorBehaviour: "rollback",
+		Errors:                []string{},
+		EventCount:            job.EventCount,
+	}
+
+	if job.ErrorMessage != nil {
+		status.Errors = append(status.Errors, *job.ErrorMessage)
+	}
+	if job.EventIDs != "" {
+		json.Unmarshal([]byte(job.EventIDs), &status.EventIDs)
+	}
+	if job.Warnings != "" {
+		json.Unmarshal([]byte(job.Warnings), &status.Warnings)
+	}
+
+	return status
+}
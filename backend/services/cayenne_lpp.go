@@ -0,0 +1,126 @@
+package services
+
+import (
+	"fmt"
+)
+
+// CayenneLPPCodecName is the name of the Cayenne Low Power Payload codec
+const CayenneLPPCodecName = "cayenne-lpp"
+
+// cayenneType describes a Cayenne LPP data type: the name of its readings, the
+// number of values and their size in bytes, whether they are signed, and the
+// resolution of one unit
+type cayenneType struct {
+	name       string
+	values     int
+	size       int
+	signed     bool
+	resolution float64
+	uom        string
+}
+
+// cayenneTypes maps Cayenne LPP type IDs to their layout
+var cayenneTypes = map[byte]cayenneType{
+	0:   {"digitalInput", 1, 1, false, 1, ""},
+	1:   {"digitalOutput", 1, 1, false, 1, ""},
+	2:   {"analogInput", 1, 2, true, 0.01, ""},
+	3:   {"analogOutput", 1, 2, true, 0.01, ""},
+	100: {"genericSensor", 1, 4, false, 1, ""},
+	101: {"illuminance", 1, 2, false, 1, "LUX"},
+	102: {"presence", 1, 1, false, 1, ""},
+	103: {"temperature", 1, 2, true, 0.1, "CEL"},
+	104: {"humidity", 1, 1, false, 0.5, "P1"},
+	113: {"accelerometer", 3, 2, true, 0.001, ""},
+	115: {"barometer", 1, 2, false, 0.1, "A97"},
+	116: {"voltage", 1, 2, false, 0.01, "VLT"},
+	117: {"current", 1, 2, false, 0.001, "AMP"},
+	118: {"frequency", 1, 4, false, 1, "HTZ"},
+	120: {"percentage", 1, 1, false, 1, "P1"},
+	121: {"altitude", 1, 2, true, 1, "MTR"},
+	125: {"concentration", 1, 2, false, 1, "59"},
+	128: {"power", 1, 2, false, 1, "WTT"},
+	130: {"distance", 1, 4, false, 0.001, "MTR"},
+	131: {"energy", 1, 4, false, 0.001, "KWH"},
+	132: {"direction", 1, 2, false, 1, "DD"},
+	133: {"unixTime", 1, 4, false, 1, ""},
+	134: {"gyrometer", 3, 2, true, 0.01, ""},
+	135: {"colour", 3, 1, false, 1, ""},
+	142: {"switch", 1, 1, false, 1, ""},
+}
+
+// cayenneGPS is the type ID of a GPS location, whose values differ in resolution
+const cayenneGPS = 136
+
+// CayenneLPPCodec decodes Cayenne Low Power Payload. Each reading is keyed by
+// its type and channel, e.g. temperature_1. Readings with several values, such
+// as accelerometer or GPS readings, decode to an object.
+type CayenneLPPCodec struct{}
+
+// Decode decodes the channel, type and value triples of a Cayenne LPP payload
+func (CayenneLPPCodec) Decode(_ int, payload []byte) (map[string]interface{}, map[string]string, error) {
+	data := make(map[string]interface{})
+	units := make(map[string]string)
+
+	for i := 0; i < len(payload); {
+		if i+2 > len(payload) {
+			return nil, nil, fmt.Errorf("truncated Cayenne LPP header at byte %d", i)
+		}
+		channel, typeID := payload[i], payload[i+1]
+		i += 2
+
+		if typeID == cayenneGPS {
+			if i+9 > len(payload) {
+				return nil, nil, fmt.Errorf("truncated Cayenne LPP GPS value on channel %d", channel)
+			}
+			data[fmt.Sprintf("gps_%d", channel)] = map[string]interface{}{
+				"latitude":  roundReading(float64(cayenneInt(payload[i:i+3], true)) * 0.0001),
+				"longitude": roundReading(float64(cayenneInt(payload[i+3:i+6], true)) * 0.0001),
+				"altitude":  roundReading(float64(cayenneInt(payload[i+6:i+9], true)) * 0.01),
+			}
+			i += 9
+			continue
+		}
+
+		layout, ok := cayenneTypes[typeID]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown Cayenne LPP type %d on channel %d", typeID, channel)
+		}
+		if i+layout.values*layout.size > len(payload) {
+			return nil, nil, fmt.Errorf("truncated Cayenne LPP %s value on channel %d", layout.name, channel)
+		}
+
+		values := make([]float64, layout.values)
+		for v := range values {
+			raw := cayenneInt(payload[i:i+layout.size], layout.signed)
+			values[v] = roundReading(float64(raw) * layout.resolution)
+			i += layout.size
+		}
+
+		key := fmt.Sprintf("%s_%d", layout.name, channel)
+		switch layout.name {
+		case "accelerometer", "gyrometer":
+			data[key] = map[string]interface{}{"x": values[0], "y": values[1], "z": values[2]}
+		case "colour":
+			data[key] = map[string]interface{}{"r": values[0], "g": values[1], "b": values[2]}
+		default:
+			data[key] = values[0]
+		}
+		if layout.uom != "" {
+			units[key] = layout.uom
+		}
+	}
+
+	return data, units, nil
+}
+
+// cayenneInt reads a big-endian integer of up to 4 bytes
+func cayenneInt(b []byte, signed bool) int64 {
+	var value int64
+	for _, octet := range b {
+		value = value<<8 | int64(octet)
+	}
+	if signed && len(b) > 0 && b[0]&0x80 != 0 {
+		value -= 1 << (8 * uint(len(b)))
+	}
+	return value
+}
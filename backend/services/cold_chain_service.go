@@ -0,0 +1,430 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"scain-backend/database"
+	"scain-backend/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ColdChainService keeps cold-chain profiles and records the excursions of the
+// lots they apply to from the sensor readings of stored events
+type ColdChainService struct {
+	mu            sync.Mutex // serializes evaluation, events are stored by several workers
+	maxReadingGap time.Duration
+}
+
+// LotExcursions is the excursion history of a lot against its profile
+type LotExcursions struct {
+	LotCode                 string                     `json:"lotCode"`
+	Profile                 *database.ColdChainProfile `json:"profile"`
+	Excursions              []database.Excursion       `json:"excursions"`
+	Count                   int                        `json:"count"`
+	ExcursionMinutes        float64                    `json:"excursionMinutes"` // cumulative, open and closed
+	AllowedExcursionMinutes *int                       `json:"allowedExcursionMinutes"`
+	AllowanceExceeded       bool                       `json:"allowanceExceeded"`
+}
+
+// NewColdChainService creates a new cold-chain service instance
+func NewColdChainService() *ColdChainService {
+	return &ColdChainService{
+		maxReadingGap: time.Duration(envInt("COLD_CHAIN_MAX_READING_GAP", 60)) * time.Minute,
+	}
+}
+
+// CreateProfile stores the cold-chain profile of a lot or product of an
+// organization. A lot or product has at most one profile per organization.
+func (s *ColdChainService) CreateProfile(orgID string, request *models.ColdChainProfileRequest) (*database.ColdChainProfile, error) {
+	if request.LotCode != nil {
+		existing, err := database.GetColdChainProfileByLot(orgID, *request.LotCode)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check existing profiles: %w", err)
+		}
+		if existing != nil {
+			return nil, fmt.Errorf("cold-chain profile for lot %s already exists", *request.LotCode)
+		}
+	} else {
+		profiles, err := database.ListColdChainProfiles(orgID, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check existing profiles: %w", err)
+		}
+		for _, profile := range profiles {
+			if *profile.Product == *request.Product {
+				return nil, fmt.Errorf("cold-chain profile for product %s already exists", *request.Product)
+			}
+		}
+	}
+
+	profile := &database.ColdChainProfile{
+		OrgID:                   orgID,
+		Name:                    request.Name,
+		LotCode:                 request.LotCode,
+		Product:                 request.Product,
+		MinTemperature:          request.MinTemperature,
+		MaxTemperature:          request.MaxTemperature,
+		MinHumidity:             request.MinHumidity,
+		MaxHumidity:             request.MaxHumidity,
+		AllowedExcursionMinutes: request.AllowedExcursionMinutes,
+		DecayModel:              request.DecayModel,
+		ShelfLifeHours:          request.ShelfLifeHours,
+		ReferenceTemperature:    request.ReferenceTemperature,
+		Q10:                     request.Q10,
+		ActivationEnergy:        request.ActivationEnergy,
+	}
+	if err := database.CreateColdChainProfile(profile); err != nil {
+		return nil, fmt.Errorf("failed to create cold-chain profile: %w", err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"profileId": profile.ID,
+		"lotCode":   profile.LotCode,
+		"product":   profile.Product,
+	}).Info("Cold-chain profile created")
+	return profile, nil
+}
+
+// ListProfiles retrieves all cold-chain profiles of an organization
+func (s *ColdChainService) ListProfiles(orgID string) ([]database.ColdChainProfile, error) {
+	return database.ListColdChainProfiles(orgID, false)
+}
+
+// GetProfile retrieves a cold-chain profile of an organization by ID
+func (s *ColdChainService) GetProfile(orgID, id string) (*database.ColdChainProfile, error) {
+	profile, err := database.GetColdChainProfileByID(orgID, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("cold-chain profile not found: %s", id)
+		}
+		return nil, fmt.Errorf("failed to get cold-chain profile from database: %w", err)
+	}
+	return profile, nil
+}
+
+// DeleteProfile deletes a cold-chain profile of an organization. Excursions
+// already recorded against it are kept.
+func (s *ColdChainService) DeleteProfile(orgID, id string) error {
+	if err := database.DeleteColdChainProfile(orgID, id); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("cold-chain profile not found: %s", id)
+		}
+		return fmt.Errorf("failed to delete cold-chain profile: %w", err)
+	}
+	return nil
+}
+
+// ProfileFor returns the profile that applies to a lot of an organization: its
+// own profile, or else the product profile with the longest prefix of an EPC or
+// EPC class recorded for the lot. It returns nil when no profile applies.
+func (s *ColdChainService) ProfileFor(orgID, lotCode string, epcs ...string) (*database.ColdChainProfile, error) {
+	profile, err := database.GetColdChainProfileByLot(orgID, lotCode)
+	if err != nil || profile != nil {
+		return profile, err
+	}
+
+	products, err := database.ListColdChainProfiles(orgID, true)
+	if err != nil || len(products) == 0 {
+		return nil, err
+	}
+	lotEPCs, err := database.ListLotEPCs(orgID, lotCode)
+	if err != nil {
+		return nil, err
+	}
+	epcs = append(epcs, lotEPCs...)
+
+	for i := range products {
+		product := *products[i].Product
+		if profile != nil && len(product) <= len(*profile.Product) {
+			continue
+		}
+		for _, epc := range epcs {
+			if strings.HasPrefix(epc, product) {
+				profile = &products[i]
+				break
+			}
+		}
+	}
+	return profile, nil
+}
+
+// EventStored checks the temperature and humidity readings of an event of a
+// lot against the lot's profile, opening an excursion when a reading leaves the
+// range and closing it when a reading is back in range
+func (s *ColdChainService) EventStored(event *models.EpcisEvent, dbEvent *database.Event) {
+	if event.LotCode == nil || len(event.SensorElementList) == 0 {
+		return
+	}
+	lotCode := *event.LotCode
+
+	var epcs []string
+	for _, epc := range eventEPCs(event) {
+		epcs = append(epcs, epc.EPC)
+	}
+	profile, err := s.ProfileFor(dbEvent.OrgID, lotCode, epcs...)
+	if err != nil {
+		logger.WithError(err).WithField("lotCode", lotCode).Error("Failed to find cold-chain profile")
+		return
+	}
+	if profile == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, element := range event.SensorElementList {
+		// Events captured directly may not have been normalized yet
+		models.NormalizeSensorElement(&element)
+		deviceID := element.SensorMetaData.DeviceID
+		if deviceID == "" && event.DeviceID != nil {
+			deviceID = *event.DeviceID
+		}
+		for _, report := range element.SensorReport {
+			if report.Time.IsZero() {
+				report.Time = event.EventTime
+			}
+			if err := s.evaluate(profile, lotCode, deviceID, dbEvent.ID, report); err != nil {
+				logger.WithError(err).WithFields(logrus.Fields{
+					"lotCode":  lotCode,
+					"deviceId": deviceID,
+					"eventId":  dbEvent.ID,
+				}).Error("Failed to evaluate cold-chain reading")
+			}
+		}
+	}
+}
+
+// evaluate applies one sensor reading to the excursions of a lot. The lot
+// belongs to the organization of its profile.
+func (s *ColdChainService) evaluate(profile *database.ColdChainProfile, lotCode, deviceID, eventID string, report models.SensorReport) error {
+	var minLimit, maxLimit *float64
+	var uom string
+	switch report.Type {
+	case models.SensorTemperature:
+		minLimit, maxLimit, uom = profile.MinTemperature, profile.MaxTemperature, models.UnitCelsius
+	case models.SensorRelativeHumidity:
+		minLimit, maxLimit, uom = profile.MinHumidity, profile.MaxHumidity, models.UnitPercent
+	default:
+		return nil
+	}
+	// Readings in another unit than the profile cannot be compared
+	if minLimit == nil && maxLimit == nil || report.UOM != nil && *report.UOM != uom {
+		return nil
+	}
+	low, high, ok := readingRange(report)
+	if !ok {
+		return nil
+	}
+
+	var limit string
+	var threshold, peak float64
+	switch {
+	case maxLimit != nil && high > *maxLimit:
+		limit, threshold, peak = database.ExcursionAboveMax, *maxLimit, high
+	case minLimit != nil && low < *minLimit:
+		limit, threshold, peak = database.ExcursionBelowMin, *minLimit, low
+	}
+
+	component := ""
+	if report.Component != nil {
+		component = *report.Component
+	}
+	at := report.Time.UTC()
+
+	open, err := database.GetOpenExcursion(profile.OrgID, lotCode, deviceID, report.Type, component)
+	if err != nil {
+		return fmt.Errorf("failed to get open excursion: %w", err)
+	}
+
+	if open != nil {
+		if limit == open.Limit {
+			// Still out of range on the same side
+			if limit == database.ExcursionAboveMax && peak > open.Peak || limit == database.ExcursionBelowMin && peak < open.Peak {
+				open.Peak = peak
+			}
+			if at.Before(open.StartedAt) {
+				open.StartedAt = at
+			}
+			if at.After(open.LastReadingAt) {
+				open.LastReadingAt = at
+			}
+			open.DurationSeconds = int64(open.LastReadingAt.Sub(open.StartedAt).Seconds())
+			return database.SaveExcursion(open)
+		}
+		// Readings older than the last one out of range do not end the excursion
+		if !at.After(open.LastReadingAt) {
+			return nil
+		}
+
+		open.Status = database.ExcursionClosed
+		open.EndedAt = &at
+		open.EndEventID = &eventID
+		open.DurationSeconds = int64(at.Sub(open.StartedAt).Seconds())
+		if err := database.SaveExcursion(open); err != nil {
+			return err
+		}
+		logger.WithFields(logrus.Fields{
+			"excursionId": open.ID,
+			"lotCode":     lotCode,
+			"deviceId":    deviceID,
+			"durationSec": open.DurationSeconds,
+		}).Info("Cold-chain excursion closed")
+		s.checkAllowance(profile, lotCode)
+	}
+
+	if limit == "" {
+		return nil
+	}
+	// Replayed readings of an excursion that has been closed since
+	covered, err := database.ExcursionCovers(profile.OrgID, lotCode, deviceID, report.Type, component, at)
+	if err != nil || covered {
+		return err
+	}
+
+	excursion := &database.Excursion{
+		OrgID:         profile.OrgID,
+		LotCode:       lotCode,
+		ProfileID:     profile.ID,
+		DeviceID:      deviceID,
+		SensorType:    report.Type,
+		Component:     component,
+		Limit:         limit,
+		Threshold:     threshold,
+		Peak:          peak,
+		UOM:           uom,
+		Status:        database.ExcursionOpen,
+		StartedAt:     at,
+		LastReadingAt: at,
+		StartEventID:  eventID,
+	}
+	if err := database.SaveExcursion(excursion); err != nil {
+		return err
+	}
+	logger.WithFields(logrus.Fields{
+		"excursionId": excursion.ID,
+		"lotCode":     lotCode,
+		"deviceId":    deviceID,
+		"sensorType":  report.Type,
+		"limit":       limit,
+		"value":       peak,
+	}).Warn("Cold-chain excursion started")
+	return nil
+}
+
+// checkAllowance warns when the excursions of a lot exceed the cumulative
+// time its profile allows
+func (s *ColdChainService) checkAllowance(profile *database.ColdChainProfile, lotCode string) {
+	excursions, err := database.ListExcursions(profile.OrgID, lotCode, "")
+	if err != nil {
+		logger.WithError(err).WithField("lotCode", lotCode).Error("Failed to list excursions")
+		return
+	}
+	if minutes := excursionMinutes(excursions); minutes > float64(profile.AllowedExcursionMinutes) {
+		logger.WithFields(logrus.Fields{
+			"lotCode":        lotCode,
+			"minutes":        minutes,
+			"allowedMinutes": profile.AllowedExcursionMinutes,
+		}).Warn("Lot exceeded its cold-chain excursion allowance")
+	}
+}
+
+// LotExcursions retrieves the excursions of a lot of an organization,
+// optionally only the open or closed ones, with the cumulative time out of
+// range against the allowance of the lot's profile
+func (s *ColdChainService) LotExcursions(orgID, lotCode, status string) (*LotExcursions, error) {
+	excursions, err := database.ListExcursions(orgID, lotCode, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list excursions: %w", err)
+	}
+	profile, err := s.ProfileFor(orgID, lotCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find cold-chain profile: %w", err)
+	}
+
+	result := &LotExcursions{
+		LotCode:          lotCode,
+		Profile:          profile,
+		Excursions:       []database.Excursion{},
+		ExcursionMinutes: excursionMinutes(excursions),
+	}
+	if profile != nil {
+		result.AllowedExcursionMinutes = &profile.AllowedExcursionMinutes
+		result.AllowanceExceeded = result.ExcursionMinutes > float64(profile.AllowedExcursionMinutes)
+	}
+	for _, excursion := range excursions {
+		if status == "" || excursion.Status == status {
+			result.Excursions = append(result.Excursions, excursion)
+		}
+	}
+	result.Count = len(result.Excursions)
+	return result, nil
+}
+
+// LotColdChain summarizes the temperature history of a lot of an organization
+// across every device that reported on it: minimum, maximum and average, mean kinetic temperature,
+// time above a threshold (the maximum of the lot's profile unless given), and
+// the remaining shelf life when the profile has a decay model
+func (s *ColdChainService) LotColdChain(orgID, lotCode string, threshold *float64) (*models.ColdChainSummary, error) {
+	readings, err := lotTemperatureReadings(orgID, lotCode, s.maxReadingGap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect temperature readings: %w", err)
+	}
+	profile, err := s.ProfileFor(orgID, lotCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find cold-chain profile: %w", err)
+	}
+
+	summary := &models.ColdChainSummary{LotCode: lotCode}
+	if profile != nil {
+		summary.ProfileID = &profile.ID
+		if threshold == nil {
+			threshold = profile.MaxTemperature
+		}
+	}
+	summarizeTemperatures(summary, readings, threshold)
+	if model := profileDecayModel(profile); model != nil {
+		summary.ShelfLife = estimateShelfLife(profile, model, readings)
+	}
+	return summary, nil
+}
+
+// excursionMinutes adds up the time out of range of excursions
+func excursionMinutes(excursions []database.Excursion) float64 {
+	var seconds int64
+	for _, excursion := range excursions {
+		seconds += excursion.DurationSeconds
+	}
+	return float64(seconds) / 60
+}
+
+// readingRange returns the lowest and highest values of a sensor report,
+// taking its statistics into account
+func readingRange(report models.SensorReport) (float64, float64, bool) {
+	var values []float64
+	if value, ok := models.SensorNumber(report.Value); ok {
+		values = append(values, value)
+	}
+	for _, stat := range []*float64{report.MinValue, report.MaxValue, report.MeanValue} {
+		if stat != nil {
+			values = append(values, *stat)
+		}
+	}
+	if len(values) == 0 {
+		return 0, 0, false
+	}
+
+	low, high := values[0], values[0]
+	for _, value := range values[1:] {
+		if value < low {
+			low = value
+		}
+		if value > high {
+			high = value
+		}
+	}
+	return low, high, true
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"scain-backend/database"
+	"scain-backend/models"
+)
+
+func TestColdChainNormalizesReadings(t *testing.T) {
+	tests := []struct {
+		name       string
+		reading    string
+		value      float64
+		uom        string
+		excursions int
+		peak       float64
+	}{
+		{"Fahrenheit above max", models.SensorTemperature, 50, "FAH", 1, 10},
+		{"Fahrenheit in range", models.SensorTemperature, 41, "FAH", 0, 0},
+		{"plain temperature type", "temperature", 9.5, "CEL", 1, 9.5},
+		{"unit in the reading name", "temp_f", 32, "", 1, 0},
+		{"humidity percentage", "humidity", 95, "%", 1, 95},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			service := NewColdChainService()
+			lotCode := "LOT-42"
+			minTemperature, maxTemperature, maxHumidity := 2.0, 8.0, 90.0
+			_, err := service.CreateProfile("org-a", &models.ColdChainProfileRequest{
+				Name:           "Chilled",
+				LotCode:        &lotCode,
+				MinTemperature: &minTemperature,
+				MaxTemperature: &maxTemperature,
+				MaxHumidity:    &maxHumidity,
+			})
+			if err != nil {
+				t.Fatalf("CreateProfile: %v", err)
+			}
+
+			// A reading as captured through /api/events, without normalization
+			at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+			report := models.SensorReport{Type: tt.reading, Value: tt.value, Time: at}
+			if tt.uom != "" {
+				report.UOM = &tt.uom
+			}
+			event := &models.EpcisEvent{
+				EventTime: at,
+				LotCode:   &lotCode,
+				SensorElementList: []models.SensorElement{{
+					SensorMetaData: models.SensorMetadata{DeviceID: "esp-1"},
+					SensorReport:   []models.SensorReport{report},
+				}},
+			}
+			service.EventStored(event, &database.Event{ID: "event-1", OrgID: "org-a"})
+
+			excursions, err := database.ListExcursions("org-a", "LOT-42", database.ExcursionOpen)
+			if err != nil {
+				t.Fatalf("ListExcursions: %v", err)
+			}
+			if len(excursions) != tt.excursions {
+				t.Fatalf("got %d open excursions, want %d", len(excursions), tt.excursions)
+			}
+			if tt.excursions > 0 && excursions[0].Peak != tt.peak {
+				t.Errorf("peak = %v, want %v", excursions[0].Peak, tt.peak)
+			}
+		})
+	}
+}
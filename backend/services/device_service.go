@@ -2,7 +2,9 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"strings"
 	"time"
@@ -14,28 +16,62 @@ import (
 	"gorm.io/gorm"
 )
 
+// ErrDeviceOtherOrganization is returned for data of a device registered to
+// another organization than the caller's. It does not tell that the device
+// exists or which organization it belongs to.
+var ErrDeviceOtherOrganization = errors.New("data of this device cannot be ingested for your organization")
+
+// ErrDeviceAlreadyRegistered is returned when registering a device whose ID or
+// DevEUI is taken. It does not tell which organization the device belongs to.
+var ErrDeviceAlreadyRegistered = errors.New("device is already registered")
+
+// ErrDeviceNotRegistered is returned for data of a device that is not
+// registered, from transports that carry no credentials
+var ErrDeviceNotRegistered = errors.New("device is not registered")
+
 // DeviceService handles device management operations
-type DeviceService struct{}
+type DeviceService struct{
+	eventBus *EventBus // heartbeats are published to it when set
+}
 
 // NewDeviceService creates a new device service instance
-func NewDeviceService() *DeviceService {
-	return &DeviceService{}
+func NewDeviceService(eventBus *EventBus) *DeviceService {
+	return &DeviceService{eventBus: eventBus}
 }
 
-// RegisterDevice registers a new device in the system
-func (s *DeviceService) RegisterDevice(deviceInfo *models.DeviceInfo) (*database.Device, error) {
+// RegisterDevice registers a new device of an organization. Device IDs and
+// DevEUIs identify hardware, so they are unique across organizations; a taken
+// one is rejected with ErrDeviceAlreadyRegistered whichever organization has
+// the device.
+func (s *DeviceService) RegisterDevice(orgID string, deviceInfo *models.DeviceInfo) (*database.Device, error) {
 	// Check if device already exists
 	existingDevice, err := database.GetDeviceByID(deviceInfo.DeviceID)
 	if err != nil && err != gorm.ErrRecordNotFound {
 		return nil, fmt.Errorf("failed to check existing device: %w", err)
 	}
 	if existingDevice != nil {
-		return nil, fmt.Errorf("device with ID %s already exists", deviceInfo.DeviceID)
+		return nil, ErrDeviceAlreadyRegistered
+	}
+
+	// A LoRaWAN device EUI maps to a single device
+	var devEUI *string
+	if deviceInfo.DevEUI != nil {
+		normalized := strings.ToUpper(*deviceInfo.DevEUI)
+		devEUI = &normalized
+
+		existingDevice, err := database.GetDeviceByDevEUI(normalized)
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("failed to check existing device: %w", err)
+		}
+		if existingDevice != nil {
+			return nil, ErrDeviceAlreadyRegistered
+		}
 	}
 
 	// Create database device
 	dbDevice := &database.Device{
 		DeviceID:        deviceInfo.DeviceID,
+		OrgID:           orgID,
 		Type:            string(deviceInfo.Type),
 		SecureBoot:      deviceInfo.SecureBoot,
 		OTACapable:      deviceInfo.OTACapable,
@@ -43,6 +79,8 @@ func (s *DeviceService) RegisterDevice(deviceInfo *models.DeviceInfo) (*database
 		CalibrationDate: deviceInfo.CalibrationDate,
 		BatteryPct:      deviceInfo.BatteryPct,
 		LastHeartbeat:   deviceInfo.LastHeartbeat,
+		DevEUI:          devEUI,
+		PayloadCodec:    deviceInfo.PayloadCodec,
 		IsActive:        true,
 	}
 
@@ -59,14 +97,15 @@ func (s *DeviceService) RegisterDevice(deviceInfo *models.DeviceInfo) (*database
 
 	logger.WithFields(logrus.Fields{
 		"deviceId": deviceInfo.DeviceID,
+		"orgId":    orgID,
 		"type":     deviceInfo.Type,
 	}).Info("Device registered successfully")
 
 	return dbDevice, nil
 }
 
-// GetDevice retrieves device information by ID
-func (s *DeviceService) GetDevice(deviceID string) (*models.DeviceInfo, error) {
+// GetDevice retrieves device information of a device of an organization by ID
+func (s *DeviceService) GetDevice(orgID, deviceID string) (*models.DeviceInfo, error) {
 	dbDevice, err := database.GetDeviceByID(deviceID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -74,6 +113,9 @@ func (s *DeviceService) GetDevice(deviceID string) (*models.DeviceInfo, error) {
 		}
 		return nil, fmt.Errorf("failed to get device from database: %w", err)
 	}
+	if dbDevice.OrgID != orgID {
+		return nil, fmt.Errorf("device not found: %s", deviceID)
+	}
 
 	// Convert to models.DeviceInfo
 	deviceInfo := &models.DeviceInfo{
@@ -85,6 +127,8 @@ func (s *DeviceService) GetDevice(deviceID string) (*models.DeviceInfo, error) {
 		CalibrationDate: dbDevice.CalibrationDate,
 		BatteryPct:      dbDevice.BatteryPct,
 		LastHeartbeat:   dbDevice.LastHeartbeat,
+		DevEUI:          dbDevice.DevEUI,
+		PayloadCodec:    dbDevice.PayloadCodec,
 	}
 
 	// Set join status if available
@@ -96,35 +140,37 @@ func (s *DeviceService) GetDevice(deviceID string) (*models.DeviceInfo, error) {
 	return deviceInfo, nil
 }
 
-// ClaimDevice claims a device using a claim code
-func (s *DeviceService) ClaimDevice(claimCode *models.ClaimCode) (*database.Device, error) {
+// ClaimDevice claims a device using a claim code, assigning it to the
+// organization the code was issued for, and issues the API key the device
+// authenticates with. The key is returned once and cannot be retrieved later.
+func (s *DeviceService) ClaimDevice(claimCode *models.ClaimCode) (*database.Device, string, error) {
 	// Validate claim code
 	if err := s.validateClaimCode(claimCode.ClaimCode); err != nil {
-		return nil, fmt.Errorf("invalid claim code: %w", err)
+		return nil, "", fmt.Errorf("invalid claim code: %w", err)
 	}
 
 	// Check if claim code exists and is valid
 	claimEntry, err := database.GetClaimCodeByCode(claimCode.ClaimCode)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("invalid claim code: %s", claimCode.ClaimCode)
+			return nil, "", fmt.Errorf("invalid claim code: %s", claimCode.ClaimCode)
 		}
-		return nil, fmt.Errorf("failed to validate claim code: %w", err)
+		return nil, "", fmt.Errorf("failed to validate claim code: %w", err)
 	}
 
 	// Check if claim code is already used
 	if claimEntry.IsUsed {
-		return nil, fmt.Errorf("claim code %s has already been used", claimCode.ClaimCode)
+		return nil, "", fmt.Errorf("claim code %s has already been used", claimCode.ClaimCode)
 	}
 
 	// Check if claim code has expired
 	if claimEntry.ExpiresAt != nil && time.Now().After(*claimEntry.ExpiresAt) {
-		return nil, fmt.Errorf("claim code %s has expired", claimCode.ClaimCode)
+		return nil, "", fmt.Errorf("claim code %s has expired", claimCode.ClaimCode)
 	}
 
 	// Check if device type matches
 	if claimEntry.DeviceType != string(claimCode.Type) {
-		return nil, fmt.Errorf("device type mismatch: expected %s, got %s", 
+		return nil, "", fmt.Errorf("device type mismatch: expected %s, got %s", 
 			claimEntry.DeviceType, claimCode.Type)
 	}
 
@@ -134,6 +180,7 @@ func (s *DeviceService) ClaimDevice(claimCode *models.ClaimCode) (*database.Devi
 	// Create new device
 	device := &database.Device{
 		DeviceID:    deviceID,
+		OrgID:       claimEntry.OrgID,
 		Type:        string(claimCode.Type),
 		ClaimCode:   &claimCode.ClaimCode,
 		ClaimedAt:   &time.Time{},
@@ -142,27 +189,45 @@ func (s *DeviceService) ClaimDevice(claimCode *models.ClaimCode) (*database.Devi
 	now := time.Now()
 	device.ClaimedAt = &now
 
-	// Save device to database
-	if err := database.CreateDevice(device); err != nil {
-		return nil, fmt.Errorf("failed to create claimed device: %w", err)
-	}
+	// Burn the claim code, create the device and issue its key together, so a
+	// code yields exactly one device and a claimed device always has a key
+	var apiKey string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		marked, err := database.MarkClaimCodeAsUsedTx(tx, claimCode.ClaimCode, deviceID)
+		if err != nil {
+			return fmt.Errorf("failed to mark claim code as used: %w", err)
+		}
+		if !marked {
+			return fmt.Errorf("claim code %s has already been used", claimCode.ClaimCode)
+		}
+
+		if err := database.CreateDeviceTx(tx, device); err != nil {
+			return fmt.Errorf("failed to create claimed device: %w", err)
+		}
 
-	// Mark claim code as used
-	if err := database.MarkClaimCodeAsUsed(claimCode.ClaimCode, deviceID); err != nil {
-		return nil, fmt.Errorf("failed to mark claim code as used: %w", err)
+		_, apiKey, err = issueAPIKeyTx(tx, claimEntry.OrgID, database.APIKeyDevice, deviceID, &deviceID)
+		if err != nil {
+			return fmt.Errorf("failed to issue device API key: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
 	}
 
 	logger.WithFields(logrus.Fields{
 		"deviceId":  deviceID,
+		"orgId":     claimEntry.OrgID,
 		"claimCode": claimCode.ClaimCode,
 		"type":      claimCode.Type,
 	}).Info("Device claimed successfully")
 
-	return device, nil
+	return device, apiKey, nil
 }
 
-// UpdateDeviceHeartbeat updates the last heartbeat timestamp for a device
-func (s *DeviceService) UpdateDeviceHeartbeat(deviceID string, batteryPct *int) error {
+// UpdateDeviceHeartbeat updates the last heartbeat timestamp for a device of an
+// organization
+func (s *DeviceService) UpdateDeviceHeartbeat(orgID, deviceID string, batteryPct *int) error {
 	now := time.Now()
 	updates := map[string]interface{}{
 		"last_heartbeat": now,
@@ -173,18 +238,22 @@ func (s *DeviceService) UpdateDeviceHeartbeat(deviceID string, batteryPct *int)
 	}
 
 	err := database.DB.Model(&database.Device{}).
-		Where("device_id = ?", deviceID).
+		Where("device_id = ? AND org_id = ?", deviceID, orgID).
 		Updates(updates).Error
 
 	if err != nil {
 		return fmt.Errorf("failed to update device heartbeat: %w", err)
 	}
 
+	if s.eventBus != nil {
+		s.eventBus.HeartbeatReceived(orgID, deviceID, now, batteryPct)
+	}
+
 	return nil
 }
 
-// GenerateClaimCodes generates claim codes for testing/admin purposes
-func (s *DeviceService) GenerateClaimCodes(deviceType models.DeviceType, count int, expiresInHours int) ([]*database.ClaimCodeEntry, error) {
+// GenerateClaimCodes generates claim codes for devices joining an organization
+func (s *DeviceService) GenerateClaimCodes(orgID string, deviceType models.DeviceType, count int, expiresInHours int) ([]*database.ClaimCodeEntry, error) {
 	var claimCodes []*database.ClaimCodeEntry
 	
 	for i := 0; i < count; i++ {
@@ -192,6 +261,7 @@ func (s *DeviceService) GenerateClaimCodes(deviceType models.DeviceType, count i
 		
 		claimCode := &database.ClaimCodeEntry{
 			ClaimCode:  code,
+			OrgID:      orgID,
 			DeviceType: string(deviceType),
 			IsUsed:     false,
 		}
@@ -210,6 +280,7 @@ func (s *DeviceService) GenerateClaimCodes(deviceType models.DeviceType, count i
 	}
 
 	logger.WithFields(logrus.Fields{
+		"orgId":      orgID,
 		"deviceType": deviceType,
 		"count":      count,
 		"expires":    expiresInHours,
@@ -218,8 +289,37 @@ func (s *DeviceService) GenerateClaimCodes(deviceType models.DeviceType, count i
 	return claimCodes, nil
 }
 
-// ProcessRawDataIngestion stores raw device data for processing
-func (s *DeviceService) ProcessRawDataIngestion(payload *models.RawIngestPayload) (*database.RawDataIngestion, error) {
+// DeviceOrganization returns the organization a device is registered to, or
+// ErrDeviceNotRegistered for devices that are not registered. It serves
+// transports such as MQTT whose messages carry no credentials, so that data
+// of unknown devices is never attributed to an organization.
+func (s *DeviceService) DeviceOrganization(deviceID string) (string, error) {
+	device, err := database.GetDeviceByID(deviceID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return "", ErrDeviceNotRegistered
+		}
+		return "", fmt.Errorf("failed to look up device: %w", err)
+	}
+	return device.OrgID, nil
+}
+
+// ProcessRawDataIngestion stores raw device data of an organization for
+// processing. Data of a device registered to another organization is rejected
+// with ErrDeviceOtherOrganization.
+func (s *DeviceService) ProcessRawDataIngestion(orgID string, payload *models.RawIngestPayload) (*database.RawDataIngestion, error) {
+	device, err := database.GetDeviceByID(payload.DeviceID)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to look up device: %w", err)
+	}
+	if device != nil && device.OrgID != orgID {
+		logger.WithFields(logrus.Fields{
+			"deviceId": payload.DeviceID,
+			"orgId":    orgID,
+		}).Warn("Rejected data of a device registered to another organization")
+		return nil, ErrDeviceOtherOrganization
+	}
+
 	// Convert data and metadata to JSON
 	dataJSON, err := json.Marshal(payload.Data)
 	if err != nil {
@@ -233,13 +333,14 @@ func (s *DeviceService) ProcessRawDataIngestion(payload *models.RawIngestPayload
 
 	// Create raw data ingestion record
 	ingestion := &database.RawDataIngestion{
+		OrgID:            orgID,
 		DeviceType:       string(payload.DeviceType),
 		DeviceID:         payload.DeviceID,
 		Timestamp:        payload.Timestamp,
 		LotCode:          payload.LotCode,
 		RawData:          string(dataJSON),
 		Metadata:         string(metadataJSON),
-		ProcessingStatus: "pending",
+		ProcessingStatus: database.IngestionPending,
 	}
 
 	// Save to database
@@ -249,13 +350,19 @@ func (s *DeviceService) ProcessRawDataIngestion(payload *models.RawIngestPayload
 
 	logger.WithFields(logrus.Fields{
 		"ingestionId": ingestion.ID,
+		"orgId":       orgID,
 		"deviceType":  payload.DeviceType,
 		"deviceId":    payload.DeviceID,
 	}).Info("Raw data ingestion created")
 
-	// Update device heartbeat
+	// Update device heartbeat, with the battery level when the device reports it
 	if payload.DeviceType != models.ERPDeviceType {
-		s.UpdateDeviceHeartbeat(payload.DeviceID, nil)
+		var batteryPct *int
+		if health := models.DeviceHealthFromReadings(payload.Data); health != nil && health.BatteryPct != nil {
+			pct := int(math.Round(math.Max(0, math.Min(100, *health.BatteryPct))))
+			batteryPct = &pct
+		}
+		s.UpdateDeviceHeartbeat(orgID, payload.DeviceID, batteryPct)
 	}
 
 	return ingestion, nil
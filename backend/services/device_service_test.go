@@ -0,0 +1,126 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"scain-backend/database"
+	"scain-backend/models"
+)
+
+// openTestDatabase initializes a fresh database in a temporary directory
+func openTestDatabase(t *testing.T) {
+	t.Helper()
+	t.Setenv("DATABASE_PATH", filepath.Join(t.TempDir(), "test.db"))
+	if err := database.InitDatabase(); err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+func TestRegisterDeviceConflicts(t *testing.T) {
+	openTestDatabase(t)
+	service := NewDeviceService(nil)
+
+	devEUI := "0004a30b001c0530"
+	_, err := service.RegisterDevice("org-a", &models.DeviceInfo{
+		DeviceID: "lora-1",
+		Type:     models.LoRaWANDeviceType,
+		DevEUI:   &devEUI,
+	})
+	if err != nil {
+		t.Fatalf("RegisterDevice: %v", err)
+	}
+
+	otherEUI := "0004A30B001C0531"
+	sameEUI := "0004A30B001C0530"
+	tests := []struct {
+		name   string
+		orgID  string
+		device *models.DeviceInfo
+	}{
+		{"same ID, same organization", "org-a", &models.DeviceInfo{DeviceID: "lora-1", Type: models.LoRaWANDeviceType}},
+		{"same ID, other organization", "org-b", &models.DeviceInfo{DeviceID: "lora-1", Type: models.LoRaWANDeviceType, DevEUI: &otherEUI}},
+		{"same DevEUI, other organization", "org-b", &models.DeviceInfo{DeviceID: "lora-2", Type: models.LoRaWANDeviceType, DevEUI: &sameEUI}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.RegisterDevice(tt.orgID, tt.device)
+			if !errors.Is(err, ErrDeviceAlreadyRegistered) {
+				t.Fatalf("error = %v, want ErrDeviceAlreadyRegistered", err)
+			}
+			// The conflict does not reveal the device or its organization
+			for _, leak := range []string{"org-a", "lora-1", sameEUI} {
+				if strings.Contains(err.Error(), leak) {
+					t.Errorf("error %q reveals %s", err, leak)
+				}
+			}
+		})
+	}
+}
+
+func TestDeviceOrganization(t *testing.T) {
+	openTestDatabase(t)
+	service := NewDeviceService(nil)
+
+	if _, err := service.RegisterDevice("org-a", &models.DeviceInfo{DeviceID: "esp-1", Type: models.ESP32DeviceType}); err != nil {
+		t.Fatalf("RegisterDevice: %v", err)
+	}
+
+	orgID, err := service.DeviceOrganization("esp-1")
+	if err != nil || orgID != "org-a" {
+		t.Errorf("DeviceOrganization(esp-1) = %q, %v, want org-a", orgID, err)
+	}
+
+	// Unregistered devices are not attributed to any organization
+	orgID, err = service.DeviceOrganization("esp-unknown")
+	if !errors.Is(err, ErrDeviceNotRegistered) || orgID != "" {
+		t.Errorf("DeviceOrganization(esp-unknown) = %q, %v, want ErrDeviceNotRegistered", orgID, err)
+	}
+}
+
+func TestProcessRawDataIngestionOtherOrganization(t *testing.T) {
+	openTestDatabase(t)
+	service := NewDeviceService(nil)
+
+	if _, err := service.RegisterDevice("org-a", &models.DeviceInfo{DeviceID: "esp-1", Type: models.ESP32DeviceType}); err != nil {
+		t.Fatalf("RegisterDevice: %v", err)
+	}
+	payload := &models.RawIngestPayload{
+		DeviceType: models.ESP32DeviceType,
+		DeviceID:   "esp-1",
+		Timestamp:  time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		Data:       map[string]interface{}{"temperature": 4.5},
+	}
+
+	// Org B's credentials cannot ingest data of org A's device
+	ingestion, err := service.ProcessRawDataIngestion("org-b", payload)
+	if !errors.Is(err, ErrDeviceOtherOrganization) || ingestion != nil {
+		t.Fatalf("ProcessRawDataIngestion(org-b) = %v, %v, want ErrDeviceOtherOrganization", ingestion, err)
+	}
+	// The rejection does not reveal the device or its organization
+	for _, leak := range []string{"org-a", "belongs", "another organization", "registered"} {
+		if strings.Contains(err.Error(), leak) {
+			t.Errorf("error %q reveals %s", err, leak)
+		}
+	}
+	if _, total, err := database.ListRawDataIngestions(&database.IngestionFilter{OrgID: "org-b"}); err != nil || total != 0 {
+		t.Errorf("org-b has %d ingestions, %v, want none", total, err)
+	}
+
+	// The device's own organization ingests its data
+	ingestion, err = service.ProcessRawDataIngestion("org-a", payload)
+	if err != nil {
+		t.Fatalf("ProcessRawDataIngestion(org-a): %v", err)
+	}
+	if ingestion.OrgID != "org-a" || ingestion.DeviceID != "esp-1" {
+		t.Errorf("ingestion of %s in %s, want esp-1 in org-a", ingestion.DeviceID, ingestion.OrgID)
+	}
+}
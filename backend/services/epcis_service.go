@@ -1,44 +1,115 @@
 package services
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"sort"
+	"time"
 
 	"scain-backend/database"
 	"scain-backend/models"
 	"scain-backend/utils"
 	
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 var logger = logrus.New()
 
+// ErrLedgerDisabled is returned when verifying events while no ledger is configured
+var ErrLedgerDisabled = errors.New("no ledger is configured")
+
+// ErrEventNotBatched is returned when proving an event that has not been added to an anchor batch
+var ErrEventNotBatched = errors.New("event is not in an anchor batch yet")
+
+// EventListener is notified of every EPCIS event once it is stored
+type EventListener interface {
+	EventStored(event *models.EpcisEvent, dbEvent *database.Event)
+}
+
 // EPCISService handles EPCIS event processing
 type EPCISService struct{
-	blockchainService *BlockchainService
+	ledger    Ledger
+	listeners []EventListener
 }
 
-// NewEPCISService creates a new EPCIS service instance
-func NewEPCISService() *EPCISService {
+// NewEPCISService creates a new EPCIS service instance. A configured ledger
+// that cannot be opened, or whose chain does not verify, is an error rather
+// than running without a ledger.
+func NewEPCISService() (*EPCISService, error) {
 	service := &EPCISService{}
 	
-	// Initialize blockchain service if enabled
-	if os.Getenv("ENABLE_BLOCKCHAIN") == "true" {
-		blockchainService, err := NewBlockchainService()
+	// Initialize the ledger events are anchored on, if any
+	ledger, err := NewLedger()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize ledger: %w", err)
+	}
+	if ledger != nil {
+		service.ledger = ledger
+		logger.WithField("ledger", ledger.Name()).Info("Ledger initialized")
+	}
+	
+	// Register declarative transformers for devices onboarded without code
+	if path := os.Getenv("TRANSFORMER_RULES_PATH"); path != "" {
+		keys, err := LoadMappingRules(path)
 		if err != nil {
-			logger.Warnf("Failed to initialize blockchain service: %v", err)
+			logger.Errorf("Failed to load transformer rules from %s: %v", path, err)
 		} else {
-			service.blockchainService = blockchainService
-			logger.Info("Blockchain service initialized")
+			logger.WithField("transformers", len(keys)).Info("Transformer rules loaded")
 		}
 	}
 	
-	return service
+	return service, nil
+}
+
+// AddListener registers a listener for stored events. Listeners are added at
+// startup and called in order, after the transaction storing the event has
+// committed.
+func (s *EPCISService) AddListener(listener EventListener) {
+	s.listeners = append(s.listeners, listener)
+}
+
+// CreateEvent processes and stores an EPCIS event of an organization
+func (s *EPCISService) CreateEvent(orgID string, event *models.EpcisEvent) (*database.Event, error) {
+	var dbEvent *database.Event
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		dbEvent, err = s.CreateEventTx(tx, orgID, event)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.EventCommitted(event, dbEvent)
+	return dbEvent, nil
+}
+
+// CreateEventTx processes and stores an EPCIS event of an organization using
+// the given transaction, queueing it for anchoring in the same transaction.
+// Listeners are left to the caller via EventCommitted once the transaction
+// has committed.
+func (s *EPCISService) CreateEventTx(tx *gorm.DB, orgID string, event *models.EpcisEvent) (*database.Event, error) {
+	dbEvent, err := newEventRecord(orgID, event)
+	if err != nil {
+		return nil, err
+	}
+
+	// Save to database
+	if err := database.CreateEventTx(tx, dbEvent); err != nil {
+		return nil, fmt.Errorf("failed to create event in database: %w", err)
+	}
+
+	return dbEvent, nil
 }
 
-// CreateEvent processes and stores an EPCIS event
-func (s *EPCISService) CreateEvent(event *models.EpcisEvent) (*database.Event, error) {
+// newEventRecord builds the database record of an EPCIS event of an organization
+func newEventRecord(orgID string, event *models.EpcisEvent) (*database.Event, error) {
 	// Compute hash for integrity
 	hash, err := utils.ComputeSHA256(event)
 	if err != nil {
@@ -53,14 +124,20 @@ func (s *EPCISService) CreateEvent(event *models.EpcisEvent) (*database.Event, e
 
 	// Create database event
 	dbEvent := &database.Event{
+		OrgID:               orgID,
 		EventType:           string(event.EventType),
-		EventTime:           event.EventTime,
+		EventTime:           event.EventTime.UTC(), // UTC so stored times compare correctly in queries
 		EventTimeZoneOffset: event.EventTimeZoneOffset,
 		Hash:                hash,
 		RawData:             string(eventJSON),
 	}
+	dbEvent.EPCs = eventEPCs(event)
 
 	// Set optional fields
+	if event.Action != nil {
+		action := string(*event.Action)
+		dbEvent.Action = &action
+	}
 	if event.BizStep != nil {
 		bizStep := string(*event.BizStep)
 		dbEvent.BizStep = &bizStep
@@ -83,103 +160,427 @@ func (s *EPCISService) CreateEvent(event *models.EpcisEvent) (*database.Event, e
 	if event.DeviceTimestamp != nil {
 		dbEvent.DeviceTimestamp = event.DeviceTimestamp
 	}
-
-	// Save to database
-	if err := database.CreateEvent(dbEvent); err != nil {
-		return nil, fmt.Errorf("failed to create event in database: %w", err)
+	if event.ParentID != nil {
+		dbEvent.ParentID = event.ParentID
+	}
+	if event.TransformationID != nil {
+		dbEvent.TransformationID = event.TransformationID
+	}
+	if cte, ok := models.ClassifyCTE(event); ok {
+		cteValue := string(cte)
+		dbEvent.CTE = &cteValue
+	}
+	if source := models.LotCodeSource(event); source != "" {
+		dbEvent.LotCodeSource = &source
 	}
 
-	// Submit to blockchain if enabled
-	var blockchainTxID string
-	if s.blockchainService != nil {
-		record, err := s.blockchainService.SubmitEvent(event)
-		if err != nil {
-			logger.Warnf("Failed to submit event to blockchain: %v", err)
-		} else {
-			blockchainTxID = record.TxID
-			// Update database with blockchain transaction ID
-			dbEvent.BlockchainTxID = &blockchainTxID
-			if err := database.UpdateEvent(dbEvent); err != nil {
-				logger.Warnf("Failed to update event with blockchain TX ID: %v", err)
-			}
+	return dbEvent, nil
+}
+
+// eventEPCs lists the EPCs and EPC classes referenced by an event, tagged with
+// the field they appear in
+func eventEPCs(event *models.EpcisEvent) []database.EventEPC {
+	var epcs []database.EventEPC
+
+	addEPCs := func(role string, list []string) {
+		for _, epc := range list {
+			epcs = append(epcs, database.EventEPC{EPC: epc, Role: role})
+		}
+	}
+	addClasses := func(role string, list []models.QuantityElement) {
+		for _, quantity := range list {
+			epcs = append(epcs, database.EventEPC{EPC: quantity.EPCClass, Role: role})
 		}
 	}
 
+	addEPCs(database.RoleEPCList, event.EPCList)
+	addClasses(database.RoleQuantityList, event.QuantityList)
+	if event.ParentID != nil {
+		addEPCs(database.RoleParentID, []string{*event.ParentID})
+	}
+	addEPCs(database.RoleChildEPCs, event.ChildEPCs)
+	addClasses(database.RoleChildQuantityList, event.ChildQuantityList)
+	addEPCs(database.RoleInputEPCList, event.InputEPCList)
+	addClasses(database.RoleInputQuantityList, event.InputQuantityList)
+	addEPCs(database.RoleOutputEPCList, event.OutputEPCList)
+	addClasses(database.RoleOutputQuantityList, event.OutputQuantityList)
+
+	return epcs
+}
+
+// EventCommitted notifies the listeners of a stored event, once the
+// transaction that stored it has committed. The event is anchored on the
+// ledger by the anchor relay from the outbox entry stored with it.
+func (s *EPCISService) EventCommitted(event *models.EpcisEvent, dbEvent *database.Event) {
 	logger.WithFields(logrus.Fields{
-		"eventId":       dbEvent.ID,
-		"eventType":     dbEvent.EventType,
-		"hash":          hash,
-		"blockchainTx":  blockchainTxID,
+		"eventId":   dbEvent.ID,
+		"orgId":     dbEvent.OrgID,
+		"eventType": dbEvent.EventType,
+		"hash":      dbEvent.Hash,
 	}).Info("EPCIS event created successfully")
 
-	return dbEvent, nil
+	for _, listener := range s.listeners {
+		listener.EventStored(event, dbEvent)
+	}
+}
+
+// VerifyEvent checks a stored event of an organization against the hash
+// anchored for it on the ledger. The hash is recomputed from the stored event,
+// so changes made to it after it was anchored are detected.
+func (s *EPCISService) VerifyEvent(orgID, id string) (*models.EventVerification, error) {
+	if s.ledger == nil {
+		return nil, ErrLedgerDisabled
+	}
+
+	dbEvent, err := database.GetEventByID(orgID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event from database: %w", err)
+	}
+	event, err := eventFromRecord(dbEvent)
+	if err != nil {
+		return nil, err
+	}
+	if event.EventID == dbEvent.ID {
+		// eventFromRecord fills in the database ID, which was not hashed
+		event.EventID = ""
+	}
+	computedHash, err := utils.ComputeSHA256(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute event hash: %w", err)
+	}
+
+	verification := &models.EventVerification{
+		EventID:      dbEvent.ID,
+		Ledger:       s.ledger.Name(),
+		AnchorStatus: dbEvent.AnchorStatus,
+		StoredHash:   dbEvent.Hash,
+		ComputedHash: computedHash,
+	}
+
+	// A batched event is anchored through the Merkle root of its batch
+	anchorID, anchoredHash := dbEvent.ID, computedHash
+	if dbEvent.BatchID != nil {
+		root, _, err := batchRoot(computedHash, dbEvent.MerklePath)
+		if err != nil {
+			return nil, err
+		}
+		verification.BatchID = *dbEvent.BatchID
+		verification.MerkleRoot = root
+		anchorID, anchoredHash = *dbEvent.BatchID, root
+	}
+
+	record, err := s.ledger.Get(anchorID)
+	if errors.Is(err, ErrLedgerRecordNotFound) {
+		return verification, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event from ledger: %w", err)
+	}
+	verification.Anchored = true
+	verification.LedgerHash = record.EventHash
+	verification.TxID = record.TxID
+	if !record.Timestamp.IsZero() {
+		anchoredAt := record.Timestamp
+		verification.AnchoredAt = &anchoredAt
+	}
+
+	matches, err := s.ledger.Verify(anchorID, anchoredHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify event on ledger: %w", err)
+	}
+	verification.Verified = matches && computedHash == dbEvent.Hash
+
+	return verification, nil
+}
+
+// EventProof returns the proof that a stored event of an organization is a
+// leaf of its anchor batch, which can be checked offline against the root
+// anchored on the ledger
+func (s *EPCISService) EventProof(orgID, id string) (*models.MerkleProof, error) {
+	dbEvent, err := database.GetEventByID(orgID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event from database: %w", err)
+	}
+	if dbEvent.BatchID == nil {
+		return nil, ErrEventNotBatched
+	}
+	// Batches sealed before they were per organization may hold events of other
+	// organizations, whose hashes the proof must not reveal
+	batch, err := database.GetAnchorBatchByID(orgID, *dbEvent.BatchID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrEventNotBatched
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get anchor batch from database: %w", err)
+	}
+
+	_, path, err := batchRoot(dbEvent.Hash, dbEvent.MerklePath)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := utils.MerkleLeafHash(dbEvent.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	proof := &models.MerkleProof{
+		EventID:      dbEvent.ID,
+		EventHash:    dbEvent.Hash,
+		LeafHash:     hex.EncodeToString(leaf),
+		BatchID:      batch.ID,
+		BatchSize:    batch.Size,
+		Path:         path,
+		MerkleRoot:   batch.Root,
+		AnchorStatus: batch.Status,
+		AnchoredAt:   batch.AnchoredAt,
+	}
+	if s.ledger != nil {
+		proof.Ledger = s.ledger.Name()
+	}
+	if batch.TxID != nil {
+		proof.TxID = *batch.TxID
+	}
+	return proof, nil
+}
+
+// batchRoot recomputes the root of the anchor batch of an event from an event
+// hash and the Merkle path stored with the event
+func batchRoot(hash, merklePath string) (string, []utils.MerkleStep, error) {
+	var path []utils.MerkleStep
+	if err := json.Unmarshal([]byte(merklePath), &path); err != nil {
+		return "", nil, fmt.Errorf("failed to unmarshal Merkle path: %w", err)
+	}
+	leaf, err := utils.MerkleLeafHash(hash)
+	if err != nil {
+		return "", nil, err
+	}
+	root, err := utils.MerkleRootFromPath(leaf, path)
+	if err != nil {
+		return "", nil, err
+	}
+	return hex.EncodeToString(root), path, nil
+}
+
+// EventHistory retrieves the ledger transactions that wrote a stored event of an organization
+func (s *EPCISService) EventHistory(orgID, id string) ([]LedgerEntry, error) {
+	if s.ledger == nil {
+		return nil, ErrLedgerDisabled
+	}
+
+	dbEvent, err := database.GetEventByID(orgID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event from database: %w", err)
+	}
+	// A batched event is anchored through its batch
+	anchorID := dbEvent.ID
+	if dbEvent.BatchID != nil {
+		anchorID = *dbEvent.BatchID
+	}
+	history, err := s.ledger.History(anchorID)
+	if err != nil {
+		if errors.Is(err, ErrLedgerRecordNotFound) {
+			return []LedgerEntry{}, nil
+		}
+		return nil, fmt.Errorf("failed to get event history from ledger: %w", err)
+	}
+	return history, nil
+}
+
+// Ledger returns the ledger events are anchored on, or nil when none is configured
+func (s *EPCISService) Ledger() Ledger {
+	return s.ledger
 }
 
-// GetEvent retrieves an EPCIS event by ID
-func (s *EPCISService) GetEvent(id string) (*models.EpcisEvent, error) {
-	dbEvent, err := database.GetEventByID(id)
+// Close releases the ledger
+func (s *EPCISService) Close() error {
+	if s.ledger == nil {
+		return nil
+	}
+	return s.ledger.Close()
+}
+
+// GetEvent retrieves an EPCIS event of an organization by ID
+func (s *EPCISService) GetEvent(orgID, id string) (*models.EpcisEvent, error) {
+	dbEvent, err := database.GetEventByID(orgID, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get event from database: %w", err)
 	}
 
-	// Unmarshal the raw data back to EPCIS event
+	return eventFromRecord(dbEvent)
+}
+
+// QueryEvents runs an EPCIS query against stored events and returns one page of
+// results as an EPCISQueryDocument. The document carries a nextPageToken when
+// more results are available.
+func (s *EPCISService) QueryEvents(query *database.EventQuery) (*models.EPCISQueryDocument, error) {
+	// Fetch one extra row to find out whether there is another page
+	pageQuery := *query
+	pageQuery.Limit = query.Limit + 1
+
+	dbEvents, err := database.QueryEvents(&pageQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events from database: %w", err)
+	}
+
+	hasMore := len(dbEvents) > query.Limit
+	if hasMore {
+		dbEvents = dbEvents[:query.Limit]
+	}
+
+	events := make([]models.EpcisEvent, 0, len(dbEvents))
+	for i := range dbEvents {
+		event, err := eventFromRecord(&dbEvents[i])
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+
+	document := models.NewEPCISQueryDocument("SimpleEventQuery", events)
+	if hasMore {
+		last := dbEvents[len(dbEvents)-1]
+		token := EncodePageToken(&database.EventCursor{EventTime: last.EventTime, ID: last.ID})
+		document.NextPageToken = &token
+	}
+
+	return document, nil
+}
+
+// pageToken is the serialized form of an event cursor
+type pageToken struct {
+	EventTime time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+// EncodePageToken encodes an event cursor as an opaque nextPageToken
+func EncodePageToken(cursor *database.EventCursor) string {
+	tokenJSON, _ := json.Marshal(pageToken{EventTime: cursor.EventTime, ID: cursor.ID})
+	return base64.RawURLEncoding.EncodeToString(tokenJSON)
+}
+
+// DecodePageToken decodes a nextPageToken back into an event cursor
+func DecodePageToken(token string) (*database.EventCursor, error) {
+	tokenJSON, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("malformed page token")
+	}
+
+	var decoded pageToken
+	if err := json.Unmarshal(tokenJSON, &decoded); err != nil || decoded.ID == "" {
+		return nil, fmt.Errorf("malformed page token")
+	}
+
+	return &database.EventCursor{EventTime: decoded.EventTime, ID: decoded.ID}, nil
+}
+
+// eventFromRecord restores the EPCIS event stored in a database record
+func eventFromRecord(dbEvent *database.Event) (*models.EpcisEvent, error) {
 	var event models.EpcisEvent
 	if err := json.Unmarshal([]byte(dbEvent.RawData), &event); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal event data: %w", err)
 	}
 
+	// Expose the database ID as the eventID unless the client supplied one
+	if event.EventID == "" {
+		event.EventID = dbEvent.ID
+	}
+
 	return &event, nil
 }
 
-// TransformRawData transforms raw device data into EPCIS events
+// TransformRawData transforms raw device data into EPCIS events with the
+// transformer registered for the device type, vendor and model of the payload
 func (s *EPCISService) TransformRawData(payload *models.RawIngestPayload) ([]*models.EpcisEvent, error) {
-	var events []*models.EpcisEvent
-
-	switch payload.DeviceType {
-	case models.ESP32DeviceType:
-		events = s.transformESP32Data(payload)
-	case models.ExpressLinkDeviceType:
-		events = s.transformExpressLinkData(payload)
-	case models.LoRaWANDeviceType:
-		events = s.transformLoRaWANData(payload)
-	case models.TrackerDeviceType:
-		events = s.transformTrackerData(payload)
-	case models.ERPDeviceType:
-		events = s.transformERPData(payload)
-	default:
+	key := PayloadTransformerKey(payload)
+	transformer, ok := LookupTransformer(key)
+	if !ok {
 		return nil, fmt.Errorf("unsupported device type: %s", payload.DeviceType)
 	}
 
+	events, err := transformer.Transform(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform %s data: %w", key, err)
+	}
+
+	// Map sensor readings to CBV measurement types and units
+	for _, event := range events {
+		for i := range event.SensorElementList {
+			models.NormalizeSensorElement(&event.SensorElementList[i])
+		}
+	}
+
 	logger.WithFields(logrus.Fields{
-		"deviceType": payload.DeviceType,
-		"deviceId":   payload.DeviceID,
-		"eventCount": len(events),
+		"deviceType":  payload.DeviceType,
+		"deviceId":    payload.DeviceID,
+		"transformer": key.String(),
+		"eventCount":  len(events),
 	}).Info("Raw data transformed to EPCIS events")
 
 	return events, nil
 }
 
 // transformESP32Data transforms ESP32 sensor data to EPCIS events
-func (s *EPCISService) transformESP32Data(payload *models.RawIngestPayload) []*models.EpcisEvent {
+func transformESP32Data(payload *models.RawIngestPayload) ([]*models.EpcisEvent, error) {
 	var events []*models.EpcisEvent
+	if len(payload.Data) == 0 {
+		return nil, fmt.Errorf("data has no sensor readings")
+	}
+
+	// Create sensor reports from raw data, with units sent as uom metadata
+	keys := make([]string, 0, len(payload.Data))
+	for key := range payload.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	units := make(map[string]string)
+	switch uom := payload.Metadata["uom"].(type) {
+	case map[string]string:
+		units = uom
+	case map[string]interface{}:
+		for key, value := range uom {
+			if unit, ok := value.(string); ok {
+				units[key] = unit
+			}
+		}
+	}
+
+	// EPCs of the observed objects, sent as epcList metadata
+	var epcs []string
+	switch epcList := payload.Metadata["epcList"].(type) {
+	case []string:
+		epcs = epcList
+	case []interface{}:
+		for _, value := range epcList {
+			if epc, ok := value.(string); ok && epc != "" {
+				epcs = append(epcs, epc)
+			}
+		}
+	}
 
-	// Create sensor reports from raw data
 	var sensorReports []models.SensorReport
-	for key, value := range payload.Data {
-		sensorReports = append(sensorReports, models.SensorReport{
+	for _, key := range keys {
+		report := models.SensorReport{
 			Type:  key,
-			Value: value,
+			Value: payload.Data[key],
 			Time:  payload.Timestamp,
-		})
+		}
+		if uom := units[key]; uom != "" {
+			report.UOM = &uom
+		}
+		sensorReports = append(sensorReports, report)
 	}
 
 	// Create EPCIS ObjectEvent with sensor data
+	action := models.ActionObserve
 	event := &models.EpcisEvent{
 		EventType:           models.ObjectEventType,
 		EventTime:           payload.Timestamp,
 		EventTimeZoneOffset: "+00:00", // Default to UTC
+		Action:              &action,
 		DeviceID:            &payload.DeviceID,
 		DeviceTimestamp:     &payload.Timestamp,
+		EPCList:             epcs,
 		LotCode:             payload.LotCode,
 		SensorElementList: []models.SensorElement{
 			{
@@ -195,39 +596,65 @@ func (s *EPCISService) transformESP32Data(payload *models.RawIngestPayload) []*m
 	}
 
 	events = append(events, event)
-	return events
+	return events, nil
 }
 
 // transformExpressLinkData transforms AWS IoT ExpressLink data to EPCIS events
-func (s *EPCISService) transformExpressLinkData(payload *models.RawIngestPayload) []*models.EpcisEvent {
+func transformExpressLinkData(payload *models.RawIngestPayload) ([]*models.EpcisEvent, error) {
 	// Similar to ESP32 but with ExpressLink specific handling
-	return s.transformESP32Data(payload) // For now, use same logic
+	return transformESP32Data(payload) // For now, use same logic
 }
 
 // transformLoRaWANData transforms LoRaWAN data to EPCIS events
-func (s *EPCISService) transformLoRaWANData(payload *models.RawIngestPayload) []*models.EpcisEvent {
-	// Similar to ESP32 but with LoRaWAN specific handling
-	return s.transformESP32Data(payload) // For now, use same logic
+func transformLoRaWANData(payload *models.RawIngestPayload) ([]*models.EpcisEvent, error) {
+	events, err := transformESP32Data(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep how the uplink was received with the sensor data
+	if radio := radioMetadata(payload.Metadata); radio != nil {
+		for _, event := range events {
+			for i := range event.SensorElementList {
+				event.SensorElementList[i].SensorMetaData.Radio = radio
+			}
+		}
+	}
+
+	return events, nil
 }
 
-// transformTrackerData transforms GPS tracker data to EPCIS events
-func (s *EPCISService) transformTrackerData(payload *models.RawIngestPayload) []*models.EpcisEvent {
+// transformTrackerData transforms GPS tracker data to EPCIS events. Data
+// without a location yields no event.
+func transformTrackerData(payload *models.RawIngestPayload) ([]*models.EpcisEvent, error) {
 	var events []*models.EpcisEvent
 
 	// Extract location data
 	lat, hasLat := payload.Data["latitude"]
 	lng, hasLng := payload.Data["longitude"]
+	if hasLat != hasLng {
+		return nil, fmt.Errorf("latitude and longitude must be sent together")
+	}
 
 	if hasLat && hasLng {
+		if err := checkCoordinate("latitude", lat, 90); err != nil {
+			return nil, err
+		}
+		if err := checkCoordinate("longitude", lng, 180); err != nil {
+			return nil, err
+		}
+
 		// Create location-based event
 		readPoint := &models.ReadPoint{
 			ID: fmt.Sprintf("geo:%v,%v", lat, lng),
 		}
 
+		action := models.ActionObserve
 		event := &models.EpcisEvent{
 			EventType:           models.ObjectEventType,
 			EventTime:           payload.Timestamp,
 			EventTimeZoneOffset: "+00:00",
+			Action:              &action,
 			BizStep:             nil, // Could be set based on business logic
 			ReadPoint:           readPoint,
 			DeviceID:            &payload.DeviceID,
@@ -238,26 +665,43 @@ func (s *EPCISService) transformTrackerData(payload *models.RawIngestPayload) []
 		events = append(events, event)
 	}
 
-	return events
+	return events, nil
+}
+
+// checkCoordinate checks that a coordinate is a number within [-limit, limit]
+func checkCoordinate(name string, value interface{}, limit float64) error {
+	number, ok := value.(float64)
+	if !ok {
+		return fmt.Errorf("%s must be a number", name)
+	}
+	if number < -limit || number > limit {
+		return fmt.Errorf("%s %v is out of range", name, number)
+	}
+	return nil
 }
 
 // transformERPData transforms ERP system data to EPCIS events
-func (s *EPCISService) transformERPData(payload *models.RawIngestPayload) []*models.EpcisEvent {
+func transformERPData(payload *models.RawIngestPayload) ([]*models.EpcisEvent, error) {
 	var events []*models.EpcisEvent
 
 	// Extract business step from ERP data
-	bizStepStr, hasBizStep := payload.Data["businessStep"].(string)
 	var bizStep *models.BusinessStep
-	if hasBizStep {
+	if value, hasBizStep := payload.Data["businessStep"]; hasBizStep {
+		bizStepStr, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("businessStep must be a string")
+		}
 		bs := models.BusinessStep(bizStepStr)
 		bizStep = &bs
 	}
 
 	// Create business event
+	action := models.ActionObserve
 	event := &models.EpcisEvent{
 		EventType:           models.TransactionEventType,
 		EventTime:           payload.Timestamp,
 		EventTimeZoneOffset: "+00:00",
+		Action:              &action,
 		BizStep:             bizStep,
 		DeviceID:            &payload.DeviceID,
 		DeviceTimestamp:     &payload.Timestamp,
@@ -265,35 +709,127 @@ func (s *EPCISService) transformERPData(payload *models.RawIngestPayload) []*mod
 	}
 
 	// Add business transactions if present
-	if txns, hasTxns := payload.Data["transactions"].([]interface{}); hasTxns {
+	if value, hasTxns := payload.Data["transactions"]; hasTxns {
+		txns, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("transactions must be a list")
+		}
 		var bizTransactions []models.BizTransaction
-		for _, txn := range txns {
-			if txnMap, ok := txn.(map[string]interface{}); ok {
-				bizTransactions = append(bizTransactions, models.BizTransaction{
-					Type:           txnMap["type"].(string),
-					BizTransaction: txnMap["id"].(string),
-				})
+		for i, txn := range txns {
+			txnMap, _ := txn.(map[string]interface{})
+			txnType, hasType := txnMap["type"].(string)
+			txnID, hasID := txnMap["id"].(string)
+			if !hasType || !hasID {
+				return nil, fmt.Errorf("transaction %d must have a type and an id", i)
 			}
+			bizTransactions = append(bizTransactions, models.BizTransaction{
+				Type:           txnType,
+				BizTransaction: txnID,
+			})
 		}
 		event.BizTransactionList = bizTransactions
 	}
 
 	events = append(events, event)
-	return events
+	return events, nil
 }
 
-// ProcessRawDataIngestion processes a raw data ingestion record
-func (s *EPCISService) ProcessRawDataIngestion(ingestionID string) error {
-	// This would typically be called by a background worker
-	// For now, we'll implement basic processing logic
-	
-	logger.WithField("ingestionId", ingestionID).Info("Processing raw data ingestion")
-	
-	// TODO: Implement background processing of raw data
-	// 1. Retrieve raw data from database
-	// 2. Transform to EPCIS events
-	// 3. Store EPCIS events
-	// 4. Mark ingestion as processed
-	
-	return nil
-} 
\ No newline at end of file
+// ProcessRawDataIngestion transforms a stored raw data ingestion into EPCIS
+// events and stores them. The events are created in one transaction so a
+// failed attempt can be retried without leaving duplicates behind. Event IDs
+// are derived from the ingestion, so replaying an ingestion yields the same
+// events rather than new copies: events that come out unchanged are kept as
+// they are, and only the others are replaced. Events that are batched or
+// anchored on the ledger are never replaced; a replay that would change them
+// fails with ErrIngestionAnchored. Listeners are only notified of the events
+// that were created. The events belong to the organization of the ingestion.
+// It returns the IDs of the derived events.
+func (s *EPCISService) ProcessRawDataIngestion(ingestion *database.RawDataIngestion) ([]string, error) {
+	logger.WithField("ingestionId", ingestion.ID).Info("Processing raw data ingestion")
+
+	payload := &models.RawIngestPayload{
+		DeviceType: models.DeviceType(ingestion.DeviceType),
+		DeviceID:   ingestion.DeviceID,
+		Timestamp:  ingestion.Timestamp,
+		LotCode:    ingestion.LotCode,
+	}
+	if err := json.Unmarshal([]byte(ingestion.RawData), &payload.Data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal raw data: %w", err)
+	}
+	if ingestion.Metadata != "" {
+		if err := json.Unmarshal([]byte(ingestion.Metadata), &payload.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal metadata: %w", err)
+		}
+	}
+
+	events, err := s.TransformRawData(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	eventIDs := make([]string, len(events))
+	var created []int
+	var dbEvents []*database.Event
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		existing, err := database.ListEventsByIngestionTx(tx, ingestion.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get events from previous run: %w", err)
+		}
+		previous := make(map[string]database.Event, len(existing))
+		for _, event := range existing {
+			previous[event.ID] = event
+		}
+
+		dbEvents = make([]*database.Event, len(events))
+		for i, event := range events {
+			dbEvent, err := newEventRecord(ingestion.OrgID, event)
+			if err != nil {
+				return fmt.Errorf("event %d: %w", i, err)
+			}
+			dbEvent.ID = ingestionEventID(ingestion.ID, i)
+			dbEvent.IngestionID = &ingestion.ID
+			eventIDs[i] = dbEvent.ID
+
+			if old, ok := previous[dbEvent.ID]; ok && old.Hash == dbEvent.Hash {
+				// Unchanged since the previous run, so it is kept as stored
+				delete(previous, dbEvent.ID)
+				continue
+			}
+			dbEvents[i] = dbEvent
+			created = append(created, i)
+		}
+
+		// What is left of the previous run is replaced or no longer derived
+		var stale []string
+		for id, old := range previous {
+			if old.BatchID != nil || old.BlockchainTxID != nil {
+				return fmt.Errorf("%w: event %s would change", ErrIngestionAnchored, id)
+			}
+			stale = append(stale, id)
+		}
+		if err := database.DeleteEventsTx(tx, stale); err != nil {
+			return fmt.Errorf("failed to remove events from previous run: %w", err)
+		}
+
+		for _, i := range created {
+			if err := database.CreateEventTx(tx, dbEvents[i]); err != nil {
+				return fmt.Errorf("event %d: failed to create event in database: %w", i, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, i := range created {
+		s.EventCommitted(events[i], dbEvents[i])
+	}
+
+	return eventIDs, nil
+}
+
+// ingestionEventID derives the ID of the nth event created from a raw data ingestion
+func ingestionEventID(ingestionID string, n int) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(fmt.Sprintf("urn:scain:ingestion:%s:%d", ingestionID, n))).String()
+}
\ No newline at end of file
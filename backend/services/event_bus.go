@@ -0,0 +1,166 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"scain-backend/database"
+	"scain-backend/models"
+)
+
+const (
+	// DefaultStreamBuffer is the number of recent messages kept for resuming
+	// when STREAM_BUFFER is not set
+	DefaultStreamBuffer = 1000
+
+	// streamSubscriberQueue is how many messages a subscriber may fall behind
+	// before it is disconnected
+	streamSubscriberQueue = 256
+)
+
+// EventBus publishes stored events and device heartbeats to live stream
+// subscribers. Recent messages are kept so a client that reconnects resumes
+// where it left off.
+type EventBus struct {
+	mu          sync.Mutex
+	nextID      uint64
+	recent      []*models.StreamMessage // ring of the most recent messages, oldest first once full
+	start       int
+	subscribers map[*StreamSubscription]struct{}
+}
+
+// StreamSubscription receives the messages that pass its filter on C. C is
+// closed when the subscriber falls too far behind or unsubscribes.
+type StreamSubscription struct {
+	C      <-chan *models.StreamMessage
+	ch     chan *models.StreamMessage
+	filter models.StreamFilter
+}
+
+// NewEventBus creates a new event bus. The number of messages kept for
+// resuming is read from STREAM_BUFFER.
+func NewEventBus() *EventBus {
+	return &EventBus{
+		recent:      make([]*models.StreamMessage, 0, envInt("STREAM_BUFFER", DefaultStreamBuffer)),
+		subscribers: make(map[*StreamSubscription]struct{}),
+	}
+}
+
+// Publish assigns the next ID to a message and delivers it to the matching
+// subscribers. Subscribers whose queue is full are disconnected rather than
+// holding up the publisher.
+func (b *EventBus) Publish(message *models.StreamMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	message.ID = b.nextID
+	if len(b.recent) < cap(b.recent) {
+		b.recent = append(b.recent, message)
+	} else {
+		b.recent[b.start] = message
+		b.start = (b.start + 1) % cap(b.recent)
+	}
+
+	for subscription := range b.subscribers {
+		if !subscription.filter.Matches(message) {
+			continue
+		}
+		select {
+		case subscription.ch <- message:
+		default:
+			delete(b.subscribers, subscription)
+			close(subscription.ch)
+		}
+	}
+}
+
+// Subscribe registers a subscriber for the messages that pass a filter. When
+// lastID is not zero, the kept messages published after it are queued first;
+// an ID the bus does not know, e.g. from before a restart, replays every kept
+// message.
+func (b *EventBus) Subscribe(filter models.StreamFilter, lastID uint64) *StreamSubscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var backlog []*models.StreamMessage
+	if lastID > 0 {
+		if lastID > b.nextID {
+			lastID = 0
+		}
+		for i := range b.recent {
+			message := b.recent[(b.start+i)%len(b.recent)]
+			if message.ID > lastID && filter.Matches(message) {
+				backlog = append(backlog, message)
+			}
+		}
+	}
+
+	ch := make(chan *models.StreamMessage, len(backlog)+streamSubscriberQueue)
+	for _, message := range backlog {
+		ch <- message
+	}
+	subscription := &StreamSubscription{C: ch, ch: ch, filter: filter}
+	b.subscribers[subscription] = struct{}{}
+	return subscription
+}
+
+// Unsubscribe removes a subscriber and closes its channel
+func (b *EventBus) Unsubscribe(subscription *StreamSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[subscription]; ok {
+		delete(b.subscribers, subscription)
+		close(subscription.ch)
+	}
+}
+
+// EventStored publishes a stored event
+func (b *EventBus) EventStored(event *models.EpcisEvent, dbEvent *database.Event) {
+	message := &models.StreamMessage{
+		OrgID: dbEvent.OrgID,
+		Type:  models.StreamEvent,
+		Time:  time.Now().UTC(),
+		Data: &models.StreamEventData{
+			EventID: dbEvent.ID,
+			Hash:    dbEvent.Hash,
+			Event:   event,
+		},
+	}
+	if event.LotCode != nil {
+		message.LotCode = *event.LotCode
+	}
+	if event.DeviceID != nil {
+		message.DeviceID = *event.DeviceID
+	} else {
+		for _, element := range event.SensorElementList {
+			if element.SensorMetaData.DeviceID != "" {
+				message.DeviceID = element.SensorMetaData.DeviceID
+				break
+			}
+		}
+	}
+	if event.BizLocation != nil {
+		message.Location = event.BizLocation.ID
+	} else if event.ReadPoint != nil {
+		message.Location = event.ReadPoint.ID
+	}
+
+	b.Publish(message)
+}
+
+// HeartbeatReceived publishes a heartbeat of a device of an organization
+func (b *EventBus) HeartbeatReceived(orgID, deviceID string, at time.Time, batteryPct *int) {
+	b.Publish(&models.StreamMessage{
+		OrgID:    orgID,
+		Type:     models.StreamHeartbeat,
+		Time:     time.Now().UTC(),
+		DeviceID: deviceID,
+		Data: &models.StreamHeartbeatData{
+			DeviceID:      deviceID,
+			LastHeartbeat: at.UTC(),
+			BatteryPct:    batteryPct,
+		},
+	})
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"scain-backend/database"
+	"scain-backend/models"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xuri/excelize/v2"
+)
+
+// Export formats
+const (
+	ExportCSV  = "csv"
+	ExportXLSX = "xlsx"
+)
+
+// fsma204Sheet is the worksheet name of the FSMA 204 spreadsheet
+const fsma204Sheet = "FSMA 204"
+
+// ExportService produces regulatory exports from stored events
+type ExportService struct{}
+
+// NewExportService creates a new export service instance
+func NewExportService() *ExportService {
+	return &ExportService{}
+}
+
+// FSMA204Rows returns one FDA sortable spreadsheet row per CTE an organization
+// recorded for a lot within an optional time range, in event time order
+func (s *ExportService) FSMA204Rows(orgID, lot string, from, to *time.Time) ([]models.FSMA204Row, error) {
+	dbEvents, err := database.FindCTEEvents(orgID, lot, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find CTE events: %w", err)
+	}
+
+	events := make([]*models.EpcisEvent, len(dbEvents))
+	sources := make([]string, len(dbEvents))
+	knownSources := make(map[string]string)
+	var locationIDs []string
+	for i := range dbEvents {
+		event, err := eventFromRecord(&dbEvents[i])
+		if err != nil {
+			return nil, err
+		}
+		events[i] = event
+
+		// The lot code source is recorded on the event that assigned the lot code
+		sources[i] = models.LotCodeSource(event)
+		if lotCode := models.TraceabilityLotCode(event); sources[i] == "" && lotCode != "" {
+			source, known := knownSources[lotCode]
+			if !known {
+				if source, err = database.FindLotCodeSource(orgID, lotCode); err != nil {
+					return nil, fmt.Errorf("failed to find lot code source for %s: %w", lotCode, err)
+				}
+				knownSources[lotCode] = source
+			}
+			sources[i] = source
+		}
+
+		locationIDs = append(locationIDs, eventLocations(event)...)
+		locationIDs = append(locationIDs, sources[i])
+	}
+
+	names, err := masterDataNames(orgID, locationIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]models.FSMA204Row, len(events))
+	for i, event := range events {
+		rows[i] = fsma204Row(&dbEvents[i], event, sources[i], names)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"lot":  lot,
+		"rows": len(rows),
+	}).Info("FSMA 204 export generated")
+
+	return rows, nil
+}
+
+// WriteFSMA204CSV writes FSMA 204 rows as CSV with a header row
+func (s *ExportService) WriteFSMA204CSV(w io.Writer, rows []models.FSMA204Row) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(models.FSMA204Columns); err != nil {
+		return err
+	}
+	for i := range rows {
+		if err := writer.Write(rows[i].Values()); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteFSMA204XLSX writes FSMA 204 rows as an Excel workbook with a filterable
+// header row
+func (s *ExportService) WriteFSMA204XLSX(w io.Writer, rows []models.FSMA204Row) error {
+	file := excelize.NewFile()
+	defer file.Close()
+
+	if err := file.SetSheetName("Sheet1", fsma204Sheet); err != nil {
+		return err
+	}
+
+	header := make([]interface{}, len(models.FSMA204Columns))
+	for i, column := range models.FSMA204Columns {
+		header[i] = column
+	}
+	if err := file.SetSheetRow(fsma204Sheet, "A1", &header); err != nil {
+		return err
+	}
+
+	for i := range rows {
+		values := rows[i].Values()
+		cells := make([]interface{}, len(values))
+		for j, value := range values {
+			cells[j] = value
+		}
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return err
+		}
+		if err := file.SetSheetRow(fsma204Sheet, cell, &cells); err != nil {
+			return err
+		}
+	}
+
+	lastCell, err := excelize.CoordinatesToCellName(len(models.FSMA204Columns), len(rows)+1)
+	if err != nil {
+		return err
+	}
+	if err := file.AutoFilter(fsma204Sheet, "A1:"+lastCell, nil); err != nil {
+		return err
+	}
+
+	return file.Write(w)
+}
+
+// fsma204Row builds the spreadsheet row of a CTE event
+func fsma204Row(dbEvent *database.Event, event *models.EpcisEvent, lotCodeSource string, names map[string]string) models.FSMA204Row {
+	cte, _ := models.ClassifyCTE(event)
+	eventTime := event.EventTime.UTC()
+
+	row := models.FSMA204Row{
+		TraceabilityLotCode:       models.TraceabilityLotCode(event),
+		TraceabilityLotCodeSource: describeLocation(lotCodeSource, names),
+		CTE:                       cte,
+		EventDate:                 eventTime.Format("2006-01-02"),
+		EventTime:                 eventTime.Format("15:04:05"),
+		EventID:                   event.EventID,
+		Hash:                      dbEvent.Hash,
+	}
+
+	epcs, quantities := event.EPCList, event.QuantityList
+	switch event.EventType {
+	case models.TransformationEventType:
+		epcs, quantities = event.OutputEPCList, event.OutputQuantityList
+	case models.AggregationEventType:
+		epcs, quantities = event.ChildEPCs, event.ChildQuantityList
+	}
+	row.ProductDescription = strings.Join(append(append([]string{}, epcs...), quantityClasses(quantities)...), "; ")
+	row.Quantity, row.UnitOfMeasure = quantityTotals(epcs, quantities)
+
+	if event.BizLocation != nil {
+		row.LocationDescription = describeLocation(event.BizLocation.ID, names)
+	} else if event.ReadPoint != nil {
+		row.LocationDescription = describeLocation(event.ReadPoint.ID, names)
+	}
+
+	var shipFrom, shipTo []string
+	for _, source := range event.SourceList {
+		shipFrom = append(shipFrom, describeLocation(source.Source, names))
+	}
+	if len(shipFrom) == 0 && cte == models.CTEShipping {
+		shipFrom = append(shipFrom, row.LocationDescription)
+	}
+	for _, destination := range event.DestinationList {
+		shipTo = append(shipTo, describeLocation(destination.Destination, names))
+	}
+	row.ShipFromLocation = strings.Join(shipFrom, "; ")
+	row.ShipToLocation = strings.Join(shipTo, "; ")
+
+	var documentTypes, documentNumbers []string
+	for _, transaction := range event.BizTransactionList {
+		documentTypes = append(documentTypes, transaction.Type)
+		documentNumbers = append(documentNumbers, transaction.BizTransaction)
+	}
+	row.ReferenceDocumentType = strings.Join(documentTypes, "; ")
+	row.ReferenceDocumentNumber = strings.Join(documentNumbers, "; ")
+
+	if dbEvent.BlockchainTxID != nil {
+		row.BlockchainTxID = *dbEvent.BlockchainTxID
+	}
+
+	return row
+}
+
+// quantityTotals sums quantities per unit of measure. EPCs count as eaches.
+func quantityTotals(epcs []string, quantities []models.QuantityElement) (string, string) {
+	var units []string
+	totals := make(map[string]float64)
+	add := func(uom string, quantity float64) {
+		if _, ok := totals[uom]; !ok {
+			units = append(units, uom)
+		}
+		totals[uom] += quantity
+	}
+
+	if len(epcs) > 0 {
+		add("EA", float64(len(epcs)))
+	}
+	for _, quantity := range quantities {
+		uom := ""
+		if quantity.UOM != nil {
+			uom = *quantity.UOM
+		}
+		add(uom, quantity.Quantity)
+	}
+
+	amounts := make([]string, len(units))
+	for i, uom := range units {
+		amounts[i] = strconv.FormatFloat(totals[uom], 'f', -1, 64)
+	}
+	return strings.Join(amounts, "; "), strings.Join(units, "; ")
+}
+
+// eventLocations lists the locations and parties an event refers to
+func eventLocations(event *models.EpcisEvent) []string {
+	var ids []string
+	if event.BizLocation != nil {
+		ids = append(ids, event.BizLocation.ID)
+	}
+	if event.ReadPoint != nil {
+		ids = append(ids, event.ReadPoint.ID)
+	}
+	for _, source := range event.SourceList {
+		ids = append(ids, source.Source)
+	}
+	for _, destination := range event.DestinationList {
+		ids = append(ids, destination.Destination)
+	}
+	return ids
+}
+
+// masterDataNames looks up the names an organization captured as master data
+// for the given IDs
+func masterDataNames(orgID string, ids []string) (map[string]string, error) {
+	elements, err := database.GetMasterDataElements(orgID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get master data: %w", err)
+	}
+
+	names := make(map[string]string)
+	for _, element := range elements {
+		var attributes []models.VocabularyAttribute
+		if err := json.Unmarshal([]byte(element.Attributes), &attributes); err != nil {
+			continue
+		}
+		for _, attribute := range attributes {
+			name, ok := attribute.Attribute.(string)
+			if ok && (attribute.ID == "name" || strings.HasSuffix(attribute.ID, "#name") || strings.HasSuffix(attribute.ID, ":name")) {
+				names[element.ID] = name
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
+// describeLocation adds the master data name of a location to its identifier
+func describeLocation(id string, names map[string]string) string {
+	if name, ok := names[id]; ok && name != "" {
+		return fmt.Sprintf("%s (%s)", name, id)
+	}
+	return id
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+	"github.com/sirupsen/logrus"
+)
+
+// FabricLedger anchors events with the scain chaincode on a Hyperledger Fabric network
+type FabricLedger struct {
+	gateway  *gateway.Gateway
+	network  *gateway.Network
+	contract *gateway.Contract
+}
+
+// NewFabricLedger initializes connection to Hyperledger Fabric
+func NewFabricLedger() (*FabricLedger, error) {
+	// Load connection profile from environment or config
+	ccpPath := os.Getenv("FABRIC_CCP_PATH")
+	if ccpPath == "" {
+		ccpPath = "./blockchain/network/connection-profile.yaml"
+	}
+
+	// Create wallet and gateway connection
+	walletPath := os.Getenv("FABRIC_WALLET_PATH")
+	if walletPath == "" {
+		walletPath = "wallet"
+	}
+	wallet, err := gateway.NewFileSystemWallet(walletPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create wallet: %w", err)
+	}
+
+	userID := os.Getenv("FABRIC_USER_ID")
+	if userID == "" {
+		userID = "appUser"
+	}
+
+	gw, err := gateway.Connect(
+		gateway.WithConfig(config.FromFile(ccpPath)),
+		gateway.WithIdentity(wallet, userID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to gateway: %w", err)
+	}
+
+	// Get network and contract
+	network, err := gw.GetNetwork(os.Getenv("FABRIC_CHANNEL_NAME"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network: %w", err)
+	}
+
+	contract := network.GetContract(os.Getenv("FABRIC_CHAINCODE_NAME"))
+
+	return &FabricLedger{
+		gateway:  gw,
+		network:  network,
+		contract: contract,
+	}, nil
+}
+
+// Name identifies the backend
+func (l *FabricLedger) Name() string {
+	return LedgerFabric
+}
+
+// Submit submits an event record to the blockchain
+func (l *FabricLedger) Submit(record *EventRecord) (string, error) {
+	result, err := l.contract.SubmitTransaction("StoreEvent",
+		record.EventID,
+		record.EventHash,
+		record.Timestamp.Format(time.RFC3339),
+		record.EventType,
+		record.Data,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			return "", fmt.Errorf("%w: %s", ErrLedgerRecordExists, record.EventID)
+		}
+		return "", fmt.Errorf("failed to submit transaction: %w", err)
+	}
+
+	// Get transaction ID from result
+	txID := string(result)
+
+	logger.WithFields(logrus.Fields{
+		"eventId": record.EventID,
+		"txId":    txID,
+	}).Debug("Event record submitted to Fabric")
+	return txID, nil
+}
+
+// Get retrieves an event record from the blockchain by ID
+func (l *FabricLedger) Get(eventID string) (*EventRecord, error) {
+	result, err := l.contract.EvaluateTransaction("GetEvent", eventID)
+	if err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			return nil, ErrLedgerRecordNotFound
+		}
+		return nil, fmt.Errorf("failed to evaluate transaction: %w", err)
+	}
+
+	var record EventRecord
+	if err := json.Unmarshal(result, &record); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event record: %w", err)
+	}
+
+	return &record, nil
+}
+
+// Verify compares the hash of an event on the blockchain with a hash
+func (l *FabricLedger) Verify(eventID, hash string) (bool, error) {
+	record, err := l.Get(eventID)
+	if err != nil {
+		return false, err
+	}
+	return record.EventHash == hash, nil
+}
+
+// fabricHistoryEntry is an entry returned by the GetEventHistory chaincode function
+type fabricHistoryEntry struct {
+	TxID      string `json:"txId"`
+	Timestamp struct {
+		Seconds int64 `json:"seconds"`
+		Nanos   int64 `json:"nanos"`
+	} `json:"timestamp"`
+	IsDelete bool         `json:"isDelete"`
+	Value    *EventRecord `json:"value"`
+}
+
+// History retrieves the transactions that wrote an event on the blockchain
+func (l *FabricLedger) History(eventID string) ([]LedgerEntry, error) {
+	result, err := l.contract.EvaluateTransaction("GetEventHistory", eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate transaction: %w", err)
+	}
+
+	var history []fabricHistoryEntry
+	if len(result) > 0 {
+		if err := json.Unmarshal(result, &history); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal event history: %w", err)
+		}
+	}
+	if len(history) == 0 {
+		return nil, ErrLedgerRecordNotFound
+	}
+
+	entries := make([]LedgerEntry, 0, len(history))
+	for _, entry := range history {
+		entries = append(entries, LedgerEntry{
+			TxID:      entry.TxID,
+			Timestamp: time.Unix(entry.Timestamp.Seconds, entry.Timestamp.Nanos).UTC(),
+			IsDelete:  entry.IsDelete,
+			Record:    entry.Value,
+		})
+	}
+
+	// The order Fabric returns the history of a key in is not guaranteed
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+	return entries, nil
+}
+
+// Close closes the gateway connection
+func (l *FabricLedger) Close() error {
+	if l.gateway != nil {
+		l.gateway.Close()
+	}
+	return nil
+}
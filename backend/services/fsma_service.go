@@ -0,0 +1,108 @@
+package services
+
+import (
+	"fmt"
+	"os"
+
+	"scain-backend/database"
+	"scain-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// FSMAService classifies EPCIS events as FSMA 204 Critical Tracking Events and
+// checks them for the Key Data Elements the FDA Food Traceability Rule requires
+type FSMAService struct {
+	mode models.FSMA204Mode
+}
+
+// NewFSMAService creates a new FSMA 204 service instance. The mode is read from
+// FSMA204_MODE (off, warn or strict) and defaults to warn.
+func NewFSMAService() *FSMAService {
+	mode := models.FSMA204Mode(os.Getenv("FSMA204_MODE"))
+	switch mode {
+	case models.FSMA204Off, models.FSMA204Warn, models.FSMA204Strict:
+	case "":
+		mode = models.FSMA204Warn
+	default:
+		logger.Warnf("Unknown FSMA204_MODE %q, using %s", mode, models.FSMA204Warn)
+		mode = models.FSMA204Warn
+	}
+
+	return &FSMAService{mode: mode}
+}
+
+// Mode returns how missing KDEs are handled at capture time
+func (s *FSMAService) Mode() models.FSMA204Mode {
+	return s.mode
+}
+
+// CheckEvents checks events an organization is about to capture and returns a
+// check for every CTE with missing KDEs. Lot code sources assigned by earlier
+// events in the same batch count as known. Nothing is checked when the mode is
+// off.
+func (s *FSMAService) CheckEvents(orgID string, events []*models.EpcisEvent) ([]models.FSMA204Check, error) {
+	checks := []models.FSMA204Check{}
+	if s.mode == models.FSMA204Off {
+		return checks, nil
+	}
+
+	lotCodeSources := make(map[string]string)
+	for i, event := range events {
+		lotCode := models.TraceabilityLotCode(event)
+		if _, known := lotCodeSources[lotCode]; lotCode != "" && !known {
+			source, err := database.FindLotCodeSource(orgID, lotCode)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find lot code source for %s: %w", lotCode, err)
+			}
+			lotCodeSources[lotCode] = source
+		}
+
+		check := models.CheckKDEs(event, lotCodeSources)
+		if source := models.LotCodeSource(event); lotCode != "" && source != "" {
+			lotCodeSources[lotCode] = source
+		}
+		if check == nil || len(check.MissingKDEs) == 0 {
+			continue
+		}
+
+		index := i
+		check.EventIndex = &index
+		check.EventID = event.EventID
+		checks = append(checks, *check)
+	}
+
+	return checks, nil
+}
+
+// CheckStoredEvent classifies a stored event of an organization and reports
+// the KDEs it lacks. The check is nil when the event is not a CTE.
+func (s *FSMAService) CheckStoredEvent(orgID, id string) (*models.FSMA204Check, error) {
+	dbEvent, err := database.GetEventByID(orgID, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("event not found: %s", id)
+		}
+		return nil, fmt.Errorf("failed to get event from database: %w", err)
+	}
+
+	event, err := eventFromRecord(dbEvent)
+	if err != nil {
+		return nil, err
+	}
+
+	lotCodeSources := make(map[string]string)
+	if lotCode := models.TraceabilityLotCode(event); lotCode != "" {
+		source, err := database.FindLotCodeSource(orgID, lotCode)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find lot code source for %s: %w", lotCode, err)
+		}
+		lotCodeSources[lotCode] = source
+	}
+
+	check := models.CheckKDEs(event, lotCodeSources)
+	if check != nil {
+		check.EventID = event.EventID
+	}
+	return check, nil
+}
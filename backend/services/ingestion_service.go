@@ -0,0 +1,141 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"scain-backend/database"
+	"scain-backend/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ErrIngestionBusy is returned when replaying an ingestion that is still queued or being processed
+var ErrIngestionBusy = errors.New("ingestion is pending or being processed")
+
+// ErrIngestionAnchored is returned when replaying an ingestion whose events are
+// batched or anchored on the ledger, which would rewrite anchored history
+var ErrIngestionAnchored = errors.New("ingestion has events that are batched or anchored on the ledger")
+
+// IngestionService lets operators inspect and replay raw data ingestions
+type IngestionService struct {
+	worker *IngestionWorker
+}
+
+// NewIngestionService creates a new ingestion service instance
+func NewIngestionService(worker *IngestionWorker) *IngestionService {
+	return &IngestionService{worker: worker}
+}
+
+// ListIngestions retrieves raw data ingestions matching a filter and the total number of matches
+func (s *IngestionService) ListIngestions(filter *database.IngestionFilter) ([]database.RawDataIngestion, int64, error) {
+	ingestions, total, err := database.ListRawDataIngestions(filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list ingestions: %w", err)
+	}
+	return ingestions, total, nil
+}
+
+// GetIngestion retrieves a raw data ingestion of an organization with its
+// payload and derived events
+func (s *IngestionService) GetIngestion(orgID, id string) (*models.IngestionDetail, error) {
+	ingestion, err := database.GetRawDataIngestionByID(orgID, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("ingestion not found: %s", id)
+		}
+		return nil, fmt.Errorf("failed to get ingestion from database: %w", err)
+	}
+
+	detail := &models.IngestionDetail{
+		ID:               ingestion.ID,
+		DeviceType:       models.DeviceType(ingestion.DeviceType),
+		DeviceID:         ingestion.DeviceID,
+		Timestamp:        ingestion.Timestamp,
+		LotCode:          ingestion.LotCode,
+		ProcessingStatus: ingestion.ProcessingStatus,
+		Attempts:         ingestion.Attempts,
+		ErrorMessage:     ingestion.ErrorMessage,
+		NextAttemptAt:    ingestion.NextAttemptAt,
+		ProcessedAt:      ingestion.ProcessedAt,
+		CreatedAt:        ingestion.CreatedAt,
+		Events:           []models.EpcisEvent{},
+	}
+	if err := json.Unmarshal([]byte(ingestion.RawData), &detail.Data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal raw data: %w", err)
+	}
+	if ingestion.Metadata != "" {
+		if err := json.Unmarshal([]byte(ingestion.Metadata), &detail.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal metadata: %w", err)
+		}
+	}
+
+	dbEvents, err := database.GetEventsByIngestionID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events for ingestion: %w", err)
+	}
+	for i := range dbEvents {
+		event, err := eventFromRecord(&dbEvents[i])
+		if err != nil {
+			return nil, err
+		}
+		detail.Events = append(detail.Events, *event)
+	}
+
+	return detail, nil
+}
+
+// Replay queues a processed or failed ingestion of an organization to be
+// transformed again. The events it produced before are replaced, not
+// duplicated, so an ingestion with anchored events cannot be replayed.
+func (s *IngestionService) Replay(orgID, id string) error {
+	if _, err := database.GetRawDataIngestionByID(orgID, id); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("ingestion not found: %s", id)
+		}
+		return fmt.Errorf("failed to get ingestion from database: %w", err)
+	}
+
+	anchored, err := database.HasAnchoredEvents(id)
+	if err != nil {
+		return fmt.Errorf("failed to get events from database: %w", err)
+	}
+	if anchored {
+		return ErrIngestionAnchored
+	}
+
+	queued, err := database.ReplayIngestion(orgID, id)
+	if err != nil {
+		return fmt.Errorf("failed to queue ingestion for replay: %w", err)
+	}
+	if !queued {
+		return ErrIngestionBusy
+	}
+
+	logger.WithField("ingestionId", id).Info("Ingestion queued for replay")
+	s.worker.Notify()
+	return nil
+}
+
+// ReplayFailed queues every failed ingestion matching a filter to be
+// transformed again, except those with anchored events, and returns how many
+// were queued
+func (s *IngestionService) ReplayFailed(filter *database.IngestionFilter) (int64, error) {
+	count, err := database.ReplayFailedIngestions(filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to queue ingestions for replay: %w", err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"orgId":    filter.OrgID,
+		"deviceId": filter.DeviceID,
+		"count":    count,
+	}).Info("Failed ingestions queued for replay")
+
+	if count > 0 {
+		s.worker.Notify()
+	}
+	return count, nil
+}
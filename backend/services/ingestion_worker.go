@@ -0,0 +1,195 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"scain-backend/database"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultIngestWorkers is the number of workers when INGEST_WORKERS is not set
+	DefaultIngestWorkers = 4
+	// DefaultIngestMaxAttempts is the number of attempts when INGEST_MAX_ATTEMPTS is not set
+	DefaultIngestMaxAttempts = 5
+
+	// ingestRetryBaseDelay is the delay before the first retry; it doubles with each attempt
+	ingestRetryBaseDelay = 2 * time.Second
+	// ingestRetryMaxDelay caps the delay between retries
+	ingestRetryMaxDelay = 5 * time.Minute
+	// ingestPollInterval is how often idle workers look for due retries
+	ingestPollInterval = time.Second
+)
+
+// IngestionWorker processes pending raw data ingestions in the background with
+// a pool of workers, retrying failed attempts with exponential backoff
+type IngestionWorker struct {
+	epcisService *EPCISService
+	workers      int
+	maxAttempts  int
+	wake         chan struct{}
+	stop         chan struct{}
+	wg           sync.WaitGroup
+}
+
+// NewIngestionWorker creates a new ingestion worker pool. The pool size and
+// number of attempts are read from INGEST_WORKERS and INGEST_MAX_ATTEMPTS.
+func NewIngestionWorker(epcisService *EPCISService) *IngestionWorker {
+	// Ingestions still processing belong to a previous process and are picked up again
+	if err := database.ResetInterruptedIngestions(); err != nil {
+		logger.Warnf("Failed to reset interrupted ingestions: %v", err)
+	}
+
+	return &IngestionWorker{
+		epcisService: epcisService,
+		workers:      envInt("INGEST_WORKERS", DefaultIngestWorkers),
+		maxAttempts:  envInt("INGEST_MAX_ATTEMPTS", DefaultIngestMaxAttempts),
+		wake:         make(chan struct{}, 1),
+		stop:         make(chan struct{}),
+	}
+}
+
+// Start launches the workers
+func (w *IngestionWorker) Start() {
+	for i := 0; i < w.workers; i++ {
+		w.wg.Add(1)
+		go w.run()
+	}
+
+	logger.WithFields(logrus.Fields{
+		"workers":     w.workers,
+		"maxAttempts": w.maxAttempts,
+	}).Info("Ingestion workers started")
+}
+
+// Stop signals the workers to exit and waits for ingestions in progress to finish
+func (w *IngestionWorker) Stop() {
+	close(w.stop)
+	w.wg.Wait()
+	logger.Info("Ingestion workers stopped")
+}
+
+// Notify wakes an idle worker after a new ingestion has been stored
+func (w *IngestionWorker) Notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run claims and processes ingestions until the pool is stopped
+func (w *IngestionWorker) run() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(ingestPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+
+		ingestion, err := database.ClaimPendingIngestion(time.Now())
+		if err != nil {
+			logger.WithError(err).Error("Failed to claim raw data ingestion")
+		}
+		if ingestion != nil {
+			// More work may be queued behind this one
+			w.Notify()
+			w.process(ingestion)
+			continue
+		}
+
+		select {
+		case <-w.stop:
+			return
+		case <-w.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// process runs one attempt at an ingestion and records its outcome
+func (w *IngestionWorker) process(ingestion *database.RawDataIngestion) {
+	ingestion.Attempts++
+	eventIDs, err := w.epcisService.ProcessRawDataIngestion(ingestion)
+
+	fields := logrus.Fields{
+		"ingestionId": ingestion.ID,
+		"deviceId":    ingestion.DeviceID,
+		"attempt":     ingestion.Attempts,
+	}
+
+	if err != nil {
+		message := err.Error()
+		ingestion.ErrorMessage = &message
+
+		// Anchored events stay as they are however often the ingestion is retried
+		if ingestion.Attempts >= w.maxAttempts || errors.Is(err, ErrIngestionAnchored) {
+			now := time.Now()
+			ingestion.ProcessingStatus = database.IngestionFailed
+			ingestion.ProcessedAt = &now
+			ingestion.NextAttemptAt = nil
+			logger.WithError(err).WithFields(fields).Error("Raw data ingestion failed")
+		} else {
+			next := time.Now().Add(retryDelay(ingestion.Attempts))
+			ingestion.ProcessingStatus = database.IngestionPending
+			ingestion.NextAttemptAt = &next
+			logger.WithError(err).WithFields(fields).Warn("Raw data ingestion attempt failed, retrying")
+		}
+	} else {
+		now := time.Now()
+		eventIDsJSON, _ := json.Marshal(eventIDs)
+		ingestion.ProcessingStatus = database.IngestionProcessed
+		ingestion.ProcessedAt = &now
+		ingestion.NextAttemptAt = nil
+		ingestion.ErrorMessage = nil
+		ingestion.EventIDs = string(eventIDsJSON)
+		fields["eventCount"] = len(eventIDs)
+		logger.WithFields(fields).Info("Raw data ingestion processed")
+	}
+
+	if err := database.UpdateRawDataIngestion(ingestion); err != nil {
+		logger.WithError(err).WithFields(fields).Error("Failed to update raw data ingestion")
+	}
+}
+
+// retryDelay returns the backoff before the attempt following the given one
+func retryDelay(attempt int) time.Duration {
+	return backoffDelay(attempt, ingestRetryBaseDelay, ingestRetryMaxDelay)
+}
+
+// backoffDelay doubles a base delay with each attempt after the first, up to a cap
+func backoffDelay(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// envInt reads a positive integer from the environment, falling back to a default
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 1 {
+		logger.Warnf("Invalid %s %q, using %d", name, value, fallback)
+		return fallback
+	}
+	return parsed
+}
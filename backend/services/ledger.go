@@ -0,0 +1,86 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Ledger backends selectable with LEDGER_BACKEND
+const (
+	LedgerNone   = "none"   // events are not anchored
+	LedgerLocal  = "local"  // hash-chained file kept by the backend itself
+	LedgerFabric = "fabric" // Hyperledger Fabric network through the gateway SDK
+)
+
+// ErrLedgerRecordNotFound is returned when an event was never anchored on the ledger
+var ErrLedgerRecordNotFound = errors.New("event not found on ledger")
+
+// ErrLedgerRecordExists is returned when submitting an event that is already anchored
+var ErrLedgerRecordExists = errors.New("event already exists on ledger")
+
+// Ledger is an append-only record of event hashes that proves stored events
+// were not altered after they were anchored
+type Ledger interface {
+	// Submit anchors an event record and returns its transaction ID. An event
+	// can only be anchored once; submitting it again fails with
+	// ErrLedgerRecordExists.
+	Submit(record *EventRecord) (string, error)
+	// Get retrieves the anchored record of an event
+	Get(eventID string) (*EventRecord, error)
+	// Verify reports whether the anchored hash of an event matches a hash
+	Verify(eventID, hash string) (bool, error)
+	// History lists the ledger transactions that wrote an event, oldest first
+	History(eventID string) ([]LedgerEntry, error)
+	// Name identifies the backend, e.g. local or fabric
+	Name() string
+	// Close releases the resources of the ledger
+	Close() error
+}
+
+// EventRecord is what the ledger stores for an event
+type EventRecord struct {
+	EventID   string    `json:"eventId"`
+	EventHash string    `json:"eventHash"`
+	Timestamp time.Time `json:"timestamp"`
+	EventType string    `json:"eventType"`
+	DeviceID  string    `json:"deviceId,omitempty"`
+	Data      string    `json:"data"`
+	TxID      string    `json:"txId,omitempty"`
+}
+
+// LedgerEntry is a ledger transaction that wrote an event record
+type LedgerEntry struct {
+	TxID      string       `json:"txId"`
+	Timestamp time.Time    `json:"timestamp"`
+	IsDelete  bool         `json:"isDelete"`
+	Record    *EventRecord `json:"record,omitempty"`
+}
+
+// NewLedger opens the ledger LEDGER_BACKEND selects, or none when it is unset.
+// ENABLE_BLOCKCHAIN=true selects the Fabric ledger for compatibility.
+func NewLedger() (Ledger, error) {
+	backend := os.Getenv("LEDGER_BACKEND")
+	if backend == "" {
+		backend = LedgerNone
+		if os.Getenv("ENABLE_BLOCKCHAIN") == "true" {
+			backend = LedgerFabric
+		}
+	}
+
+	switch backend {
+	case LedgerNone:
+		return nil, nil
+	case LedgerLocal:
+		path := os.Getenv("LEDGER_PATH")
+		if path == "" {
+			path = "./ledger.jsonl"
+		}
+		return NewLocalLedger(path)
+	case LedgerFabric:
+		return NewFabricLedger()
+	default:
+		return nil, fmt.Errorf("unknown ledger backend: %s", backend)
+	}
+}
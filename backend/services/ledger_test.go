@@ -0,0 +1,115 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeLocalLedger anchors records of events on a new local ledger and returns its path
+func writeLocalLedger(t *testing.T, eventIDs ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ledger.jsonl")
+	ledger, err := NewLocalLedger(path)
+	if err != nil {
+		t.Fatalf("NewLocalLedger: %v", err)
+	}
+	defer ledger.Close()
+
+	for _, eventID := range eventIDs {
+		_, err := ledger.Submit(&EventRecord{
+			EventID:   eventID,
+			EventHash: strings.Repeat("0", 64),
+			Timestamp: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+			EventType: "ObjectEvent",
+			Data:      "{}",
+		})
+		if err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+	return path
+}
+
+func TestNewEPCISServiceOpensLedger(t *testing.T) {
+	t.Setenv("LEDGER_BACKEND", LedgerLocal)
+	t.Setenv("LEDGER_PATH", writeLocalLedger(t, "event-1", "event-2"))
+
+	service, err := NewEPCISService()
+	if err != nil {
+		t.Fatalf("NewEPCISService: %v", err)
+	}
+	defer service.Ledger().Close()
+	if verified, err := service.Ledger().Verify("event-2", strings.Repeat("0", 64)); err != nil || !verified {
+		t.Errorf("Verify(event-2) = %v, %v, want the anchored record", verified, err)
+	}
+}
+
+func TestNewEPCISServiceRejectsBrokenLedger(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend string
+		ledger  func(t *testing.T) string
+	}{
+		{
+			name:    "altered block",
+			backend: LedgerLocal,
+			ledger: func(t *testing.T) string {
+				path := writeLocalLedger(t, "event-1", "event-2")
+				content, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("failed to read ledger: %v", err)
+				}
+				altered := strings.Replace(string(content), strings.Repeat("0", 64), strings.Repeat("1", 64), 1)
+				if err := os.WriteFile(path, []byte(altered), 0o600); err != nil {
+					t.Fatalf("failed to alter ledger: %v", err)
+				}
+				return path
+			},
+		},
+		{
+			name:    "removed block",
+			backend: LedgerLocal,
+			ledger: func(t *testing.T) string {
+				path := writeLocalLedger(t, "event-1", "event-2", "event-3")
+				content, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("failed to read ledger: %v", err)
+				}
+				lines := strings.SplitAfter(string(content), "\n")
+				if err := os.WriteFile(path, []byte(lines[0]+lines[2]), 0o600); err != nil {
+					t.Fatalf("failed to alter ledger: %v", err)
+				}
+				return path
+			},
+		},
+		{
+			name:    "corrupt file",
+			backend: LedgerLocal,
+			ledger: func(t *testing.T) string {
+				path := filepath.Join(t.TempDir(), "ledger.jsonl")
+				if err := os.WriteFile(path, []byte("not a block\n"), 0o600); err != nil {
+					t.Fatalf("failed to write ledger: %v", err)
+				}
+				return path
+			},
+		},
+		{
+			name:    "unknown backend",
+			backend: "blockchain",
+			ledger:  func(t *testing.T) string { return "" },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LEDGER_BACKEND", tt.backend)
+			t.Setenv("LEDGER_PATH", tt.ledger(t))
+			// Running without the ledger would leave tampering unnoticed
+			if _, err := NewEPCISService(); err == nil {
+				t.Fatal("NewEPCISService accepted the ledger")
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// genesisHash is the previous hash of the first block of a local ledger
+var genesisHash = strings.Repeat("0", 64)
+
+// localBlock is one line of a local ledger file. Each block commits to the
+// block before it, so altering, removing or reordering any block breaks the
+// chain from that block on.
+type localBlock struct {
+	Seq       int64       `json:"seq"`
+	PrevHash  string      `json:"prevHash"`
+	Timestamp time.Time   `json:"timestamp"`
+	Record    EventRecord `json:"record"`
+	Hash      string      `json:"hash"` // also the transaction ID of the block
+}
+
+// computeHash hashes the sequence number, previous hash, timestamp and record of a block
+func (b *localBlock) computeHash() (string, error) {
+	record := b.Record
+	record.TxID = ""
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal ledger record: %w", err)
+	}
+
+	hasher := sha256.New()
+	hasher.Write([]byte(strconv.FormatInt(b.Seq, 10) + "\n" + b.PrevHash + "\n" + b.Timestamp.UTC().Format(time.RFC3339Nano) + "\n"))
+	hasher.Write(recordJSON)
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// LocalLedger is an append-only, hash-chained ledger kept in a JSON lines
+// file by the backend itself. It needs no network, so anchoring behaves the
+// same in development and tests as with Fabric, but it only detects tampering
+// with the file, not a rewrite of the whole chain by whoever controls the host.
+type LocalLedger struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	blocks map[string]*localBlock // event ID to the block that anchored it
+	last   *localBlock
+}
+
+// NewLocalLedger opens the local ledger at a path, creating it if needed, and
+// verifies its chain
+func NewLocalLedger(path string) (*LocalLedger, error) {
+	ledger := &LocalLedger{
+		path:   path,
+		blocks: make(map[string]*localBlock),
+	}
+	if err := ledger.load(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger file: %w", err)
+	}
+	ledger.file = file
+
+	logger.WithField("blocks", len(ledger.blocks)).Infof("Local ledger %s loaded", path)
+	return ledger, nil
+}
+
+// load reads the blocks of the ledger file and checks that they form an unbroken chain
+func (l *LocalLedger) load() error {
+	file, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open ledger file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		block := &localBlock{}
+		if err := json.Unmarshal(scanner.Bytes(), block); err != nil {
+			return fmt.Errorf("ledger %s is corrupt after block %d: %w", l.path, l.lastSeq(), err)
+		}
+		if err := l.checkLink(block); err != nil {
+			return fmt.Errorf("ledger %s is corrupt at block %d: %w", l.path, block.Seq, err)
+		}
+		l.append(block)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read ledger file: %w", err)
+	}
+	return nil
+}
+
+// checkLink checks that a block follows the last block and that its hash is intact
+func (l *LocalLedger) checkLink(block *localBlock) error {
+	prevHash := genesisHash
+	if l.last != nil {
+		prevHash = l.last.Hash
+	}
+	if block.Seq != l.lastSeq()+1 {
+		return fmt.Errorf("expected block %d", l.lastSeq()+1)
+	}
+	if block.PrevHash != prevHash {
+		return fmt.Errorf("previous hash does not match")
+	}
+
+	hash, err := block.computeHash()
+	if err != nil {
+		return err
+	}
+	if block.Hash != hash {
+		return fmt.Errorf("block hash does not match its contents")
+	}
+	return nil
+}
+
+// append adds a verified block to the in-memory index
+func (l *LocalLedger) append(block *localBlock) {
+	block.Record.TxID = block.Hash
+	l.blocks[block.Record.EventID] = block
+	l.last = block
+}
+
+// lastSeq returns the sequence number of the last block, 0 when there is none
+func (l *LocalLedger) lastSeq() int64 {
+	if l.last == nil {
+		return 0
+	}
+	return l.last.Seq
+}
+
+// Name identifies the backend
+func (l *LocalLedger) Name() string {
+	return LedgerLocal
+}
+
+// Submit appends a block anchoring an event record to the ledger file
+func (l *LocalLedger) Submit(record *EventRecord) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return "", fmt.Errorf("ledger %s is closed", l.path)
+	}
+	if _, exists := l.blocks[record.EventID]; exists {
+		return "", fmt.Errorf("%w: %s", ErrLedgerRecordExists, record.EventID)
+	}
+
+	prevHash := genesisHash
+	if l.last != nil {
+		prevHash = l.last.Hash
+	}
+	block := &localBlock{
+		Seq:       l.lastSeq() + 1,
+		PrevHash:  prevHash,
+		Timestamp: record.Timestamp.UTC(),
+		Record:    *record,
+	}
+	if block.Timestamp.IsZero() {
+		block.Timestamp = time.Now().UTC()
+	}
+	block.Record.TxID = ""
+
+	hash, err := block.computeHash()
+	if err != nil {
+		return "", err
+	}
+	block.Hash = hash
+
+	line, err := json.Marshal(block)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal ledger block: %w", err)
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return "", fmt.Errorf("failed to write ledger block: %w", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return "", fmt.Errorf("failed to sync ledger file: %w", err)
+	}
+
+	l.append(block)
+	return block.Hash, nil
+}
+
+// Get retrieves the record anchoring an event
+func (l *LocalLedger) Get(eventID string) (*EventRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	block, ok := l.blocks[eventID]
+	if !ok {
+		return nil, ErrLedgerRecordNotFound
+	}
+	record := block.Record
+	return &record, nil
+}
+
+// Verify compares the anchored hash of an event with a hash
+func (l *LocalLedger) Verify(eventID, hash string) (bool, error) {
+	record, err := l.Get(eventID)
+	if err != nil {
+		return false, err
+	}
+	return record.EventHash == hash, nil
+}
+
+// History returns the block that anchored an event; events are only written once
+func (l *LocalLedger) History(eventID string) ([]LedgerEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	block, ok := l.blocks[eventID]
+	if !ok {
+		return nil, ErrLedgerRecordNotFound
+	}
+	record := block.Record
+	return []LedgerEntry{{
+		TxID:      block.Hash,
+		Timestamp: block.Timestamp,
+		Record:    &record,
+	}}, nil
+}
+
+// Close closes the ledger file
+func (l *LocalLedger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"scain-backend/database"
+	"scain-backend/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Network servers that forward LoRaWAN uplinks
+const (
+	NetworkServerTTN        = "ttn"
+	NetworkServerChirpStack = "chirpstack"
+)
+
+// networkServerCodecName records that readings were decoded by the network server
+const networkServerCodecName = "network-server"
+
+// ErrPayloadDecode is returned when an uplink payload cannot be decoded
+var ErrPayloadDecode = errors.New("failed to decode uplink payload")
+
+// LoRaWANService maps uplinks forwarded by LoRaWAN network servers to raw
+// ingest payloads
+type LoRaWANService struct {
+	defaultCodec string
+}
+
+// lorawanUplink is an uplink in a form common to all network servers
+type lorawanUplink struct {
+	radio      models.RadioMetadata
+	receivedAt time.Time
+	payload    []byte
+	decoded    map[string]interface{}
+	hasGateway bool
+}
+
+// NewLoRaWANService creates a new LoRaWAN service instance. Payloads of devices
+// without a codec are decoded with LORAWAN_DEFAULT_CODEC, which defaults to
+// Cayenne LPP, unless the network server already decoded them.
+func NewLoRaWANService() *LoRaWANService {
+	codec := os.Getenv("LORAWAN_DEFAULT_CODEC")
+	if codec == "" {
+		codec = CayenneLPPCodecName
+	}
+	if _, ok := GetPayloadCodec(codec); !ok {
+		logger.Warnf("Unknown LORAWAN_DEFAULT_CODEC %q, using %s", codec, CayenneLPPCodecName)
+		codec = CayenneLPPCodecName
+	}
+
+	return &LoRaWANService{defaultCodec: codec}
+}
+
+// TTNPayload maps an uplink from The Things Stack to a raw ingest payload. The
+// payload is nil when the uplink carries no application data.
+func (s *LoRaWANService) TTNPayload(uplink *models.TTNUplink) (*models.RawIngestPayload, error) {
+	message := uplink.UplinkMessage
+	u := &lorawanUplink{
+		radio: models.RadioMetadata{
+			NetworkServer:   NetworkServerTTN,
+			DevEUI:          uplink.EndDeviceIDs.DevEUI,
+			FPort:           message.FPort,
+			FCnt:            message.FCnt,
+			GatewayCount:    len(message.RxMetadata),
+			SpreadingFactor: message.Settings.DataRate.LoRa.SpreadingFactor,
+			Bandwidth:       message.Settings.DataRate.LoRa.Bandwidth,
+		},
+		receivedAt: time.Now().UTC(),
+		payload:    message.FRMPayload,
+		decoded:    message.DecodedPayload,
+	}
+	if message.ReceivedAt != nil {
+		u.receivedAt = *message.ReceivedAt
+	} else if uplink.ReceivedAt != nil {
+		u.receivedAt = *uplink.ReceivedAt
+	}
+	if message.Settings.Frequency != nil {
+		if frequency, err := strconv.ParseInt(*message.Settings.Frequency, 10, 64); err == nil {
+			u.radio.Frequency = &frequency
+		}
+	}
+
+	for _, rx := range message.RxMetadata {
+		rssi := rx.RSSI
+		if rssi == nil {
+			rssi = rx.ChannelRSSI
+		}
+		gatewayID := rx.GatewayIDs.GatewayID
+		if gatewayID == "" {
+			gatewayID = rx.GatewayIDs.EUI
+		}
+		u.addGateway(gatewayID, rssi, rx.SNR)
+	}
+
+	return s.payload(u)
+}
+
+// ChirpStackPayload maps an uplink event from ChirpStack to a raw ingest
+// payload. The payload is nil when the uplink carries no application data.
+func (s *LoRaWANService) ChirpStackPayload(uplink *models.ChirpStackUplink) (*models.RawIngestPayload, error) {
+	lora := uplink.TxInfo.Modulation.LoRa
+	u := &lorawanUplink{
+		radio: models.RadioMetadata{
+			NetworkServer:   NetworkServerChirpStack,
+			DevEUI:          uplink.DeviceInfo.DevEUI,
+			FPort:           uplink.FPort,
+			FCnt:            uplink.FCnt,
+			GatewayCount:    len(uplink.RxInfo),
+			SpreadingFactor: lora.SpreadingFactor,
+			Bandwidth:       lora.Bandwidth,
+			Frequency:       uplink.TxInfo.Frequency,
+		},
+		receivedAt: time.Now().UTC(),
+		payload:    uplink.Data,
+		decoded:    uplink.Object,
+	}
+	if uplink.Time != nil {
+		u.receivedAt = *uplink.Time
+	}
+
+	for _, rx := range uplink.RxInfo {
+		u.addGateway(rx.GatewayID, rx.RSSI, rx.SNR)
+	}
+
+	return s.payload(u)
+}
+
+// addGateway records the reception by a gateway if its signal is the strongest so far
+func (u *lorawanUplink) addGateway(gatewayID string, rssi, snr *float64) {
+	if u.hasGateway && (rssi == nil || (u.radio.RSSI != nil && *u.radio.RSSI >= *rssi)) {
+		return
+	}
+	u.hasGateway = true
+	u.radio.GatewayID = gatewayID
+	u.radio.RSSI = rssi
+	u.radio.SNR = snr
+}
+
+// payload resolves the device of an uplink by its DevEUI and decodes the
+// readings. Devices registered with a payload codec are decoded with it;
+// otherwise readings decoded by the network server are used, falling back to
+// the default codec. Uplinks from unregistered devices use the DevEUI as the
+// device ID.
+func (s *LoRaWANService) payload(u *lorawanUplink) (*models.RawIngestPayload, error) {
+	if len(u.payload) == 0 && len(u.decoded) == 0 {
+		return nil, nil
+	}
+
+	u.radio.DevEUI = strings.ToUpper(u.radio.DevEUI)
+	deviceID := u.radio.DevEUI
+	codecName := ""
+
+	device, err := database.GetDeviceByDevEUI(u.radio.DevEUI)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to look up device by DevEUI: %w", err)
+	}
+	if device != nil {
+		deviceID = device.DeviceID
+		if device.PayloadCodec != nil {
+			codecName = *device.PayloadCodec
+		}
+	}
+	if codecName == "" && len(u.decoded) > 0 {
+		codecName = networkServerCodecName
+	}
+	if codecName == "" {
+		codecName = s.defaultCodec
+	}
+
+	data := u.decoded
+	var units map[string]string
+	if codecName != networkServerCodecName {
+		codec, ok := GetPayloadCodec(codecName)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown codec %s", ErrPayloadDecode, codecName)
+		}
+		if data, units, err = codec.Decode(u.radio.FPort, u.payload); err != nil {
+			return nil, fmt.Errorf("%w with %s: %v", ErrPayloadDecode, codecName, err)
+		}
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w with %s: no readings", ErrPayloadDecode, codecName)
+	}
+
+	metadata := map[string]interface{}{
+		"source": u.radio.NetworkServer,
+		"codec":  codecName,
+		"radio":  u.radio,
+	}
+	if len(units) > 0 {
+		metadata["uom"] = units
+	}
+
+	logger.WithFields(logrus.Fields{
+		"networkServer": u.radio.NetworkServer,
+		"devEui":        u.radio.DevEUI,
+		"deviceId":      deviceID,
+		"codec":         codecName,
+		"readings":      len(data),
+	}).Debug("LoRaWAN uplink decoded")
+
+	return &models.RawIngestPayload{
+		DeviceType: models.LoRaWANDeviceType,
+		DeviceID:   deviceID,
+		Timestamp:  u.receivedAt,
+		Data:       data,
+		Metadata:   metadata,
+	}, nil
+}
+
+// radioMetadata restores the radio metadata stored with a LoRaWAN ingestion
+func radioMetadata(metadata map[string]interface{}) *models.RadioMetadata {
+	stored, ok := metadata["radio"]
+	if !ok {
+		return nil
+	}
+
+	radioJSON, err := json.Marshal(stored)
+	if err != nil {
+		return nil
+	}
+	var radio models.RadioMetadata
+	if err := json.Unmarshal(radioJSON, &radio); err != nil {
+		return nil
+	}
+	return &radio
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"scain-backend/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MappingRules declares how the raw data of a device shape maps to an EPCIS
+// ObjectEvent, so new devices can be onboarded without code. Paths are dotted
+// paths into the payload ({"deviceId", "deviceType", "timestamp", "lotCode",
+// "data", "metadata"}), with numeric segments indexing arrays, e.g.
+// data.readings.0.temp. Text fields are templates in which {path} is replaced
+// by the value at the path; a field whose paths are missing is left out.
+// Rules are written in YAML or JSON.
+type MappingRules struct {
+	DeviceType  models.DeviceType `yaml:"deviceType"`
+	Vendor      string            `yaml:"vendor"`
+	Model       string            `yaml:"model"`
+	EventTime   string            `yaml:"eventTime"` // path to an RFC 3339 or Unix time, the payload timestamp when missing
+	BizStep     string            `yaml:"bizStep"`
+	Disposition string            `yaml:"disposition"`
+	ReadPoint   string            `yaml:"readPoint"`
+	BizLocation string            `yaml:"bizLocation"`
+	LotCode     string            `yaml:"lotCode"` // the payload lot code when empty
+	EPCs        []string          `yaml:"epcs"`
+	Sensors     []SensorMapping   `yaml:"sensors"`
+}
+
+// SensorMapping maps the value at a path to a sensor report. Numeric values
+// are multiplied by the scale, when given, and the offset is added.
+type SensorMapping struct {
+	Path      string  `yaml:"path"`
+	Type      string  `yaml:"type"`
+	UOM       string  `yaml:"uom"`
+	Component string  `yaml:"component"`
+	Scale     float64 `yaml:"scale"`
+	Offset    float64 `yaml:"offset"`
+}
+
+// MappingTransformer transforms raw data according to mapping rules
+type MappingTransformer struct {
+	rules MappingRules
+}
+
+// templatePlaceholder matches the {path} placeholders of a template
+var templatePlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// NewMappingTransformer checks mapping rules and creates a transformer from them
+func NewMappingTransformer(rules MappingRules) (*MappingTransformer, error) {
+	if rules.DeviceType == "" {
+		return nil, fmt.Errorf("deviceType is required")
+	}
+	if rules.Model != "" && rules.Vendor == "" {
+		return nil, fmt.Errorf("model requires a vendor")
+	}
+	for i, sensor := range rules.Sensors {
+		if sensor.Path == "" || sensor.Type == "" {
+			return nil, fmt.Errorf("sensor %d: path and type are required", i)
+		}
+	}
+
+	return &MappingTransformer{rules: rules}, nil
+}
+
+// Key returns the transformer key the rules apply to
+func (t *MappingTransformer) Key() TransformerKey {
+	return TransformerKey{DeviceType: t.rules.DeviceType, Vendor: t.rules.Vendor, Model: t.rules.Model}
+}
+
+// Transform maps the raw data to one ObjectEvent
+func (t *MappingTransformer) Transform(payload *models.RawIngestPayload) ([]*models.EpcisEvent, error) {
+	document := map[string]interface{}{
+		"deviceId":   payload.DeviceID,
+		"deviceType": string(payload.DeviceType),
+		"timestamp":  payload.Timestamp.UTC().Format(time.RFC3339Nano),
+		"data":       payload.Data,
+		"metadata":   payload.Metadata,
+	}
+	if payload.LotCode != nil {
+		document["lotCode"] = *payload.LotCode
+	}
+
+	eventTime := payload.Timestamp
+	if t.rules.EventTime != "" {
+		if value, ok := lookupPath(document, t.rules.EventTime); ok {
+			parsed, err := parseMappedTime(value)
+			if err != nil {
+				return nil, fmt.Errorf("eventTime %s: %w", t.rules.EventTime, err)
+			}
+			eventTime = parsed
+		}
+	}
+
+	action := models.ActionObserve
+	event := &models.EpcisEvent{
+		EventType:           models.ObjectEventType,
+		EventTime:           eventTime,
+		EventTimeZoneOffset: "+00:00",
+		Action:              &action,
+		DeviceID:            &payload.DeviceID,
+		DeviceTimestamp:     &payload.Timestamp,
+		LotCode:             payload.LotCode,
+	}
+
+	if lotCode, ok := expandTemplate(t.rules.LotCode, document); ok {
+		event.LotCode = &lotCode
+	}
+	if bizStep, ok := expandTemplate(t.rules.BizStep, document); ok {
+		step := models.BusinessStep(bizStep)
+		event.BizStep = &step
+	}
+	if disposition, ok := expandTemplate(t.rules.Disposition, document); ok {
+		event.Disposition = &disposition
+	}
+	if readPoint, ok := expandTemplate(t.rules.ReadPoint, document); ok {
+		event.ReadPoint = &models.ReadPoint{ID: readPoint}
+	}
+	if bizLocation, ok := expandTemplate(t.rules.BizLocation, document); ok {
+		event.BizLocation = &models.BizLocation{ID: bizLocation}
+	}
+	for _, template := range t.rules.EPCs {
+		if epc, ok := expandTemplate(template, document); ok {
+			event.EPCList = append(event.EPCList, epc)
+		}
+	}
+
+	var reports []models.SensorReport
+	for _, sensor := range t.rules.Sensors {
+		value, ok := lookupPath(document, sensor.Path)
+		if !ok || value == nil {
+			continue
+		}
+		if number, isNumber := value.(float64); isNumber {
+			if sensor.Scale != 0 {
+				number *= sensor.Scale
+			}
+			value = roundReading(number + sensor.Offset)
+		}
+
+		report := models.SensorReport{Type: sensor.Type, Value: value, Time: eventTime}
+		if sensor.UOM != "" {
+			uom := sensor.UOM
+			report.UOM = &uom
+		}
+		if sensor.Component != "" {
+			component := sensor.Component
+			report.Component = &component
+		}
+		reports = append(reports, report)
+	}
+	if len(t.rules.Sensors) > 0 && len(reports) == 0 {
+		return nil, fmt.Errorf("none of the sensor paths are present")
+	}
+	if len(reports) > 0 {
+		event.SensorElementList = []models.SensorElement{
+			{
+				SensorMetaData: models.SensorMetadata{
+					DeviceID:       payload.DeviceID,
+					DeviceMetadata: &models.DeviceMetadata{Type: payload.DeviceType},
+				},
+				SensorReport: reports,
+			},
+		}
+	}
+
+	return []*models.EpcisEvent{event}, nil
+}
+
+// LoadMappingRules registers a mapping transformer for every rules file at a
+// path, which is a YAML or JSON file or a directory of them. Nothing is
+// registered unless all files are valid. It returns the keys registered.
+func LoadMappingRules(path string) ([]TransformerKey, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		files = files[:0]
+		for _, entry := range entries {
+			switch strings.ToLower(filepath.Ext(entry.Name())) {
+			case ".yaml", ".yml", ".json":
+				if !entry.IsDir() {
+					files = append(files, filepath.Join(path, entry.Name()))
+				}
+			}
+		}
+		sort.Strings(files)
+	}
+
+	parsed := make([]*MappingTransformer, 0, len(files))
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		// JSON rules are valid YAML
+		var rules MappingRules
+		if err := yaml.Unmarshal(content, &rules); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		transformer, err := NewMappingTransformer(rules)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		parsed = append(parsed, transformer)
+	}
+
+	keys := make([]TransformerKey, len(parsed))
+	for i, transformer := range parsed {
+		keys[i] = transformer.Key()
+		RegisterTransformer(keys[i], transformer)
+	}
+	return keys, nil
+}
+
+// lookupPath returns the value at a dotted path in a decoded JSON document
+func lookupPath(document interface{}, path string) (interface{}, bool) {
+	current := document
+	for _, segment := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// expandTemplate replaces the {path} placeholders of a template. It reports
+// false when the template is empty or a path is missing.
+func expandTemplate(template string, document interface{}) (string, bool) {
+	if template == "" {
+		return "", false
+	}
+
+	complete := true
+	expanded := templatePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		value, ok := lookupPath(document, placeholder[1:len(placeholder)-1])
+		if !ok || value == nil {
+			complete = false
+			return ""
+		}
+		if number, isNumber := value.(float64); isNumber {
+			return strconv.FormatFloat(number, 'f', -1, 64)
+		}
+		return fmt.Sprint(value)
+	})
+	return expanded, complete
+}
+
+// parseMappedTime reads an RFC 3339 time or a Unix time in seconds or
+// milliseconds
+func parseMappedTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case string:
+		return time.Parse(time.RFC3339, v)
+	case float64:
+		// In seconds these would be after the year 2286, so they are milliseconds
+		if v > 1e10 {
+			return time.UnixMilli(int64(v)).UTC(), nil
+		}
+		return time.Unix(int64(v), 0).UTC(), nil
+	default:
+		return time.Time{}, fmt.Errorf("unsupported time value %v", value)
+	}
+}
@@ -0,0 +1,352 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"scain-backend/models"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultMQTTTopic is the topic pattern subscribed to when MQTT_TOPIC is not
+	// set. The single-level wildcard holds the device ID.
+	DefaultMQTTTopic = "scain/+/telemetry"
+	// DefaultMQTTClientID is the client ID used when MQTT_CLIENT_ID is not set
+	DefaultMQTTClientID = "scain-backend"
+	// DefaultMQTTQoS is the subscription QoS used when MQTT_QOS is not set
+	DefaultMQTTQoS = 1
+
+	// mqttDisconnectQuiesce is how long Stop waits for in-flight work, in milliseconds
+	mqttDisconnectQuiesce = 1000
+)
+
+// MQTTListener subscribes to device telemetry on an MQTT broker and stores each
+// message as a raw data ingestion, the same way POST /api/ingest does
+type MQTTListener struct {
+	deviceService *DeviceService
+	worker        *IngestionWorker
+	validate      *validator.Validate
+	brokerURL     string
+	topic         string
+	qos           byte
+	deviceType    models.DeviceType
+	client        mqtt.Client
+}
+
+// mqttEPCISDocument is the EPCIS document published by the ESP32 firmware
+type mqttEPCISDocument struct {
+	Type      string `json:"type"`
+	EPCISBody struct {
+		EventList []mqttEPCISEvent `json:"eventList"`
+	} `json:"epcisBody"`
+}
+
+// mqttEPCISEvent holds the parts of a firmware event needed for ingestion.
+// The firmware sends deviceMetadata as a plain string, so events are not
+// decoded as models.EpcisEvent.
+type mqttEPCISEvent struct {
+	EventTime         *time.Time `json:"eventTime"`
+	LotCode           *string    `json:"lotCode"`
+	EPCList           []string   `json:"epcList"`
+	SensorElementList []struct {
+		SensorMetadata struct {
+			DeviceID       string      `json:"deviceID"`
+			DeviceMetadata interface{} `json:"deviceMetadata"`
+		} `json:"sensorMetadata"`
+		SensorReport []struct {
+			Type      string      `json:"type"`
+			Value     interface{} `json:"value"`
+			UOM       string      `json:"uom"`
+			Component string      `json:"component"`
+		} `json:"sensorReport"`
+	} `json:"sensorElementList"`
+}
+
+// mqttRawPayload is a raw ingest payload whose device ID and timestamp may be
+// left to the topic and the time of receipt
+type mqttRawPayload struct {
+	DeviceType models.DeviceType      `json:"deviceType"`
+	DeviceID   string                 `json:"deviceId"`
+	Timestamp  *time.Time             `json:"timestamp"`
+	LotCode    *string                `json:"lotCode"`
+	Data       map[string]interface{} `json:"data"`
+	Metadata   map[string]interface{} `json:"metadata"`
+}
+
+// NewMQTTListener creates a new MQTT listener validating telemetry with the
+// validator the API validates requests with. The broker is read from
+// MQTT_BROKER_URL, and the listener stays disabled when it is not set. The topic
+// pattern, client ID, credentials, QoS and default device type are read from
+// MQTT_TOPIC, MQTT_CLIENT_ID, MQTT_USERNAME, MQTT_PASSWORD, MQTT_QOS and
+// MQTT_DEVICE_TYPE.
+func NewMQTTListener(deviceService *DeviceService, worker *IngestionWorker, validate *validator.Validate) *MQTTListener {
+	listener := &MQTTListener{
+		deviceService: deviceService,
+		worker:        worker,
+		validate:      validate,
+		brokerURL:     os.Getenv("MQTT_BROKER_URL"),
+		topic:         os.Getenv("MQTT_TOPIC"),
+		qos:           DefaultMQTTQoS,
+		deviceType:    models.DeviceType(os.Getenv("MQTT_DEVICE_TYPE")),
+	}
+	if listener.topic == "" {
+		listener.topic = DefaultMQTTTopic
+	}
+	if listener.deviceType == "" {
+		listener.deviceType = models.ESP32DeviceType
+	}
+	if value := os.Getenv("MQTT_QOS"); value != "" {
+		qos, err := strconv.Atoi(value)
+		if err != nil || qos < 0 || qos > 2 {
+			logger.Warnf("Invalid MQTT_QOS %q, using %d", value, DefaultMQTTQoS)
+		} else {
+			listener.qos = byte(qos)
+		}
+	}
+	if listener.brokerURL == "" {
+		return listener
+	}
+
+	clientID := os.Getenv("MQTT_CLIENT_ID")
+	if clientID == "" {
+		clientID = DefaultMQTTClientID
+	}
+
+	options := mqtt.NewClientOptions().
+		AddBroker(listener.brokerURL).
+		SetClientID(clientID).
+		SetUsername(os.Getenv("MQTT_USERNAME")).
+		SetPassword(os.Getenv("MQTT_PASSWORD")).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOrderMatters(false).
+		SetOnConnectHandler(listener.subscribe).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			logger.WithError(err).Warn("MQTT connection lost, reconnecting")
+		})
+	listener.client = mqtt.NewClient(options)
+
+	return listener
+}
+
+// Enabled reports whether a broker is configured
+func (l *MQTTListener) Enabled() bool {
+	return l.client != nil
+}
+
+// Start connects to the broker. The connection is retried in the background
+// until the broker is reachable, and the subscription is renewed on every
+// reconnect.
+func (l *MQTTListener) Start() {
+	if !l.Enabled() {
+		return
+	}
+
+	l.client.Connect()
+	logger.WithFields(logrus.Fields{
+		"broker": l.brokerURL,
+		"topic":  l.topic,
+	}).Info("MQTT listener started")
+}
+
+// Stop disconnects from the broker
+func (l *MQTTListener) Stop() {
+	if !l.Enabled() {
+		return
+	}
+
+	l.client.Disconnect(mqttDisconnectQuiesce)
+	logger.Info("MQTT listener stopped")
+}
+
+// subscribe subscribes to the telemetry topic once connected
+func (l *MQTTListener) subscribe(client mqtt.Client) {
+	token := client.Subscribe(l.topic, l.qos, l.handleMessage)
+	if token.Wait() && token.Error() != nil {
+		logger.WithError(token.Error()).WithField("topic", l.topic).Error("Failed to subscribe to MQTT topic")
+		return
+	}
+	logger.WithField("topic", l.topic).Info("Subscribed to MQTT topic")
+}
+
+// handleMessage stores the telemetry in a message as raw data ingestions of
+// the organizations the devices are registered to. Telemetry of unregistered
+// devices and messages that cannot be ingested are logged and dropped.
+func (l *MQTTListener) handleMessage(_ mqtt.Client, message mqtt.Message) {
+	fields := logrus.Fields{"topic": message.Topic()}
+
+	payloads, err := l.Payloads(message.Topic(), message.Payload())
+	if err != nil {
+		logger.WithError(err).WithFields(fields).Warn("Dropped MQTT message")
+		return
+	}
+
+	for _, payload := range payloads {
+		if err := l.validate.Struct(payload); err != nil {
+			logger.WithError(err).WithFields(fields).Warn("Dropped invalid MQTT telemetry")
+			continue
+		}
+
+		orgID, err := l.deviceService.DeviceOrganization(payload.DeviceID)
+		if errors.Is(err, ErrDeviceNotRegistered) {
+			logger.WithField("deviceId", payload.DeviceID).WithFields(fields).Warn("Dropped MQTT telemetry of unregistered device")
+			continue
+		}
+		if err != nil {
+			logger.WithError(err).WithFields(fields).Error("Failed to ingest MQTT telemetry")
+			continue
+		}
+		ingestion, err := l.deviceService.ProcessRawDataIngestion(orgID, payload)
+		if err != nil {
+			logger.WithError(err).WithFields(fields).Error("Failed to ingest MQTT telemetry")
+			continue
+		}
+		l.worker.Notify()
+
+		logger.WithFields(logrus.Fields{
+			"topic":       message.Topic(),
+			"deviceId":    payload.DeviceID,
+			"ingestionId": ingestion.ID,
+		}).Info("MQTT telemetry ingested")
+	}
+}
+
+// Payloads maps an MQTT message to raw ingest payloads. Messages are either
+// EPCIS documents carrying sensor reports, as published by the ESP32 firmware,
+// with one payload per event, or raw ingest payloads. The device ID comes from
+// the topic when the topic pattern has a single-level wildcard, and otherwise
+// from the message.
+func (l *MQTTListener) Payloads(topic string, message []byte) ([]*models.RawIngestPayload, error) {
+	topicDeviceID := l.topicDeviceID(topic)
+	received := time.Now().UTC()
+
+	var document mqttEPCISDocument
+	if err := json.Unmarshal(message, &document); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if document.Type == "EPCISDocument" {
+		if len(document.EPCISBody.EventList) == 0 {
+			return nil, fmt.Errorf("EPCIS document has no events")
+		}
+
+		payloads := make([]*models.RawIngestPayload, 0, len(document.EPCISBody.EventList))
+		for i := range document.EPCISBody.EventList {
+			payload := l.eventPayload(&document.EPCISBody.EventList[i], topic, topicDeviceID, received)
+			payloads = append(payloads, payload)
+		}
+		return payloads, nil
+	}
+
+	var raw mqttRawPayload
+	if err := json.Unmarshal(message, &raw); err != nil {
+		return nil, fmt.Errorf("invalid raw ingest payload: %w", err)
+	}
+	if raw.Data == nil {
+		return nil, fmt.Errorf("message is neither an EPCIS document nor a raw ingest payload")
+	}
+
+	payload := &models.RawIngestPayload{
+		DeviceType: raw.DeviceType,
+		DeviceID:   raw.DeviceID,
+		Timestamp:  received,
+		LotCode:    raw.LotCode,
+		Data:       raw.Data,
+		Metadata:   raw.Metadata,
+	}
+	if payload.DeviceType == "" {
+		payload.DeviceType = l.deviceType
+	}
+	if topicDeviceID != "" {
+		payload.DeviceID = topicDeviceID
+	}
+	if raw.Timestamp != nil {
+		payload.Timestamp = *raw.Timestamp
+	}
+	if payload.Metadata == nil {
+		payload.Metadata = make(map[string]interface{})
+	}
+	payload.Metadata["source"] = "mqtt"
+	payload.Metadata["topic"] = topic
+
+	return []*models.RawIngestPayload{payload}, nil
+}
+
+// eventPayload flattens the sensor reports of a firmware event into raw data.
+// Reports are keyed by type, qualified by component when one is given, and
+// their units are kept in the metadata.
+func (l *MQTTListener) eventPayload(event *mqttEPCISEvent, topic, topicDeviceID string, received time.Time) *models.RawIngestPayload {
+	payload := &models.RawIngestPayload{
+		DeviceType: l.deviceType,
+		DeviceID:   topicDeviceID,
+		Timestamp:  received,
+		LotCode:    event.LotCode,
+		Data:       make(map[string]interface{}),
+	}
+	if event.EventTime != nil {
+		payload.Timestamp = *event.EventTime
+	}
+
+	units := make(map[string]interface{})
+	for _, element := range event.SensorElementList {
+		if payload.DeviceID == "" {
+			payload.DeviceID = element.SensorMetadata.DeviceID
+		}
+		for _, report := range element.SensorReport {
+			if report.Type == "" {
+				continue
+			}
+			key := report.Type
+			if report.Component != "" {
+				key += "/" + report.Component
+			}
+			payload.Data[key] = report.Value
+			if report.UOM != "" {
+				units[key] = report.UOM
+			}
+		}
+	}
+
+	payload.Metadata = map[string]interface{}{
+		"source": "mqtt",
+		"topic":  topic,
+	}
+	if len(units) > 0 {
+		payload.Metadata["uom"] = units
+	}
+	if len(event.EPCList) > 0 {
+		payload.Metadata["epcList"] = event.EPCList
+	}
+
+	return payload
+}
+
+// topicDeviceID returns the topic level matched by the first single-level
+// wildcard of the topic pattern. A shared subscription prefix is ignored.
+func (l *MQTTListener) topicDeviceID(topic string) string {
+	pattern := l.topic
+	if strings.HasPrefix(pattern, "$share/") {
+		if parts := strings.SplitN(pattern, "/", 3); len(parts) == 3 {
+			pattern = parts[2]
+		}
+	}
+
+	levels := strings.Split(topic, "/")
+	for i, level := range strings.Split(pattern, "/") {
+		if level == "#" || i >= len(levels) {
+			break
+		}
+		if level == "+" {
+			return levels[i]
+		}
+	}
+	return ""
+}
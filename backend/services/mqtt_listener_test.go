@@ -0,0 +1,343 @@
+package services
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"scain-backend/database"
+	"scain-backend/models"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/go-playground/validator/v10"
+)
+
+func TestMQTTTopicDeviceID(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		topic   string
+		want    string
+	}{
+		{"default pattern", DefaultMQTTTopic, "scain/esp32-001/telemetry", "esp32-001"},
+		{"wildcard first", "+/telemetry", "esp32-001/telemetry", "esp32-001"},
+		{"first of several wildcards", "farms/+/+/telemetry", "farms/north/esp32-001/telemetry", "north"},
+		{"shared subscription", "$share/backend/scain/+/telemetry", "scain/esp32-001/telemetry", "esp32-001"},
+		{"multi-level wildcard only", "scain/#", "scain/esp32-001/telemetry", ""},
+		{"no wildcard", "scain/telemetry", "scain/telemetry", ""},
+		{"topic shorter than pattern", "scain/devices/+", "scain/devices", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener := &MQTTListener{topic: tt.pattern, deviceType: models.ESP32DeviceType}
+			if got := listener.topicDeviceID(tt.topic); got != tt.want {
+				t.Errorf("topicDeviceID(%q) = %q, want %q", tt.topic, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMQTTPayloadsEPCISDocument(t *testing.T) {
+	listener := &MQTTListener{topic: DefaultMQTTTopic, deviceType: models.ESP32DeviceType}
+	message := `{
+		"type": "EPCISDocument",
+		"epcisBody": {"eventList": [
+			{
+				"eventTime": "2026-03-01T12:00:00Z",
+				"lotCode": "LOT-42",
+				"epcList": ["urn:epc:id:sgtin:0614141.107346.2018"],
+				"sensorElementList": [{
+					"sensorMetadata": {"deviceID": "firmware-id", "deviceMetadata": "ESP32-S3"},
+					"sensorReport": [
+						{"type": "temperature", "value": 4.5, "uom": "CEL"},
+						{"type": "temperature", "component": "probe", "value": 3.9, "uom": "CEL"},
+						{"type": "humidity", "value": 61},
+						{"value": 1}
+					]
+				}]
+			},
+			{"sensorElementList": [{"sensorReport": [{"type": "battery", "value": 87}]}]}
+		]}
+	}`
+
+	before := time.Now().UTC()
+	payloads, err := listener.Payloads("scain/esp32-001/telemetry", []byte(message))
+	if err != nil {
+		t.Fatalf("Payloads: %v", err)
+	}
+	if len(payloads) != 2 {
+		t.Fatalf("got %d payloads, want 2", len(payloads))
+	}
+
+	first := payloads[0]
+	if first.DeviceID != "esp32-001" {
+		t.Errorf("deviceId = %s, want the topic device ID", first.DeviceID)
+	}
+	if first.DeviceType != models.ESP32DeviceType {
+		t.Errorf("deviceType = %s, want ESP32", first.DeviceType)
+	}
+	if want := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC); !first.Timestamp.Equal(want) {
+		t.Errorf("timestamp = %v, want %v", first.Timestamp, want)
+	}
+	if first.LotCode == nil || *first.LotCode != "LOT-42" {
+		t.Errorf("lotCode = %v, want LOT-42", first.LotCode)
+	}
+	wantData := map[string]interface{}{"temperature": 4.5, "temperature/probe": 3.9, "humidity": 61.0}
+	if len(first.Data) != len(wantData) {
+		t.Errorf("data = %v, want %v", first.Data, wantData)
+	}
+	for key, value := range wantData {
+		if first.Data[key] != value {
+			t.Errorf("data[%s] = %v, want %v", key, first.Data[key], value)
+		}
+	}
+	units, _ := first.Metadata["uom"].(map[string]interface{})
+	if units["temperature"] != "CEL" || units["temperature/probe"] != "CEL" || units["humidity"] != nil {
+		t.Errorf("uom = %v, want CEL for both temperatures only", units)
+	}
+	if first.Metadata["source"] != "mqtt" || first.Metadata["topic"] != "scain/esp32-001/telemetry" {
+		t.Errorf("metadata = %v, want the source and topic", first.Metadata)
+	}
+
+	// The EPCs of the firmware event become the EPCs of the stored event
+	events, err := transformESP32Data(first)
+	if err != nil {
+		t.Fatalf("transformESP32Data: %v", err)
+	}
+	if epcs := events[0].EPCList; len(epcs) != 1 || epcs[0] != "urn:epc:id:sgtin:0614141.107346.2018" {
+		t.Errorf("epcList = %v, want the EPC of the firmware event", epcs)
+	}
+
+	// Events without a time are stamped with the time of receipt
+	if second := payloads[1]; second.Timestamp.Before(before) || second.Data["battery"] != 87.0 {
+		t.Errorf("second payload = %+v, want the receipt time and battery reading", second)
+	}
+}
+
+func TestMQTTPayloadsDeviceIDFromMessage(t *testing.T) {
+	listener := &MQTTListener{topic: "scain/#", deviceType: models.ESP32DeviceType}
+	message := `{"type": "EPCISDocument", "epcisBody": {"eventList": [{"sensorElementList": [{
+		"sensorMetadata": {"deviceID": "firmware-id"},
+		"sensorReport": [{"type": "temperature", "value": 4.5}]
+	}]}]}}`
+
+	payloads, err := listener.Payloads("scain/telemetry", []byte(message))
+	if err != nil {
+		t.Fatalf("Payloads: %v", err)
+	}
+	if payloads[0].DeviceID != "firmware-id" {
+		t.Errorf("deviceId = %s, want the sensor metadata device ID", payloads[0].DeviceID)
+	}
+}
+
+func TestMQTTPayloadsRawPayload(t *testing.T) {
+	listener := &MQTTListener{topic: DefaultMQTTTopic, deviceType: models.ESP32DeviceType}
+
+	payloads, err := listener.Payloads("scain/tracker-7/telemetry", []byte(`{
+		"deviceType": "Tracker",
+		"deviceId": "spoofed",
+		"timestamp": "2026-03-01T12:00:00Z",
+		"data": {"latitude": 52.52, "longitude": 13.405},
+		"metadata": {"vendor": "Tive"}
+	}`))
+	if err != nil {
+		t.Fatalf("Payloads: %v", err)
+	}
+	if len(payloads) != 1 {
+		t.Fatalf("got %d payloads, want 1", len(payloads))
+	}
+	payload := payloads[0]
+	if payload.DeviceID != "tracker-7" {
+		t.Errorf("deviceId = %s, want the topic device ID over the message one", payload.DeviceID)
+	}
+	if payload.DeviceType != models.TrackerDeviceType {
+		t.Errorf("deviceType = %s, want Tracker", payload.DeviceType)
+	}
+	if want := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC); !payload.Timestamp.Equal(want) {
+		t.Errorf("timestamp = %v, want %v", payload.Timestamp, want)
+	}
+	if payload.Metadata["vendor"] != "Tive" || payload.Metadata["source"] != "mqtt" {
+		t.Errorf("metadata = %v, want the vendor and source", payload.Metadata)
+	}
+
+	// The device type defaults to the configured one
+	payloads, err = listener.Payloads("scain/esp32-001/telemetry", []byte(`{"data": {"temperature": 4.5}}`))
+	if err != nil {
+		t.Fatalf("Payloads: %v", err)
+	}
+	if payloads[0].DeviceType != models.ESP32DeviceType || payloads[0].Metadata["topic"] != "scain/esp32-001/telemetry" {
+		t.Errorf("payload = %+v, want the default device type and topic", payloads[0])
+	}
+}
+
+func TestMQTTPayloadsRejectsMalformedMessages(t *testing.T) {
+	listener := &MQTTListener{topic: DefaultMQTTTopic, deviceType: models.ESP32DeviceType}
+
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{"not JSON", `temperature=4.5`, "invalid JSON"},
+		{"EPCIS document without events", `{"type": "EPCISDocument", "epcisBody": {"eventList": []}}`, "no events"},
+		{"invalid event time", `{"type": "EPCISDocument", "epcisBody": {"eventList": [{"eventTime": "yesterday"}]}}`, "invalid JSON"},
+		{"neither document nor payload", `{"temperature": 4.5}`, "neither an EPCIS document nor a raw ingest payload"},
+		{"data not an object", `{"data": [4.5]}`, "invalid raw ingest payload"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := listener.Payloads("scain/esp32-001/telemetry", []byte(tt.message))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// stubMQTTClient stands in for a broker connection, delivering published
+// messages to the handlers of matching subscriptions
+type stubMQTTClient struct {
+	mqtt.Client
+	mu            sync.Mutex
+	subscriptions map[string]mqtt.MessageHandler
+	qos           map[string]byte
+}
+
+func newStubMQTTClient() *stubMQTTClient {
+	return &stubMQTTClient{
+		subscriptions: make(map[string]mqtt.MessageHandler),
+		qos:           make(map[string]byte),
+	}
+}
+
+func (c *stubMQTTClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscriptions[topic] = callback
+	c.qos[topic] = qos
+	return stubMQTTToken{}
+}
+
+// publish delivers a message to every subscription whose filter matches its topic
+func (c *stubMQTTClient) publish(topic, payload string) {
+	c.mu.Lock()
+	var handlers []mqtt.MessageHandler
+	for filter, handler := range c.subscriptions {
+		if mqttTopicMatches(filter, topic) {
+			handlers = append(handlers, handler)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(c, stubMQTTMessage{topic: topic, payload: []byte(payload)})
+	}
+}
+
+// mqttTopicMatches reports whether a topic matches a subscription filter
+func mqttTopicMatches(filter, topic string) bool {
+	filterLevels, levels := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(levels) || level != "+" && level != levels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(levels)
+}
+
+// stubMQTTToken is a completed token
+type stubMQTTToken struct{}
+
+func (stubMQTTToken) Wait() bool                     { return true }
+func (stubMQTTToken) WaitTimeout(time.Duration) bool { return true }
+func (stubMQTTToken) Error() error                   { return nil }
+func (stubMQTTToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+// stubMQTTMessage is a received message
+type stubMQTTMessage struct {
+	mqtt.Message
+	topic   string
+	payload []byte
+}
+
+func (m stubMQTTMessage) Topic() string   { return m.topic }
+func (m stubMQTTMessage) Payload() []byte { return m.payload }
+
+func TestMQTTListenerIngestsSubscribedTelemetry(t *testing.T) {
+	openTestDatabase(t)
+	t.Setenv("LEDGER_BACKEND", LedgerNone)
+
+	deviceService := NewDeviceService(nil)
+	if _, err := deviceService.RegisterDevice("org-a", &models.DeviceInfo{DeviceID: "esp32-001", Type: models.ESP32DeviceType}); err != nil {
+		t.Fatalf("RegisterDevice: %v", err)
+	}
+	epcisService, err := NewEPCISService()
+	if err != nil {
+		t.Fatalf("NewEPCISService: %v", err)
+	}
+	worker := NewIngestionWorker(epcisService)
+	listener := &MQTTListener{
+		deviceService: deviceService,
+		worker:        worker,
+		validate:      validator.New(),
+		topic:         DefaultMQTTTopic,
+		qos:           DefaultMQTTQoS,
+		deviceType:    models.ESP32DeviceType,
+	}
+
+	client := newStubMQTTClient()
+	listener.subscribe(client)
+	if qos, ok := client.qos[DefaultMQTTTopic]; !ok || qos != DefaultMQTTQoS {
+		t.Fatalf("subscriptions = %v, want %s at QoS %d", client.qos, DefaultMQTTTopic, DefaultMQTTQoS)
+	}
+
+	message := `{"type": "EPCISDocument", "epcisBody": {"eventList": [{
+		"eventTime": "2026-03-01T12:00:00Z",
+		"lotCode": "LOT-42",
+		"epcList": ["urn:epc:id:sgtin:0614141.107346.2018", "urn:epc:id:sgtin:0614141.107346.2019"],
+		"sensorElementList": [{"sensorReport": [{"type": "temperature", "value": 4.5, "uom": "CEL"}]}]
+	}]}}`
+	client.publish("scain/esp32-001/telemetry", message)
+	// Telemetry of unregistered devices and other topics is not ingested
+	client.publish("scain/esp32-unknown/telemetry", message)
+	client.publish("scain/esp32-001/status", message)
+
+	ingestion, err := database.ClaimPendingIngestion(time.Now())
+	if err != nil || ingestion == nil {
+		t.Fatalf("ClaimPendingIngestion = %v, %v, want the ingestion of the message", ingestion, err)
+	}
+	if ingestion.OrgID != "org-a" || ingestion.DeviceID != "esp32-001" {
+		t.Errorf("ingestion of %s in %s, want esp32-001 in org-a", ingestion.DeviceID, ingestion.OrgID)
+	}
+	if other, err := database.ClaimPendingIngestion(time.Now()); err != nil || other != nil {
+		t.Errorf("ClaimPendingIngestion = %v, %v, want a single ingestion", other, err)
+	}
+
+	worker.process(ingestion)
+	if ingestion.ProcessingStatus != database.IngestionProcessed {
+		t.Fatalf("ingestion is %s: %v", ingestion.ProcessingStatus, ingestion.ErrorMessage)
+	}
+	dbEvents, err := database.GetEventsByIngestionID(ingestion.ID)
+	if err != nil || len(dbEvents) != 1 {
+		t.Fatalf("GetEventsByIngestionID = %d events, %v, want 1", len(dbEvents), err)
+	}
+	event, err := eventFromRecord(&dbEvents[0])
+	if err != nil {
+		t.Fatalf("eventFromRecord: %v", err)
+	}
+	if strings.Join(event.EPCList, ",") != "urn:epc:id:sgtin:0614141.107346.2018,urn:epc:id:sgtin:0614141.107346.2019" {
+		t.Errorf("epcList = %v, want the EPCs of the message", event.EPCList)
+	}
+	if event.LotCode == nil || *event.LotCode != "LOT-42" || len(event.SensorElementList) != 1 {
+		t.Errorf("event = %+v, want the lot and readings of the message", event)
+	}
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"scain-backend/database"
+)
+
+// Notification types
+const (
+	NotificationAlertOpened    = "alert.opened"
+	NotificationAlertEscalated = "alert.escalated"
+	NotificationAlertResolved  = "alert.resolved"
+	NotificationTest           = "test"
+)
+
+const (
+	// notifyTimeout bounds how long delivering one notification may take, retries included
+	notifyTimeout = 10 * time.Second
+	// notifyMaxAttempts is the number of attempts at delivering a notification
+	notifyMaxAttempts = 3
+	// notifyRetryMaxDelay caps the delay between attempts
+	notifyRetryMaxDelay = 4 * time.Second
+)
+
+// notifyRetryDelay is the delay before the second attempt; it doubles with each attempt
+var notifyRetryDelay = time.Second
+
+// AlertNotification is what notifiers deliver about an alert
+type AlertNotification struct {
+	Type   string          `json:"type"`
+	Text   string          `json:"text"` // one-line summary
+	Alert  *database.Alert `json:"alert,omitempty"`
+	SentAt time.Time       `json:"sentAt"`
+}
+
+// Notifier delivers alert notifications to people or systems
+type Notifier interface {
+	Notify(ctx context.Context, notification *AlertNotification) error
+}
+
+var (
+	notifiersMu sync.RWMutex
+	notifiers   = map[string]Notifier{}
+)
+
+// RegisterNotifier makes a notifier available under a name so alert rules can
+// use it. Registering a name again replaces the notifier.
+func RegisterNotifier(name string, notifier Notifier) {
+	notifiersMu.Lock()
+	defer notifiersMu.Unlock()
+	notifiers[name] = notifier
+}
+
+// GetNotifier returns the notifier registered under a name
+func GetNotifier(name string) (Notifier, bool) {
+	notifiersMu.RLock()
+	defer notifiersMu.RUnlock()
+	notifier, ok := notifiers[name]
+	return notifier, ok
+}
+
+// NotifierNames lists the registered notifiers in name order
+func NotifierNames() []string {
+	notifiersMu.RLock()
+	defer notifiersMu.RUnlock()
+
+	names := make([]string, 0, len(notifiers))
+	for name := range notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// registerEnvNotifiers registers the notifiers configured in the environment:
+// webhook (ALERT_WEBHOOK_URL), slack (ALERT_SLACK_WEBHOOK_URL) and email
+// (ALERT_SMTP_HOST and ALERT_SMTP_TO)
+func registerEnvNotifiers() {
+	if url := os.Getenv("ALERT_WEBHOOK_URL"); url != "" {
+		RegisterNotifier("webhook", &WebhookNotifier{URL: url})
+	}
+	if url := os.Getenv("ALERT_SLACK_WEBHOOK_URL"); url != "" {
+		RegisterNotifier("slack", &SlackNotifier{URL: url})
+	}
+	if host, to := os.Getenv("ALERT_SMTP_HOST"), os.Getenv("ALERT_SMTP_TO"); host != "" && to != "" {
+		from := os.Getenv("ALERT_SMTP_FROM")
+		if from == "" {
+			from = "scain@localhost"
+		}
+		RegisterNotifier("email", &EmailNotifier{
+			Host:     host,
+			Port:     envInt("ALERT_SMTP_PORT", 587),
+			Username: os.Getenv("ALERT_SMTP_USERNAME"),
+			Password: os.Getenv("ALERT_SMTP_PASSWORD"),
+			From:     from,
+			To:       strings.Split(to, ","),
+		})
+	}
+}
+
+// WebhookNotifier posts notifications as JSON to a URL
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client // http.DefaultClient when nil
+}
+
+// Notify posts the notification
+func (n *WebhookNotifier) Notify(ctx context.Context, notification *AlertNotification) error {
+	return retryNotify(ctx, func() (bool, error) {
+		return postJSON(ctx, n.Client, n.URL, notification)
+	})
+}
+
+// SlackNotifier posts notifications to a Slack-compatible incoming webhook
+type SlackNotifier struct {
+	URL    string
+	Client *http.Client // http.DefaultClient when nil
+}
+
+// Notify posts the text of the notification
+func (n *SlackNotifier) Notify(ctx context.Context, notification *AlertNotification) error {
+	return retryNotify(ctx, func() (bool, error) {
+		return postJSON(ctx, n.Client, n.URL, map[string]string{"text": notification.Text})
+	})
+}
+
+// retryNotify runs delivery attempts with exponential backoff until one
+// succeeds, fails for good, the attempts run out or the context is done
+func retryNotify(ctx context.Context, deliver func() (bool, error)) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		retry, err = deliver()
+		if err == nil || !retry || attempt >= notifyMaxAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(backoffDelay(attempt, notifyRetryDelay, notifyRetryMaxDelay))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (after %d attempts)", err, attempt)
+		case <-timer.C:
+		}
+	}
+}
+
+// postJSON posts a JSON body and fails unless the response is a success. It
+// reports whether a failed post is worth retrying: network errors, rate
+// limiting and server errors are.
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}) (bool, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		retry := response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500
+		return retry, fmt.Errorf("%s responded with %s", url, response.Status)
+	}
+	return false, nil
+}
+
+// EmailNotifier sends notifications by SMTP. Credentials are only sent over TLS
+// or to localhost. Connection failures and transient (4xx) SMTP replies are
+// retried; permanent (5xx) replies are not.
+type EmailNotifier struct {
+	Host     string
+	Port     int
+	Username string // no authentication when empty
+	Password string
+	From     string
+	To       []string
+}
+
+// Notify sends the notification as a plain text email
+func (n *EmailNotifier) Notify(ctx context.Context, notification *AlertNotification) error {
+	body, err := json.MarshalIndent(notification.Alert, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", n.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", notification.Text)
+	fmt.Fprintf(&message, "Date: %s\r\n", notification.SentAt.Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	message.WriteString(notification.Text + "\r\n")
+	if notification.Alert != nil {
+		message.WriteString("\r\n" + strings.ReplaceAll(string(body), "\n", "\r\n") + "\r\n")
+	}
+
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+	address := n.Host + ":" + strconv.Itoa(n.Port)
+	return retryNotify(ctx, func() (bool, error) {
+		err := smtp.SendMail(address, auth, n.From, n.To, message.Bytes())
+		var reply *textproto.Error
+		if errors.As(err, &reply) && reply.Code >= 500 {
+			return false, err
+		}
+		return err != nil, err
+	})
+}
@@ -0,0 +1,357 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"scain-backend/database"
+)
+
+func init() {
+	// Keep retries fast in tests
+	notifyRetryDelay = time.Millisecond
+}
+
+// testNotification builds a notification about an open alert
+func testNotification() *AlertNotification {
+	return &AlertNotification{
+		Type: NotificationAlertOpened,
+		Text: "[critical] Temperature excursion on LOT-42",
+		Alert: &database.Alert{
+			ID:       "alert-1",
+			OrgID:    "default",
+			Severity: "critical",
+			Status:   "open",
+		},
+		SentAt: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+// recordingServer is an HTTP stand-in that records the requests it receives
+// and answers them with the given status codes in turn, then with 200
+type recordingServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	bodies   [][]byte
+	headers  []http.Header
+	statuses []int
+}
+
+func newRecordingServer(t *testing.T, statuses ...int) *recordingServer {
+	t.Helper()
+	server := &recordingServer{statuses: statuses}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		server.mu.Lock()
+		attempt := len(server.bodies)
+		server.bodies = append(server.bodies, body)
+		server.headers = append(server.headers, r.Header.Clone())
+		status := http.StatusOK
+		if attempt < len(server.statuses) {
+			status = server.statuses[attempt]
+		}
+		server.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *recordingServer) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.bodies)
+}
+
+func (s *recordingServer) lastBody() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bodies[len(s.bodies)-1]
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	server := newRecordingServer(t)
+	notifier := &WebhookNotifier{URL: server.URL}
+
+	if err := notifier.Notify(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if server.requests() != 1 {
+		t.Fatalf("got %d requests, want 1", server.requests())
+	}
+	if contentType := server.headers[0].Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type = %s, want application/json", contentType)
+	}
+
+	var received AlertNotification
+	if err := json.Unmarshal(server.lastBody(), &received); err != nil {
+		t.Fatalf("body is not a notification: %v", err)
+	}
+	if received.Type != NotificationAlertOpened || received.Text != testNotification().Text {
+		t.Errorf("notification = %+v", received)
+	}
+	if received.Alert == nil || received.Alert.ID != "alert-1" || received.Alert.Severity != "critical" {
+		t.Errorf("alert = %+v, want alert-1", received.Alert)
+	}
+	if !received.SentAt.Equal(testNotification().SentAt) {
+		t.Errorf("sentAt = %v, want %v", received.SentAt, testNotification().SentAt)
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	server := newRecordingServer(t)
+	notifier := &SlackNotifier{URL: server.URL}
+
+	if err := notifier.Notify(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	var received map[string]interface{}
+	if err := json.Unmarshal(server.lastBody(), &received); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if len(received) != 1 || received["text"] != testNotification().Text {
+		t.Errorf("body = %v, want only the text", received)
+	}
+}
+
+func TestHTTPNotifierRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int
+		fails    bool
+	}{
+		{"server error is retried", []int{http.StatusInternalServerError}, 2, false},
+		{"rate limiting is retried", []int{http.StatusTooManyRequests, http.StatusBadGateway}, 3, false},
+		{"gives up after the last attempt", []int{503, 503, 503, 503}, notifyMaxAttempts, true},
+		{"client error is not retried", []int{http.StatusBadRequest}, 1, true},
+		{"gone is not retried", []int{http.StatusGone}, 1, true},
+	}
+
+	notifiers := map[string]func(url string) Notifier{
+		"webhook": func(url string) Notifier { return &WebhookNotifier{URL: url} },
+		"slack":   func(url string) Notifier { return &SlackNotifier{URL: url} },
+	}
+	for kind, newNotifier := range notifiers {
+		for _, tt := range tests {
+			t.Run(kind+"/"+tt.name, func(t *testing.T) {
+				server := newRecordingServer(t, tt.statuses...)
+				err := newNotifier(server.URL).Notify(context.Background(), testNotification())
+				if tt.fails && err == nil {
+					t.Error("expected an error")
+				}
+				if !tt.fails && err != nil {
+					t.Errorf("Notify: %v", err)
+				}
+				if server.requests() != tt.requests {
+					t.Errorf("got %d requests, want %d", server.requests(), tt.requests)
+				}
+			})
+		}
+	}
+}
+
+func TestHTTPNotifierStopsWhenContextIsDone(t *testing.T) {
+	server := newRecordingServer(t, 503, 503, 503)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := (&WebhookNotifier{URL: server.URL}).Notify(ctx, testNotification())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if server.requests() != 0 {
+		t.Errorf("got %d requests, want none", server.requests())
+	}
+}
+
+func TestHTTPNotifierUnreachable(t *testing.T) {
+	server := newRecordingServer(t)
+	url := server.URL
+	server.Close()
+
+	if err := (&SlackNotifier{URL: url}).Notify(context.Background(), testNotification()); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+// smtpServer is an SMTP stand-in that records the messages it receives. It
+// answers DATA with the given replies in turn, then with 250.
+type smtpServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	messages []string
+	from     []string
+	to       [][]string
+	replies  []string
+	sessions int32
+}
+
+func newSMTPServer(t *testing.T, replies ...string) *smtpServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	server := &smtpServer{listener: listener, replies: replies}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+// serve runs one SMTP session
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	session := int(atomic.AddInt32(&s.sessions, 1)) - 1
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	var from string
+	var to []string
+	reply("220 localhost ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			from = strings.Trim(strings.TrimSpace(line)[len("MAIL FROM:"):], "<>")
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			to = append(to, strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var message strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				message.WriteString(dataLine)
+			}
+			if session < len(s.replies) {
+				reply(s.replies[session])
+				continue
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, message.String())
+			s.from = append(s.from, from)
+			s.to = append(s.to, to)
+			s.mu.Unlock()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+// notifier returns an email notifier sending to the stand-in
+func (s *smtpServer) notifier() *EmailNotifier {
+	address := s.listener.Addr().(*net.TCPAddr)
+	return &EmailNotifier{
+		Host: "127.0.0.1",
+		Port: address.Port,
+		From: "scain@localhost",
+		To:   []string{"qa@example.com", "ops@example.com"},
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	server := newSMTPServer(t)
+
+	if err := server.notifier().Notify(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(server.messages))
+	}
+	if server.from[0] != "scain@localhost" {
+		t.Errorf("sender = %s, want scain@localhost", server.from[0])
+	}
+	if strings.Join(server.to[0], ",") != "qa@example.com,ops@example.com" {
+		t.Errorf("recipients = %v", server.to[0])
+	}
+
+	message := server.messages[0]
+	for _, want := range []string{
+		"From: scain@localhost\r\n",
+		"To: qa@example.com, ops@example.com\r\n",
+		"Subject: [critical] Temperature excursion on LOT-42\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n",
+		`"id": "alert-1"`,
+	} {
+		if !strings.Contains(message, want) {
+			t.Errorf("message does not contain %q:\n%s", want, message)
+		}
+	}
+}
+
+func TestEmailNotifierRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		replies  []string
+		sessions int32
+		messages int
+		fails    bool
+	}{
+		{"transient reply is retried", []string{"451 Try again later"}, 2, 1, false},
+		{"gives up after the last attempt", []string{"421 Busy", "421 Busy", "421 Busy"}, notifyMaxAttempts, 0, true},
+		{"permanent reply is not retried", []string{"554 Rejected"}, 1, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newSMTPServer(t, tt.replies...)
+			err := server.notifier().Notify(context.Background(), testNotification())
+			if tt.fails && err == nil {
+				t.Error("expected an error")
+			}
+			if !tt.fails && err != nil {
+				t.Errorf("Notify: %v", err)
+			}
+			if sessions := atomic.LoadInt32(&server.sessions); sessions != tt.sessions {
+				t.Errorf("got %d sessions, want %d", sessions, tt.sessions)
+			}
+			server.mu.Lock()
+			defer server.mu.Unlock()
+			if len(server.messages) != tt.messages {
+				t.Errorf("got %d messages, want %d", len(server.messages), tt.messages)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"fmt"
+
+	"scain-backend/database"
+	"scain-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// OrganizationService manages the organizations data is partitioned by
+type OrganizationService struct{}
+
+// NewOrganizationService creates a new organization service instance
+func NewOrganizationService() *OrganizationService {
+	return &OrganizationService{}
+}
+
+// CreateOrganization stores a new organization
+func (s *OrganizationService) CreateOrganization(request *models.OrganizationRequest) (*database.Organization, error) {
+	existing, err := database.GetOrganizationByID(request.ID)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to check existing organization: %w", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("organization %s already exists", request.ID)
+	}
+
+	org := &database.Organization{
+		ID:   request.ID,
+		Name: request.Name,
+	}
+	if err := database.CreateOrganization(org); err != nil {
+		return nil, fmt.Errorf("failed to create organization: %w", err)
+	}
+
+	logger.WithField("orgId", org.ID).Info("Organization created")
+	return org, nil
+}
+
+// ListOrganizations retrieves all organizations
+func (s *OrganizationService) ListOrganizations() ([]database.Organization, error) {
+	orgs, err := database.ListOrganizations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	return orgs, nil
+}
+
+// GetOrganization retrieves an organization by ID
+func (s *OrganizationService) GetOrganization(id string) (*database.Organization, error) {
+	org, err := database.GetOrganizationByID(id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("organization not found: %s", id)
+		}
+		return nil, fmt.Errorf("failed to get organization from database: %w", err)
+	}
+	return org, nil
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// PayloadCodec decodes the binary payload of a LoRaWAN uplink into sensor
+// readings. Decode returns the readings and, for readings with a known unit, the
+// UN/CEFACT unit code keyed like the readings.
+type PayloadCodec interface {
+	Decode(fPort int, payload []byte) (map[string]interface{}, map[string]string, error)
+}
+
+var (
+	payloadCodecsMu sync.RWMutex
+	payloadCodecs   = map[string]PayloadCodec{
+		CayenneLPPCodecName: CayenneLPPCodec{},
+	}
+)
+
+// RegisterPayloadCodec makes a codec available under a name so devices can be
+// registered with it. Registering a name again replaces the codec.
+func RegisterPayloadCodec(name string, codec PayloadCodec) {
+	payloadCodecsMu.Lock()
+	defer payloadCodecsMu.Unlock()
+	payloadCodecs[name] = codec
+}
+
+// GetPayloadCodec returns the codec registered under a name
+func GetPayloadCodec(name string) (PayloadCodec, bool) {
+	payloadCodecsMu.RLock()
+	defer payloadCodecsMu.RUnlock()
+	codec, ok := payloadCodecs[name]
+	return codec, ok
+}
+
+// PayloadCodecNames lists the registered codecs in name order
+func PayloadCodecNames() []string {
+	payloadCodecsMu.RLock()
+	defer payloadCodecsMu.RUnlock()
+
+	names := make([]string, 0, len(payloadCodecs))
+	for name := range payloadCodecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ByteField describes one reading at a fixed position in a payload
+type ByteField struct {
+	Name   string  // key of the reading
+	Offset int     // position of the first byte
+	Type   string  // uint8, int8, uint16, int16, uint32, int32 or float32, big-endian
+	Scale  float64 // multiplier applied to the raw value, 1 when zero
+	UOM    string  // UN/CEFACT unit code, optional
+}
+
+// ByteLayoutCodec decodes payloads with a fixed byte layout. Layouts are
+// registered per device model with RegisterPayloadCodec:
+//
+//	services.RegisterPayloadCodec("acme-th1", services.ByteLayoutCodec{Fields: []services.ByteField{
+//		{Name: "temperature", Offset: 0, Type: "int16", Scale: 0.01, UOM: "CEL"},
+//		{Name: "humidity", Offset: 2, Type: "uint8", Scale: 0.5, UOM: "P1"},
+//	}})
+type ByteLayoutCodec struct {
+	FPort  int // only payloads on this port are decoded, any port when zero
+	Fields []ByteField
+}
+
+// byteFieldSizes maps the field types of a byte layout to their size
+var byteFieldSizes = map[string]int{
+	"uint8": 1, "int8": 1, "uint16": 2, "int16": 2, "uint32": 4, "int32": 4, "float32": 4,
+}
+
+// Decode reads each field of the layout from the payload
+func (c ByteLayoutCodec) Decode(fPort int, payload []byte) (map[string]interface{}, map[string]string, error) {
+	if c.FPort != 0 && fPort != c.FPort {
+		return nil, nil, fmt.Errorf("unexpected fPort %d, layout is for fPort %d", fPort, c.FPort)
+	}
+
+	data := make(map[string]interface{})
+	units := make(map[string]string)
+	for _, field := range c.Fields {
+		size, ok := byteFieldSizes[field.Type]
+		if !ok {
+			return nil, nil, fmt.Errorf("field %s: unknown type %s", field.Name, field.Type)
+		}
+		if field.Offset < 0 || field.Offset+size > len(payload) {
+			return nil, nil, fmt.Errorf("field %s: payload of %d bytes is too short", field.Name, len(payload))
+		}
+
+		b := payload[field.Offset : field.Offset+size]
+		var value float64
+		switch field.Type {
+		case "uint8":
+			value = float64(b[0])
+		case "int8":
+			value = float64(int8(b[0]))
+		case "uint16":
+			value = float64(binary.BigEndian.Uint16(b))
+		case "int16":
+			value = float64(int16(binary.BigEndian.Uint16(b)))
+		case "uint32":
+			value = float64(binary.BigEndian.Uint32(b))
+		case "int32":
+			value = float64(int32(binary.BigEndian.Uint32(b)))
+		case "float32":
+			value = float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+		}
+		if field.Scale != 0 {
+			value *= field.Scale
+		}
+
+		data[field.Name] = roundReading(value)
+		if field.UOM != "" {
+			units[field.Name] = field.UOM
+		}
+	}
+	return data, units, nil
+}
+
+// roundReading drops the floating point noise introduced by scaling
+func roundReading(value float64) float64 {
+	return math.Round(value*1e6) / 1e6
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"scain-backend/database"
+	"scain-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultRecallDrillLimit is the number of drills listed when no limit is given
+const DefaultRecallDrillLimit = 50
+
+// dispositionInTransit is the CBV disposition of goods between shipping and receiving
+const dispositionInTransit = "in_transit"
+
+// RecallService runs recall drills over the lot genealogy
+type RecallService struct {
+	traceService *TraceService
+}
+
+// NewRecallService creates a new recall service instance
+func NewRecallService(traceService *TraceService) *RecallService {
+	return &RecallService{
+		traceService: traceService,
+	}
+}
+
+// RunDrill traces a suspect lot of an organization forward, reports every
+// downstream lot, location, customer and shipment still in transit, and stores
+// the report together with how long the drill took
+func (s *RecallService) RunDrill(orgID string, request *models.RecallDrillRequest) (*models.RecallDrillReport, error) {
+	depth := DefaultTraceDepth
+	if request.Depth != nil {
+		depth = *request.Depth
+	}
+
+	startedAt := time.Now().UTC()
+	graph, err := s.traceService.Trace(orgID, nil, request.LotCode, models.TraceForward, depth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to trace lot: %w", err)
+	}
+
+	report, err := buildRecallReport(orgID, graph)
+	if err != nil {
+		return nil, err
+	}
+	report.LotCode = request.LotCode
+	report.Depth = depth
+	report.InitiatedBy = request.InitiatedBy
+	report.Notes = request.Notes
+	report.StartedAt = startedAt
+	report.CompletedAt = time.Now().UTC()
+	report.DurationMs = report.CompletedAt.Sub(startedAt).Milliseconds()
+	report.WithinFSMAWindow = report.CompletedAt.Sub(startedAt) <= models.FSMA204TraceWindow
+
+	report.ID = uuid.New().String()
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal recall drill report: %w", err)
+	}
+
+	drill := &database.RecallDrill{
+		ID:               report.ID,
+		OrgID:            orgID,
+		LotCode:          report.LotCode,
+		Depth:            report.Depth,
+		InitiatedBy:      report.InitiatedBy,
+		StartedAt:        report.StartedAt,
+		CompletedAt:      report.CompletedAt,
+		DurationMs:       report.DurationMs,
+		WithinFSMAWindow: report.WithinFSMAWindow,
+		AffectedLots:     len(report.AffectedLots),
+		Locations:        len(report.AffectedLocations),
+		Customers:        len(report.Customers),
+		InTransit:        len(report.InTransit),
+		Report:           string(reportJSON),
+	}
+	if err := database.CreateRecallDrill(drill); err != nil {
+		return nil, fmt.Errorf("failed to save recall drill: %w", err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"drillId":      drill.ID,
+		"lotCode":      drill.LotCode,
+		"durationMs":   drill.DurationMs,
+		"affectedLots": drill.AffectedLots,
+		"customers":    drill.Customers,
+		"inTransit":    drill.InTransit,
+	}).Info("Recall drill completed")
+
+	return report, nil
+}
+
+// GetDrill retrieves the report of a stored recall drill of an organization
+func (s *RecallService) GetDrill(orgID, id string) (*models.RecallDrillReport, error) {
+	drill, err := database.GetRecallDrillByID(orgID, id)
+	if err != nil {
+		return nil, fmt.Errorf("recall drill not found: %w", err)
+	}
+
+	var report models.RecallDrillReport
+	if err := json.Unmarshal([]byte(drill.Report), &report); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal recall drill report: %w", err)
+	}
+	return &report, nil
+}
+
+// ListDrills retrieves the stored recall drills of an organization, most
+// recent first
+func (s *RecallService) ListDrills(orgID, lotCode string, limit int) ([]database.RecallDrill, error) {
+	if limit <= 0 {
+		limit = DefaultRecallDrillLimit
+	}
+	return database.ListRecallDrills(orgID, lotCode, limit)
+}
+
+// buildRecallReport summarises a forward trace graph of an organization as a
+// recall drill report
+func buildRecallReport(orgID string, graph *models.TraceGraph) (*models.RecallDrillReport, error) {
+	report := &models.RecallDrillReport{
+		Truncated:         graph.Truncated,
+		AffectedLots:      []string{},
+		AffectedProducts:  []string{},
+		AffectedLocations: []string{},
+		Customers:         []models.RecallCustomer{},
+		BizTransactions:   []models.BizTransaction{},
+		InTransit:         []models.InTransitShipment{},
+		EventCount:        len(graph.Events),
+	}
+
+	var products []string
+	for _, node := range graph.Nodes {
+		switch node.Kind {
+		case models.LotNode, models.EPCNode, models.EPCClassNode:
+			products = append(products, node.ID)
+			if node.ID == graph.Root {
+				continue
+			}
+			if node.Kind == models.LotNode {
+				report.AffectedLots = append(report.AffectedLots, node.ID)
+			} else {
+				report.AffectedProducts = append(report.AffectedProducts, node.ID)
+			}
+		case models.LocationNode:
+			report.AffectedLocations = append(report.AffectedLocations, node.ID)
+		}
+	}
+
+	customers := make(map[string]int)
+	transactions := make(map[models.BizTransaction]bool)
+	for _, event := range graph.Events {
+		for _, transaction := range event.BizTransactionList {
+			if !transactions[transaction] {
+				transactions[transaction] = true
+				report.BizTransactions = append(report.BizTransactions, transaction)
+			}
+		}
+
+		if len(event.DestinationList) > 0 {
+			for _, destination := range event.DestinationList {
+				addCustomer(report, customers, destination.Destination, destination.Type, event)
+			}
+		} else if event.BizStep != nil && *event.BizStep == models.Shipping {
+			// Without a destination the business transactions are the only record of the customer
+			for _, transaction := range event.BizTransactionList {
+				addCustomer(report, customers, transaction.BizTransaction, transaction.Type, event)
+			}
+		}
+	}
+
+	inTransit, err := inTransitShipments(orgID, products)
+	if err != nil {
+		return nil, err
+	}
+	report.InTransit = inTransit
+
+	sort.Strings(report.AffectedLots)
+	sort.Strings(report.AffectedProducts)
+	sort.Strings(report.AffectedLocations)
+
+	return report, nil
+}
+
+// addCustomer records a customer and the event that reached it
+func addCustomer(report *models.RecallDrillReport, customers map[string]int, id, customerType string, event models.EpcisEvent) {
+	index, ok := customers[id]
+	if !ok {
+		index = len(report.Customers)
+		customers[id] = index
+		report.Customers = append(report.Customers, models.RecallCustomer{
+			ID:              id,
+			Type:            customerType,
+			BizTransactions: []models.BizTransaction{},
+			EventIDs:        []string{},
+		})
+	}
+
+	customer := &report.Customers[index]
+	if !containsString(customer.EventIDs, event.EventID) {
+		customer.EventIDs = append(customer.EventIDs, event.EventID)
+	}
+	for _, transaction := range event.BizTransactionList {
+		if !containsTransaction(customer.BizTransactions, transaction) {
+			customer.BizTransactions = append(customer.BizTransactions, transaction)
+		}
+	}
+}
+
+// inTransitShipments finds the affected products whose latest shipping event
+// has not been followed by a receiving event, along with the trackers that
+// reported on them since they were shipped. All events recorded for a product
+// are considered, not only those that link it into the trace graph.
+func inTransitShipments(orgID string, products []string) ([]models.InTransitShipment, error) {
+	result := []models.InTransitShipment{}
+
+	for _, product := range products {
+		dbEvents, err := database.FindEventsByIdentifier(orgID, product)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find events for %s: %w", product, err)
+		}
+
+		var shipment *models.InTransitShipment
+		for i := range dbEvents {
+			event, err := eventFromRecord(&dbEvents[i])
+			if err != nil {
+				return nil, err
+			}
+
+			switch {
+			case event.BizStep != nil && *event.BizStep == models.Receiving:
+				shipment = nil
+			case shipment == nil && isShipment(event):
+				shipment = &models.InTransitShipment{
+					Product:   product,
+					ShippedAt: event.EventTime,
+					EventID:   event.EventID,
+					Trackers:  []string{},
+				}
+				addTrackers(shipment, event)
+			case shipment != nil:
+				addTrackers(shipment, event)
+			}
+		}
+
+		if shipment != nil {
+			result = append(result, *shipment)
+		}
+	}
+
+	return result, nil
+}
+
+// isShipment reports whether an event ships goods or records them as in transit
+func isShipment(event *models.EpcisEvent) bool {
+	return (event.BizStep != nil && *event.BizStep == models.Shipping) ||
+		(event.Disposition != nil && *event.Disposition == dispositionInTransit)
+}
+
+// addTrackers records the devices that reported an event against a shipment
+func addTrackers(shipment *models.InTransitShipment, event *models.EpcisEvent) {
+	if event.DeviceID != nil && !containsString(shipment.Trackers, *event.DeviceID) {
+		shipment.Trackers = append(shipment.Trackers, *event.DeviceID)
+	}
+	for _, element := range event.SensorElementList {
+		deviceID := element.SensorMetaData.DeviceID
+		if deviceID != "" && !containsString(shipment.Trackers, deviceID) {
+			shipment.Trackers = append(shipment.Trackers, deviceID)
+		}
+	}
+}
+
+// containsTransaction reports whether a slice contains a business transaction
+func containsTransaction(transactions []models.BizTransaction, transaction models.BizTransaction) bool {
+	for _, t := range transactions {
+		if t == transaction {
+			return true
+		}
+	}
+	return false
+}
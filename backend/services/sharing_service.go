@@ -0,0 +1,127 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"scain-backend/database"
+	"scain-backend/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ErrShareWithSelf is returned when an organization names itself as the partner of an agreement
+var ErrShareWithSelf = errors.New("an organization cannot share events with itself")
+
+// SharingService manages the agreements organizations share events under, and
+// resolves which partner events an organization may read
+type SharingService struct{}
+
+// NewSharingService creates a new sharing service instance
+func NewSharingService() *SharingService {
+	return &SharingService{}
+}
+
+// CreateAgreement stores an agreement letting a partner read the events of an
+// organization within a scope
+func (s *SharingService) CreateAgreement(orgID string, request *models.SharingAgreementRequest) (*database.SharingAgreement, error) {
+	if request.PartnerOrgID == orgID {
+		return nil, ErrShareWithSelf
+	}
+	if _, err := database.GetOrganizationByID(request.PartnerOrgID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("organization not found: %s", request.PartnerOrgID)
+		}
+		return nil, fmt.Errorf("failed to get organization from database: %w", err)
+	}
+
+	scopeJSON, err := json.Marshal(request.Scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal scope: %w", err)
+	}
+
+	agreement := &database.SharingAgreement{
+		OrgID:        orgID,
+		PartnerOrgID: request.PartnerOrgID,
+		Scope:        string(scopeJSON),
+		Description:  request.Description,
+		ExpiresAt:    request.ExpiresAt,
+	}
+	if err := database.CreateSharingAgreement(agreement); err != nil {
+		return nil, fmt.Errorf("failed to create sharing agreement: %w", err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"agreementId":  agreement.ID,
+		"orgId":        orgID,
+		"partnerOrgId": agreement.PartnerOrgID,
+	}).Info("Sharing agreement created")
+	return agreement, nil
+}
+
+// ListAgreements retrieves the agreements an organization granted or
+// received, or both when no direction is given
+func (s *SharingService) ListAgreements(orgID, direction string) ([]database.SharingAgreement, error) {
+	agreements, err := database.ListSharingAgreements(orgID, direction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sharing agreements: %w", err)
+	}
+	return agreements, nil
+}
+
+// GetAgreement retrieves an agreement an organization granted or received by ID
+func (s *SharingService) GetAgreement(orgID, id string) (*database.SharingAgreement, error) {
+	agreement, err := database.GetSharingAgreementByID(orgID, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("sharing agreement not found: %s", id)
+		}
+		return nil, fmt.Errorf("failed to get sharing agreement from database: %w", err)
+	}
+	return agreement, nil
+}
+
+// RevokeAgreement ends an agreement an organization granted. Only the granting
+// organization can revoke it; the partner loses access immediately.
+func (s *SharingService) RevokeAgreement(orgID, id string) (*database.SharingAgreement, error) {
+	if err := database.RevokeSharingAgreement(orgID, id, time.Now().UTC()); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("sharing agreement not found: %s", id)
+		}
+		return nil, fmt.Errorf("failed to revoke sharing agreement: %w", err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"agreementId": id,
+		"orgId":       orgID,
+	}).Info("Sharing agreement revoked")
+	return s.GetAgreement(orgID, id)
+}
+
+// Grants returns the scopes partners currently share with an organization,
+// from the agreements that are neither revoked nor expired
+func (s *SharingService) Grants(orgID string) ([]database.SharedScope, error) {
+	agreements, err := database.ListActiveSharingAgreements(orgID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sharing agreements: %w", err)
+	}
+
+	grants := make([]database.SharedScope, 0, len(agreements))
+	for _, agreement := range agreements {
+		var scope models.SharingScope
+		if err := json.Unmarshal([]byte(agreement.Scope), &scope); err != nil {
+			logger.WithError(err).WithField("agreementId", agreement.ID).Warn("Skipping sharing agreement with invalid scope")
+			continue
+		}
+		grants = append(grants, database.SharedScope{
+			OrgID:        agreement.OrgID,
+			LotCodes:     scope.LotCodes,
+			EPCPrefixes:  scope.EPCPrefixes,
+			BizLocations: scope.BizLocations,
+		})
+	}
+	return grants, nil
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"scain-backend/database"
+	"scain-backend/models"
+)
+
+const (
+	// mktActivationEnergy is the activation energy conventionally used for mean
+	// kinetic temperature, in kJ/mol
+	mktActivationEnergy = 83.144
+	// gasConstant is the universal gas constant in kJ/(mol·K)
+	gasConstant = 0.008314462618
+	// kelvinOffset converts degrees Celsius to kelvin
+	kelvinOffset = 273.15
+)
+
+// DecayModel gives how fast a product loses shelf life at a temperature,
+// relative to the rate at its reference temperature
+type DecayModel interface {
+	RelativeRate(celsius float64) float64
+}
+
+// Q10Model speeds up decay by a factor of Q10 for every 10 degrees above the
+// reference temperature
+type Q10Model struct {
+	Q10                  float64
+	ReferenceTemperature float64 // CEL
+}
+
+// RelativeRate returns Q10^((T - Tref) / 10)
+func (m Q10Model) RelativeRate(celsius float64) float64 {
+	return math.Pow(m.Q10, (celsius-m.ReferenceTemperature)/10)
+}
+
+// ArrheniusModel relates the rate of decay to temperature with the Arrhenius
+// equation
+type ArrheniusModel struct {
+	ActivationEnergy     float64 // kJ/mol
+	ReferenceTemperature float64 // CEL
+}
+
+// RelativeRate returns exp(Ea/R · (1/Tref - 1/T)) with temperatures in kelvin
+func (m ArrheniusModel) RelativeRate(celsius float64) float64 {
+	return math.Exp(m.ActivationEnergy / gasConstant * (1/(m.ReferenceTemperature+kelvinOffset) - 1/(celsius+kelvinOffset)))
+}
+
+// profileDecayModel returns the decay model of a profile, or nil when it has none
+func profileDecayModel(profile *database.ColdChainProfile) DecayModel {
+	if profile == nil || profile.DecayModel == nil || profile.ShelfLifeHours == nil || profile.ReferenceTemperature == nil {
+		return nil
+	}
+	switch *profile.DecayModel {
+	case models.DecayModelQ10:
+		if profile.Q10 != nil {
+			return Q10Model{Q10: *profile.Q10, ReferenceTemperature: *profile.ReferenceTemperature}
+		}
+	case models.DecayModelArrhenius:
+		if profile.ActivationEnergy != nil {
+			return ArrheniusModel{ActivationEnergy: *profile.ActivationEnergy, ReferenceTemperature: *profile.ReferenceTemperature}
+		}
+	}
+	return nil
+}
+
+// temperatureReading is one temperature reading of a lot, in degrees Celsius
+type temperatureReading struct {
+	deviceID string
+	at       time.Time
+	value    float64 // the reading, or its mean when only statistics were reported
+	low      float64
+	high     float64
+	hours    float64 // how long the reading holds
+}
+
+// lotTemperatureReadings collects the temperature readings of all events of an
+// organization that reference a lot, in time order. Each reading holds until
+// the next one from any device, for at most maxGap; the last one does not hold.
+func lotTemperatureReadings(orgID, lotCode string, maxGap time.Duration) ([]temperatureReading, error) {
+	dbEvents, err := database.FindEventsByIdentifier(orgID, lotCode)
+	if err != nil {
+		return nil, err
+	}
+
+	var readings []temperatureReading
+	for i := range dbEvents {
+		event, err := eventFromRecord(&dbEvents[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, element := range event.SensorElementList {
+			// Events captured directly may not have been normalized yet
+			models.NormalizeSensorElement(&element)
+			deviceID := element.SensorMetaData.DeviceID
+			if deviceID == "" && event.DeviceID != nil {
+				deviceID = *event.DeviceID
+			}
+
+			for _, report := range element.SensorReport {
+				if report.Type != models.SensorTemperature || report.UOM != nil && *report.UOM != models.UnitCelsius {
+					continue
+				}
+				low, high, ok := readingRange(report)
+				if !ok {
+					continue
+				}
+				value, isNumber := models.SensorNumber(report.Value)
+				if !isNumber {
+					value = (low + high) / 2
+					if report.MeanValue != nil {
+						value = *report.MeanValue
+					}
+				}
+				at := report.Time
+				if at.IsZero() {
+					at = event.EventTime
+				}
+				readings = append(readings, temperatureReading{deviceID: deviceID, at: at.UTC(), value: value, low: low, high: high})
+			}
+		}
+	}
+
+	sort.SliceStable(readings, func(i, j int) bool {
+		return readings[i].at.Before(readings[j].at)
+	})
+	for i := 0; i+1 < len(readings); i++ {
+		gap := readings[i+1].at.Sub(readings[i].at)
+		if gap > maxGap {
+			gap = maxGap
+		}
+		readings[i].hours = gap.Hours()
+	}
+	return readings, nil
+}
+
+// summarizeTemperatures computes the statistics, mean kinetic temperature and
+// time above a threshold of a lot's readings. Readings are weighted by how long
+// they hold, or equally when none holds.
+func summarizeTemperatures(summary *models.ColdChainSummary, readings []temperatureReading, threshold *float64) {
+	summary.Readings = len(readings)
+	summary.Devices = []string{}
+	if len(readings) == 0 {
+		return
+	}
+
+	var totalHours float64
+	for _, reading := range readings {
+		totalHours += reading.hours
+	}
+	weight := func(reading temperatureReading) float64 {
+		if totalHours == 0 {
+			return 1
+		}
+		return reading.hours
+	}
+
+	devices := make(map[string]bool)
+	low, high := readings[0].low, readings[0].high
+	var weights, weightedSum, arrheniusSum, hoursAbove float64
+	for _, reading := range readings {
+		if reading.deviceID != "" && !devices[reading.deviceID] {
+			devices[reading.deviceID] = true
+			summary.Devices = append(summary.Devices, reading.deviceID)
+		}
+		low = math.Min(low, reading.low)
+		high = math.Max(high, reading.high)
+
+		w := weight(reading)
+		weights += w
+		weightedSum += w * reading.value
+		arrheniusSum += w * math.Exp(-mktActivationEnergy/(gasConstant*(reading.value+kelvinOffset)))
+		if threshold != nil && reading.value > *threshold {
+			hoursAbove += reading.hours
+		}
+	}
+	sort.Strings(summary.Devices)
+
+	from, to := readings[0].at, readings[len(readings)-1].at
+	avg := roundHundredths(weightedSum / weights)
+	mkt := roundHundredths(mktActivationEnergy/gasConstant/-math.Log(arrheniusSum/weights) - kelvinOffset)
+	low, high = roundHundredths(low), roundHundredths(high)
+
+	summary.From = &from
+	summary.To = &to
+	summary.MinTemperature = &low
+	summary.MaxTemperature = &high
+	summary.AvgTemperature = &avg
+	summary.MeanKineticTemperature = &mkt
+	if threshold != nil {
+		minutes := roundHundredths(hoursAbove * 60)
+		summary.Threshold = threshold
+		summary.MinutesAboveThreshold = &minutes
+	}
+}
+
+// estimateShelfLife consumes the shelf life of a lot reading by reading,
+// starting at the first reading, and predicts when it runs out if the lot stays
+// at its last recorded temperature
+func estimateShelfLife(profile *database.ColdChainProfile, model DecayModel, readings []temperatureReading) *models.ShelfLifeEstimate {
+	if len(readings) == 0 {
+		return nil
+	}
+
+	shelfLife := *profile.ShelfLifeHours
+	estimate := &models.ShelfLifeEstimate{
+		Model:                *profile.DecayModel,
+		ShelfLifeHours:       shelfLife,
+		ReferenceTemperature: *profile.ReferenceTemperature,
+	}
+
+	var consumed float64
+	for _, reading := range readings {
+		rate := model.RelativeRate(reading.value)
+		if !estimate.Expired && consumed+reading.hours*rate >= shelfLife {
+			// Expired during this reading
+			estimate.Expired = true
+			estimate.PredictedExpiry = reading.at.Add(time.Duration((shelfLife - consumed) / rate * float64(time.Hour))).Truncate(time.Second)
+		}
+		consumed += reading.hours * rate
+	}
+
+	estimate.ConsumedHours = roundHundredths(consumed)
+	if estimate.Expired {
+		return estimate
+	}
+
+	last := readings[len(readings)-1]
+	remaining := (shelfLife - consumed) / model.RelativeRate(last.value)
+	estimate.RemainingHours = roundHundredths(remaining)
+	estimate.RemainingPct = roundHundredths((shelfLife - consumed) / shelfLife * 100)
+	estimate.PredictedExpiry = last.at.Add(time.Duration(remaining * float64(time.Hour))).Truncate(time.Second)
+	return estimate
+}
+
+// roundHundredths rounds a computed value to two decimals
+func roundHundredths(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"scain-backend/database"
+	"scain-backend/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ErrDeliveryNotDead is returned when redelivering a delivery that has not been dead-lettered
+var ErrDeliveryNotDead = errors.New("only dead deliveries can be redelivered")
+
+// SubscriptionService manages webhook subscriptions and queues a delivery to
+// every subscription whose filter matches a stored event
+type SubscriptionService struct {
+	dispatcher *WebhookDispatcher
+}
+
+// NewSubscriptionService creates a new subscription service instance
+func NewSubscriptionService(dispatcher *WebhookDispatcher) *SubscriptionService {
+	return &SubscriptionService{dispatcher: dispatcher}
+}
+
+// CreateSubscription stores a subscription of an organization
+func (s *SubscriptionService) CreateSubscription(orgID string, request *models.SubscriptionRequest) (*database.Subscription, error) {
+	request.Filter.Normalize()
+	filterJSON, err := json.Marshal(request.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal filter: %w", err)
+	}
+
+	subscription := &database.Subscription{
+		OrgID:       orgID,
+		URL:         request.URL,
+		Filter:      string(filterJSON),
+		Secret:      request.Secret,
+		Description: request.Description,
+	}
+	if err := database.CreateSubscription(subscription); err != nil {
+		return nil, fmt.Errorf("failed to create subscription: %w", err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"subscriptionId": subscription.ID,
+		"url":            subscription.URL,
+	}).Info("Subscription created")
+	return subscription, nil
+}
+
+// ListSubscriptions retrieves all subscriptions of an organization
+func (s *SubscriptionService) ListSubscriptions(orgID string) ([]database.Subscription, error) {
+	subscriptions, err := database.ListSubscriptions(orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+	return subscriptions, nil
+}
+
+// GetSubscription retrieves a subscription of an organization by ID
+func (s *SubscriptionService) GetSubscription(orgID, id string) (*database.Subscription, error) {
+	subscription, err := database.GetSubscriptionByID(orgID, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("subscription not found: %s", id)
+		}
+		return nil, fmt.Errorf("failed to get subscription from database: %w", err)
+	}
+	return subscription, nil
+}
+
+// DeleteSubscription deletes a subscription of an organization together with
+// its delivery log
+func (s *SubscriptionService) DeleteSubscription(orgID, id string) error {
+	if err := database.DeleteSubscription(orgID, id); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("subscription not found: %s", id)
+		}
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+	return nil
+}
+
+// ListDeliveries retrieves the delivery log of a subscription of an
+// organization, optionally only the deliveries in one status
+func (s *SubscriptionService) ListDeliveries(orgID, subscriptionID, status string, limit int) ([]database.WebhookDelivery, error) {
+	if _, err := s.GetSubscription(orgID, subscriptionID); err != nil {
+		return nil, err
+	}
+	deliveries, err := database.ListWebhookDeliveries(&database.DeliveryFilter{
+		OrgID:          orgID,
+		SubscriptionID: subscriptionID,
+		Status:         status,
+		Limit:          limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// ListDeadLetters retrieves the deliveries of every subscription of an
+// organization that were given up after their last attempt
+func (s *SubscriptionService) ListDeadLetters(orgID string, limit int) ([]database.WebhookDelivery, error) {
+	deliveries, err := database.ListWebhookDeliveries(&database.DeliveryFilter{
+		OrgID:  orgID,
+		Status: database.DeliveryDead,
+		Limit:  limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+	return deliveries, nil
+}
+
+// Redeliver queues a dead delivery of a subscription of an organization again
+// with a fresh set of attempts
+func (s *SubscriptionService) Redeliver(orgID, subscriptionID, deliveryID string) (*database.WebhookDelivery, error) {
+	delivery, err := database.GetWebhookDeliveryByID(orgID, deliveryID)
+	if err != nil || delivery.SubscriptionID != subscriptionID {
+		if err == nil || err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("delivery not found: %s", deliveryID)
+		}
+		return nil, fmt.Errorf("failed to get delivery from database: %w", err)
+	}
+
+	queued, err := database.RedeliverWebhookDelivery(deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue delivery: %w", err)
+	}
+	if !queued {
+		return nil, ErrDeliveryNotDead
+	}
+	s.dispatcher.Notify()
+
+	return database.GetWebhookDeliveryByID(orgID, deliveryID)
+}
+
+// EventStored queues a delivery of the event to every subscription of its
+// organization whose filter matches it
+func (s *SubscriptionService) EventStored(event *models.EpcisEvent, dbEvent *database.Event) {
+	subscriptions, err := database.ListSubscriptions(dbEvent.OrgID)
+	if err != nil {
+		logger.WithError(err).WithField("eventId", dbEvent.ID).Error("Failed to list subscriptions")
+		return
+	}
+
+	queued := 0
+	for _, subscription := range subscriptions {
+		var filter models.SubscriptionFilter
+		if err := json.Unmarshal([]byte(subscription.Filter), &filter); err != nil {
+			logger.WithError(err).WithField("subscriptionId", subscription.ID).Error("Invalid subscription filter")
+			continue
+		}
+		if !filterMatches(&filter, dbEvent) {
+			continue
+		}
+
+		payload, err := json.Marshal(&models.EventNotification{
+			SubscriptionID: subscription.ID,
+			EventID:        dbEvent.ID,
+			Hash:           dbEvent.Hash,
+			Event:          event,
+			CreatedAt:      dbEvent.CreatedAt,
+		})
+		if err != nil {
+			logger.WithError(err).WithField("eventId", dbEvent.ID).Error("Failed to marshal event notification")
+			return
+		}
+		delivery := &database.WebhookDelivery{
+			OrgID:          dbEvent.OrgID,
+			SubscriptionID: subscription.ID,
+			EventID:        dbEvent.ID,
+			Status:         database.DeliveryPending,
+			Payload:        string(payload),
+		}
+		if err := database.CreateWebhookDelivery(delivery); err != nil {
+			logger.WithError(err).WithFields(logrus.Fields{
+				"subscriptionId": subscription.ID,
+				"eventId":        dbEvent.ID,
+			}).Error("Failed to queue webhook delivery")
+			continue
+		}
+		queued++
+	}
+
+	if queued > 0 {
+		s.dispatcher.Notify()
+	}
+}
+
+// filterMatches reports whether an event matches every field of a filter
+func filterMatches(filter *models.SubscriptionFilter, event *database.Event) bool {
+	if len(filter.EventTypes) > 0 {
+		matched := false
+		for _, eventType := range filter.EventTypes {
+			matched = matched || string(eventType) == event.EventType
+		}
+		if !matched {
+			return false
+		}
+	}
+	return matchesAny(filter.BizSteps, event.BizStep) &&
+		matchesAny(filter.BizLocations, event.BizLocationID) &&
+		matchesAny(filter.LotCodes, event.LotCode)
+}
+
+// matchesAny reports whether a value is one of the alternatives, or whether
+// there are none
+func matchesAny(alternatives []string, value *string) bool {
+	if len(alternatives) == 0 {
+		return true
+	}
+	if value == nil {
+		return false
+	}
+	for _, alternative := range alternatives {
+		if alternative == *value {
+			return true
+		}
+	}
+	return false
+}
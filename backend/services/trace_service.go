@@ -0,0 +1,458 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"scain-backend/database"
+	"scain-backend/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultTraceDepth is the number of product hops followed when no depth is given
+	DefaultTraceDepth = 10
+	// MaxTraceDepth is the largest number of product hops a trace may follow
+	MaxTraceDepth = 25
+)
+
+// TraceService builds lot genealogy graphs from stored EPCIS events
+type TraceService struct{}
+
+// NewTraceService creates a new trace service instance
+func NewTraceService() *TraceService {
+	return &TraceService{}
+}
+
+// traceLink is an edge found in one or more events, together with the product
+// it leads to when the trace continues through it
+type traceLink struct {
+	from     string
+	to       string
+	relation string
+	kind     models.NodeKind // kind of the node the link adds
+	next     string          // product to expand next, empty for locations and parties
+	events   []*models.EpcisEvent
+}
+
+// traceBuilder accumulates the nodes, edges and events of a trace
+type traceBuilder struct {
+	orgID           string                 // events of the organization are followed
+	shared          []database.SharedScope // and partner events within these scopes
+	graph           *models.TraceGraph
+	nodes           map[string]int // node ID to index in graph.Nodes
+	edges           map[string]int // from, to and relation to index in graph.Edges
+	events          map[string]bool
+	partnerEvents   map[string]string // event ID to the partner organization that recorded it
+	redacted        map[string]bool   // database IDs of the partner events redacted
+	transformations map[string][]*models.EpcisEvent
+}
+
+// Trace follows product lineage from a lot code, EPC or EPC class. A backward
+// trace walks from outputs to inputs and from parents to their contents; a
+// forward trace walks from inputs to outputs and from contents to their
+// parents. Locations and parties the visited products moved between are added
+// as leaf nodes. The events of the tracing organization are followed, and so
+// are partner events within the scopes shared with it; partner events outside
+// them are reported redacted.
+func (s *TraceService) Trace(orgID string, shared []database.SharedScope, identifier string, direction models.TraceDirection, maxDepth int) (*models.TraceGraph, error) {
+	if direction != models.TraceBackward && direction != models.TraceForward {
+		return nil, fmt.Errorf("invalid trace direction: %s", direction)
+	}
+	if maxDepth < 1 || maxDepth > MaxTraceDepth {
+		return nil, fmt.Errorf("trace depth must be between 1 and %d", MaxTraceDepth)
+	}
+
+	b := &traceBuilder{
+		orgID:  orgID,
+		shared: shared,
+		graph: &models.TraceGraph{
+			Root:      identifier,
+			Direction: direction,
+			MaxDepth:  maxDepth,
+			Nodes:     []models.TraceNode{},
+			Edges:     []models.TraceEdge{},
+			Events:    []models.EpcisEvent{},
+		},
+		nodes:           make(map[string]int),
+		edges:           make(map[string]int),
+		events:          make(map[string]bool),
+		partnerEvents:   make(map[string]string),
+		redacted:        make(map[string]bool),
+		transformations: make(map[string][]*models.EpcisEvent),
+	}
+	b.addNode(identifier, productKind(identifier), 0)
+
+	expanded := make(map[string]bool)
+	queue := []string{identifier}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if expanded[id] {
+			continue
+		}
+		expanded[id] = true
+
+		depth := b.graph.Nodes[b.nodes[id]].Depth
+		dbEvents, err := database.FindVisibleEventsByIdentifier(b.orgID, b.shared, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find events for %s: %w", id, err)
+		}
+		if err := b.redactPartnerEvents(id, dbEvents); err != nil {
+			return nil, err
+		}
+
+		for i := range dbEvents {
+			event, err := b.eventFromRecord(&dbEvents[i])
+			if err != nil {
+				return nil, err
+			}
+
+			productLinks, err := b.productLinks(event, id, direction)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, link := range append(productLinks, locationLinks(event, id)...) {
+				if link.next == "" {
+					b.addLink(link, depth+1)
+					continue
+				}
+
+				// Products beyond the depth limit are left out and the graph marked truncated
+				if depth >= maxDepth {
+					if _, known := b.nodes[link.next]; !known {
+						b.graph.Truncated = true
+						continue
+					}
+				}
+				b.addLink(link, depth+1)
+				if !expanded[link.next] {
+					queue = append(queue, link.next)
+				}
+			}
+		}
+	}
+
+	sort.Slice(b.graph.Events, func(i, j int) bool {
+		return b.graph.Events[i].EventTime.Before(b.graph.Events[j].EventTime)
+	})
+	sort.Slice(b.graph.Redacted, func(i, j int) bool {
+		return b.graph.Redacted[i].EventTime.Before(b.graph.Redacted[j].EventTime)
+	})
+	for eventID, partnerOrgID := range b.partnerEvents {
+		if !b.events[eventID] {
+			continue
+		}
+		if b.graph.SharedEvents == nil {
+			b.graph.SharedEvents = make(map[string]string)
+		}
+		b.graph.SharedEvents[eventID] = partnerOrgID
+	}
+
+	logger.WithFields(logrus.Fields{
+		"root":      identifier,
+		"direction": direction,
+		"nodes":     len(b.graph.Nodes),
+		"edges":     len(b.graph.Edges),
+		"redacted":  len(b.graph.Redacted),
+	}).Info("Trace completed")
+
+	return b.graph, nil
+}
+
+// eventFromRecord converts a stored event, remembering which partner recorded
+// it when it is not an event of the tracing organization
+func (b *traceBuilder) eventFromRecord(dbEvent *database.Event) (*models.EpcisEvent, error) {
+	event, err := eventFromRecord(dbEvent)
+	if err != nil {
+		return nil, err
+	}
+	if dbEvent.OrgID != b.orgID {
+		b.partnerEvents[event.EventID] = dbEvent.OrgID
+	}
+	return event, nil
+}
+
+// redactPartnerEvents records the partner events that reference a product but
+// are not among the visible events, i.e. lie outside every shared scope
+func (b *traceBuilder) redactPartnerEvents(id string, visible []database.Event) error {
+	partnerEvents, err := database.FindPartnerEventsByIdentifier(b.shared, id)
+	if err != nil {
+		return fmt.Errorf("failed to find partner events for %s: %w", id, err)
+	}
+	if len(partnerEvents) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(visible))
+	for _, event := range visible {
+		seen[event.ID] = true
+	}
+	for _, event := range partnerEvents {
+		if seen[event.ID] || b.redacted[event.ID] {
+			continue
+		}
+		b.redacted[event.ID] = true
+		b.graph.Redacted = append(b.graph.Redacted, models.RedactedEvent{
+			OrgID:      event.OrgID,
+			Identifier: id,
+			EventType:  models.EventType(event.EventType),
+			EventTime:  event.EventTime,
+		})
+	}
+	return nil
+}
+
+// productLinks returns the links from an event to the products that are
+// upstream (backward) or downstream (forward) of the given product
+func (b *traceBuilder) productLinks(event *models.EpcisEvent, id string, direction models.TraceDirection) ([]traceLink, error) {
+	var links []traceLink
+	forward := direction == models.TraceForward
+
+	switch event.EventType {
+	case models.TransformationEventType:
+		inputs, outputs, events, err := b.transformationIO(event)
+		if err != nil {
+			return nil, err
+		}
+		if forward && containsString(inputs, id) {
+			for _, output := range outputs {
+				links = append(links, productLink(id, output, models.RelationTransformedInto, output, events))
+			}
+		}
+		if !forward && containsString(outputs, id) {
+			for _, input := range inputs {
+				links = append(links, productLink(input, id, models.RelationTransformedInto, input, events))
+			}
+		}
+
+	case models.AggregationEventType:
+		if event.ParentID == nil {
+			break
+		}
+		parent := *event.ParentID
+		children := append(append([]string{}, event.ChildEPCs...), quantityClasses(event.ChildQuantityList)...)
+		events := []*models.EpcisEvent{event}
+
+		if event.Action != nil && *event.Action == models.ActionDelete {
+			// Unpacking: whatever affected the parent affects the children released from it
+			if forward && id == parent {
+				for _, child := range children {
+					links = append(links, productLink(parent, child, models.RelationDisaggregatedTo, child, events))
+				}
+			}
+			if !forward && containsString(children, id) {
+				links = append(links, productLink(parent, id, models.RelationDisaggregatedTo, parent, events))
+			}
+			break
+		}
+
+		if forward && containsString(children, id) {
+			links = append(links, productLink(id, parent, models.RelationAggregatedInto, parent, events))
+		}
+		if !forward && id == parent {
+			for _, child := range children {
+				links = append(links, productLink(child, parent, models.RelationAggregatedInto, child, events))
+			}
+		}
+
+	default:
+		// A lot code recorded with EPCs or EPC classes identifies the same product,
+		// so the link is followed in both directions
+		if event.LotCode == nil {
+			break
+		}
+		lot := *event.LotCode
+		members := append(append([]string{}, event.EPCList...), quantityClasses(event.QuantityList)...)
+		events := []*models.EpcisEvent{event}
+
+		if id == lot {
+			for _, member := range members {
+				links = append(links, productLink(lot, member, models.RelationIncludes, member, events))
+			}
+		} else if containsString(members, id) {
+			links = append(links, productLink(lot, id, models.RelationIncludes, lot, events))
+		}
+	}
+
+	return links, nil
+}
+
+// transformationIO returns the inputs and outputs of a transformation. Events
+// sharing a transformationID are combined, since each may only record part of it.
+func (b *traceBuilder) transformationIO(event *models.EpcisEvent) ([]string, []string, []*models.EpcisEvent, error) {
+	events := []*models.EpcisEvent{event}
+
+	if event.TransformationID != nil {
+		cached, ok := b.transformations[*event.TransformationID]
+		if !ok {
+			dbEvents, err := database.GetEventsByTransformationID(b.orgID, b.shared, *event.TransformationID)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to get transformation %s: %w", *event.TransformationID, err)
+			}
+			for i := range dbEvents {
+				sibling, err := b.eventFromRecord(&dbEvents[i])
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				cached = append(cached, sibling)
+			}
+			b.transformations[*event.TransformationID] = cached
+		}
+		if len(cached) > 0 {
+			events = cached
+		}
+	}
+
+	var inputs, outputs []string
+	for _, e := range events {
+		inputs = append(inputs, e.InputEPCList...)
+		inputs = append(inputs, quantityClasses(e.InputQuantityList)...)
+		outputs = append(outputs, e.OutputEPCList...)
+		outputs = append(outputs, quantityClasses(e.OutputQuantityList)...)
+
+		// The lot code of a transformation names the lot it produced
+		if e.LotCode != nil {
+			outputs = append(outputs, *e.LotCode)
+		}
+	}
+
+	return inputs, outputs, events, nil
+}
+
+// locationLinks returns the locations and parties a product moved between in an event
+func locationLinks(event *models.EpcisEvent, id string) []traceLink {
+	var links []traceLink
+	events := []*models.EpcisEvent{event}
+
+	for _, source := range event.SourceList {
+		links = append(links, traceLink{
+			from: source.Source, to: id, relation: models.RelationShippedFrom,
+			kind: sourceDestKind(source.Type), events: events,
+		})
+	}
+	for _, destination := range event.DestinationList {
+		links = append(links, traceLink{
+			from: id, to: destination.Destination, relation: models.RelationShippedTo,
+			kind: sourceDestKind(destination.Type), events: events,
+		})
+	}
+
+	if event.BizLocation != nil {
+		link := traceLink{
+			from: id, to: event.BizLocation.ID, relation: models.RelationObservedAt,
+			kind: models.LocationNode, events: events,
+		}
+		if event.BizStep != nil {
+			switch *event.BizStep {
+			case models.Shipping:
+				link.from, link.to, link.relation = event.BizLocation.ID, id, models.RelationShippedFrom
+			case models.Receiving:
+				link.relation = models.RelationReceivedAt
+			}
+		}
+		links = append(links, link)
+	}
+
+	return links
+}
+
+// addLink records a link's node, edge and justifying events in the graph
+func (b *traceBuilder) addLink(link traceLink, depth int) {
+	if link.next != "" {
+		b.addNode(link.next, link.kind, depth)
+	} else if link.from == link.to {
+		return
+	} else if _, known := b.nodes[link.from]; !known {
+		b.addNode(link.from, link.kind, depth)
+	} else {
+		b.addNode(link.to, link.kind, depth)
+	}
+
+	key := link.from + "\x00" + link.to + "\x00" + link.relation
+	index, ok := b.edges[key]
+	if !ok {
+		index = len(b.graph.Edges)
+		b.edges[key] = index
+		b.graph.Edges = append(b.graph.Edges, models.TraceEdge{
+			From:     link.from,
+			To:       link.to,
+			Relation: link.relation,
+			EventIDs: []string{},
+		})
+	}
+
+	edge := &b.graph.Edges[index]
+	for _, event := range link.events {
+		if !containsString(edge.EventIDs, event.EventID) {
+			edge.EventIDs = append(edge.EventIDs, event.EventID)
+		}
+		if !b.events[event.EventID] {
+			b.events[event.EventID] = true
+			b.graph.Events = append(b.graph.Events, *event)
+		}
+	}
+}
+
+// addNode adds a node to the graph unless it is already present
+func (b *traceBuilder) addNode(id string, kind models.NodeKind, depth int) {
+	if _, ok := b.nodes[id]; ok {
+		return
+	}
+	b.nodes[id] = len(b.graph.Nodes)
+	b.graph.Nodes = append(b.graph.Nodes, models.TraceNode{ID: id, Kind: kind, Depth: depth})
+}
+
+// productLink creates a link that continues the trace at the given product
+func productLink(from, to, relation, next string, events []*models.EpcisEvent) traceLink {
+	return traceLink{
+		from:     from,
+		to:       to,
+		relation: relation,
+		kind:     productKind(next),
+		next:     next,
+		events:   events,
+	}
+}
+
+// productKind infers the node kind of a product identifier
+func productKind(id string) models.NodeKind {
+	switch {
+	case strings.HasPrefix(id, "urn:epc:class:"), strings.HasPrefix(id, "urn:epc:idpat:"):
+		return models.EPCClassNode
+	case strings.HasPrefix(id, "urn:epc:id:"), strings.HasPrefix(id, "https://id.gs1.org/"):
+		return models.EPCNode
+	default:
+		return models.LotNode
+	}
+}
+
+// sourceDestKind infers the node kind of a source or destination from its CBV type
+func sourceDestKind(sourceDestType string) models.NodeKind {
+	if strings.HasSuffix(sourceDestType, "party") {
+		return models.PartyNode
+	}
+	return models.LocationNode
+}
+
+// quantityClasses returns the EPC classes of a quantity list
+func quantityClasses(quantities []models.QuantityElement) []string {
+	classes := make([]string, 0, len(quantities))
+	for _, quantity := range quantities {
+		classes = append(classes, quantity.EPCClass)
+	}
+	return classes
+}
+
+// containsString reports whether a slice contains a string
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
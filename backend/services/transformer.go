@@ -0,0 +1,115 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"scain-backend/models"
+)
+
+// Transformer turns the raw data of a device into EPCIS events
+type Transformer interface {
+	Transform(payload *models.RawIngestPayload) ([]*models.EpcisEvent, error)
+}
+
+// TransformerFunc adapts a function to the Transformer interface
+type TransformerFunc func(payload *models.RawIngestPayload) ([]*models.EpcisEvent, error)
+
+// Transform calls f(payload)
+func (f TransformerFunc) Transform(payload *models.RawIngestPayload) ([]*models.EpcisEvent, error) {
+	return f(payload)
+}
+
+// TransformerKey selects the transformer of a device. Vendor and model are
+// optional; a transformer registered without them handles every device of the
+// type that has no more specific transformer.
+type TransformerKey struct {
+	DeviceType models.DeviceType `json:"deviceType"`
+	Vendor     string            `json:"vendor,omitempty"`
+	Model      string            `json:"model,omitempty"`
+}
+
+// String formats the key as type/vendor/model, leaving out empty parts
+func (k TransformerKey) String() string {
+	parts := []string{string(k.DeviceType)}
+	if k.Vendor != "" {
+		parts = append(parts, k.Vendor)
+	}
+	if k.Model != "" {
+		parts = append(parts, k.Model)
+	}
+	return strings.Join(parts, "/")
+}
+
+// normalize makes vendor and model matching case-insensitive
+func (k TransformerKey) normalize() TransformerKey {
+	k.Vendor = strings.ToLower(k.Vendor)
+	k.Model = strings.ToLower(k.Model)
+	return k
+}
+
+var (
+	transformersMu sync.RWMutex
+	transformers   = map[TransformerKey]Transformer{
+		{DeviceType: models.ESP32DeviceType}:       TransformerFunc(transformESP32Data),
+		{DeviceType: models.ExpressLinkDeviceType}: TransformerFunc(transformExpressLinkData),
+		{DeviceType: models.LoRaWANDeviceType}:     TransformerFunc(transformLoRaWANData),
+		{DeviceType: models.TrackerDeviceType}:     TransformerFunc(transformTrackerData),
+		{DeviceType: models.ERPDeviceType}:         TransformerFunc(transformERPData),
+	}
+)
+
+// RegisterTransformer registers a transformer for a device type, optionally
+// narrowed to a vendor and model. Registering a key again replaces the
+// transformer, including the built-in one of a device type.
+func RegisterTransformer(key TransformerKey, transformer Transformer) {
+	transformersMu.Lock()
+	defer transformersMu.Unlock()
+	transformers[key.normalize()] = transformer
+}
+
+// LookupTransformer returns the most specific transformer registered for a
+// key: the one for its vendor and model, then for its vendor, then for its
+// device type
+func LookupTransformer(key TransformerKey) (Transformer, bool) {
+	key = key.normalize()
+	candidates := []TransformerKey{
+		key,
+		{DeviceType: key.DeviceType, Vendor: key.Vendor},
+		{DeviceType: key.DeviceType},
+	}
+
+	transformersMu.RLock()
+	defer transformersMu.RUnlock()
+	for _, candidate := range candidates {
+		if transformer, ok := transformers[candidate]; ok {
+			return transformer, true
+		}
+	}
+	return nil, false
+}
+
+// TransformerKeys lists the registered transformer keys in order
+func TransformerKeys() []TransformerKey {
+	transformersMu.RLock()
+	keys := make([]TransformerKey, 0, len(transformers))
+	for key := range transformers {
+		keys = append(keys, key)
+	}
+	transformersMu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
+}
+
+// PayloadTransformerKey returns the transformer key of a payload. The vendor
+// and model are read from the vendor and model metadata.
+func PayloadTransformerKey(payload *models.RawIngestPayload) TransformerKey {
+	key := TransformerKey{DeviceType: payload.DeviceType}
+	key.Vendor, _ = payload.Metadata["vendor"].(string)
+	key.Model, _ = payload.Metadata["model"].(string)
+	return key
+}
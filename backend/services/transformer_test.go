@@ -0,0 +1,344 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"scain-backend/models"
+)
+
+var testTimestamp = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// testPayload builds a raw payload of a device type with the given data
+func testPayload(deviceType models.DeviceType, data map[string]interface{}) *models.RawIngestPayload {
+	lotCode := "LOT-42"
+	return &models.RawIngestPayload{
+		DeviceType: deviceType,
+		DeviceID:   "device-1",
+		Timestamp:  testTimestamp,
+		LotCode:    &lotCode,
+		Data:       data,
+	}
+}
+
+// transformOne runs the transformer registered for a payload and expects one event
+func transformOne(t *testing.T, payload *models.RawIngestPayload) *models.EpcisEvent {
+	t.Helper()
+	transformer, ok := LookupTransformer(PayloadTransformerKey(payload))
+	if !ok {
+		t.Fatalf("no transformer for %s", payload.DeviceType)
+	}
+	events, err := transformer.Transform(payload)
+	if err != nil {
+		t.Fatalf("Transform: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	return events[0]
+}
+
+// checkCommonFields checks the fields every built-in transformer copies from the payload
+func checkCommonFields(t *testing.T, event *models.EpcisEvent, eventType models.EventType) {
+	t.Helper()
+	if event.EventType != eventType {
+		t.Errorf("eventType = %s, want %s", event.EventType, eventType)
+	}
+	if !event.EventTime.Equal(testTimestamp) {
+		t.Errorf("eventTime = %v, want %v", event.EventTime, testTimestamp)
+	}
+	if event.EventTimeZoneOffset != "+00:00" {
+		t.Errorf("eventTimeZoneOffset = %s, want +00:00", event.EventTimeZoneOffset)
+	}
+	if event.Action == nil || *event.Action != models.ActionObserve {
+		t.Errorf("action = %v, want OBSERVE", event.Action)
+	}
+	if event.DeviceID == nil || *event.DeviceID != "device-1" {
+		t.Errorf("deviceId = %v, want device-1", event.DeviceID)
+	}
+	if event.LotCode == nil || *event.LotCode != "LOT-42" {
+		t.Errorf("lotCode = %v, want LOT-42", event.LotCode)
+	}
+}
+
+// checkSensorReports checks the sensor reports of an event by type
+func checkSensorReports(t *testing.T, event *models.EpcisEvent, want map[string]interface{}) {
+	t.Helper()
+	if len(event.SensorElementList) != 1 {
+		t.Fatalf("got %d sensor elements, want 1", len(event.SensorElementList))
+	}
+	element := event.SensorElementList[0]
+	if element.SensorMetaData.DeviceID != "device-1" {
+		t.Errorf("sensor deviceId = %s, want device-1", element.SensorMetaData.DeviceID)
+	}
+	if len(element.SensorReport) != len(want) {
+		t.Fatalf("got %d sensor reports, want %d", len(element.SensorReport), len(want))
+	}
+	for _, report := range element.SensorReport {
+		value, ok := want[report.Type]
+		if !ok {
+			t.Errorf("unexpected sensor report %s", report.Type)
+			continue
+		}
+		if report.Value != value {
+			t.Errorf("%s = %v, want %v", report.Type, report.Value, value)
+		}
+		if !report.Time.Equal(testTimestamp) {
+			t.Errorf("%s time = %v, want %v", report.Type, report.Time, testTimestamp)
+		}
+	}
+}
+
+// expectRejected expects the transformer of a payload to reject it with an error mentioning want
+func expectRejected(t *testing.T, payload *models.RawIngestPayload, want string) {
+	t.Helper()
+	transformer, ok := LookupTransformer(PayloadTransformerKey(payload))
+	if !ok {
+		t.Fatalf("no transformer for %s", payload.DeviceType)
+	}
+	events, err := transformer.Transform(payload)
+	if err == nil {
+		t.Fatalf("expected an error, got %d events", len(events))
+	}
+	if !strings.Contains(err.Error(), want) {
+		t.Fatalf("error = %q, want it to mention %q", err, want)
+	}
+}
+
+func TestESP32Transformer(t *testing.T) {
+	payload := testPayload(models.ESP32DeviceType, map[string]interface{}{
+		"temperature": 4.5,
+		"humidity":    61.0,
+	})
+	payload.Metadata = map[string]interface{}{
+		"uom": map[string]interface{}{"temperature": "CEL"},
+	}
+
+	event := transformOne(t, payload)
+	checkCommonFields(t, event, models.ObjectEventType)
+	checkSensorReports(t, event, map[string]interface{}{"temperature": 4.5, "humidity": 61.0})
+	for _, report := range event.SensorElementList[0].SensorReport {
+		if report.Type == "temperature" && (report.UOM == nil || *report.UOM != "CEL") {
+			t.Errorf("temperature uom = %v, want CEL", report.UOM)
+		}
+		if report.Type == "humidity" && report.UOM != nil {
+			t.Errorf("humidity uom = %s, want none", *report.UOM)
+		}
+	}
+
+	expectRejected(t, testPayload(models.ESP32DeviceType, map[string]interface{}{}), "no sensor readings")
+}
+
+func TestExpressLinkTransformer(t *testing.T) {
+	event := transformOne(t, testPayload(models.ExpressLinkDeviceType, map[string]interface{}{"temperature": -18.0}))
+	checkCommonFields(t, event, models.ObjectEventType)
+	checkSensorReports(t, event, map[string]interface{}{"temperature": -18.0})
+	if meta := event.SensorElementList[0].SensorMetaData.DeviceMetadata; meta == nil || meta.Type != models.ExpressLinkDeviceType {
+		t.Errorf("deviceMetadata = %v, want type ExpressLink", meta)
+	}
+
+	expectRejected(t, testPayload(models.ExpressLinkDeviceType, map[string]interface{}{}), "no sensor readings")
+}
+
+func TestLoRaWANTransformer(t *testing.T) {
+	payload := testPayload(models.LoRaWANDeviceType, map[string]interface{}{"temperature_1": 3.2})
+	payload.Metadata = map[string]interface{}{
+		"radio": map[string]interface{}{
+			"networkServer": "ttn",
+			"devEui":        "0004A30B001C0530",
+			"fPort":         2.0,
+			"fCnt":          17.0,
+		},
+	}
+
+	event := transformOne(t, payload)
+	checkCommonFields(t, event, models.ObjectEventType)
+	checkSensorReports(t, event, map[string]interface{}{"temperature_1": 3.2})
+	radio := event.SensorElementList[0].SensorMetaData.Radio
+	if radio == nil {
+		t.Fatal("radio metadata is missing")
+	}
+	if radio.DevEUI != "0004A30B001C0530" || radio.FPort != 2 || radio.FCnt != 17 {
+		t.Errorf("radio = %+v, want devEui 0004A30B001C0530, fPort 2, fCnt 17", radio)
+	}
+
+	expectRejected(t, testPayload(models.LoRaWANDeviceType, map[string]interface{}{}), "no sensor readings")
+}
+
+func TestTrackerTransformer(t *testing.T) {
+	event := transformOne(t, testPayload(models.TrackerDeviceType, map[string]interface{}{
+		"latitude":  52.52,
+		"longitude": 13.405,
+	}))
+	checkCommonFields(t, event, models.ObjectEventType)
+	if event.ReadPoint == nil || event.ReadPoint.ID != "geo:52.52,13.405" {
+		t.Errorf("readPoint = %v, want geo:52.52,13.405", event.ReadPoint)
+	}
+
+	// A report without a location is not an event
+	transformer, _ := LookupTransformer(TransformerKey{DeviceType: models.TrackerDeviceType})
+	events, err := transformer.Transform(testPayload(models.TrackerDeviceType, map[string]interface{}{"battery": 87.0}))
+	if err != nil || len(events) != 0 {
+		t.Errorf("Transform without location = %d events, %v, want none", len(events), err)
+	}
+
+	tests := []struct {
+		name string
+		data map[string]interface{}
+		want string
+	}{
+		{"latitude without longitude", map[string]interface{}{"latitude": 52.52}, "together"},
+		{"latitude not a number", map[string]interface{}{"latitude": "52.52N", "longitude": 13.405}, "latitude must be a number"},
+		{"longitude out of range", map[string]interface{}{"latitude": 52.52, "longitude": 213.4}, "longitude 213.4 is out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectRejected(t, testPayload(models.TrackerDeviceType, tt.data), tt.want)
+		})
+	}
+}
+
+func TestERPTransformer(t *testing.T) {
+	event := transformOne(t, testPayload(models.ERPDeviceType, map[string]interface{}{
+		"businessStep": "shipping",
+		"transactions": []interface{}{
+			map[string]interface{}{"type": "po", "id": "urn:epcglobal:cbv:bt:0614141000005:PO-1"},
+		},
+	}))
+	checkCommonFields(t, event, models.TransactionEventType)
+	if event.BizStep == nil || *event.BizStep != models.BusinessStep("shipping") {
+		t.Errorf("bizStep = %v, want shipping", event.BizStep)
+	}
+	if len(event.BizTransactionList) != 1 {
+		t.Fatalf("got %d business transactions, want 1", len(event.BizTransactionList))
+	}
+	if txn := event.BizTransactionList[0]; txn.Type != "po" || txn.BizTransaction != "urn:epcglobal:cbv:bt:0614141000005:PO-1" {
+		t.Errorf("business transaction = %+v", txn)
+	}
+
+	tests := []struct {
+		name string
+		data map[string]interface{}
+		want string
+	}{
+		{"businessStep not a string", map[string]interface{}{"businessStep": 3.0}, "businessStep must be a string"},
+		{"transactions not a list", map[string]interface{}{"transactions": "PO-1"}, "transactions must be a list"},
+		{"transaction without id", map[string]interface{}{"transactions": []interface{}{map[string]interface{}{"type": "po"}}}, "transaction 0 must have a type and an id"},
+		{"transaction not an object", map[string]interface{}{"transactions": []interface{}{"PO-1"}}, "transaction 0 must have a type and an id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectRejected(t, testPayload(models.ERPDeviceType, tt.data), tt.want)
+		})
+	}
+}
+
+func TestMappingTransformer(t *testing.T) {
+	transformer, err := NewMappingTransformer(MappingRules{
+		DeviceType:  models.TrackerDeviceType,
+		Vendor:      "Tive",
+		EventTime:   "data.entry_time_epoch",
+		ReadPoint:   "geo:{data.location.latitude},{data.location.longitude}",
+		Disposition: "urn:epcglobal:cbv:disp:in_transit",
+		EPCs:        []string{"urn:epc:id:sscc:{data.shipment_id}", "urn:epc:id:sgtin:{data.missing}"},
+		Sensors: []SensorMapping{
+			{Path: "data.temperature.celsius", Type: "gs1:Temperature", UOM: "CEL"},
+			{Path: "data.battery.millivolts", Type: "gs1:Voltage", UOM: "VLT", Scale: 0.001},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewMappingTransformer: %v", err)
+	}
+
+	payload := testPayload(models.TrackerDeviceType, map[string]interface{}{
+		"entry_time_epoch": 1772366400000.0,
+		"location":         map[string]interface{}{"latitude": 52.52, "longitude": 13.405},
+		"shipment_id":      "106141411234567897",
+		"temperature":      map[string]interface{}{"celsius": 5.25},
+		"battery":          map[string]interface{}{"millivolts": 3712.0},
+	})
+	events, err := transformer.Transform(payload)
+	if err != nil {
+		t.Fatalf("Transform: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	event := events[0]
+
+	if event.EventType != models.ObjectEventType {
+		t.Errorf("eventType = %s, want ObjectEvent", event.EventType)
+	}
+	if want := time.UnixMilli(1772366400000).UTC(); !event.EventTime.Equal(want) {
+		t.Errorf("eventTime = %v, want %v", event.EventTime, want)
+	}
+	if event.ReadPoint == nil || event.ReadPoint.ID != "geo:52.52,13.405" {
+		t.Errorf("readPoint = %v, want geo:52.52,13.405", event.ReadPoint)
+	}
+	if event.Disposition == nil || *event.Disposition != "urn:epcglobal:cbv:disp:in_transit" {
+		t.Errorf("disposition = %v", event.Disposition)
+	}
+	if len(event.EPCList) != 1 || event.EPCList[0] != "urn:epc:id:sscc:106141411234567897" {
+		t.Errorf("epcList = %v, want the SSCC only", event.EPCList)
+	}
+	if event.LotCode == nil || *event.LotCode != "LOT-42" {
+		t.Errorf("lotCode = %v, want LOT-42", event.LotCode)
+	}
+	if len(event.SensorElementList) != 1 {
+		t.Fatalf("got %d sensor elements, want 1", len(event.SensorElementList))
+	}
+	reports := event.SensorElementList[0].SensorReport
+	if len(reports) != 2 {
+		t.Fatalf("got %d sensor reports, want 2", len(reports))
+	}
+	if reports[0].Type != "gs1:Temperature" || reports[0].Value != 5.25 || reports[0].UOM == nil || *reports[0].UOM != "CEL" {
+		t.Errorf("temperature report = %+v", reports[0])
+	}
+	if reports[1].Type != "gs1:Voltage" || reports[1].Value != 3.712 {
+		t.Errorf("voltage report = %+v", reports[1])
+	}
+
+	tests := []struct {
+		name string
+		data map[string]interface{}
+		want string
+	}{
+		{"no sensor paths present", map[string]interface{}{"shipment_id": "1"}, "none of the sensor paths are present"},
+		{"unsupported event time", map[string]interface{}{"entry_time_epoch": true, "temperature": map[string]interface{}{"celsius": 5.0}}, "eventTime data.entry_time_epoch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := transformer.Transform(testPayload(models.TrackerDeviceType, tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewMappingTransformerRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules MappingRules
+	}{
+		{"missing device type", MappingRules{}},
+		{"model without vendor", MappingRules{DeviceType: models.TrackerDeviceType, Model: "Solo"}},
+		{"sensor without type", MappingRules{DeviceType: models.TrackerDeviceType, Sensors: []SensorMapping{{Path: "data.t"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewMappingTransformer(tt.rules); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestTransformRawDataRejectsUnknownDeviceType(t *testing.T) {
+	service := &EPCISService{}
+	_, err := service.TransformRawData(testPayload(models.DeviceType("Toaster"), map[string]interface{}{"temperature": 200.0}))
+	if err == nil || !strings.Contains(err.Error(), "unsupported device type") {
+		t.Fatalf("error = %v, want unsupported device type", err)
+	}
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"scain-backend/database"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultWebhookWorkers is the number of workers when WEBHOOK_WORKERS is not set
+	DefaultWebhookWorkers = 2
+	// DefaultWebhookMaxAttempts is the number of attempts when WEBHOOK_MAX_ATTEMPTS is not set
+	DefaultWebhookMaxAttempts = 8
+
+	// Delivery request headers
+	WebhookSignatureHeader = "X-Scain-Signature" // sha256=<hex HMAC-SHA256 of the body with the subscription secret>
+	WebhookDeliveryHeader  = "X-Scain-Delivery"
+	WebhookEventHeader     = "X-Scain-Event-Id"
+	WebhookAttemptHeader   = "X-Scain-Attempt"
+
+	// webhookRetryBaseDelay is the delay before the first retry; it doubles with each attempt
+	webhookRetryBaseDelay = 10 * time.Second
+	// webhookRetryMaxDelay caps the delay between retries
+	webhookRetryMaxDelay = time.Hour
+	// webhookTimeout bounds one delivery attempt
+	webhookTimeout = 15 * time.Second
+	// webhookPollInterval is how often idle workers look for due retries
+	webhookPollInterval = time.Second
+	// webhookErrorBodyLimit is how much of an error response is kept in the log
+	webhookErrorBodyLimit = 512
+)
+
+// WebhookDispatcher delivers queued webhook deliveries in the background with
+// a pool of workers, retrying failed attempts with exponential backoff until
+// the last attempt, after which the delivery is dead-lettered
+type WebhookDispatcher struct {
+	client      *http.Client
+	workers     int
+	maxAttempts int
+	wake        chan struct{}
+	stop        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewWebhookDispatcher creates a new webhook dispatcher. The pool size and
+// number of attempts are read from WEBHOOK_WORKERS and WEBHOOK_MAX_ATTEMPTS.
+func NewWebhookDispatcher() *WebhookDispatcher {
+	// Deliveries in flight belong to a previous process and are picked up again
+	if err := database.ResetInterruptedDeliveries(); err != nil {
+		logger.Warnf("Failed to reset interrupted webhook deliveries: %v", err)
+	}
+
+	return &WebhookDispatcher{
+		client:      &http.Client{Timeout: webhookTimeout},
+		workers:     envInt("WEBHOOK_WORKERS", DefaultWebhookWorkers),
+		maxAttempts: envInt("WEBHOOK_MAX_ATTEMPTS", DefaultWebhookMaxAttempts),
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+	}
+}
+
+// Start launches the workers
+func (d *WebhookDispatcher) Start() {
+	for i := 0; i < d.workers; i++ {
+		d.wg.Add(1)
+		go d.run()
+	}
+
+	logger.WithFields(logrus.Fields{
+		"workers":     d.workers,
+		"maxAttempts": d.maxAttempts,
+	}).Info("Webhook dispatcher started")
+}
+
+// Stop signals the workers to exit and waits for deliveries in progress to finish
+func (d *WebhookDispatcher) Stop() {
+	close(d.stop)
+	d.wg.Wait()
+	logger.Info("Webhook dispatcher stopped")
+}
+
+// Notify wakes an idle worker after a delivery has been queued
+func (d *WebhookDispatcher) Notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run claims and delivers until the pool is stopped
+func (d *WebhookDispatcher) run() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		default:
+		}
+
+		delivery, err := database.ClaimPendingDelivery(time.Now())
+		if err != nil {
+			logger.WithError(err).Error("Failed to claim webhook delivery")
+		}
+		if delivery != nil {
+			// More work may be queued behind this one
+			d.Notify()
+			d.deliver(delivery)
+			continue
+		}
+
+		select {
+		case <-d.stop:
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver runs one attempt at a delivery and records its outcome
+func (d *WebhookDispatcher) deliver(delivery *database.WebhookDelivery) {
+	delivery.Attempts++
+	fields := logrus.Fields{
+		"deliveryId":     delivery.ID,
+		"subscriptionId": delivery.SubscriptionID,
+		"eventId":        delivery.EventID,
+		"attempt":        delivery.Attempts,
+	}
+
+	subscription, err := database.GetSubscriptionByID(delivery.OrgID, delivery.SubscriptionID)
+	var statusCode int
+	if err == nil {
+		statusCode, err = d.post(subscription, delivery)
+	}
+	if statusCode != 0 {
+		delivery.LastStatusCode = &statusCode
+	}
+
+	now := time.Now()
+	if err != nil {
+		message := err.Error()
+		delivery.LastError = &message
+
+		if delivery.Attempts >= d.maxAttempts {
+			delivery.Status = database.DeliveryDead
+			delivery.NextAttemptAt = nil
+			logger.WithError(err).WithFields(fields).Error("Webhook delivery failed, moved to dead letters")
+		} else {
+			next := now.Add(backoffDelay(delivery.Attempts, webhookRetryBaseDelay, webhookRetryMaxDelay))
+			delivery.Status = database.DeliveryPending
+			delivery.NextAttemptAt = &next
+			logger.WithError(err).WithFields(fields).Warn("Webhook delivery attempt failed, retrying")
+		}
+	} else {
+		delivery.Status = database.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+		delivery.LastError = nil
+		logger.WithFields(fields).Info("Webhook delivered")
+	}
+
+	if err := database.UpdateWebhookDelivery(delivery); err != nil {
+		logger.WithError(err).WithFields(fields).Error("Failed to update webhook delivery")
+	}
+}
+
+// post sends a delivery to its subscription and returns the response status.
+// Any response other than a 2xx is a failed attempt.
+func (d *WebhookDispatcher) post(subscription *database.Subscription, delivery *database.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	body := []byte(delivery.Payload)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(WebhookSignatureHeader, SignWebhookPayload(subscription.Secret, body))
+	request.Header.Set(WebhookDeliveryHeader, delivery.ID)
+	request.Header.Set(WebhookEventHeader, delivery.EventID)
+	request.Header.Set(WebhookAttemptHeader, strconv.Itoa(delivery.Attempts))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		excerpt, _ := io.ReadAll(io.LimitReader(response.Body, webhookErrorBodyLimit))
+		return response.StatusCode, fmt.Errorf("%s responded with %s: %s", subscription.URL, response.Status, bytes.TrimSpace(excerpt))
+	}
+	io.Copy(io.Discard, response.Body)
+	return response.StatusCode, nil
+}
+
+// SignWebhookPayload returns the signature header value of a delivery body:
+// sha256= followed by the hex HMAC-SHA256 of the body keyed with the secret
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"scain-backend/database"
+	"scain-backend/middleware"
+	"scain-backend/models"
+	"scain-backend/services"
+)
+
+// requestGrants returns the scopes partners share with the organization a
+// request acts for, responding with an error when they cannot be loaded
+func requestGrants(c *gin.Context) ([]database.SharedScope, bool) {
+	grants, err := sharingService.Grants(requestOrg(c))
+	if err != nil {
+		logger.WithError(err).Error("Failed to load sharing agreements")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to load sharing agreements",
+			Code:    500,
+		})
+		return nil, false
+	}
+	return grants, true
+}
+
+// createSharingAgreementHandler handles sharing events with a partner organization
+func createSharingAgreementHandler(c *gin.Context) {
+	var request models.SharingAgreementRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationError := middleware.FormatValidationError(err)
+		c.JSON(http.StatusBadRequest, validationError)
+		return
+	}
+
+	if err := validate.Struct(&request); err != nil {
+		validationError := middleware.FormatValidationError(err)
+		c.JSON(http.StatusBadRequest, validationError)
+		return
+	}
+
+	agreement, err := sharingService.CreateAgreement(requestOrg(c), &request)
+	if err != nil {
+		if errors.Is(err, services.ErrShareWithSelf) || strings.HasPrefix(err.Error(), "organization not found") {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Invalid partner organization",
+				Message: err.Error(),
+				Code:    400,
+			})
+			return
+		}
+		logger.WithError(err).Error("Failed to create sharing agreement")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to create sharing agreement",
+			Code:    500,
+		})
+		return
+	}
+
+	c.Header("Location", "/api/sharing-agreements/"+agreement.ID)
+	c.JSON(http.StatusCreated, map[string]interface{}{
+		"status":    "created",
+		"agreement": agreement,
+	})
+}
+
+// listSharingAgreementsHandler handles listing the sharing agreements an
+// organization granted and received
+func listSharingAgreementsHandler(c *gin.Context) {
+	direction := c.Query("direction")
+	if direction != "" && direction != database.SharingGranted && direction != database.SharingReceived {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid query parameter",
+			Message: "direction must be granted or received",
+			Code:    400,
+		})
+		return
+	}
+
+	agreements, err := sharingService.ListAgreements(requestOrg(c), direction)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list sharing agreements")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to list sharing agreements",
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"agreements": agreements,
+		"count":      len(agreements),
+	})
+}
+
+// getSharingAgreementHandler handles sharing agreement retrieval
+func getSharingAgreementHandler(c *gin.Context) {
+	agreementID := c.Param("id")
+
+	agreement, err := sharingService.GetAgreement(requestOrg(c), agreementID)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "sharing agreement not found") {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "Sharing agreement not found",
+				Message: err.Error(),
+				Code:    404,
+			})
+			return
+		}
+		logger.WithError(err).WithField("agreementId", agreementID).Error("Failed to retrieve sharing agreement")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to retrieve sharing agreement",
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"status":    "found",
+		"agreement": agreement,
+	})
+}
+
+// revokeSharingAgreementHandler handles revoking a sharing agreement the
+// organization granted
+func revokeSharingAgreementHandler(c *gin.Context) {
+	agreementID := c.Param("id")
+
+	agreement, err := sharingService.RevokeAgreement(requestOrg(c), agreementID)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "sharing agreement not found") {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "Sharing agreement not found",
+				Message: err.Error(),
+				Code:    404,
+			})
+			return
+		}
+		logger.WithError(err).WithField("agreementId", agreementID).Error("Failed to revoke sharing agreement")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to revoke sharing agreement",
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"status":    "revoked",
+		"agreement": agreement,
+	})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"scain-backend/models"
+)
+
+const (
+	// streamKeepAlive is how often an idle stream is kept alive: an SSE comment
+	// or a WebSocket ping
+	streamKeepAlive = 15 * time.Second
+	// streamWriteTimeout bounds writing one WebSocket frame
+	streamWriteTimeout = 10 * time.Second
+)
+
+// streamUpgrader upgrades live stream requests to WebSocket connections from
+// the origins CORS allows
+var streamUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return originAllowed(r.Header.Get("Origin")) },
+}
+
+// streamParams reads the filter and the ID to resume after of a live stream
+// request. Only messages of the caller's organization are streamed. The ID is taken from the Last-Event-ID header, which EventSource
+// sends when it reconnects, or from the lastEventId query parameter.
+func streamParams(c *gin.Context) (models.StreamFilter, uint64, bool) {
+	var filter models.StreamFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid query parameter",
+			Message: err.Error(),
+			Code:    400,
+		})
+		return filter, 0, false
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+	var lastID uint64
+	if lastEventID != "" {
+		parsed, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Invalid last event ID",
+				Message: "Last-Event-ID must be the ID of a stream message",
+				Code:    400,
+			})
+			return filter, 0, false
+		}
+		lastID = parsed
+	}
+	filter.OrgID = requestOrg(c)
+	return filter, lastID, true
+}
+
+// streamEventsHandler streams new events and device heartbeats as Server-Sent Events
+func streamEventsHandler(c *gin.Context) {
+	filter, lastID, ok := streamParams(c)
+	if !ok {
+		return
+	}
+
+	subscription := eventBus.Subscribe(filter, lastID)
+	defer eventBus.Unsubscribe(subscription)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // stop reverse proxies from buffering the stream
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case message, ok := <-subscription.C:
+			if !ok {
+				// Fell too far behind; the client reconnects and resumes
+				return
+			}
+			data, err := json.Marshal(message)
+			if err != nil {
+				logger.WithError(err).Error("Failed to marshal stream message")
+				continue
+			}
+			if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", message.ID, message.Type, data); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(c.Writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// streamEventsWebSocketHandler streams new events and device heartbeats over a
+// WebSocket, one JSON message per frame
+func streamEventsWebSocketHandler(c *gin.Context) {
+	filter, lastID, ok := streamParams(c)
+	if !ok {
+		return
+	}
+
+	conn, err := streamUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already answered the request
+		logger.WithError(err).Warn("Failed to upgrade stream to WebSocket")
+		return
+	}
+	defer conn.Close()
+
+	subscription := eventBus.Subscribe(filter, lastID)
+	defer eventBus.Unsubscribe(subscription)
+
+	// Clients only send control frames; reading handles them and notices when
+	// the client goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case message, ok := <-subscription.C:
+			if !ok {
+				deadline := time.Now().Add(streamWriteTimeout)
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "stream fell behind, resume from the last message ID"), deadline)
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if err := conn.WriteJSON(message); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
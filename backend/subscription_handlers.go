@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"scain-backend/database"
+	"scain-backend/middleware"
+	"scain-backend/models"
+	"scain-backend/services"
+)
+
+const (
+	defaultDeliveriesPerPage = 100
+	maxDeliveriesPerPage     = 1000
+)
+
+// deliveryStatuses lists the webhook delivery statuses that can be filtered on
+var deliveryStatuses = map[string]bool{
+	database.DeliveryPending:    true,
+	database.DeliveryDelivering: true,
+	database.DeliveryDelivered:  true,
+	database.DeliveryDead:       true,
+}
+
+// createSubscriptionHandler handles webhook subscription creation
+func createSubscriptionHandler(c *gin.Context) {
+	var request models.SubscriptionRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		validationError := middleware.FormatValidationError(err)
+		c.JSON(http.StatusBadRequest, validationError)
+		return
+	}
+
+	if err := validate.Struct(&request); err != nil {
+		validationError := middleware.FormatValidationError(err)
+		c.JSON(http.StatusBadRequest, validationError)
+		return
+	}
+
+	subscription, err := subscriptionService.CreateSubscription(requestOrg(c), &request)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create subscription")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to create subscription",
+			Code:    500,
+		})
+		return
+	}
+
+	c.Header("Location", "/api/subscriptions/"+subscription.ID)
+	c.JSON(http.StatusCreated, map[string]interface{}{
+		"status":       "created",
+		"subscription": subscription,
+	})
+}
+
+// listSubscriptionsHandler handles webhook subscription listing
+func listSubscriptionsHandler(c *gin.Context) {
+	subscriptions, err := subscriptionService.ListSubscriptions(requestOrg(c))
+	if err != nil {
+		logger.WithError(err).Error("Failed to list subscriptions")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to list subscriptions",
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"subscriptions": subscriptions,
+		"count":         len(subscriptions),
+	})
+}
+
+// getSubscriptionHandler handles webhook subscription retrieval
+func getSubscriptionHandler(c *gin.Context) {
+	subscriptionID := c.Param("id")
+
+	subscription, err := subscriptionService.GetSubscription(requestOrg(c), subscriptionID)
+	if err != nil {
+		logger.WithError(err).WithField("subscriptionId", subscriptionID).Error("Failed to retrieve subscription")
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "Subscription not found",
+			Message: err.Error(),
+			Code:    404,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"status":       "found",
+		"subscription": subscription,
+	})
+}
+
+// deleteSubscriptionHandler handles webhook subscription deletion
+func deleteSubscriptionHandler(c *gin.Context) {
+	subscriptionID := c.Param("id")
+
+	if err := subscriptionService.DeleteSubscription(requestOrg(c), subscriptionID); err != nil {
+		logger.WithError(err).WithField("subscriptionId", subscriptionID).Error("Failed to delete subscription")
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "Subscription not found",
+			Message: err.Error(),
+			Code:    404,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"status":         "deleted",
+		"subscriptionId": subscriptionID,
+	})
+}
+
+// listDeliveriesHandler handles retrieval of the delivery log of a subscription
+func listDeliveriesHandler(c *gin.Context) {
+	subscriptionID := c.Param("id")
+	status := c.Query("status")
+
+	if status != "" && !deliveryStatuses[status] {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid query parameter",
+			Message: "status must be pending, delivering, delivered or dead",
+			Code:    400,
+		})
+		return
+	}
+	limit, err := parseIntParam(c, "limit", defaultDeliveriesPerPage, 1, maxDeliveriesPerPage)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid query parameter",
+			Message: err.Error(),
+			Code:    400,
+		})
+		return
+	}
+
+	deliveries, err := subscriptionService.ListDeliveries(requestOrg(c), subscriptionID, status, limit)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "subscription not found") {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "Subscription not found",
+				Message: err.Error(),
+				Code:    404,
+			})
+			return
+		}
+		logger.WithError(err).WithField("subscriptionId", subscriptionID).Error("Failed to list deliveries")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to list deliveries",
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"subscriptionId": subscriptionID,
+		"deliveries":     deliveries,
+		"count":          len(deliveries),
+	})
+}
+
+// listDeadLettersHandler handles retrieval of the deliveries given up after their last attempt
+func listDeadLettersHandler(c *gin.Context) {
+	limit, err := parseIntParam(c, "limit", defaultDeliveriesPerPage, 1, maxDeliveriesPerPage)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid query parameter",
+			Message: err.Error(),
+			Code:    400,
+		})
+		return
+	}
+
+	deliveries, err := subscriptionService.ListDeadLetters(requestOrg(c), limit)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list dead letters")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to list dead letters",
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"deliveries": deliveries,
+		"count":      len(deliveries),
+	})
+}
+
+// redeliverHandler handles redelivery of a dead-lettered delivery
+func redeliverHandler(c *gin.Context) {
+	subscriptionID := c.Param("id")
+	deliveryID := c.Param("deliveryId")
+
+	delivery, err := subscriptionService.Redeliver(requestOrg(c), subscriptionID, deliveryID)
+	if err != nil {
+		if errors.Is(err, services.ErrDeliveryNotDead) {
+			c.JSON(http.StatusConflict, ErrorResponse{
+				Error:   "Redelivery not possible",
+				Message: err.Error(),
+				Code:    409,
+			})
+			return
+		}
+		logger.WithError(err).WithField("deliveryId", deliveryID).Error("Failed to redeliver")
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "Delivery not found",
+			Message: err.Error(),
+			Code:    404,
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, map[string]interface{}{
+		"status":   "queued",
+		"delivery": delivery,
+	})
+}
@@ -58,6 +58,7 @@ EVENT_DATA='{
   "eventType": "ObjectEvent",
   "eventTime": "2024-07-21T12:00:00Z", 
   "eventTimeZoneOffset": "+00:00",
+  "action": "ADD",
   "bizStep": "harvesting",
   "epcList": ["urn:epc:id:sgtin:123456.789012.001"],
   "deviceId": "test-esp32-001"
@@ -0,0 +1,176 @@
+#!/bin/bash
+
+# Scain Backend Tenant Isolation Test Script
+# This script checks that one organization cannot read or trace the data of
+# another unless it shares them through a sharing agreement. The backend must
+# run with the same JWT_SECRET.
+
+set -e
+
+BASE_URL="${BASE_URL:-http://localhost:8081}"
+JWT_SECRET="${JWT_SECRET:?JWT_SECRET must be set to the secret the backend uses}"
+RED='\033[0;31m'
+GREEN='\033[0;32m'
+BLUE='\033[0;34m'
+NC='\033[0m' # No Color
+
+echo -e "${BLUE}🔒 Scain Backend Tenant Isolation Tests${NC}"
+echo "=========================================="
+
+FAILURES=0
+
+# Function to encode data as unpadded base64url
+base64url() {
+    openssl base64 -A | tr '+/' '-_' | tr -d '='
+}
+
+# Function to mint an HS256 admin token for a user of an organization
+token() {
+    local org=$1
+    local header payload signature
+    header=$(printf '{"alg":"HS256","typ":"JWT"}' | base64url)
+    payload=$(printf '{"sub":"%s-admin","org":"%s","roles":["admin"],"exp":%d}' "$org" "$org" $(($(date +%s) + 3600)) | base64url)
+    signature=$(printf '%s.%s' "$header" "$payload" | openssl dgst -sha256 -hmac "$JWT_SECRET" -binary | base64url)
+    echo "$header.$payload.$signature"
+}
+
+# Function to make an HTTP request and print the status code
+status() {
+    local method=$1
+    local endpoint=$2
+    local token=$3
+    local data=$4
+
+    if [ -n "$data" ]; then
+        curl -s -o /dev/null -w '%{http_code}' -X "$method" "$BASE_URL$endpoint" \
+            -H "Authorization: Bearer $token" \
+            -H "Content-Type: application/json" \
+            -d "$data"
+    else
+        curl -s -o /dev/null -w '%{http_code}' -X "$method" "$BASE_URL$endpoint" \
+            -H "Authorization: Bearer $token"
+    fi
+}
+
+# Function to compare an outcome with the expected one
+check() {
+    local description=$1
+    local expected=$2
+    local actual=$3
+
+    if [ "$expected" = "$actual" ]; then
+        echo -e "${GREEN}✔${NC} $description"
+    else
+        echo -e "${RED}✘${NC} $description (expected $expected, got $actual)"
+        FAILURES=$((FAILURES + 1))
+    fi
+}
+
+SUFFIX=$(date +%s)
+ORG_A="tenancy-a-$SUFFIX"
+ORG_B="tenancy-b-$SUFFIX"
+LOT="TENANCY-LOT-$SUFFIX"
+
+OPERATOR=$(token default)
+check "Default organization creates organization A" 201 \
+    "$(status POST /api/organizations "$OPERATOR" "{\"id\":\"$ORG_A\",\"name\":\"Tenant A\"}")"
+check "Default organization creates organization B" 201 \
+    "$(status POST /api/organizations "$OPERATOR" "{\"id\":\"$ORG_B\",\"name\":\"Tenant B\"}")"
+
+TOKEN_A=$(token "$ORG_A")
+TOKEN_B=$(token "$ORG_B")
+
+check "Organization B may not create organizations" 403 \
+    "$(status POST /api/organizations "$TOKEN_B" "{\"id\":\"other-$SUFFIX\",\"name\":\"Other\"}")"
+check "Organization B may not list organizations" 403 "$(status GET /api/organizations "$TOKEN_B")"
+
+EVENT_DATA="{
+  \"eventType\": \"ObjectEvent\",
+  \"eventTime\": \"2024-07-21T12:00:00Z\",
+  \"eventTimeZoneOffset\": \"+00:00\",
+  \"action\": \"ADD\",
+  \"bizStep\": \"harvesting\",
+  \"epcList\": [\"urn:epc:id:sgtin:4012345.011111.$SUFFIX\"],
+  \"lotCode\": \"$LOT\"
+}"
+EVENT_ID=$(curl -s -X POST "$BASE_URL/api/events" \
+    -H "Authorization: Bearer $TOKEN_A" \
+    -H "Content-Type: application/json" \
+    -d "$EVENT_DATA" | jq -r .eventId)
+check "Organization A records an event" true "$([ -n "$EVENT_ID" ] && [ "$EVENT_ID" != null ] && echo true || echo false)"
+
+check "Organization A reads its event" 200 "$(status GET "/api/events/$EVENT_ID" "$TOKEN_A")"
+check "Organization B cannot read the event" 404 "$(status GET "/api/events/$EVENT_ID" "$TOKEN_B")"
+
+count() {
+    curl -s "$BASE_URL$1" -H "Authorization: Bearer $2" | jq "$3"
+}
+
+check "Organization A queries the lot" 1 \
+    "$(count "/api/events?lotCode=$LOT" "$TOKEN_A" '.epcisBody.queryResults.resultsBody.eventList | length')"
+check "Organization B queries the lot and finds nothing" 0 \
+    "$(count "/api/events?lotCode=$LOT" "$TOKEN_B" '.epcisBody.queryResults.resultsBody.eventList | length')"
+check "Organization A traces the lot" 1 "$(count "/api/trace/$LOT" "$TOKEN_A" '.events | length')"
+check "Organization B traces the lot and finds nothing" 0 "$(count "/api/trace/$LOT" "$TOKEN_B" '.events | length')"
+
+PROFILE_DATA="{\"name\": \"Tenancy\", \"lotCode\": \"$LOT\", \"maxTemperature\": 5}"
+PROFILE_ID=$(curl -s -X POST "$BASE_URL/api/cold-chain/profiles" \
+    -H "Authorization: Bearer $TOKEN_A" \
+    -H "Content-Type: application/json" \
+    -d "$PROFILE_DATA" | jq -r .profile.id)
+check "Organization B cannot read the cold-chain profile of organization A" 404 \
+    "$(status GET "/api/cold-chain/profiles/$PROFILE_ID" "$TOKEN_B")"
+check "Organization B creates its own profile for the same lot code" 201 \
+    "$(status POST /api/cold-chain/profiles "$TOKEN_B" "$PROFILE_DATA")"
+
+# Organization A ships the EPC under another lot, which it does not share
+OTHER_LOT="TENANCY-OTHER-$SUFFIX"
+OTHER_DATA="{
+  \"eventType\": \"ObjectEvent\",
+  \"eventTime\": \"2024-07-22T08:00:00Z\",
+  \"eventTimeZoneOffset\": \"+00:00\",
+  \"action\": \"OBSERVE\",
+  \"bizStep\": \"shipping\",
+  \"epcList\": [\"urn:epc:id:sgtin:4012345.011111.$SUFFIX\"],
+  \"lotCode\": \"$OTHER_LOT\"
+}"
+check "Organization A records an event for another lot" 201 "$(status POST /api/events "$TOKEN_A" "$OTHER_DATA")"
+
+check "Organization A cannot share with itself" 400 \
+    "$(status POST /api/sharing-agreements "$TOKEN_A" "{\"partnerOrgId\":\"$ORG_A\",\"scope\":{\"lotCodes\":[\"$LOT\"]}}")"
+check "A sharing agreement needs a scope" 400 \
+    "$(status POST /api/sharing-agreements "$TOKEN_A" "{\"partnerOrgId\":\"$ORG_B\",\"scope\":{}}")"
+check "A sharing agreement cannot expire in the past" 400 \
+    "$(status POST /api/sharing-agreements "$TOKEN_A" "{\"partnerOrgId\":\"$ORG_B\",\"scope\":{\"lotCodes\":[\"$LOT\"]},\"expiresAt\":\"2020-01-01T00:00:00Z\"}")"
+
+AGREEMENT_ID=$(curl -s -X POST "$BASE_URL/api/sharing-agreements" \
+    -H "Authorization: Bearer $TOKEN_A" \
+    -H "Content-Type: application/json" \
+    -d "{\"partnerOrgId\":\"$ORG_B\",\"scope\":{\"lotCodes\":[\"$LOT\"]}}" | jq -r .agreement.id)
+check "Organization A shares the lot with organization B" true \
+    "$([ -n "$AGREEMENT_ID" ] && [ "$AGREEMENT_ID" != null ] && echo true || echo false)"
+
+check "Organization B queries the shared lot" 1 \
+    "$(count "/api/events?lotCode=$LOT" "$TOKEN_B" '.epcisBody.queryResults.resultsBody.eventList | length')"
+check "Organization B queries the unshared lot and finds nothing" 0 \
+    "$(count "/api/events?lotCode=$OTHER_LOT" "$TOKEN_B" '.epcisBody.queryResults.resultsBody.eventList | length')"
+check "Organization B traces the shared lot" 1 "$(count "/api/trace/$LOT" "$TOKEN_B" '.events | length')"
+check "The trace marks the event as shared by organization A" "\"$ORG_A\"" \
+    "$(count "/api/trace/$LOT" "$TOKEN_B" '.sharedEvents | to_entries | .[0].value')"
+check "The trace redacts the event of the unshared lot" 1 "$(count "/api/trace/$LOT" "$TOKEN_B" '.redacted | length')"
+check "Organization B cannot revoke the agreement" 404 "$(status DELETE "/api/sharing-agreements/$AGREEMENT_ID" "$TOKEN_B")"
+check "Organization A revokes the agreement" 200 "$(status DELETE "/api/sharing-agreements/$AGREEMENT_ID" "$TOKEN_A")"
+check "Organization B no longer finds the lot" 0 \
+    "$(count "/api/events?lotCode=$LOT" "$TOKEN_B" '.epcisBody.queryResults.resultsBody.eventList | length')"
+
+check "Organization A shares its GS1 company prefix with organization B" 201 \
+    "$(status POST /api/sharing-agreements "$TOKEN_A" "{\"partnerOrgId\":\"$ORG_B\",\"scope\":{\"epcPrefixes\":[\"4012345\"]}}")"
+check "Organization B queries both lots by company prefix" 2 \
+    "$(count "/api/events?MATCH_epc=urn:epc:id:sgtin:4012345.011111.$SUFFIX" "$TOKEN_B" '.epcisBody.queryResults.resultsBody.eventList | length')"
+
+echo
+if [ "$FAILURES" -gt 0 ]; then
+    echo -e "${RED}$FAILURES check(s) failed${NC}"
+    exit 1
+fi
+echo -e "${GREEN}All tenant isolation and sharing checks passed${NC}"
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"scain-backend/models"
+	"scain-backend/services"
+)
+
+// traceHandler handles backward and forward lot genealogy traces
+func traceHandler(c *gin.Context) {
+	identifier := c.Param("id")
+	direction := models.TraceDirection(c.DefaultQuery("direction", string(models.TraceBackward)))
+
+	depth := services.DefaultTraceDepth
+	if depthParam := c.Query("depth"); depthParam != "" {
+		parsed, err := strconv.Atoi(depthParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "Invalid query parameter",
+				Message: "depth must be an integer",
+				Code:    400,
+			})
+			return
+		}
+		depth = parsed
+	}
+
+	if direction != models.TraceBackward && direction != models.TraceForward {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid query parameter",
+			Message: "direction must be backward or forward",
+			Code:    400,
+		})
+		return
+	}
+	if depth < 1 || depth > services.MaxTraceDepth {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "Invalid query parameter",
+			Message: "depth must be between 1 and " + strconv.Itoa(services.MaxTraceDepth),
+			Code:    400,
+		})
+		return
+	}
+
+	grants, ok := requestGrants(c)
+	if !ok {
+		return
+	}
+
+	graph, err := traceService.Trace(requestOrg(c), grants, identifier, direction, depth)
+	if err != nil {
+		logger.WithError(err).WithField("identifier", identifier).Error("Failed to trace")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to trace " + identifier,
+			Code:    500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, graph)
+}
@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// nextAuthKeyInfo is the HKDF info NextAuth.js v4 derives its session token
+// encryption key with
+const nextAuthKeyInfo = "NextAuth.js Generated Encryption Key"
+
+// JWTClaims holds the claims of a verified token
+type JWTClaims map[string]interface{}
+
+// String returns a string claim, or an empty string when it is missing
+func (c JWTClaims) String(name string) string {
+	value, _ := c[name].(string)
+	return value
+}
+
+// Strings returns a claim that is a list of strings, or a single string
+func (c JWTClaims) Strings(name string) []string {
+	switch value := c[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var values []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// VerifyHS256 verifies a compact JWS signed with HMAC-SHA256 and returns its
+// claims, once checked against the expiry and not-before times
+func VerifyHS256(token, secret string) (JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("unsupported token algorithm %q", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	var claims JWTClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+	return claims, checkTimes(claims)
+}
+
+// DecryptNextAuthJWE decrypts a NextAuth.js v4 session token, a compact JWE
+// with direct A256GCM encryption under a key derived from NEXTAUTH_SECRET, and
+// returns its claims, once checked against the expiry and not-before times
+func DecryptNextAuthJWE(token, secret string) (JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Enc string `json:"enc"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	if header.Alg != "dir" || header.Enc != "A256GCM" {
+		return nil, fmt.Errorf("unsupported token encryption %s/%s", header.Alg, header.Enc)
+	}
+
+	iv, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token IV")
+	}
+	ciphertext, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token ciphertext")
+	}
+	tag, err := base64.RawURLEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token tag")
+	}
+
+	block, err := aes.NewCipher(hkdfSHA256([]byte(secret), []byte(nextAuthKeyInfo)))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return nil, fmt.Errorf("malformed token IV")
+	}
+	plaintext, err := gcm.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	var claims JWTClaims
+	if err := json.Unmarshal(plaintext, &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+	return claims, checkTimes(claims)
+}
+
+// hkdfSHA256 derives a 32-byte key with HKDF-SHA256 and an empty salt (RFC 5869)
+func hkdfSHA256(secret, info []byte) []byte {
+	extract := hmac.New(sha256.New, make([]byte, sha256.Size))
+	extract.Write(secret)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write(info)
+	expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
+
+// decodeSegment decodes a base64url JSON token segment
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// checkTimes rejects tokens that have expired or are not valid yet. Tokens
+// without an expiry time would be valid forever and are rejected too.
+func checkTimes(claims JWTClaims) error {
+	now := float64(time.Now().Unix())
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("token has no expiry time")
+	}
+	if now >= exp {
+		return fmt.Errorf("token has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now < nbf {
+		return fmt.Errorf("token is not valid yet")
+	}
+	return nil
+}
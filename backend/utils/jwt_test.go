@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signHS256 returns a compact JWS of claims signed with HMAC-SHA256
+func signHS256(t *testing.T, claims map[string]interface{}, secret string) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("failed to marshal claims: %v", err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) +
+		"." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyHS256(t *testing.T) {
+	now := time.Now().Unix()
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		secret string
+		want   string // error substring, empty when the token is valid
+	}{
+		{"valid", map[string]interface{}{"sub": "user-1", "exp": now + 60}, "secret", ""},
+		{"valid after not-before", map[string]interface{}{"sub": "user-1", "exp": now + 60, "nbf": now - 60}, "secret", ""},
+		{"without expiry", map[string]interface{}{"sub": "user-1"}, "secret", "no expiry"},
+		{"expiry not a number", map[string]interface{}{"sub": "user-1", "exp": "never"}, "secret", "no expiry"},
+		{"expired", map[string]interface{}{"sub": "user-1", "exp": now - 60}, "secret", "expired"},
+		{"not valid yet", map[string]interface{}{"sub": "user-1", "exp": now + 120, "nbf": now + 60}, "secret", "not valid yet"},
+		{"other secret", map[string]interface{}{"sub": "user-1", "exp": now + 60}, "other", "signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := VerifyHS256(signHS256(t, tt.claims, tt.secret), "secret")
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("VerifyHS256: %v", err)
+				}
+				if claims.String("sub") != "user-1" {
+					t.Errorf("sub = %q, want user-1", claims.String("sub"))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Sides a sibling on a Merkle path can be on
+const (
+	MerkleLeft  = "left"
+	MerkleRight = "right"
+)
+
+// Prefixes that keep leaf and node hashes apart, so an inner node can never
+// be presented as a leaf (as in RFC 6962)
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// MerkleStep is a sibling on the path from a leaf up to the Merkle root
+type MerkleStep struct {
+	Hash     string `json:"hash"`     // hex SHA-256 of the sibling
+	Position string `json:"position"` // whether the sibling is left or right of the running hash
+}
+
+// MerkleLeafHash returns the leaf hash of a hex SHA-256 event hash:
+// SHA-256 of 0x00 followed by the decoded event hash
+func MerkleLeafHash(eventHash string) ([]byte, error) {
+	decoded, err := hex.DecodeString(eventHash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event hash: %w", err)
+	}
+	sum := sha256.Sum256(append([]byte{merkleLeafPrefix}, decoded...))
+	return sum[:], nil
+}
+
+// merkleNodeHash returns the hash of an inner node: SHA-256 of 0x01 followed
+// by the left and right child hashes
+func merkleNodeHash(left, right []byte) []byte {
+	data := make([]byte, 0, 1+len(left)+len(right))
+	data = append(data, merkleNodePrefix)
+	data = append(data, left...)
+	data = append(data, right...)
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// BuildMerkleTree computes the root of a tree over leaf hashes and the path of
+// each leaf to it. A node without a sibling is carried up to the next level
+// unchanged, so its path has no step for that level.
+func BuildMerkleTree(leaves [][]byte) ([]byte, [][]MerkleStep) {
+	if len(leaves) == 0 {
+		return nil, nil
+	}
+
+	paths := make([][]MerkleStep, len(leaves))
+	// positions[i] is the index of the node leaf i has reached in the current level
+	positions := make([]int, len(leaves))
+	for i := range positions {
+		positions[i] = i
+	}
+
+	level := leaves
+	for len(level) > 1 {
+		for i, position := range positions {
+			switch {
+			case position%2 == 1:
+				paths[i] = append(paths[i], MerkleStep{Hash: hex.EncodeToString(level[position-1]), Position: MerkleLeft})
+			case position+1 < len(level):
+				paths[i] = append(paths[i], MerkleStep{Hash: hex.EncodeToString(level[position+1]), Position: MerkleRight})
+			}
+			positions[i] = position / 2
+		}
+
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, merkleNodeHash(level[i], level[i+1]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+		level = next
+	}
+
+	return level[0], paths
+}
+
+// MerkleRootFromPath recomputes the root a leaf hash leads to along a path
+func MerkleRootFromPath(leaf []byte, path []MerkleStep) ([]byte, error) {
+	current := leaf
+	for _, step := range path {
+		sibling, err := hex.DecodeString(step.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Merkle path hash: %w", err)
+		}
+		switch step.Position {
+		case MerkleLeft:
+			current = merkleNodeHash(sibling, current)
+		case MerkleRight:
+			current = merkleNodeHash(current, sibling)
+		default:
+			return nil, fmt.Errorf("invalid Merkle path position: %s", step.Position)
+		}
+	}
+	return current, nil
+}
@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// testLeaves returns the leaf hashes of n distinct event hashes
+func testLeaves(t *testing.T, n int) [][]byte {
+	t.Helper()
+	leaves := make([][]byte, n)
+	for i := range leaves {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("event-%d", i)))
+		leaf, err := MerkleLeafHash(hex.EncodeToString(sum[:]))
+		if err != nil {
+			t.Fatalf("MerkleLeafHash: %v", err)
+		}
+		leaves[i] = leaf
+	}
+	return leaves
+}
+
+func TestBuildMerkleTree(t *testing.T) {
+	node := merkleNodeHash
+
+	tests := []struct {
+		name     string
+		size     int
+		root     func(l [][]byte) []byte
+		pathLens []int
+	}{
+		{
+			name:     "single leaf is the root",
+			size:     1,
+			root:     func(l [][]byte) []byte { return l[0] },
+			pathLens: []int{0},
+		},
+		{
+			name:     "two leaves",
+			size:     2,
+			root:     func(l [][]byte) []byte { return node(l[0], l[1]) },
+			pathLens: []int{1, 1},
+		},
+		{
+			name:     "odd leaf is carried up",
+			size:     3,
+			root:     func(l [][]byte) []byte { return node(node(l[0], l[1]), l[2]) },
+			pathLens: []int{2, 2, 1},
+		},
+		{
+			name: "power of two plus one",
+			size: 5,
+			root: func(l [][]byte) []byte {
+				return node(node(node(l[0], l[1]), node(l[2], l[3])), l[4])
+			},
+			pathLens: []int{3, 3, 3, 3, 1},
+		},
+		{
+			name: "power of two plus one, deeper",
+			size: 9,
+			root: func(l [][]byte) []byte {
+				left := node(node(node(l[0], l[1]), node(l[2], l[3])), node(node(l[4], l[5]), node(l[6], l[7])))
+				return node(left, l[8])
+			},
+			pathLens: []int{4, 4, 4, 4, 4, 4, 4, 4, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			leaves := testLeaves(t, tt.size)
+			root, paths := BuildMerkleTree(leaves)
+
+			if want := tt.root(leaves); !bytes.Equal(root, want) {
+				t.Fatalf("root = %x, want %x", root, want)
+			}
+			if len(paths) != tt.size {
+				t.Fatalf("got %d paths, want %d", len(paths), tt.size)
+			}
+			for i, path := range paths {
+				if len(path) != tt.pathLens[i] {
+					t.Errorf("leaf %d: path has %d steps, want %d", i, len(path), tt.pathLens[i])
+				}
+				got, err := MerkleRootFromPath(leaves[i], path)
+				if err != nil {
+					t.Fatalf("leaf %d: MerkleRootFromPath: %v", i, err)
+				}
+				if !bytes.Equal(got, root) {
+					t.Errorf("leaf %d: path leads to %x, want %x", i, got, root)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildMerkleTreeEmpty(t *testing.T) {
+	root, paths := BuildMerkleTree(nil)
+	if root != nil || paths != nil {
+		t.Fatalf("BuildMerkleTree(nil) = %x, %v, want nil, nil", root, paths)
+	}
+}
+
+func TestMerkleRootFromPathTampered(t *testing.T) {
+	leaves := testLeaves(t, 5)
+	root, paths := BuildMerkleTree(leaves)
+
+	tamperedHash := func(path []MerkleStep) []MerkleStep {
+		sum := sha256.Sum256([]byte("forged"))
+		path[0].Hash = hex.EncodeToString(sum[:])
+		return path
+	}
+	swappedPosition := func(path []MerkleStep) []MerkleStep {
+		if path[0].Position == MerkleLeft {
+			path[0].Position = MerkleRight
+		} else {
+			path[0].Position = MerkleLeft
+		}
+		return path
+	}
+	droppedStep := func(path []MerkleStep) []MerkleStep {
+		return path[1:]
+	}
+
+	tests := []struct {
+		name   string
+		leaf   []byte
+		path   func([]MerkleStep) []MerkleStep
+		errors bool
+	}{
+		{name: "tampered leaf", leaf: leaves[1]},
+		{name: "tampered sibling hash", path: tamperedHash},
+		{name: "swapped sibling position", path: swappedPosition},
+		{name: "dropped step", path: droppedStep},
+		{name: "leaf hash of another event", leaf: leaves[4]},
+		{
+			name: "invalid position",
+			path: func(path []MerkleStep) []MerkleStep {
+				path[0].Position = "up"
+				return path
+			},
+			errors: true,
+		},
+		{
+			name: "invalid sibling hash",
+			path: func(path []MerkleStep) []MerkleStep {
+				path[0].Hash = "not hex"
+				return path
+			},
+			errors: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			leaf := leaves[0]
+			if tt.leaf != nil {
+				leaf = tt.leaf
+			}
+			path := append([]MerkleStep(nil), paths[0]...)
+			if tt.path != nil {
+				path = tt.path(path)
+			}
+
+			got, err := MerkleRootFromPath(leaf, path)
+			if tt.errors {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MerkleRootFromPath: %v", err)
+			}
+			if bytes.Equal(got, root) {
+				t.Fatal("tampered proof leads to the batch root")
+			}
+		})
+	}
+}
+
+func TestMerkleLeafHash(t *testing.T) {
+	if _, err := MerkleLeafHash("zz"); err == nil {
+		t.Fatal("expected an error for an invalid event hash")
+	}
+
+	eventHash := sha256.Sum256([]byte("event"))
+	leaf, err := MerkleLeafHash(hex.EncodeToString(eventHash[:]))
+	if err != nil {
+		t.Fatalf("MerkleLeafHash: %v", err)
+	}
+	want := sha256.Sum256(append([]byte{0x00}, eventHash[:]...))
+	if !bytes.Equal(leaf, want[:]) {
+		t.Fatalf("leaf = %x, want %x", leaf, want)
+	}
+	// A leaf is never the node hash of the same bytes
+	if bytes.Equal(leaf, merkleNodeHash(eventHash[:16], eventHash[16:])) {
+		t.Fatal("leaf and node hashes collide")
+	}
+}
@@ -2,6 +2,7 @@ import { Suspense } from 'react'
 import { Metadata } from 'next'
 import { getServerSession } from 'next-auth/next';
 import { authOptions } from '@/lib/authOptions';
+import { getSessionToken } from '@/lib/session';
 import { redirect } from 'next/navigation';
 import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card'
 import { CardSensor } from '@/components/CardSensor'
@@ -65,6 +66,7 @@ export default async function DashboardPage() {
   if (!session) {
     redirect('/login');
   }
+  const accessToken = getSessionToken()
   // Calculate KPIs
   const totalLots = mockSensorData.length
   const activeLots = mockSensorData.filter(lot => new Date(lot.timestamp) > new Date(Date.now() - 24 * 60 * 60 * 1000)).length
@@ -87,7 +89,7 @@ export default async function DashboardPage() {
                 <div className="h-2 w-2 rounded-full bg-green-500 animate-pulse" />
                 Live • FSMA §204 Compliant
               </div>
-              <RecallDrillModal />
+              <RecallDrillModal accessToken={accessToken} />
             </div>
           </div>
         </div>
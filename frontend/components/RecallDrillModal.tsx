@@ -4,11 +4,26 @@ import * as React from 'react'
 import { cn } from '@/lib/utils'
 import { AlertTriangle, Download, Search, X, File } from 'lucide-react'
 
+const API_URL = process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8081'
+
+interface RecallDrillReport {
+  id: string
+  lotCode: string
+  durationMs: number
+  withinFsmaWindow: boolean
+  affectedLots: string[]
+  affectedLocations: string[]
+  customers: { id: string; type: string }[]
+  inTransit: { product: string; trackers: string[] }[]
+}
+
 interface RecallDrillModalProps {
   className?: string
+  /** Session token of the signed-in user, sent to the backend as a bearer token */
+  accessToken?: string
 }
 
-export function RecallDrillModal({ className }: RecallDrillModalProps) {
+export function RecallDrillModal({ className, accessToken }: RecallDrillModalProps) {
   const [isOpen, setIsOpen] = React.useState(false)
   const [selectedLot, setSelectedLot] = React.useState('')
   const [isSearching, setIsSearching] = React.useState(false)
@@ -17,12 +32,31 @@ export function RecallDrillModal({ className }: RecallDrillModalProps) {
     if (!selectedLot) return
     
     setIsSearching(true)
-    // Simulate API call
-    await new Promise(resolve => setTimeout(resolve, 2000))
-    setIsSearching(false)
-    
-    // In real implementation, this would open the recall trace results
-    alert(`Recall drill initiated for ${selectedLot}. Full trace completed in 2 seconds.`)
+    try {
+      const response = await fetch(`${API_URL}/api/recall-drills`, {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+          ...(accessToken ? { Authorization: `Bearer ${accessToken}` } : {}),
+        },
+        body: JSON.stringify({ lotCode: selectedLot }),
+      })
+      if (!response.ok) {
+        throw new Error(`Recall drill failed with status ${response.status}`)
+      }
+      const report: RecallDrillReport = await response.json()
+
+      // In real implementation, this would open the recall trace results
+      alert(
+        `Recall drill for ${report.lotCode} completed in ${report.durationMs} ms.\n` +
+        `Affected lots: ${report.affectedLots.length}, locations: ${report.affectedLocations.length}, ` +
+        `customers: ${report.customers.length}, in transit: ${report.inTransit.length}.`
+      )
+    } catch (error) {
+      alert(`Recall drill for ${selectedLot} failed: ${(error as Error).message}`)
+    } finally {
+      setIsSearching(false)
+    }
   }
 
   const handleExportPDF = () => {
@@ -0,0 +1,29 @@
+import { cookies } from 'next/headers';
+
+// NextAuth.js stores the session token under the secure name over HTTPS
+const SESSION_COOKIES = ['__Secure-next-auth.session-token', 'next-auth.session-token'];
+
+/**
+ * Returns the NextAuth.js session token of the current request, which the
+ * backend accepts as `Authorization: Bearer <token>`. Large tokens are split
+ * across numbered cookies (`.0`, `.1`, ...) and joined back together.
+ * Only callable from server components and route handlers.
+ */
+export function getSessionToken(): string | undefined {
+  const store = cookies();
+  for (const name of SESSION_COOKIES) {
+    const token = store.get(name)?.value;
+    if (token) {
+      return token;
+    }
+
+    const chunks: string[] = [];
+    for (let i = 0; store.has(`${name}.${i}`); i++) {
+      chunks.push(store.get(`${name}.${i}`)?.value ?? '');
+    }
+    if (chunks.length > 0) {
+      return chunks.join('');
+    }
+  }
+  return undefined;
+}